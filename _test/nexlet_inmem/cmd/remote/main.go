@@ -11,6 +11,7 @@ import (
 
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/nex/models"
 	"github.com/synadia-io/nex/sdk/go/agent"
 
 	inmem "github.com/synadia-io/nex/_test/nexlet_inmem"
@@ -26,6 +27,8 @@ var (
 var (
 	exitCode int = 1
 	nexus        = flag.String("nexus", "nexus", "Nexus name to use for the agent")
+	agentSeed    = flag.String("agent-seed", "", "User nkey seed identifying the agent to nodes with an agent policy")
+	joinToken    = flag.String("join-token", "", "Join token issued for the agent key")
 )
 
 func main() {
@@ -70,13 +73,29 @@ func main() {
 		return
 	}
 
-	rrr, err := agent.RemoteAgentInit(nc, *nexus, pubKey)
+	var agentKp nkeys.KeyPair
+	var rrr *models.RegisterRemoteAgentResponse
+	if *agentSeed != "" {
+		agentKp, err = nkeys.FromSeed([]byte(*agentSeed))
+		if err != nil {
+			slog.Error("Failed to parse agent seed", "error", err)
+			return
+		}
+		rrr, err = agent.RemoteAgentInitWithKey(nc, *nexus, agentKp, *joinToken)
+	} else {
+		rrr, err = agent.RemoteAgentInit(nc, *nexus, pubKey)
+	}
 	if err != nil {
 		slog.Error(err.Error())
 		return
 	}
 
-	myAgent, err := inmem.NewInMemAgent(*nexus, rrr.RespondTo, logger)
+	var agentOpts []inmem.InMemAgentOpt
+	if agentKp != nil {
+		agentOpts = append(agentOpts, inmem.WithRegistrationKey(agentKp))
+	}
+
+	myAgent, err := inmem.NewInMemAgent(*nexus, rrr.RespondTo, logger, agentOpts...)
 	if err != nil {
 		slog.Error(err.Error())
 		return
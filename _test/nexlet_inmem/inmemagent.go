@@ -2,6 +2,7 @@ package inmem
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"log/slog"
 	"slices"
@@ -32,6 +33,8 @@ type InMemAgent struct {
 	XPair        nkeys.KeyPair
 	StartTime    time.Time
 	Runner       *agent.Runner
+	// Key a remote agent registers with; unset for agents started by a node
+	RegistrationKey nkeys.KeyPair
 
 	Logger *slog.Logger
 }
@@ -58,6 +61,13 @@ func WithAgentName(name string) InMemAgentOpt {
 	}
 }
 
+func WithRegistrationKey(kp nkeys.KeyPair) InMemAgentOpt {
+	return func(a *InMemAgent) error {
+		a.RegistrationKey = kp
+		return nil
+	}
+}
+
 func WithWorkloadType(workloadType string) InMemAgentOpt {
 	return func(a *InMemAgent) error {
 		a.WorkloadType = workloadType
@@ -71,6 +81,9 @@ func NewInMemAgent(nexus, nodeId string, logger *slog.Logger, opts ...InMemAgent
 	runnerOpts := []agent.RunnerOpt{
 		agent.WithLogger(logger),
 	}
+	if inmemAgent.RegistrationKey != nil {
+		runnerOpts = append(runnerOpts, agent.WithRegistrationKey(inmemAgent.RegistrationKey))
+	}
 
 	if !nkeys.IsValidPublicServerKey(nodeId) {
 		return nil, errors.New("node id is not a valid public server key")
@@ -195,13 +208,26 @@ func (a *InMemAgent) StartWorkload(workloadId string, startRequest *models.Agent
 	a.Logger.Debug("StartWorkload successful")
 
 	if startRequest.Request.WorkloadLifecycle == models.WorkloadLifecycleFunction {
-		err = a.Runner.RegisterTrigger(workloadId, startRequest.Request.Namespace, workloadId, &startRequest.WorkloadCreds, func(_ []byte) ([]byte, error) {
-			a.Logger.Debug("Function trigger invoked", slog.String("workloadId", workloadId))
-			return []byte("Function executed successfully"), nil
-		})
-		if err != nil {
-			a.Logger.Error("failed to register function trigger", slog.String("workloadId", workloadId), slog.String("namespace", startRequest.Request.Namespace), slog.String("name", startRequest.Request.Name), slog.Any("error", err))
-			return nil, err
+		// functions listen on the trigger subjects of the run request, or on
+		// their workload id
+		runRequest := struct {
+			TriggerSubjects []string `json:"trigger_subjects"`
+		}{}
+		_ = json.Unmarshal([]byte(startRequest.Request.RunRequest), &runRequest)
+		if len(runRequest.TriggerSubjects) == 0 {
+			runRequest.TriggerSubjects = []string{workloadId}
+		}
+
+		for _, subject := range runRequest.TriggerSubjects {
+			err = a.Runner.RegisterTrigger(workloadId, startRequest.Request.Namespace, subject, &startRequest.WorkloadCreds, func(_ []byte) ([]byte, error) {
+				a.Logger.Debug("Function trigger invoked", slog.String("workloadId", workloadId))
+				return []byte("Function executed successfully"), nil
+			}, agent.WithTriggerQueueGroup(agent.TriggerQueueGroup(startRequest.Request.Namespace, startRequest.Request.Name)))
+			if err != nil {
+				a.Logger.Error("failed to register function trigger", slog.String("workloadId", workloadId), slog.String("namespace", startRequest.Request.Namespace), slog.String("name", startRequest.Request.Name), slog.Any("error", err))
+				_ = a.Runner.UnregisterTrigger(workloadId)
+				return nil, err
+			}
 		}
 	}
 
@@ -278,8 +304,9 @@ func (a *InMemAgent) QueryWorkloads(namespace string, filter []string) (*models.
 			StartTime:         workload.startTime.Format(time.RFC3339),
 			WorkloadType:      a.WorkloadType,
 			WorkloadState:     models.WorkloadStateRunning,
-			WorkloadLifecycle: "service",
+			WorkloadLifecycle: string(workload.startRequest.WorkloadLifecycle),
 			Metadata:          map[string]string{"extra": "metadata"},
+			Tags:              workload.startRequest.Tags,
 		})
 	}
 
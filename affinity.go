@@ -0,0 +1,150 @@
+package nex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/synadia-io/nex/models"
+	"github.com/synadia-io/orbit.go/natsext"
+)
+
+// affinityQueryTimeout bounds how long an auction waits for the agents to
+// report their workloads
+const affinityQueryTimeout = 2 * time.Second
+
+// checkAffinity returns the first affinity rule the workloads running on this
+// node in the namespace do not satisfy, or an empty string if they satisfy all
+// of them
+func (n *NexNode) checkAffinity(namespace string, affinity *models.WorkloadAffinity) (string, error) {
+	if affinity == nil || (len(affinity.Affinity) == 0 && len(affinity.AntiAffinity) == 0) {
+		return "", nil
+	}
+
+	workloads, err := n.namespaceWorkloads(namespace)
+	if err != nil {
+		return "", err
+	}
+
+	return unsatisfiedAffinity(affinity, workloads), nil
+}
+
+// namespaceWorkloads lists the workloads the agents of this node run in the
+// namespace along with the workloads still being started
+func (n *NexNode) namespaceWorkloads(namespace string) ([]models.WorkloadSummary, error) {
+	ret := []models.WorkloadSummary{}
+
+	if count := n.registeredAgents.Count(); count > 0 {
+		reqB, err := json.Marshal(models.AgentListWorkloadsRequest{Namespace: namespace})
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(n.ctx, affinityQueryTimeout)
+		defer cancel()
+
+		msgs, err := natsext.RequestMany(ctx, n.nc, models.AgentAPIQueryWorkloadsSubject(n.id), reqB, natsext.RequestManyMaxMessages(count))
+		if err != nil {
+			return nil, err
+		}
+
+		var errs error
+		received := 0
+		msgs(func(m *nats.Msg, err error) bool {
+			if err == nil {
+				resp := models.AgentListWorkloadsResponse{}
+				err = json.Unmarshal(m.Data, &resp)
+				if err == nil {
+					ret = append(ret, resp...)
+				}
+			}
+			errs = errors.Join(errs, err)
+			received++
+			return received < count
+		})
+		if errs != nil {
+			return nil, fmt.Errorf("failed to query agent workloads: %w", errs)
+		}
+		if received < count {
+			return nil, fmt.Errorf("only %d of %d agents reported their workloads", received, count)
+		}
+	}
+
+	n.operationsMu.RLock()
+	defer n.operationsMu.RUnlock()
+	for _, op := range n.operations {
+		if op.req == nil || op.status.Namespace != namespace || operationFinished(op.status.State) {
+			continue
+		}
+		if slices.ContainsFunc(ret, func(w models.WorkloadSummary) bool { return w.Id == op.status.WorkloadId }) {
+			continue
+		}
+		ret = append(ret, models.WorkloadSummary{
+			Id:                op.status.WorkloadId,
+			Name:              op.req.Name,
+			Tags:              op.req.Tags,
+			WorkloadLifecycle: string(op.req.WorkloadLifecycle),
+			WorkloadState:     models.WorkloadStateStarting,
+			WorkloadType:      op.req.WorkloadType,
+		})
+	}
+
+	return ret, nil
+}
+
+// unsatisfiedAffinity describes the first rule the workloads do not satisfy.
+// Every affinity rule needs a matching workload and no anti-affinity rule may
+// have one
+func unsatisfiedAffinity(affinity *models.WorkloadAffinity, workloads []models.WorkloadSummary) string {
+	for _, rule := range affinity.Affinity {
+		if !slices.ContainsFunc(workloads, func(w models.WorkloadSummary) bool { return affinityRuleMatches(rule, w) }) {
+			return "affinity " + affinityRuleString(rule)
+		}
+	}
+	for _, rule := range affinity.AntiAffinity {
+		if slices.ContainsFunc(workloads, func(w models.WorkloadSummary) bool { return affinityRuleMatches(rule, w) }) {
+			return "anti-affinity " + affinityRuleString(rule)
+		}
+	}
+	return ""
+}
+
+func affinityRuleMatches(rule models.WorkloadAffinityRule, w models.WorkloadSummary) bool {
+	if w.WorkloadState == models.WorkloadStateStopped || w.WorkloadState == models.WorkloadStateError {
+		return false
+	}
+	if rule.Name != "" && w.Name != rule.Name {
+		return false
+	}
+	if rule.Group != "" && w.Tags[models.TagWorkloadGroup] != rule.Group {
+		return false
+	}
+	for k, v := range rule.Tags {
+		if tV, ok := w.Tags[k]; !ok || tV != v {
+			return false
+		}
+	}
+	return true
+}
+
+func affinityRuleString(rule models.WorkloadAffinityRule) string {
+	s := ""
+	if rule.Name != "" {
+		s += fmt.Sprintf(" name=%s", rule.Name)
+	}
+	if rule.Group != "" {
+		s += fmt.Sprintf(" group=%s", rule.Group)
+	}
+	for _, k := range slices.Sorted(maps.Keys(rule.Tags)) {
+		s += fmt.Sprintf(" tag %s=%s", k, rule.Tags[k])
+	}
+	if s == "" {
+		return "any workload"
+	}
+	return s[1:]
+}
@@ -0,0 +1,188 @@
+package native
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/synadia-io/nex/internal"
+)
+
+// functionWaitDelay bounds how long a killed function process may hold on to
+// its output, e.g. through children it started
+const functionWaitDelay = time.Second
+
+// errFunctionStopped is returned by invocations arriving after the function stopped
+var errFunctionStopped = errors.New("function stopped")
+
+// nativeFunction runs the invocations of a function workload. Every invocation
+// gets its own process of the binary, which reads the payload on stdin and
+// writes the reply to stdout. Processes of the warm pool are started ahead of
+// invocations so they are past their startup when a trigger arrives
+type nativeFunction struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	path    string
+	argv    []string
+	env     []string
+	stderr  io.Writer
+	timeout time.Duration
+
+	warm    chan *functionProcess
+	stopped sync.Once
+	// Total time spent in invocations
+	runtime atomic.Int64
+}
+
+type functionProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bytes.Buffer
+}
+
+func newNativeFunction(ctx context.Context, path string, argv, env []string, stderr io.Writer, timeout time.Duration, warmPool int) (*nativeFunction, error) {
+	f := &nativeFunction{
+		path:    path,
+		argv:    argv,
+		env:     env,
+		stderr:  stderr,
+		timeout: timeout,
+		warm:    make(chan *functionProcess, warmPool),
+	}
+	f.ctx, f.cancel = context.WithCancel(ctx)
+
+	for range warmPool {
+		p, err := f.spawn()
+		if err != nil {
+			f.stop()
+			return nil, fmt.Errorf("failed to start warm function process: %w", err)
+		}
+		f.warm <- p
+	}
+
+	return f, nil
+}
+
+func (f *nativeFunction) spawn() (*functionProcess, error) {
+	p := &functionProcess{stdout: new(bytes.Buffer)}
+
+	p.cmd = exec.CommandContext(f.ctx, f.path, f.argv...)
+	p.cmd.Env = f.env
+	p.cmd.Stdout = p.stdout
+	p.cmd.Stderr = f.stderr
+	p.cmd.SysProcAttr = internal.SysProcAttr()
+	p.cmd.WaitDelay = functionWaitDelay
+
+	var err error
+	p.stdin, err = p.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// invoke passes the payload to a function process and returns what it wrote
+// to stdout. A process that exits with a non-zero status returns an error
+// wrapping the *exec.ExitError; a process that runs past the timeout is killed
+// and returns an error wrapping context.DeadlineExceeded as well
+func (f *nativeFunction) invoke(payload []byte) ([]byte, error) {
+	if f.ctx.Err() != nil {
+		return nil, errFunctionStopped
+	}
+
+	start := time.Now()
+	defer func() {
+		f.runtime.Add(int64(time.Since(start)))
+	}()
+
+	var p *functionProcess
+	select {
+	case p = <-f.warm:
+		// replace the warm process taken by this invocation
+		go f.refill()
+	default:
+		var err error
+		p, err = f.spawn()
+		if err != nil {
+			return nil, fmt.Errorf("failed to start function process: %w", err)
+		}
+	}
+
+	// the payload is written in the background so a process that does not
+	// read its stdin still runs into the timeout
+	go func() {
+		_, _ = p.stdin.Write(payload)
+		_ = p.stdin.Close()
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- p.cmd.Wait()
+	}()
+
+	timeout := time.NewTimer(f.timeout)
+	defer timeout.Stop()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return p.stdout.Bytes(), fmt.Errorf("function failed: %w", err)
+		}
+		return p.stdout.Bytes(), nil
+	case <-timeout.C:
+		_ = p.cmd.Process.Kill()
+		err := <-done
+		return p.stdout.Bytes(), fmt.Errorf("function timed out after %s: %w: %w", f.timeout, context.DeadlineExceeded, err)
+	}
+}
+
+func (f *nativeFunction) refill() {
+	if f.ctx.Err() != nil {
+		return
+	}
+
+	p, err := f.spawn()
+	if err != nil {
+		return
+	}
+
+	select {
+	case f.warm <- p:
+	default:
+		_ = p.cmd.Process.Kill()
+		_ = p.cmd.Wait()
+	}
+}
+
+// Runtime returns the total time spent in invocations
+func (f *nativeFunction) Runtime() time.Duration {
+	return time.Duration(f.runtime.Load())
+}
+
+// stop kills the warm processes and the invocations still running
+func (f *nativeFunction) stop() {
+	f.stopped.Do(func() {
+		f.cancel()
+		for {
+			select {
+			case p := <-f.warm:
+				_ = p.stdin.Close()
+				_ = p.cmd.Wait()
+			default:
+				return
+			}
+		}
+	})
+}
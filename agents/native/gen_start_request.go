@@ -12,6 +12,10 @@ type StartRequest struct {
 	// A description of the workload
 	Description *string `json:"description,omitempty"`
 
+	// SHA-256 digest of the artifact in hex; the workload is not started if the
+	// artifact does not match
+	Digest *string `json:"digest,omitempty"`
+
 	// The base64-encoded byte array of the encrypted environment with public key of
 	// encryptor
 	Environment StartRequestEnvironment `json:"environment,omitempty"`
@@ -19,14 +23,79 @@ type StartRequest struct {
 	// The port to expose
 	ExposePorts []int `json:"expose_ports,omitempty"`
 
+	// Maximum number of concurrent function invocations; defaults to 100, 0 means
+	// no limit
+	MaxInFlight *int `json:"max_in_flight,omitempty"`
+
+	// Restart the workload when a secret it references is rotated
+	RestartOnSecretRotation *bool `json:"restart_on_secret_rotation,omitempty"`
+
+	// Maximum duration of one function invocation, e.g. 10s; defaults to 30s
+	Timeout *string `json:"timeout,omitempty"`
+
+	// Consume the trigger subject from a durable consumer of a JetStream stream, so
+	// no message is lost while the function is not running
+	TriggerStream *StartRequestTriggerStream `json:"trigger_stream,omitempty"`
+
+	// Subjects that invoke a function workload; each message is passed to the
+	// binary on stdin and its stdout is the reply
+	TriggerSubjects []string `json:"trigger_subjects,omitempty"`
+
 	// The URI of the workload
 	Uri string `json:"uri"`
+
+	// Number of function processes started ahead of invocations
+	WarmPool *int `json:"warm_pool,omitempty"`
 }
 
 // The base64-encoded byte array of the encrypted environment with public key of
 // encryptor
 type StartRequestEnvironment map[string]string
 
+// Consume the trigger subject from a durable consumer of a JetStream stream, so
+// no message is lost while the function is not running
+type StartRequestTriggerStream struct {
+	// Delays before redelivering a message the function failed on, e.g. 1s; the
+	// last one repeats
+	Backoff []string `json:"backoff,omitempty"`
+
+	// Subject messages are published to after their last delivery failed; they are
+	// dropped when empty
+	DeadLetterSubject *string `json:"dead_letter_subject,omitempty"`
+
+	// Name of the durable consumer shared by the replicas of the function; defaults
+	// to the workload namespace and name joined with an underscore
+	Durable *string `json:"durable,omitempty"`
+
+	// Deliveries of a message before it is sent to the dead-letter subject; defaults
+	// to 5
+	MaxDeliver *int `json:"max_deliver,omitempty"`
+
+	// The stream holding the trigger subject
+	Stream string `json:"stream"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *StartRequestTriggerStream) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["stream"]; raw != nil && !ok {
+		return fmt.Errorf("field stream in StartRequestTriggerStream: required")
+	}
+	type Plain StartRequestTriggerStream
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	if plain.MaxDeliver != nil && 0 > *plain.MaxDeliver {
+		return fmt.Errorf("field %s: must be >= %v", "max_deliver", 0)
+	}
+	*j = StartRequestTriggerStream(plain)
+	return nil
+}
+
 // UnmarshalJSON implements json.Unmarshaler.
 func (j *StartRequest) UnmarshalJSON(value []byte) error {
 	var raw map[string]interface{}
@@ -41,6 +110,12 @@ func (j *StartRequest) UnmarshalJSON(value []byte) error {
 	if err := json.Unmarshal(value, &plain); err != nil {
 		return err
 	}
+	if plain.MaxInFlight != nil && 0 > *plain.MaxInFlight {
+		return fmt.Errorf("field %s: must be >= %v", "max_in_flight", 0)
+	}
+	if plain.WarmPool != nil && 0 > *plain.WarmPool {
+		return fmt.Errorf("field %s: must be >= %v", "warm_pool", 0)
+	}
 	*j = StartRequest(plain)
 	return nil
 }
@@ -23,6 +23,8 @@ const (
 	NEXLET_NAME          string = "go_exec"
 	NEXLET_REGISTER_TYPE string = "native"
 	MAX_RESTARTS         int    = 3
+
+	DEFAULT_FUNCTION_TIMEOUT time.Duration = 30 * time.Second
 )
 
 var (
@@ -33,6 +35,7 @@ var (
 	SUPPORTED_LIFECYCLES        = []models.WorkloadLifecycle{
 		models.WorkloadLifecycleJob,
 		models.WorkloadLifecycleService,
+		models.WorkloadLifecycleFunction,
 	}
 )
 
@@ -127,18 +130,13 @@ func (a *NativeAgent) Heartbeat() (*models.AgentHeartbeat, error) {
 		return nil, err
 	}
 
-	supportedLifecycles := make([]string, len(SUPPORTED_LIFECYCLES))
-	for i, lc := range SUPPORTED_LIFECYCLES {
-		supportedLifecycles[i] = string(lc)
-	}
-
 	return &models.AgentHeartbeat{
 		Data: string(statsB),
 		Summary: models.AgentSummary{
 			Name:                NEXLET_NAME,
 			StartTime:           a.startTime,
 			State:               string(a.agentState),
-			SupportedLifecycles: strings.Join(supportedLifecycles, ","),
+			SupportedLifecycles: supportedLifecycles(),
 			Type:                NEXLET_REGISTER_TYPE,
 			Version:             VERSION,
 			WorkloadCount:       a.state.WorkloadCount(),
@@ -191,12 +189,20 @@ func (a *NativeAgent) Ping() (*models.AgentSummary, error) {
 		Type:                NEXLET_REGISTER_TYPE,
 		StartTime:           a.startTime,
 		State:               string(models.AgentStateRunning),
-		SupportedLifecycles: "job,service",
+		SupportedLifecycles: supportedLifecycles(),
 		Version:             VERSION,
 		WorkloadCount:       a.state.WorkloadCount(),
 	}, nil
 }
 
+func supportedLifecycles() string {
+	lifecycles := make([]string, len(SUPPORTED_LIFECYCLES))
+	for i, lc := range SUPPORTED_LIFECYCLES {
+		lifecycles[i] = string(lc)
+	}
+	return strings.Join(lifecycles, ",")
+}
+
 // AgentIngress Interface
 func (a *NativeAgent) PingWorkload(workloadId string) bool {
 	_, ok := a.state.Exists(workloadId)
@@ -33,7 +33,7 @@ func TestNewWorkloadAgent(t *testing.T) {
 		be.Equal(t, "Runs workloads as subprocesses on the host machine", req.Description)
 		be.Equal(t, 0, req.MaxWorkloads)
 		be.Nonzero(t, req.PublicXkey)
-		be.AllEqual(t, []models.WorkloadLifecycle{models.WorkloadLifecycleJob, models.WorkloadLifecycleService}, req.SupportedLifecycles)
+		be.AllEqual(t, []models.WorkloadLifecycle{models.WorkloadLifecycleJob, models.WorkloadLifecycleService, models.WorkloadLifecycleFunction}, req.SupportedLifecycles)
 		be.Equal(t, startRequest, req.StartRequestSchema)
 	})
 
@@ -22,6 +22,14 @@ type NativeProcess struct {
 	State        models.WorkloadState
 	Restarts     int
 	MaxRestarts  int
+
+	// Secret keys resolved when the workload was started
+	Secrets           []string
+	RestartOnRotation bool
+	rotating          bool
+
+	// Set for function workloads, which run a process per invocation
+	function *nativeFunction
 }
 
 func (n *NativeProcess) SetState(inState models.WorkloadState) {
@@ -37,3 +45,21 @@ func (n *NativeProcess) GetState() models.WorkloadState {
 
 	return n.State
 }
+
+// setRotating marks the next exit of the process as a restart to pick up rotated secrets
+func (n *NativeProcess) setRotating() {
+	n.Lock()
+	defer n.Unlock()
+
+	n.rotating = true
+}
+
+// takeRotating reports whether the process was stopped to rotate secrets and clears the flag
+func (n *NativeProcess) takeRotating() bool {
+	n.Lock()
+	defer n.Unlock()
+
+	rotating := n.rotating
+	n.rotating = false
+	return rotating
+}
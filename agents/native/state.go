@@ -9,6 +9,7 @@ import (
 	"log/slog"
 	"os"
 	"os/exec"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -30,6 +31,8 @@ type nexletState struct {
 
 	status    models.AgentState
 	workloads map[string]NativeProcesses
+
+	secretWatch sync.Once
 }
 
 func newNexletState(ctx context.Context, logger *slog.Logger, runner *agent.Runner) *nexletState {
@@ -95,11 +98,15 @@ func (n *nexletState) GetNamespaceWorkloadList(ns string) (*models.AgentListWork
 	}
 
 	for id, w := range namespace {
+		runtime := "--"
+		if w.function != nil {
+			runtime = w.function.Runtime().String()
+		}
 		ws := models.WorkloadSummary{
 			Id:                id,
 			Metadata:          map[string]string{},
 			Name:              w.StartRequest.Name,
-			Runtime:           "--",
+			Runtime:           runtime,
 			StartTime:         w.StartedAt.Format(time.RFC3339),
 			WorkloadLifecycle: string(w.StartRequest.WorkloadLifecycle),
 			WorkloadState:     w.GetState(),
@@ -171,6 +178,7 @@ func (n *nexletState) AddWorkload(namespace, workloadId string, req *models.Agen
 		}
 	}
 
+	n.reportOperation(req, models.AgentOperationUpdateStateFetchingArtifact)
 	ar, err := getArtifact(startReq.Uri, nc)
 	if err != nil {
 		delete(n.workloads[namespace], workloadId)
@@ -182,9 +190,17 @@ func (n *nexletState) AddWorkload(namespace, workloadId string, req *models.Agen
 	}
 	n.logger.Debug("located artifact", slog.Any("artifact_reference", ar))
 
+	if startReq.Digest != nil && !strings.EqualFold(*startReq.Digest, ar.Digest) {
+		delete(n.workloads[namespace], workloadId)
+		n.Unlock()
+		return fmt.Errorf("artifact digest %s does not match requested digest %s", ar.Digest, *startReq.Digest)
+	}
+
+	secrets := []string{}
 	env := []string{}
 	for k, v := range startReq.Environment {
 		if secretKey, found := strings.CutPrefix(v, models.NexSecretPrefix); found {
+			secrets = append(secrets, secretKey)
 			secretValue, err := n.runner.GetNamespaceSecret(namespace, secretKey)
 			if err != nil {
 				delete(n.workloads[namespace], workloadId)
@@ -201,6 +217,7 @@ func (n *nexletState) AddWorkload(namespace, workloadId string, req *models.Agen
 	argv := []string{}
 	for _, v := range startReq.Argv {
 		if secretKey, found := strings.CutPrefix(v, models.NexSecretPrefix); found {
+			secrets = append(secrets, secretKey)
 			secretValue, err := n.runner.GetNamespaceSecret(namespace, secretKey)
 			if err != nil {
 				delete(n.workloads[namespace], workloadId)
@@ -218,8 +235,28 @@ func (n *nexletState) AddWorkload(namespace, workloadId string, req *models.Agen
 		"NEX_WORKLOAD_NATS_SERVERS=" + strings.Join(req.WorkloadCreds.NatsServers, ","),
 		"NEX_WORKLOAD_NATS_NKEY=" + req.WorkloadCreds.NatsUserSeed,
 		"NEX_WORKLOAD_NATS_B64_JWT=" + base64.StdEncoding.EncodeToString([]byte(req.WorkloadCreds.NatsUserJwt)),
+		"NEX_WORKLOAD_NATS_RENEW_SUBJECT=" + models.RenewWorkloadCredsRequestSubject(namespace, n.runner.NodeID(), workloadId),
 	}...)
 
+	n.reportOperation(req, models.AgentOperationUpdateStateStarting)
+	if req.Request.WorkloadLifecycle == models.WorkloadLifecycleFunction {
+		err = n.startFunction(namespace, workloadId, req, startReq, ar.LocalCachePath, argv, env)
+		if err != nil {
+			delete(n.workloads[namespace], workloadId)
+			n.Unlock()
+			return err
+		}
+		n.workloads[namespace][workloadId].Secrets = secrets
+		n.workloads[namespace][workloadId].SetState(models.WorkloadStateRunning)
+		n.logger.Debug("function created", slog.String("namespace", namespace), slog.String("workloadId", workloadId), slog.Any("trigger_subjects", startReq.TriggerSubjects))
+		n.Unlock()
+
+		if err := n.runner.EmitEvent(namespace, models.WorkloadStartedEvent{Id: workloadId, Namespace: namespace, WorkloadType: NEXLET_REGISTER_TYPE}); err != nil {
+			n.logger.Error("error emitting workload started event", slog.String("err", err.Error()))
+		}
+		return nil
+	}
+
 	n.logger.Debug("running binary", slog.Any("binary", ar.OriginalURI), slog.Any("args", startReq.Argv))
 	cmd := exec.CommandContext(poisonPill, ar.LocalCachePath, argv...)
 	cmd.Env = env
@@ -233,14 +270,21 @@ func (n *nexletState) AddWorkload(namespace, workloadId string, req *models.Agen
 		return fmt.Errorf("failed to start native binary: %w", err)
 	}
 	n.workloads[namespace][workloadId].Process = cmd.Process
+	n.workloads[namespace][workloadId].Secrets = secrets
+	n.workloads[namespace][workloadId].RestartOnRotation = startReq.RestartOnSecretRotation != nil && *startReq.RestartOnSecretRotation
 	n.workloads[namespace][workloadId].SetState(models.WorkloadStateRunning)
 
-	go func(namespace, workloadId string, req *models.AgentStartWorkloadRequest) {
-		workload := n.workloads[namespace][workloadId]
+	if len(secrets) > 0 {
+		n.secretWatch.Do(func() {
+			go n.watchSecretRotations()
+		})
+	}
 
+	go func(namespace, workloadId string, req *models.AgentStartWorkloadRequest, workload *NativeProcess) {
 		// process exits cleanly
 		pState, err := workload.Process.Wait()
-		if err == nil {
+		rotating := workload.takeRotating()
+		if err == nil && !rotating {
 			n.logger.Debug("workload exited without error", slog.String("workload_id", workloadId), slog.String("namespace", namespace), slog.Any("exit_code", pState.ExitCode()))
 			switch {
 			case workload.GetState() == models.WorkloadStateStopping: // workload was placed in stopping state by user - happy path
@@ -268,15 +312,19 @@ func (n *nexletState) AddWorkload(namespace, workloadId string, req *models.Agen
 			}
 		}
 
-		n.logger.Debug("workload process exited unexpectedly; attempting restart", slog.String("workloadId", workloadId), slog.String("namespace", req.Request.Namespace), slog.Int("exit_code", pState.ExitCode()), slog.Any("restarts", n.workloads[req.Request.Namespace][workloadId].Restarts))
-		workload.SetState(models.WorkloadStateError)
-		workload.Restarts++
+		if rotating {
+			n.logger.Info("restarting workload to rotate secrets", slog.String("workloadId", workloadId), slog.String("namespace", namespace))
+		} else {
+			n.logger.Debug("workload process exited unexpectedly; attempting restart", slog.String("workloadId", workloadId), slog.String("namespace", req.Request.Namespace), slog.Int("exit_code", pState.ExitCode()), slog.Any("restarts", workload.Restarts))
+			workload.SetState(models.WorkloadStateError)
+			workload.Restarts++
+		}
 
 		err = n.AddWorkload(namespace, workloadId, req)
 		if err != nil {
 			n.logger.Error("error restarting workload", slog.String("err", err.Error()))
 		}
-	}(namespace, workloadId, req)
+	}(namespace, workloadId, req, n.workloads[namespace][workloadId])
 
 	n.logger.Debug("workload created", slog.String("namespace", namespace), slog.String("workloadId", workloadId), slog.Bool("restart", n.workloads[namespace][workloadId].Restarts > 0))
 	n.Unlock()
@@ -287,6 +335,107 @@ func (n *nexletState) AddWorkload(namespace, workloadId string, req *models.Agen
 	return nil
 }
 
+// reportOperation tells the node how far the workload start has come. The node
+// rejects updates sent by restarts since the operation finished with the first start
+func (n *nexletState) reportOperation(req *models.AgentStartWorkloadRequest, state models.AgentOperationUpdateState) {
+	if n.runner == nil || req.OperationId == "" {
+		return
+	}
+
+	err := n.runner.UpdateOperation(req.OperationId, state)
+	if err != nil {
+		n.logger.Debug("failed to report operation progress", slog.String("err", err.Error()), slog.String("operation_id", req.OperationId))
+	}
+}
+
+// startFunction starts the warm pool of a function workload and subscribes it
+// to its trigger subjects. The caller holds the state lock
+func (n *nexletState) startFunction(namespace, workloadId string, req *models.AgentStartWorkloadRequest, startReq *StartRequest, path string, argv, env []string) error {
+	if len(startReq.TriggerSubjects) == 0 {
+		return errors.New("function workloads require at least one trigger subject")
+	}
+
+	timeout := DEFAULT_FUNCTION_TIMEOUT
+	if startReq.Timeout != nil {
+		var err error
+		timeout, err = time.ParseDuration(*startReq.Timeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid function timeout %q", *startReq.Timeout)
+		}
+	}
+
+	// replicas of the function on other nodes share the invocations. The
+	// function kills processes at the timeout; the deadline of the runner only
+	// backs it up, and keeps stream messages from being redelivered meanwhile
+	opts := []agent.TriggerOpt{
+		agent.WithTriggerQueueGroup(agent.TriggerQueueGroup(namespace, req.Request.Name)),
+		agent.WithTriggerTimeout(timeout + 2*functionWaitDelay),
+	}
+	if startReq.MaxInFlight != nil {
+		opts = append(opts, agent.WithTriggerMaxInFlight(*startReq.MaxInFlight))
+	}
+	if startReq.TriggerStream != nil {
+		consumer, err := triggerConsumer(namespace, req.Request.Name, startReq)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, agent.WithTriggerConsumer(consumer))
+	}
+
+	warmPool := 0
+	if startReq.WarmPool != nil {
+		warmPool = *startReq.WarmPool
+	}
+
+	f, err := newNativeFunction(n.ctx, path, argv, env, n.runner.GetLogger(workloadId, namespace, models.LogOutStderr), timeout, warmPool)
+	if err != nil {
+		return err
+	}
+
+	for _, subject := range startReq.TriggerSubjects {
+		err = n.runner.RegisterTrigger(workloadId, namespace, subject, &req.WorkloadCreds, f.invoke, opts...)
+		if err != nil {
+			f.stop()
+			_ = n.runner.UnregisterTrigger(workloadId)
+			return fmt.Errorf("failed to register function trigger: %w", err)
+		}
+	}
+
+	n.workloads[namespace][workloadId].function = f
+	return nil
+}
+
+// triggerConsumer returns the durable consumer a function consumes its trigger
+// subject from
+func triggerConsumer(namespace, name string, startReq *StartRequest) (agent.TriggerConsumer, error) {
+	ts := startReq.TriggerStream
+	if len(startReq.TriggerSubjects) != 1 {
+		return agent.TriggerConsumer{}, errors.New("stream triggers take exactly one trigger subject")
+	}
+
+	consumer := agent.TriggerConsumer{
+		Stream:  ts.Stream,
+		Durable: agent.TriggerDurable(namespace, name),
+	}
+	if ts.Durable != nil {
+		consumer.Durable = *ts.Durable
+	}
+	if ts.MaxDeliver != nil {
+		consumer.MaxDeliver = *ts.MaxDeliver
+	}
+	if ts.DeadLetterSubject != nil {
+		consumer.DeadLetterSubject = *ts.DeadLetterSubject
+	}
+	for _, b := range ts.Backoff {
+		d, err := time.ParseDuration(b)
+		if err != nil || d <= 0 {
+			return agent.TriggerConsumer{}, fmt.Errorf("invalid trigger backoff %q", b)
+		}
+		consumer.Backoff = append(consumer.Backoff, d)
+	}
+	return consumer, nil
+}
+
 func (n *nexletState) RemoveWorkload(namespace, workloadId string) error {
 	np := n.getWorkload(namespace, workloadId)
 	if np == nil {
@@ -295,6 +444,21 @@ func (n *nexletState) RemoveWorkload(namespace, workloadId string) error {
 		return errors.New(errStr)
 	}
 
+	if np.function != nil {
+		// the runner unregisters the triggers once the workload is removed
+		np.SetState(models.WorkloadStateStopping)
+		np.function.stop()
+
+		n.Lock()
+		delete(n.workloads[namespace], workloadId)
+		n.Unlock()
+
+		if err := n.runner.EmitEvent(namespace, models.WorkloadStoppedEvent{Id: workloadId, Namespace: namespace, WorkloadType: NEXLET_REGISTER_TYPE}); err != nil {
+			n.logger.Error("error emitting workload stopped event", slog.String("err", err.Error()))
+		}
+		return nil
+	}
+
 	go func(w *NativeProcess) {
 		n.Lock()
 		w.SetState(models.WorkloadStateStopping)
@@ -365,6 +529,99 @@ func (n *nexletState) RemoveWorkload(namespace, workloadId string) error {
 	return nil
 }
 
+// watchSecretRotations restarts workloads that opted into secret rotation when a
+// secret they use changes
+func (n *nexletState) watchSecretRotations() {
+	updates, err := n.runner.WatchSecrets(n.ctx)
+	if err != nil {
+		n.logger.Warn("unable to watch for secret rotations", slog.String("err", err.Error()))
+		return
+	}
+
+	for update := range updates {
+		if update.Deleted {
+			continue
+		}
+		n.rotateSecret(update.Namespace, update.Key)
+	}
+}
+
+// rotateSecret performs a rolling restart of the workloads using the secret; each
+// workload is running again before the next one is restarted
+func (n *nexletState) rotateSecret(namespace, secretKey string) {
+	n.Lock()
+	workloadIds := []string{}
+	for id, w := range n.workloads[namespace] {
+		if !slices.Contains(w.Secrets, secretKey) {
+			continue
+		}
+		if w.function != nil {
+			n.logger.Warn("secret rotated for function workload; function must be restarted to use the new value", slog.String("workloadId", id), slog.String("namespace", namespace), slog.String("secret_key", secretKey))
+			continue
+		}
+		if !w.RestartOnRotation {
+			n.logger.Warn("secret rotated for workload without a rotation policy; workload must be restarted manually", slog.String("workloadId", id), slog.String("namespace", namespace), slog.String("secret_key", secretKey))
+			continue
+		}
+		workloadIds = append(workloadIds, id)
+	}
+	n.Unlock()
+
+	for _, id := range workloadIds {
+		err := n.restartWorkload(namespace, id)
+		if err != nil {
+			n.logger.Error("failed to restart workload for secret rotation", slog.String("err", err.Error()), slog.String("workloadId", id), slog.String("namespace", namespace))
+			continue
+		}
+
+		if err := n.runner.EmitEvent(namespace, models.WorkloadSecretRotatedEvent{Id: id, Namespace: namespace, SecretKey: secretKey, WorkloadType: NEXLET_REGISTER_TYPE}); err != nil {
+			n.logger.Error("error emitting workload secret rotated event", slog.String("err", err.Error()))
+		}
+	}
+}
+
+// restartWorkload stops the workload process and waits for it to be started again
+// with freshly resolved secrets
+func (n *nexletState) restartWorkload(namespace, workloadId string) error {
+	w := n.getWorkload(namespace, workloadId)
+	if w == nil {
+		return errors.New(string(models.GenericErrorsWorkloadNotFound))
+	}
+
+	n.Lock()
+	oldProcess := w.Process
+	n.Unlock()
+
+	w.setRotating()
+	err := stopProcess(oldProcess)
+	if err != nil {
+		n.logger.Warn("error stopping process for rotation; cancelling context", slog.String("err", err.Error()))
+		w.cancel()
+	}
+
+	timeout := time.After(30 * time.Second)
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-timeout:
+			return errors.New("timed out waiting for workload to restart")
+		case <-ticker.C:
+			n.Lock()
+			w, ok := n.workloads[namespace][workloadId]
+			restarted := ok && w.Process != oldProcess && w.GetState() == models.WorkloadStateRunning
+			n.Unlock()
+			if !ok {
+				return errors.New("workload stopped during secret rotation")
+			}
+			if restarted {
+				return nil
+			}
+		}
+	}
+}
+
 func (n *nexletState) SetLameduckMode(before time.Duration) error {
 	n.Lock()
 	defer n.Unlock()
@@ -375,6 +632,15 @@ func (n *nexletState) SetLameduckMode(before time.Duration) error {
 		for id, process := range processes {
 			go func() {
 				process.SetState(models.WorkloadStateStopping)
+				if process.function != nil {
+					process.function.stop()
+					_ = n.runner.UnregisterTrigger(id)
+					if err := n.runner.EmitEvent(namespace, models.WorkloadStoppedEvent{Id: id, Namespace: namespace, WorkloadType: NEXLET_REGISTER_TYPE}); err != nil {
+						n.logger.Error("error emitting workload stopped event", slog.String("err", err.Error()))
+					}
+					wg.Done()
+					return
+				}
 				err := internal.StopProcess(process.Process)
 				if err != nil {
 					n.logger.Error("error stopping process; cancelling context", slog.String("err", err.Error()))
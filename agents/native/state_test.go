@@ -6,14 +6,18 @@ import (
 	"io"
 	"log/slog"
 	"os/exec"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/carlmjohnson/be"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nkeys"
 	"github.com/synadia-io/nex/sdk/go/agent"
 	"github.com/synadia-io/nex/_test"
+	secretstore "github.com/synadia-io/nex/internal/secret_store"
 	"github.com/synadia-io/nex/models"
 )
 
@@ -177,3 +181,307 @@ func TestAddWorkloadWithInvalidUri(t *testing.T) {
 	_, ok := ns.Exists(workloadID)
 	be.False(t, ok)
 }
+
+func TestSecretRotation(t *testing.T) {
+	workingDir := t.TempDir()
+	s := _test.StartNatsServer(t, workingDir)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	xkp, err := nkeys.CreateCurveKeys()
+	be.NilErr(t, err)
+
+	store, err := secretstore.NewNatsKVSecretStore(nc, "nex-secrets", xkp, nil)
+	be.NilErr(t, err)
+	_, err = store.PutSecret("derp", "sleeptime", []byte("30"))
+	be.NilErr(t, err)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	runner, err := agent.NewRunner(context.TODO(), "nexus", "", nil, agent.WithLogger(logger), agent.WithSecretStore(store))
+	be.NilErr(t, err)
+
+	rotated := make(chan models.WorkloadSecretRotatedEvent, 2)
+	runner.EmitEvent = func(_ string, e any) error {
+		if rse, ok := e.(models.WorkloadSecretRotatedEvent); ok {
+			rotated <- rse
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ns := newNexletState(ctx, logger, runner)
+
+	sleepPath, err := exec.LookPath("sleep")
+	be.NilErr(t, err)
+
+	workload := func(rotation bool) *models.AgentStartWorkloadRequest {
+		return &models.AgentStartWorkloadRequest{
+			Request: models.StartWorkloadRequest{
+				Name:              "sleeper",
+				Namespace:         "derp",
+				RunRequest:        fmt.Sprintf(`{"uri":"file://%s","argv":["secret://sleeptime"],"restart_on_secret_rotation":%t}`, sleepPath, rotation),
+				WorkloadLifecycle: "service",
+				WorkloadType:      "native",
+			},
+		}
+	}
+
+	be.NilErr(t, ns.AddWorkload("derp", "rotates", workload(true)))
+	be.NilErr(t, ns.AddWorkload("derp", "static", workload(false)))
+
+	rotatesProcess := ns.getWorkload("derp", "rotates").Process
+	staticProcess := ns.getWorkload("derp", "static").Process
+	be.AllEqual(t, []string{"sleeptime"}, ns.getWorkload("derp", "rotates").Secrets)
+
+	// give the watcher time to start
+	time.Sleep(250 * time.Millisecond)
+	_, err = store.PutSecret("derp", "sleeptime", []byte("40"))
+	be.NilErr(t, err)
+
+	select {
+	case e := <-rotated:
+		be.Equal(t, "rotates", e.Id)
+		be.Equal(t, "sleeptime", e.SecretKey)
+	case <-time.After(10 * time.Second):
+		t.Fatal("workload was not rotated")
+	}
+
+	ns.Lock()
+	be.True(t, rotatesProcess != ns.workloads["derp"]["rotates"].Process)
+	be.Equal(t, 0, ns.workloads["derp"]["rotates"].Restarts)
+	be.True(t, staticProcess == ns.workloads["derp"]["static"].Process)
+	ns.Unlock()
+
+	be.NilErr(t, ns.RemoveWorkload("derp", "rotates"))
+	be.NilErr(t, ns.RemoveWorkload("derp", "static"))
+	time.Sleep(300 * time.Millisecond)
+}
+
+func TestFunctionWorkload(t *testing.T) {
+	workingDir := t.TempDir()
+	s := _test.StartNatsServer(t, workingDir)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	runner, err := agent.NewRunner(context.TODO(), "nexus", "", nil, agent.WithLogger(logger))
+	be.NilErr(t, err)
+
+	triggered := make(chan models.WorkloadTriggeredEvent, 10)
+	runner.EmitEvent = func(_ string, e any) error {
+		if wte, ok := e.(models.WorkloadTriggeredEvent); ok {
+			triggered <- wte
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ns := newNexletState(ctx, logger, runner)
+
+	shPath, err := exec.LookPath("sh")
+	be.NilErr(t, err)
+
+	function := func(script, extra string) *models.AgentStartWorkloadRequest {
+		return &models.AgentStartWorkloadRequest{
+			Request: models.StartWorkloadRequest{
+				Name:              "fn",
+				Namespace:         "derp",
+				RunRequest:        fmt.Sprintf(`{"uri":"file://%s","argv":["-c",%q],"trigger_subjects":["fn.>"]%s}`, shPath, script, extra),
+				WorkloadLifecycle: models.WorkloadLifecycleFunction,
+				WorkloadType:      "native",
+			},
+			WorkloadCreds: models.NatsConnectionData{
+				NatsServers: []string{s.ClientURL()},
+			},
+		}
+	}
+
+	nextEvent := func(t *testing.T) models.WorkloadTriggeredEvent {
+		t.Helper()
+		select {
+		case e := <-triggered:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("no workload triggered event")
+		}
+		return models.WorkloadTriggeredEvent{}
+	}
+
+	t.Run("reply", func(t *testing.T) {
+		be.NilErr(t, ns.AddWorkload("derp", "echo", function("tr a-z A-Z", `,"warm_pool":2`)))
+		be.Equal(t, 2, len(ns.getWorkload("derp", "echo").function.warm))
+
+		for range 3 {
+			msg, err := nc.Request("fn.echo", []byte("hello"), 5*time.Second)
+			be.NilErr(t, err)
+			be.Equal(t, "HELLO", string(msg.Data))
+			be.Zero(t, msg.Header.Get("error"))
+
+			e := nextEvent(t)
+			be.Equal(t, "echo", e.Id)
+			be.Equal(t, 0, *e.ExitCode)
+		}
+
+		list, err := ns.GetNamespaceWorkloadList("derp")
+		be.NilErr(t, err)
+		be.Equal(t, 1, len(*list))
+		be.Equal(t, string(models.WorkloadLifecycleFunction), (*list)[0].WorkloadLifecycle)
+
+		be.NilErr(t, ns.RemoveWorkload("derp", "echo"))
+		be.NilErr(t, runner.UnregisterTrigger("echo"))
+		be.Equal(t, 0, ns.WorkloadCount())
+	})
+
+	t.Run("exit status", func(t *testing.T) {
+		be.NilErr(t, ns.AddWorkload("derp", "fails", function("echo partial; exit 3", "")))
+
+		msg, err := nc.Request("fn.fails", nil, 5*time.Second)
+		be.NilErr(t, err)
+		be.Equal(t, "partial\n", string(msg.Data))
+		be.Nonzero(t, msg.Header.Get("error"))
+
+		e := nextEvent(t)
+		be.Equal(t, 3, *e.ExitCode)
+		be.Nonzero(t, e.Error)
+
+		be.NilErr(t, ns.RemoveWorkload("derp", "fails"))
+		be.NilErr(t, runner.UnregisterTrigger("fails"))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		be.NilErr(t, ns.AddWorkload("derp", "slow", function("sleep 10", `,"timeout":"200ms"`)))
+
+		start := time.Now()
+		msg, err := nc.Request("fn.slow", nil, 5*time.Second)
+		be.NilErr(t, err)
+		be.True(t, time.Since(start) < 5*time.Second)
+		be.In(t, "timed out", msg.Header.Get("error"))
+
+		e := nextEvent(t)
+		be.Equal(t, -1, *e.ExitCode)
+		be.True(t, e.TimedOut)
+		be.Equal(t, 1, e.Failures)
+
+		be.NilErr(t, ns.RemoveWorkload("derp", "slow"))
+		be.NilErr(t, runner.UnregisterTrigger("slow"))
+	})
+
+	t.Run("queue group", func(t *testing.T) {
+		be.NilErr(t, ns.AddWorkload("derp", "replica1", function("cat", `,"max_in_flight":1`)))
+		be.NilErr(t, ns.AddWorkload("derp", "replica2", function("cat", `,"max_in_flight":1`)))
+		// a function with the same name in another namespace is not a replica
+		other := function("cat", "")
+		other.Request.Namespace = "other"
+		be.NilErr(t, ns.AddWorkload("other", "namesake", other))
+
+		handled := map[string]int{}
+		namesake := 0
+		for range 4 {
+			_, err := nc.Request("fn.replicas", nil, 5*time.Second)
+			be.NilErr(t, err)
+
+			// one replica and the namesake handle each message
+			for range 2 {
+				e := nextEvent(t)
+				be.Equal(t, 0, e.InFlight)
+				if e.Id == "namesake" {
+					namesake++
+					continue
+				}
+				handled[e.Id] = e.Invocations
+			}
+		}
+		be.Equal(t, 4, handled["replica1"]+handled["replica2"])
+		be.Equal(t, 4, namesake)
+
+		// every message is handled by one of the replicas
+		select {
+		case e := <-triggered:
+			t.Fatalf("unexpected workload triggered event for %s", e.Id)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		for _, id := range []string{"replica1", "replica2"} {
+			be.NilErr(t, ns.RemoveWorkload("derp", id))
+			be.NilErr(t, runner.UnregisterTrigger(id))
+		}
+		be.NilErr(t, ns.RemoveWorkload("other", "namesake"))
+		be.NilErr(t, runner.UnregisterTrigger("namesake"))
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		js, err := jetstream.New(nc)
+		be.NilErr(t, err)
+		_, err = js.CreateStream(t.Context(), jetstream.StreamConfig{Name: "EVENTS", Subjects: []string{"events.>"}})
+		be.NilErr(t, err)
+
+		dead, err := nc.SubscribeSync("dlq")
+		be.NilErr(t, err)
+
+		stream := func(id string) {
+			req := function("! grep -q fail", `,"trigger_stream":{"stream":"EVENTS","max_deliver":2,"backoff":["10ms"],"dead_letter_subject":"dlq"}`)
+			req.Request.RunRequest = strings.Replace(req.Request.RunRequest, `"fn.>"`, `"events.>"`, 1)
+			be.NilErr(t, ns.AddWorkload("derp", id, req))
+		}
+
+		// published before the function was deployed
+		_, err = js.Publish(t.Context(), "events.a", []byte("ok"))
+		be.NilErr(t, err)
+
+		stream("consumer1")
+		e := nextEvent(t)
+		be.Equal(t, 0, *e.ExitCode)
+
+		_, err = js.Publish(t.Context(), "events.b", []byte("fail"))
+		be.NilErr(t, err)
+		for i := range 2 {
+			e = nextEvent(t)
+			be.Equal(t, 1, *e.ExitCode)
+			be.Equal(t, i+1, e.Failures)
+		}
+
+		msg, err := dead.NextMsg(5 * time.Second)
+		be.NilErr(t, err)
+		be.Equal(t, "fail", string(msg.Data))
+		be.Equal(t, "EVENTS", msg.Header.Get(models.TriggerStreamHeader))
+		be.Equal(t, "events.b", msg.Header.Get(models.TriggerSubjectHeader))
+		be.Equal(t, "2", msg.Header.Get(models.TriggerDeliveriesHeader))
+		be.Nonzero(t, msg.Header.Get(models.TriggerErrorHeader))
+
+		be.NilErr(t, ns.RemoveWorkload("derp", "consumer1"))
+		be.NilErr(t, runner.UnregisterTrigger("consumer1"))
+
+		// published while the function was not running
+		_, err = js.Publish(t.Context(), "events.c", []byte("ok"))
+		be.NilErr(t, err)
+
+		stream("consumer2")
+		e = nextEvent(t)
+		be.Equal(t, "consumer2", e.Id)
+		be.Equal(t, 0, *e.ExitCode)
+
+		consumer, err := js.Consumer(t.Context(), "EVENTS", "derp_fn")
+		be.NilErr(t, err)
+		be.Equal(t, uint64(3), consumer.CachedInfo().Delivered.Stream)
+
+		be.NilErr(t, ns.RemoveWorkload("derp", "consumer2"))
+		be.NilErr(t, runner.UnregisterTrigger("consumer2"))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		req := function("cat", "")
+		req.Request.RunRequest = fmt.Sprintf(`{"uri":"file://%s"}`, shPath)
+		be.Nonzero(t, ns.AddWorkload("derp", "nosubjects", req))
+		be.Nonzero(t, ns.AddWorkload("derp", "badtimeout", function("cat", `,"timeout":"soon"`)))
+		be.Nonzero(t, ns.AddWorkload("derp", "badbackoff", function("cat", `,"trigger_stream":{"stream":"EVENTS","backoff":["later"]}`)))
+		be.Equal(t, 0, ns.WorkloadCount())
+	})
+}
@@ -0,0 +1,146 @@
+package nex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/synadia-io/nex/models"
+)
+
+// auditedRequest observes how a handler responds to a request so the outcome
+// can be written to the audit log once the handler returns
+type auditedRequest struct {
+	micro.Request
+
+	action    string
+	caller    string
+	target    string
+	outcome   models.AuditRecordOutcome
+	errMsg    string
+	responded bool
+	skip      bool
+}
+
+func (a *auditedRequest) Respond(data []byte, opts ...micro.RespondOpt) error {
+	a.observe(opts)
+	return a.Request.Respond(data, opts...)
+}
+
+func (a *auditedRequest) RespondJSON(data any, opts ...micro.RespondOpt) error {
+	a.observe(opts)
+	return a.Request.RespondJSON(data, opts...)
+}
+
+func (a *auditedRequest) Error(code, description string, data []byte, opts ...micro.RespondOpt) error {
+	a.responded = true
+	if a.outcome == "" {
+		a.outcome = models.AuditRecordOutcomeFailure
+	}
+	a.errMsg = description
+	return a.Request.Error(code, description, data, opts...)
+}
+
+// observe records the outcome of a response, which is a failure when the
+// handler forwards error headers from an agent
+func (a *auditedRequest) observe(opts []micro.RespondOpt) {
+	a.responded = true
+
+	m := &nats.Msg{Header: nats.Header{}}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if desc := m.Header.Get(micro.ErrorHeader); desc != "" {
+		a.outcome = models.AuditRecordOutcomeFailure
+		a.errMsg = desc
+		return
+	}
+	if a.outcome == "" {
+		a.outcome = models.AuditRecordOutcomeSuccess
+	}
+}
+
+// audited wraps the handler of a mutating endpoint so every request it
+// responds to is written to the audit log
+func (n *NexNode) audited(action string, handler func(micro.Request)) func(micro.Request) {
+	return func(r micro.Request) {
+		ar := &auditedRequest{Request: r, action: action}
+		handler(ar)
+
+		if !ar.responded || ar.skip {
+			return
+		}
+
+		// $NEX.SVC.<namespace>.control.<ACTION>[.<target>]
+		// $NEX.SVC.<nodeid|nexus>.agent.<ACTION>[.<target>]
+		splitSub := strings.SplitN(r.Subject(), ".", 6)
+		namespace := splitSub[2]
+		if splitSub[3] == "agent" {
+			namespace = models.SystemNamespace
+		}
+		if ar.target == "" && len(splitSub) == 6 {
+			ar.target = splitSub[5]
+		}
+
+		digest := sha256.Sum256(r.Data())
+		rec := models.AuditRecord{
+			Action:        ar.action,
+			Caller:        ar.caller,
+			Error:         ar.errMsg,
+			Namespace:     namespace,
+			NodeId:        n.id,
+			Outcome:       ar.outcome,
+			RequestDigest: hex.EncodeToString(digest[:]),
+			Target:        ar.target,
+			Timestamp:     time.Now().UTC(),
+		}
+
+		err := n.auditLog.RecordAudit(rec)
+		if err != nil {
+			n.logger.Error("failed to record audit log", slog.String("err", err.Error()), slog.String("action", ar.action), slog.String("namespace", namespace))
+		}
+	}
+}
+
+// auditTarget sets the target recorded for an audited request when the target
+// is not part of the request subject
+func auditTarget(r micro.Request, target string) {
+	if ar, ok := r.(*auditedRequest); ok {
+		ar.target = target
+	}
+}
+
+// auditAction sets the action recorded for an audited request when it depends
+// on the request rather than the endpoint
+func auditAction(r micro.Request, action string) {
+	if ar, ok := r.(*auditedRequest); ok {
+		ar.action = action
+	}
+}
+
+// auditCaller sets the caller recorded for an audited request to the key the
+// control authorizer verified
+func auditCaller(r micro.Request, caller string) {
+	if ar, ok := r.(*auditedRequest); ok {
+		ar.caller = caller
+	}
+}
+
+// auditDenied marks an audited request as denied by the control authorizer
+func auditDenied(r micro.Request) {
+	if ar, ok := r.(*auditedRequest); ok {
+		ar.outcome = models.AuditRecordOutcomeDenied
+	}
+}
+
+// auditSkip leaves an audited request out of the audit log because it did not
+// change anything on this node
+func auditSkip(r micro.Request) {
+	if ar, ok := r.(*auditedRequest); ok {
+		ar.skip = true
+	}
+}
@@ -2,16 +2,24 @@ package client
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"iter"
+	"maps"
 	"math/rand"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	"github.com/nats-io/nats.go/micro"
 	"github.com/nats-io/nkeys"
 	"github.com/nats-io/nuid"
 	"github.com/synadia-io/orbit.go/natsext"
+	"github.com/synadia-io/nex/scheduling"
 	"github.com/synadia-io/nex/models"
 )
 
@@ -26,12 +34,16 @@ type nexClient struct {
 	cancel    context.CancelFunc
 	nc        *nats.Conn
 	namespace string
+	// signer signs control requests with the identity of the caller
+	signer nkeys.KeyPair
 
 	// timeout configurations
 	defaultTimeout          time.Duration
 	startWorkloadTimeout    time.Duration
 	requestManyStall        time.Duration
 	auctionRequestManyStall time.Duration
+	// fullStall waits out the stall even when every live node has answered
+	fullStall bool
 }
 
 func NewClient(ctx context.Context, nc *nats.Conn, namespace string, opts ...ClientOption) (*nexClient, error) {
@@ -67,6 +79,13 @@ func NewClient(ctx context.Context, nc *nats.Conn, namespace string, opts ...Cli
 	return client, nil
 }
 
+// close releases the default timeout of the client
+func (n *nexClient) close() {
+	if n.cancel != nil {
+		n.cancel()
+	}
+}
+
 func (n *nexClient) GetNodeInfo(nodeId string) (*models.NodeInfoResponse, error) {
 	req := &models.NodeInfoRequest{}
 	reqB, err := json.Marshal(req)
@@ -74,7 +93,7 @@ func (n *nexClient) GetNodeInfo(nodeId string) (*models.NodeInfoResponse, error)
 		return nil, err
 	}
 
-	resp, err := n.nc.Request(models.NodeInfoRequestSubject(n.namespace, nodeId), reqB, n.defaultTimeout)
+	resp, err := n.request(models.NodeInfoRequestSubject(n.namespace, nodeId), reqB, n.defaultTimeout)
 	if err != nil && !errors.Is(err, nats.ErrNoResponders) && !errors.Is(err, nats.ErrTimeout) {
 		return nil, err
 	}
@@ -83,6 +102,11 @@ func (n *nexClient) GetNodeInfo(nodeId string) (*models.NodeInfoResponse, error)
 		return nil, errors.New("node not found")
 	}
 
+	err = responseError(resp)
+	if err != nil {
+		return nil, err
+	}
+
 	infoResponse := new(models.NodeInfoResponse)
 	err = json.Unmarshal(resp.Data, infoResponse)
 	if err != nil {
@@ -92,10 +116,16 @@ func (n *nexClient) GetNodeInfo(nodeId string) (*models.NodeInfoResponse, error)
 	return infoResponse, nil
 }
 
-func (n *nexClient) SetLameduck(nodeId string, delay time.Duration, tag map[string]string) (*models.LameduckResponse, error) {
+func (n *nexClient) SetLameduck(nodeId string, delay time.Duration, tag map[string]string, opts ...LameduckOption) (*models.LameduckResponse, error) {
+	lOpts := new(lameduckOptions)
+	for _, opt := range opts {
+		opt(lOpts)
+	}
+
 	req := &models.LameduckRequest{
-		Delay: delay.String(),
-		Tag:   tag,
+		Constraints: lOpts.constraints,
+		Delay:       delay.String(),
+		Tag:         tag,
 	}
 
 	reqB, err := json.Marshal(req)
@@ -103,7 +133,7 @@ func (n *nexClient) SetLameduck(nodeId string, delay time.Duration, tag map[stri
 		return nil, err
 	}
 
-	respMsg, err := n.nc.Request(models.LameduckRequestSubject(n.namespace, nodeId), reqB, n.defaultTimeout)
+	respMsg, err := n.request(models.LameduckRequestSubject(n.namespace, nodeId), reqB, n.defaultTimeout)
 	if err != nil && !errors.Is(err, nats.ErrNoResponders) {
 		return nil, err
 	}
@@ -111,6 +141,11 @@ func (n *nexClient) SetLameduck(nodeId string, delay time.Duration, tag map[stri
 		return &models.LameduckResponse{Success: false}, nil
 	}
 
+	err = responseError(respMsg)
+	if err != nil {
+		return nil, err
+	}
+
 	resp := new(models.LameduckResponse)
 	err = json.Unmarshal(respMsg.Data, resp)
 	if err != nil {
@@ -120,9 +155,50 @@ func (n *nexClient) SetLameduck(nodeId string, delay time.Duration, tag map[stri
 	return resp, nil
 }
 
-func (n *nexClient) ListNodes(filter map[string]string) ([]*models.NodePingResponse, error) {
+// UpdateNodeTags sets and removes tags on a running node. Reserved tags can
+// not be changed
+func (n *nexClient) UpdateNodeTags(nodeId string, set map[string]string, remove []string) (*models.NodeTagsResponse, error) {
+	req := &models.NodeTagsRequest{
+		Remove: remove,
+		Set:    set,
+	}
+
+	reqB, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respMsg, err := n.request(models.NodeTagsRequestSubject(n.namespace, nodeId), reqB, n.defaultTimeout)
+	if err != nil && !errors.Is(err, nats.ErrNoResponders) && !errors.Is(err, nats.ErrTimeout) {
+		return nil, err
+	}
+	if err != nil || len(respMsg.Data) == 0 {
+		return nil, errors.New("node not found")
+	}
+
+	err = responseError(respMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(models.NodeTagsResponse)
+	err = json.Unmarshal(respMsg.Data, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (n *nexClient) ListNodes(filter map[string]string, opts ...ListNodesOption) ([]*models.NodePingResponse, error) {
+	lOpts := new(listNodesOptions)
+	for _, opt := range opts {
+		opt(lOpts)
+	}
+
 	req := &models.NodePingRequest{
-		Filter: filter,
+		Constraints: lOpts.constraints,
+		Filter:      filter,
 	}
 
 	reqB, err := json.Marshal(req)
@@ -130,7 +206,7 @@ func (n *nexClient) ListNodes(filter map[string]string) ([]*models.NodePingRespo
 		return nil, err
 	}
 
-	msgs, err := natsext.RequestMany(n.ctx, n.nc, models.PingRequestSubject(n.namespace), reqB, natsext.RequestManyStall(n.requestManyStall))
+	msgs, err := n.requestAll(models.PingRequestSubject(n.namespace), reqB, n.requestManyStall)
 	if errors.Is(err, nats.ErrNoResponders) || errors.Is(err, nats.ErrTimeout) {
 		return []*models.NodePingResponse{}, nil
 	}
@@ -138,9 +214,19 @@ func (n *nexClient) ListNodes(filter map[string]string) ([]*models.NodePingRespo
 		return nil, err
 	}
 
-	var errs error
+	var errs, respErrs error
 	resp := []*models.NodePingResponse{}
 	msgs(func(m *nats.Msg, err error) bool {
+		if err == nil {
+			if rErr := responseError(m); rErr != nil {
+				respErrs = errors.Join(respErrs, rErr)
+				return true
+			}
+			if len(m.Data) == 0 {
+				// the node ignored the request
+				return true
+			}
+		}
 		if err == nil && m.Data != nil && string(m.Data) != "null" {
 			t := new(models.NodePingResponse)
 			err = json.Unmarshal(m.Data, t)
@@ -152,14 +238,26 @@ func (n *nexClient) ListNodes(filter map[string]string) ([]*models.NodePingRespo
 		return true
 	})
 
+	if len(resp) == 0 && respErrs != nil {
+		return nil, respErrs
+	}
+
 	return resp, nil
 }
 
-func (n *nexClient) Auction(typ string, tags map[string]string) ([]*models.AuctionResponse, error) {
+func (n *nexClient) Auction(typ string, tags map[string]string, opts ...AuctionOption) ([]*models.AuctionResponse, error) {
+	aOpts := new(auctionOptions)
+	for _, opt := range opts {
+		opt(aOpts)
+	}
+
 	auctionRequest := &models.AuctionRequest{
-		AgentType: typ,
-		AuctionId: nuid.New().Next(),
-		Tags:      tags,
+		Affinity:    aOpts.affinity,
+		AgentType:   typ,
+		AuctionId:   nuid.New().Next(),
+		Constraints: aOpts.constraints,
+		Resources:   aOpts.resources,
+		Tags:        tags,
 	}
 
 	auctionRequestB, err := json.Marshal(auctionRequest)
@@ -167,7 +265,7 @@ func (n *nexClient) Auction(typ string, tags map[string]string) ([]*models.Aucti
 		return nil, err
 	}
 
-	msgs, err := natsext.RequestMany(n.ctx, n.nc, models.AuctionRequestSubject(n.namespace), auctionRequestB, natsext.RequestManyStall(n.auctionRequestManyStall))
+	msgs, err := n.requestAll(models.AuctionRequestSubject(n.namespace), auctionRequestB, n.auctionRequestManyStall)
 	if errors.Is(err, nats.ErrNoResponders) {
 		return []*models.AuctionResponse{}, nil
 	}
@@ -175,10 +273,19 @@ func (n *nexClient) Auction(typ string, tags map[string]string) ([]*models.Aucti
 		return nil, err
 	}
 
-	var errs error
+	var errs, respErrs error
 	resp := []*models.AuctionResponse{}
 	msgs(func(m *nats.Msg, err error) bool {
 		if err == nil {
+			if rErr := responseError(m); rErr != nil {
+				respErrs = errors.Join(respErrs, rErr)
+				return true
+			}
+			if len(m.Data) == 0 {
+				// the node ignored the request
+				return true
+			}
+
 			t := new(models.AuctionResponse)
 			err = json.Unmarshal(m.Data, t)
 			if err == nil {
@@ -189,15 +296,29 @@ func (n *nexClient) Auction(typ string, tags map[string]string) ([]*models.Aucti
 		return true
 	})
 
+	if len(resp) == 0 && respErrs != nil {
+		return nil, respErrs
+	}
+
 	return resp, nil
 }
 
-func (n *nexClient) StartWorkload(deployId, name, desc, runRequest, typ string, lifecycle models.WorkloadLifecycle, pTags models.NodeTags) (*models.StartWorkloadResponse, error) {
+func (n *nexClient) StartWorkload(deployId, name, desc, runRequest, typ string, lifecycle models.WorkloadLifecycle, pTags models.NodeTags, opts ...StartWorkloadOption) (*models.StartWorkloadResponse, error) {
+	sOpts := new(startWorkloadOptions)
+	for _, opt := range opts {
+		opt(sOpts)
+	}
+
 	if pTags == nil {
 		pTags = make(models.NodeTags)
 	}
+	if sOpts.group != "" {
+		pTags = maps.Clone(pTags)
+		pTags[models.TagWorkloadGroup] = sOpts.group
+	}
 
 	req := &models.StartWorkloadRequest{
+		Affinity:          sOpts.affinity,
 		Namespace:         n.namespace,
 		Name:              name,
 		Description:       desc,
@@ -205,6 +326,8 @@ func (n *nexClient) StartWorkload(deployId, name, desc, runRequest, typ string,
 		WorkloadLifecycle: lifecycle,
 		WorkloadType:      typ,
 		Tags:              pTags,
+		Permissions:       sOpts.permissions,
+		Resources:         sOpts.resources,
 	}
 
 	reqB, err := json.Marshal(req)
@@ -212,13 +335,22 @@ func (n *nexClient) StartWorkload(deployId, name, desc, runRequest, typ string,
 		return nil, err
 	}
 
-	startResponseMsg, err := n.nc.Request(models.AuctionDeployRequestSubject(n.namespace, deployId), reqB, n.startWorkloadTimeout)
+	header := nats.Header{}
+	if sOpts.dryRun {
+		header.Set(models.DryRunHeader, "true")
+	}
+	msg, err := n.controlMsg(models.AuctionDeployRequestSubject(n.namespace, deployId), reqB, header)
+	if err != nil {
+		return nil, err
+	}
+
+	startResponseMsg, err := n.nc.RequestMsg(msg, n.startWorkloadTimeout)
 	if err != nil {
 		return nil, err
 	}
 
 	if startResponseMsg.Header.Get(micro.ErrorCodeHeader) != "" {
-		return nil, errors.New("Failed to start workload: " + startResponseMsg.Header.Get(micro.ErrorHeader))
+		return nil, errors.New("Failed to start workload: " + responseError(startResponseMsg).Error())
 	}
 
 	startResponse := new(models.StartWorkloadResponse)
@@ -227,9 +359,90 @@ func (n *nexClient) StartWorkload(deployId, name, desc, runRequest, typ string,
 		return nil, err
 	}
 
+	if startResponse.OperationId == "" || sOpts.async {
+		return startResponse, nil
+	}
+
+	_, err = n.WaitForOperation(startResponse.OperationId)
+	if err != nil {
+		return nil, errors.New("Failed to start workload: " + err.Error())
+	}
+
 	return startResponse, nil
 }
 
+// WaitForOperation waits until the node finishes the deploy operation. The
+// final status is returned along with an error if the workload failed to start.
+// Operations are kept in the memory of the node running them, so an operation
+// id is unknown once that node restarts and waiting on it times out
+func (n *nexClient) WaitForOperation(operationID string) (*models.OperationStatus, error) {
+	// Subscribe before asking for the current status so no update is missed
+	updates := make(chan *nats.Msg, 16)
+	sub, err := n.nc.ChanSubscribe(models.OperationSubject(n.namespace, operationID), updates)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = sub.Unsubscribe()
+	}()
+
+	msg, err := n.controlMsg(models.OperationStatusRequestSubject(n.namespace, operationID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the node running the operation responds; keep waiting for updates
+	// if it does not answer in time
+	statusMsg, err := n.nc.RequestMsg(msg, n.requestManyStall)
+	if err != nil && !errors.Is(err, nats.ErrTimeout) {
+		return nil, err
+	}
+	if err == nil {
+		if err := responseError(statusMsg); err != nil {
+			return nil, err
+		}
+		status, done, err := operationResult(statusMsg.Data)
+		if done {
+			return status, err
+		}
+	}
+
+	timeout := time.NewTimer(n.startWorkloadTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-n.ctx.Done():
+			return nil, context.Cause(n.ctx)
+		case <-timeout.C:
+			return nil, fmt.Errorf("timed out waiting for operation %s", operationID)
+		case m := <-updates:
+			status, done, err := operationResult(m.Data)
+			if done {
+				return status, err
+			}
+		}
+	}
+}
+
+// operationResult reports whether the operation status is final and the
+// error of a failed operation
+func operationResult(data []byte) (*models.OperationStatus, bool, error) {
+	status := new(models.OperationStatus)
+	err := json.Unmarshal(data, status)
+	if err != nil {
+		return nil, true, err
+	}
+
+	switch status.State {
+	case models.OperationStatusStateRunning:
+		return status, true, nil
+	case models.OperationStatusStateFailed:
+		return status, true, fmt.Errorf("operation %s failed: %s", status.OperationId, status.Error)
+	default:
+		return status, false, nil
+	}
+}
+
 func (n *nexClient) StopWorkload(workloadId string) (*models.StopWorkloadResponse, error) {
 	req := models.StopWorkloadRequest{
 		Namespace: n.namespace,
@@ -240,7 +453,7 @@ func (n *nexClient) StopWorkload(workloadId string) (*models.StopWorkloadRespons
 		return nil, err
 	}
 
-	msgs, err := natsext.RequestMany(n.ctx, n.nc, models.UndeployRequestSubject(n.namespace, workloadId), reqB, natsext.RequestManyStall(n.requestManyStall))
+	msgs, err := n.requestMany(models.UndeployRequestSubject(n.namespace, workloadId), reqB, natsext.RequestManyStall(n.requestManyStall))
 	if err != nil {
 		return &models.StopWorkloadResponse{
 			Id:           workloadId,
@@ -258,6 +471,12 @@ func (n *nexClient) StopWorkload(workloadId string) (*models.StopWorkloadRespons
 	}
 
 	msgs(func(m *nats.Msg, e error) bool {
+		if e == nil {
+			if rErr := responseError(m); rErr != nil {
+				ret.Message = rErr.Error()
+				return true
+			}
+		}
 		if e == nil && m.Data != nil && string(m.Data) != "null" {
 			var swresp models.StopWorkloadResponse
 			err = json.Unmarshal(m.Data, &swresp)
@@ -285,7 +504,7 @@ func (n *nexClient) ListWorkloads(filter []string) ([]*models.AgentListWorkloads
 		return nil, err
 	}
 
-	msgs, err := natsext.RequestMany(n.ctx, n.nc, models.NamespacePingRequestSubject(n.namespace), reqB, natsext.RequestManyStall(n.requestManyStall))
+	msgs, err := n.requestAll(models.NamespacePingRequestSubject(n.namespace), reqB, n.requestManyStall)
 	if errors.Is(err, nats.ErrNoResponders) {
 		return []*models.AgentListWorkloadsResponse{}, nil
 	}
@@ -293,9 +512,19 @@ func (n *nexClient) ListWorkloads(filter []string) ([]*models.AgentListWorkloads
 		return nil, err
 	}
 
-	var errs error
+	var errs, respErrs error
 	resp := []*models.AgentListWorkloadsResponse{}
 	msgs(func(m *nats.Msg, err error) bool {
+		if err == nil {
+			if rErr := responseError(m); rErr != nil {
+				respErrs = errors.Join(respErrs, rErr)
+				return true
+			}
+			if len(m.Data) == 0 {
+				// the node ignored the request
+				return true
+			}
+		}
 		if err == nil && m.Data != nil && string(m.Data) != "null" {
 			t := new(models.AgentListWorkloadsResponse)
 			err = json.Unmarshal(m.Data, t)
@@ -307,10 +536,40 @@ func (n *nexClient) ListWorkloads(filter []string) ([]*models.AgentListWorkloads
 		return true
 	})
 
+	if len(resp) == 0 && respErrs != nil {
+		return nil, respErrs
+	}
+
 	return resp, nil
 }
 
 func (n *nexClient) CloneWorkload(id string, tags map[string]string) (*models.StartWorkloadResponse, error) {
+	cloneResp, err := n.workloadStartRequest(id)
+	if err != nil {
+		return nil, err
+	}
+
+	aucResp, err := n.Auction(cloneResp.WorkloadType, tags, WithAuctionAffinity(cloneResp.Affinity))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(aucResp) == 0 {
+		return nil, errors.New("no nodes available for placement")
+	}
+
+	randomNode := aucResp[rand.Intn(len(aucResp))]
+	swr, err := n.StartWorkload(randomNode.BidderId, cloneResp.Name, cloneResp.Description, cloneResp.RunRequest, cloneResp.WorkloadType, cloneResp.WorkloadLifecycle, tags, WithPermissions(cloneResp.Permissions), WithAffinity(cloneResp.Affinity), WithGroup(cloneResp.Tags[models.TagWorkloadGroup]))
+	if err != nil {
+		return nil, err
+	}
+
+	return swr, nil
+}
+
+// workloadStartRequest fetches the start request of a running workload from
+// the node running it
+func (n *nexClient) workloadStartRequest(id string) (*models.StartWorkloadRequest, error) {
 	tKp, err := nkeys.CreateCurveKeys()
 	if err != nil {
 		return nil, err
@@ -332,7 +591,7 @@ func (n *nexClient) CloneWorkload(id string, tags map[string]string) (*models.St
 	}
 
 	genericNotFoundError := errors.New(string(models.GenericErrorsWorkloadNotFound))
-	msgs, err := natsext.RequestMany(n.ctx, n.nc, models.CloneWorkloadRequestSubject(n.namespace, id), cloneReqB, natsext.RequestManyStall(n.requestManyStall))
+	msgs, err := n.requestMany(models.CloneWorkloadRequestSubject(n.namespace, id), cloneReqB, natsext.RequestManyStall(n.requestManyStall))
 	if errors.Is(err, nats.ErrNoResponders) {
 		return nil, genericNotFoundError
 	}
@@ -344,7 +603,14 @@ func (n *nexClient) CloneWorkload(id string, tags map[string]string) (*models.St
 	}
 
 	var cloneResp *models.StartWorkloadRequest
+	var respErr error
 	msgs(func(m *nats.Msg, err error) bool {
+		if err == nil {
+			if rErr := responseError(m); rErr != nil {
+				respErr = rErr
+				return true
+			}
+		}
 		if err == nil && m.Data != nil && string(m.Data) != "null" {
 			err = json.Unmarshal(m.Data, &cloneResp)
 			if err != nil {
@@ -354,24 +620,815 @@ func (n *nexClient) CloneWorkload(id string, tags map[string]string) (*models.St
 		return true
 	})
 
+	if cloneResp == nil && respErr != nil {
+		return nil, respErr
+	}
 	if cloneResp == nil {
 		return nil, errors.New(string(models.GenericErrorsWorkloadNotFound))
 	}
 
-	aucResp, err := n.Auction(cloneResp.WorkloadType, tags)
+	return cloneResp, nil
+}
+
+// FunctionResponse is the reply of a function workload to InvokeFunction
+type FunctionResponse struct {
+	// Id of the workload that handled the invocation
+	WorkloadId string      `json:"workload_id"`
+	Subject    string      `json:"subject"`
+	Data       []byte      `json:"data"`
+	Headers    nats.Header `json:"headers,omitempty"`
+	// Error set by the function when the invocation failed
+	Error string `json:"error,omitempty"`
+	// Round trip of the invocation, including the time the request waited for
+	// a free invocation
+	Duration time.Duration `json:"duration"`
+}
+
+// InvokeFunction sends the payload to the trigger subject of a function
+// workload, given by id or name, and waits for its reply. The subject is taken
+// from the trigger_subjects of the workload's start request unless set with
+// WithInvokeSubject. An invocation the function failed is returned with the
+// error it reported, not as an error
+func (n *nexClient) InvokeFunction(ctx context.Context, workload string, payload []byte, headers nats.Header, opts ...InvokeFunctionOption) (*FunctionResponse, error) {
+	options := &invokeFunctionOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	subject := options.subject
+	if subject == "" {
+		var err error
+		subject, err = n.triggerSubject(workload)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.defaultTimeout)
+		defer cancel()
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = payload
+	for k, v := range headers {
+		msg.Header[k] = v
+	}
+
+	start := time.Now()
+	reply, err := n.nc.RequestMsgWithContext(ctx, msg)
+	if errors.Is(err, nats.ErrNoResponders) {
+		return nil, fmt.Errorf("no function is subscribed to %s", subject)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if len(aucResp) == 0 {
-		return nil, errors.New("no nodes available for placement")
+	return &FunctionResponse{
+		WorkloadId: reply.Header.Get("workload_id"),
+		Subject:    subject,
+		Data:       reply.Data,
+		Headers:    reply.Header,
+		Error:      reply.Header.Get("error"),
+		Duration:   time.Since(start),
+	}, nil
+}
+
+// triggerSubject resolves the subject a function workload, given by id or
+// name, is invoked on from its start request
+func (n *nexClient) triggerSubject(workload string) (string, error) {
+	wls, err := n.ListWorkloads(nil)
+	if err != nil {
+		return "", err
 	}
 
-	randomNode := aucResp[rand.Intn(len(aucResp))]
-	swr, err := n.StartWorkload(randomNode.BidderId, cloneResp.Name, cloneResp.Description, cloneResp.RunRequest, cloneResp.WorkloadType, cloneResp.WorkloadLifecycle, tags)
+	id := ""
+	for _, resp := range wls {
+		for _, wl := range *resp {
+			if wl.Id != workload && wl.Name != workload {
+				continue
+			}
+			if wl.WorkloadLifecycle != string(models.WorkloadLifecycleFunction) {
+				return "", fmt.Errorf("workload %s is a %s, not a function", workload, wl.WorkloadLifecycle)
+			}
+			id = wl.Id
+		}
+	}
+	if id == "" {
+		return "", errors.New(string(models.GenericErrorsWorkloadNotFound))
+	}
+
+	startReq, err := n.workloadStartRequest(id)
+	if err != nil {
+		return "", err
+	}
+
+	runReq := struct {
+		TriggerSubjects []string        `json:"trigger_subjects"`
+		TriggerStream   json.RawMessage `json:"trigger_stream"`
+	}{}
+	err = json.Unmarshal([]byte(startReq.RunRequest), &runReq)
+	if err != nil || len(runReq.TriggerSubjects) == 0 {
+		return "", fmt.Errorf("start request of workload %s has no trigger subjects", workload)
+	}
+	if len(runReq.TriggerStream) > 0 {
+		return "", fmt.Errorf("workload %s consumes its triggers from a stream and does not reply; publish to %s instead", workload, runReq.TriggerSubjects[0])
+	}
+
+	for _, subject := range runReq.TriggerSubjects {
+		if !subjectHasWildcard(subject) {
+			return subject, nil
+		}
+	}
+	return "", fmt.Errorf("trigger subjects of workload %s have wildcards; pass the subject to invoke", workload)
+}
+
+func subjectHasWildcard(subject string) bool {
+	for _, token := range strings.Split(subject, ".") {
+		if token == "*" || token == ">" {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *nexClient) PutSecret(key string, value []byte) (*models.SecretResponse, error) {
+	return n.secretRequest(models.SecretOperationPut, &models.SecretRequest{
+		Key:   key,
+		Value: base64.StdEncoding.EncodeToString(value),
+	})
+}
+
+// GetSecret retrieves a secret of the namespace. The node encrypts the value
+// for a one-time xkey, and only answers when it runs a control authorizer
+func (n *nexClient) GetSecret(key string) ([]byte, error) {
+	xkp, err := nkeys.CreateCurveKeys()
+	if err != nil {
+		return nil, err
+	}
+	xkpPub, err := xkp.PublicKey()
 	if err != nil {
 		return nil, err
 	}
 
-	return swr, nil
+	resp, err := n.secretRequest(models.SecretOperationGet, &models.SecretRequest{Key: key, Xkey: xkpPub})
+	if err != nil {
+		return nil, err
+	}
+
+	encValue, err := base64.StdEncoding.DecodeString(resp.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode secret value: %w", err)
+	}
+	return xkp.Open(encValue, resp.Xkey)
+}
+
+func (n *nexClient) ListSecrets() ([]string, error) {
+	resp, err := n.secretRequest(models.SecretOperationList, &models.SecretRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Keys, nil
+}
+
+func (n *nexClient) DeleteSecret(key string) error {
+	_, err := n.secretRequest(models.SecretOperationDelete, &models.SecretRequest{Key: key})
+	return err
+}
+
+func (n *nexClient) secretRequest(operation string, req *models.SecretRequest) (*models.SecretResponse, error) {
+	reqB, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respMsg, err := n.request(models.SecretRequestSubject(n.namespace, operation), reqB, n.defaultTimeout)
+	if errors.Is(err, nats.ErrNoResponders) {
+		return nil, errors.New("no nodes with a secret store available")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = responseError(respMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(models.SecretResponse)
+	err = json.Unmarshal(respMsg.Data, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// ListAuditRecords returns the audit records of the namespace stored in the audit
+// stream since the given time. The system namespace lists the records of every
+// namespace
+func (n *nexClient) ListAuditRecords(stream string, since time.Time) ([]*models.AuditRecord, error) {
+	js, err := jetstream.New(n.nc)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := models.AuditRecordSubject(n.namespace, ">")
+	if n.namespace == models.SystemNamespace {
+		filter = models.AuditSubscribeSubject()
+	}
+
+	cfg := jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{filter},
+		DeliverPolicy:  jetstream.DeliverAllPolicy,
+	}
+	if !since.IsZero() {
+		cfg.DeliverPolicy = jetstream.DeliverByStartTimePolicy
+		cfg.OptStartTime = &since
+	}
+
+	consumer, err := js.OrderedConsumer(n.ctx, stream, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := consumer.Info(n.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := []*models.AuditRecord{}
+	for pending := info.NumPending; pending > 0; {
+		msgs, err := consumer.Fetch(int(min(pending, 256)), jetstream.FetchMaxWait(n.defaultTimeout))
+		if err != nil {
+			return nil, err
+		}
+
+		received := 0
+		for m := range msgs.Messages() {
+			received++
+			rec := new(models.AuditRecord)
+			err = json.Unmarshal(m.Data(), rec)
+			if err != nil {
+				return nil, err
+			}
+			resp = append(resp, rec)
+		}
+		if msgs.Error() != nil {
+			return nil, msgs.Error()
+		}
+		if received == 0 {
+			break
+		}
+		pending -= uint64(received)
+	}
+
+	return resp, nil
+}
+
+// SetQuota stores the quota of the namespace in the quota bucket used by nodes
+// running the quota auctioneer. It applies to the next auction
+func (n *nexClient) SetQuota(bucket string, quota *models.NamespaceQuota) error {
+	js, err := jetstream.New(n.nc)
+	if err != nil {
+		return err
+	}
+
+	kv, err := js.KeyValue(n.ctx, bucket)
+	if err != nil {
+		return err
+	}
+
+	quotaB, err := json.Marshal(quota)
+	if err != nil {
+		return err
+	}
+
+	_, err = kv.Put(n.ctx, models.QuotaKey(n.namespace), quotaB)
+	return err
+}
+
+// GetQuota returns the quota of the namespace and the usage counted against it.
+// The quota is nil when none is set
+func (n *nexClient) GetQuota(bucket string) (*models.NamespaceQuota, *models.NamespaceQuotaUsage, error) {
+	js, err := jetstream.New(n.nc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kv, err := js.KeyValue(n.ctx, bucket)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var quota *models.NamespaceQuota
+	entry, err := kv.Get(n.ctx, models.QuotaKey(n.namespace))
+	switch {
+	case errors.Is(err, jetstream.ErrKeyNotFound):
+	case err != nil:
+		return nil, nil, err
+	default:
+		quota = new(models.NamespaceQuota)
+		err = json.Unmarshal(entry.Value(), quota)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	usage := &models.NamespaceQuotaUsage{WorkloadsPerType: make(models.NamespaceQuotaUsageWorkloadsPerType)}
+	entry, err = kv.Get(n.ctx, models.QuotaUsageKey(n.namespace))
+	switch {
+	case errors.Is(err, jetstream.ErrKeyNotFound):
+	case err != nil:
+		return nil, nil, err
+	default:
+		err = json.Unmarshal(entry.Value(), usage)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return quota, usage, nil
+}
+
+// scheduleNameRegexp matches the schedule names that can be used in the keys
+// of the schedule bucket
+var scheduleNameRegexp = regexp.MustCompile(`^[-_A-Za-z0-9]+$`)
+
+// PutSchedule stores the job schedule of the namespace in the schedule bucket
+// used by nodes running the job scheduler. A schedule with the same name is
+// replaced. Runs are due from the creation time of the schedule, which is set
+// to now if it is zero. The schedule is signed with the signing key of the
+// client, and every run is authorized as its caller
+func (n *nexClient) PutSchedule(bucket string, sched *models.JobSchedule) error {
+	if !scheduleNameRegexp.MatchString(sched.Name) {
+		return fmt.Errorf("invalid schedule name %q: only letters, digits, - and _ are allowed", sched.Name)
+	}
+	_, _, err := scheduling.ParseSchedule(sched)
+	if err != nil {
+		return err
+	}
+
+	kv, err := n.keyValue(bucket)
+	if err != nil {
+		return err
+	}
+
+	sched.Namespace = n.namespace
+	sched.Workload.Namespace = n.namespace
+	sched.Workload.WorkloadLifecycle = models.WorkloadLifecycleJob
+	if sched.Created.IsZero() {
+		sched.Created = time.Now().UTC()
+	}
+
+	sched.Caller, sched.Signature = n.callerKey(), ""
+	input, err := sched.SigningInput()
+	if err != nil {
+		return err
+	}
+	sched.Signature, err = n.signDefinition(input)
+	if err != nil {
+		return err
+	}
+
+	schedB, err := json.Marshal(sched)
+	if err != nil {
+		return err
+	}
+
+	_, err = kv.Put(n.ctx, models.ScheduleKey(n.namespace, sched.Name), schedB)
+	return err
+}
+
+// ListSchedules returns the job schedules of the namespace
+func (n *nexClient) ListSchedules(bucket string) ([]*models.JobSchedule, error) {
+	kv, err := n.keyValue(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	lister, err := kv.ListKeysFiltered(n.ctx, models.ScheduleKey(n.namespace, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := []*models.JobSchedule{}
+	for key := range lister.Keys() {
+		entry, err := kv.Get(n.ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		sched := new(models.JobSchedule)
+		err = json.Unmarshal(entry.Value(), sched)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, sched)
+	}
+	return schedules, nil
+}
+
+// DeleteSchedule removes a job schedule so no further runs are started. Runs
+// that are running are not stopped and the run history is kept
+func (n *nexClient) DeleteSchedule(bucket, name string) error {
+	kv, err := n.keyValue(bucket)
+	if err != nil {
+		return err
+	}
+
+	_, err = kv.Get(n.ctx, models.ScheduleKey(n.namespace, name))
+	if err != nil {
+		return err
+	}
+
+	err = kv.Purge(n.ctx, models.ScheduleKey(n.namespace, name))
+	if err != nil {
+		return err
+	}
+	return kv.Purge(n.ctx, models.ScheduleTickKey(n.namespace, name))
+}
+
+// ListJobRuns returns the recorded runs of a job schedule, oldest first
+func (n *nexClient) ListJobRuns(bucket, name string) ([]*models.JobRun, error) {
+	kv, err := n.keyValue(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return scheduling.ListRuns(n.ctx, kv, n.namespace, name)
+}
+
+// PutLazyFunction stores the lazy function of the namespace in the function
+// bucket used by nodes running the function activator. A function with the
+// same name is replaced; a running instance keeps its definition until it is
+// stopped. The trigger subjects are read from the start request if not set.
+// The function is signed with the signing key of the client, and every
+// instance is authorized as its caller
+func (n *nexClient) PutLazyFunction(bucket string, fn *models.LazyFunction) error {
+	if !scheduleNameRegexp.MatchString(fn.Name) {
+		return fmt.Errorf("invalid function name %q: only letters, digits, - and _ are allowed", fn.Name)
+	}
+	_, err := scheduling.ParseIdleTimeout(fn)
+	if err != nil {
+		return err
+	}
+
+	runReq := struct {
+		TriggerSubjects []string        `json:"trigger_subjects"`
+		TriggerStream   json.RawMessage `json:"trigger_stream"`
+	}{}
+	if fn.Workload.RunRequest != "" {
+		err = json.Unmarshal([]byte(fn.Workload.RunRequest), &runReq)
+		if err != nil {
+			return fmt.Errorf("invalid start request: %w", err)
+		}
+	}
+	if len(runReq.TriggerStream) > 0 {
+		return errors.New("functions consuming their triggers from a stream cannot be lazy")
+	}
+	if len(fn.TriggerSubjects) == 0 {
+		fn.TriggerSubjects = runReq.TriggerSubjects
+	}
+	if len(fn.TriggerSubjects) == 0 {
+		return fmt.Errorf("function %s has no trigger subjects", fn.Name)
+	}
+
+	kv, err := n.keyValue(bucket)
+	if err != nil {
+		return err
+	}
+
+	fn.Namespace = n.namespace
+	fn.Workload.Name = fn.Name
+	fn.Workload.Namespace = n.namespace
+	fn.Workload.WorkloadLifecycle = models.WorkloadLifecycleFunction
+	if fn.Created.IsZero() {
+		fn.Created = time.Now().UTC()
+	}
+
+	fn.Caller, fn.Signature = n.callerKey(), ""
+	input, err := fn.SigningInput()
+	if err != nil {
+		return err
+	}
+	fn.Signature, err = n.signDefinition(input)
+	if err != nil {
+		return err
+	}
+
+	fnB, err := json.Marshal(fn)
+	if err != nil {
+		return err
+	}
+
+	_, err = kv.Put(n.ctx, models.LazyFunctionKey(n.namespace, fn.Name), fnB)
+	return err
+}
+
+// ListLazyFunctions returns the lazy functions of the namespace
+func (n *nexClient) ListLazyFunctions(bucket string) ([]*models.LazyFunction, error) {
+	kv, err := n.keyValue(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	lister, err := kv.ListKeysFiltered(n.ctx, models.LazyFunctionKey(n.namespace, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	functions := []*models.LazyFunction{}
+	for key := range lister.Keys() {
+		entry, err := kv.Get(n.ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		fn := new(models.LazyFunction)
+		err = json.Unmarshal(entry.Value(), fn)
+		if err != nil {
+			return nil, err
+		}
+		functions = append(functions, fn)
+	}
+	return functions, nil
+}
+
+// ListFunctionInstances returns the running instances of the lazy functions of
+// the namespace
+func (n *nexClient) ListFunctionInstances(bucket string) ([]*models.FunctionInstance, error) {
+	kv, err := n.keyValue(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return scheduling.ListFunctionInstances(n.ctx, kv, n.namespace)
+}
+
+// DeleteLazyFunction removes a lazy function. The activator stops its running
+// instance
+func (n *nexClient) DeleteLazyFunction(bucket, name string) error {
+	kv, err := n.keyValue(bucket)
+	if err != nil {
+		return err
+	}
+
+	_, err = kv.Get(n.ctx, models.LazyFunctionKey(n.namespace, name))
+	if err != nil {
+		return err
+	}
+	return kv.Purge(n.ctx, models.LazyFunctionKey(n.namespace, name))
+}
+
+// PutAutoscalingPolicy stores the autoscaling policy of the namespace in the
+// autoscaler bucket used by nodes running the autoscaler. A policy with the
+// same name is replaced; the running instances are kept and scaled by the new
+// policy. Instances are started as services named after the policy. The
+// policy is signed with the signing key of the client, and scaling is
+// authorized as its caller
+func (n *nexClient) PutAutoscalingPolicy(bucket string, policy *models.AutoscalingPolicy) error {
+	if !scheduleNameRegexp.MatchString(policy.Name) {
+		return fmt.Errorf("invalid autoscaler name %q: only letters, digits, - and _ are allowed", policy.Name)
+	}
+	_, _, err := scheduling.ParseAutoscalingPolicy(policy)
+	if err != nil {
+		return err
+	}
+
+	kv, err := n.keyValue(bucket)
+	if err != nil {
+		return err
+	}
+
+	policy.Namespace = n.namespace
+	policy.Workload.Name = policy.Name
+	policy.Workload.Namespace = n.namespace
+	policy.Workload.WorkloadLifecycle = models.WorkloadLifecycleService
+	if policy.Created.IsZero() {
+		policy.Created = time.Now().UTC()
+	}
+
+	policy.Caller, policy.Signature = n.callerKey(), ""
+	input, err := policy.SigningInput()
+	if err != nil {
+		return err
+	}
+	policy.Signature, err = n.signDefinition(input)
+	if err != nil {
+		return err
+	}
+
+	policyB, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+
+	_, err = kv.Put(n.ctx, models.AutoscalingPolicyKey(n.namespace, policy.Name), policyB)
+	return err
+}
+
+// ListAutoscalingPolicies returns the autoscaling policies of the namespace
+func (n *nexClient) ListAutoscalingPolicies(bucket string) ([]*models.AutoscalingPolicy, error) {
+	kv, err := n.keyValue(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	lister, err := kv.ListKeysFiltered(n.ctx, models.AutoscalingPolicyKey(n.namespace, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	policies := []*models.AutoscalingPolicy{}
+	for key := range lister.Keys() {
+		entry, err := kv.Get(n.ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		policy := new(models.AutoscalingPolicy)
+		err = json.Unmarshal(entry.Value(), policy)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// ListAutoscalingStatus returns the last evaluations of the autoscaling
+// policies of the namespace
+func (n *nexClient) ListAutoscalingStatus(bucket string) ([]*models.AutoscalingStatus, error) {
+	kv, err := n.keyValue(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return scheduling.ListAutoscalingStatus(n.ctx, kv, n.namespace)
+}
+
+// DeleteAutoscalingPolicy removes an autoscaling policy and its status. The
+// running instances are left running
+func (n *nexClient) DeleteAutoscalingPolicy(bucket, name string) error {
+	kv, err := n.keyValue(bucket)
+	if err != nil {
+		return err
+	}
+
+	_, err = kv.Get(n.ctx, models.AutoscalingPolicyKey(n.namespace, name))
+	if err != nil {
+		return err
+	}
+	err = kv.Purge(n.ctx, models.AutoscalingPolicyKey(n.namespace, name))
+	if err != nil {
+		return err
+	}
+	return kv.Purge(n.ctx, models.AutoscalingStatusKey(n.namespace, name))
+}
+
+func (n *nexClient) keyValue(bucket string) (jetstream.KeyValue, error) {
+	js, err := jetstream.New(n.nc)
+	if err != nil {
+		return nil, err
+	}
+	return js.KeyValue(n.ctx, bucket)
+}
+
+// request sends a control request signed with the identity of the caller
+func (n *nexClient) request(subject string, data []byte, timeout time.Duration) (*nats.Msg, error) {
+	msg, err := n.controlMsg(subject, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	return n.nc.RequestMsg(msg, timeout)
+}
+
+// requestAll sends a control request to every node. It returns once every live
+// node has answered, or when no answer arrives within the stall if the nodes do
+// not advertise how many of them are live
+func (n *nexClient) requestAll(subject string, data []byte, stall time.Duration) (iter.Seq2[*nats.Msg, error], error) {
+	live := 0
+	if !n.fullStall {
+		live = n.liveNodes(stall)
+	}
+	if live == 0 {
+		msg, err := n.controlMsg(subject, data, nil)
+		if err != nil {
+			return nil, err
+		}
+		return natsext.RequestManyMsg(n.ctx, n.nc, msg, natsext.RequestManyStall(stall))
+	}
+
+	msg, err := n.controlMsg(subject, data, nats.Header{models.ExpectReplyHeader: []string{"true"}})
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := natsext.RequestManyMsg(n.ctx, n.nc, msg, natsext.RequestManyStall(stall), natsext.RequestManyMaxMessages(live))
+	if err != nil {
+		return nil, err
+	}
+
+	// RequestMany only notices the limit when the next message arrives, so stop
+	// as soon as the last expected answer is yielded
+	return func(yield func(*nats.Msg, error) bool) {
+		received := 0
+		msgs(func(m *nats.Msg, err error) bool {
+			if !yield(m, err) {
+				return false
+			}
+			received++
+			return received < live
+		})
+	}, nil
+}
+
+// liveNodes asks the nexus how many nodes are live. It returns 0 if no node
+// answers within the timeout
+func (n *nexClient) liveNodes(timeout time.Duration) int {
+	msg, err := n.request(models.MembershipRequestSubject(n.namespace), nil, timeout)
+	if err != nil || responseError(msg) != nil {
+		return 0
+	}
+
+	resp := new(models.NexusMembershipResponse)
+	err = json.Unmarshal(msg.Data, resp)
+	if err != nil {
+		return 0
+	}
+
+	return resp.NodeCount
+}
+
+// requestMany sends a control request signed with the identity of the caller
+// and gathers the responses of all nodes
+func (n *nexClient) requestMany(subject string, data []byte, opts ...natsext.RequestManyOpt) (iter.Seq2[*nats.Msg, error], error) {
+	msg, err := n.controlMsg(subject, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	return natsext.RequestManyMsg(n.ctx, n.nc, msg, opts...)
+}
+
+// controlMsg builds a control request with the given headers. The signature
+// covers the subject and the headers listed in models.ControlSignedHeaders, so
+// they must not be changed once the message is signed
+func (n *nexClient) controlMsg(subject string, data []byte, header nats.Header) (*nats.Msg, error) {
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	for k, v := range header {
+		msg.Header[k] = v
+	}
+	if n.signer == nil {
+		return msg, nil
+	}
+
+	caller, err := n.signer.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := models.NewControlNonce()
+	sig, err := n.signer.Sign(models.ControlSigningInput(subject, nonce, msg.Header, data))
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Header.Set(models.ControlCallerHeader, caller)
+	msg.Header.Set(models.ControlNonceHeader, nonce)
+	msg.Header.Set(models.ControlSignatureHeader, base64.RawURLEncoding.EncodeToString(sig))
+	return msg, nil
+}
+
+// callerKey returns the public key of the signing key, if there is one
+func (n *nexClient) callerKey() string {
+	if n.signer == nil {
+		return ""
+	}
+	caller, _ := n.signer.PublicKey()
+	return caller
+}
+
+// signDefinition signs the signing input of a stored definition with the
+// identity of the caller. Definitions are left unsigned without a signing key
+func (n *nexClient) signDefinition(input []byte) (string, error) {
+	if n.signer == nil {
+		return "", nil
+	}
+	sig, err := n.signer.Sign(input)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// responseError returns the error carried by a micro error response
+func responseError(m *nats.Msg) error {
+	if m.Header.Get(micro.ErrorHeader) == "" {
+		return nil
+	}
+
+	errMsg := struct {
+		Error string `json:"error"`
+	}{}
+	if json.Unmarshal(m.Data, &errMsg) == nil && errMsg.Error != "" {
+		return fmt.Errorf("%s: %s", m.Header.Get(micro.ErrorHeader), errMsg.Error)
+	}
+	return errors.New(m.Header.Get(micro.ErrorHeader))
 }
@@ -103,3 +103,63 @@ func BenchmarkClientAuction(b *testing.B) {
 
 	b.ReportAllocs() // Report memory allocations
 }
+
+func BenchmarkClientAuctionExpectedResponders(b *testing.B) {
+	const (
+		namespace    = "user"
+		workloadType = "inmem"
+	)
+
+	testCases := []struct {
+		name        string
+		clusterSize int
+		opts        []ClientOption
+	}{
+		{"1NodeFullStall", 1, []ClientOption{WithFullStall()}},
+		{"1NodeExpectedResponders", 1, nil},
+		{"3NodesFullStall", 3, []ClientOption{WithFullStall()}},
+		{"3NodesExpectedResponders", 3, nil},
+		{"5NodesFullStall", 5, []ClientOption{WithFullStall()}},
+		{"5NodesExpectedResponders", 5, nil},
+	}
+
+	for _, tc := range testCases {
+		b.Run(tc.name, func(b *testing.B) {
+			workDir := b.TempDir()
+			server := _test.StartNatsServer(b, workDir)
+			defer server.Shutdown()
+
+			nexNodes := _test.StartNexus(b, b.Context(), server.ClientURL(), tc.clusterSize, false)
+			defer func() {
+				for _, nn := range nexNodes {
+					nn.Shutdown()
+				}
+			}()
+
+			nc, err := nats.Connect(server.ClientURL())
+			be.NilErr(b, err)
+			defer nc.Close()
+
+			client, err := NewClient(b.Context(), nc, namespace, tc.opts...)
+			be.NilErr(b, err)
+
+			// wait until every node bids so the runs compare the same auction
+			for {
+				auctionResponses, err := client.Auction(workloadType, map[string]string{})
+				be.NilErr(b, err)
+				if len(auctionResponses) == tc.clusterSize {
+					break
+				}
+			}
+
+			b.ResetTimer()
+			for b.Loop() {
+				auctionResponses, err := client.Auction(workloadType, map[string]string{})
+				be.NilErr(b, err)
+				b.StopTimer()
+				be.Equal(b, tc.clusterSize, len(auctionResponses))
+				b.StartTimer()
+			}
+		})
+	}
+}
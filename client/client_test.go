@@ -2,12 +2,20 @@ package client
 
 import (
 	"context"
+	"encoding/base64"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/carlmjohnson/be"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/nex"
 	"github.com/synadia-io/nex/_test"
+	"github.com/synadia-io/nex/internal/audit"
+	"github.com/synadia-io/nex/internal/cauthorizer"
+	secretstore "github.com/synadia-io/nex/internal/secret_store"
 	"github.com/synadia-io/nex/models"
 )
 
@@ -206,6 +214,50 @@ func TestNexClient_SystemAsUser(t *testing.T) {
 	be.NilErr(t, err)
 	be.False(t, ldresp.Success)
 
+	_, err = client.UpdateNodeTags(_test.Node1Pub, map[string]string{"foo": "bar"}, nil)
+	be.Equal(t, "node not found", err.Error())
+
+	for _, node := range nexNodes {
+		be.NilErr(t, node.Shutdown())
+	}
+}
+
+func TestNexClient_UpdateNodeTags(t *testing.T) {
+	workDir := t.TempDir()
+	server := _test.StartNatsServer(t, workDir)
+	defer server.Shutdown()
+
+	nc, err := nats.Connect(server.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nexNodes := _test.StartNexus(t, ctx, server.ClientURL(), 2, false)
+	be.Equal(t, 2, len(nexNodes))
+
+	client, err := NewClient(context.Background(), nc, models.SystemNamespace)
+	be.NilErr(t, err)
+
+	resp, err := client.UpdateNodeTags(_test.Node1Pub, map[string]string{"pool": "gpu"}, nil)
+	be.NilErr(t, err)
+	be.Equal(t, _test.Node1Pub, resp.NodeId)
+	be.Equal(t, "gpu", resp.Tags["pool"])
+
+	nodes, err := client.ListNodes(map[string]string{"pool": "gpu"})
+	be.NilErr(t, err)
+	be.Equal(t, 1, len(nodes))
+	be.Equal(t, _test.Node1Pub, nodes[0].NodeId)
+
+	_, err = client.UpdateNodeTags(_test.Node1Pub, map[string]string{models.TagNodeName: "renamed"}, nil)
+	be.Nonzero(t, err)
+
+	resp, err = client.UpdateNodeTags(_test.Node1Pub, nil, []string{"pool"})
+	be.NilErr(t, err)
+	_, ok := resp.Tags["pool"]
+	be.False(t, ok)
+
 	for _, node := range nexNodes {
 		be.NilErr(t, node.Shutdown())
 	}
@@ -319,6 +371,252 @@ func TestNexClient_List_NoNodes(t *testing.T) {
 	}
 }
 
+func TestNexClient_DryRun(t *testing.T) {
+	workDir := t.TempDir()
+	server := _test.StartNatsServer(t, workDir)
+	defer func() {
+		for server.NumClients() == 0 {
+			server.Shutdown()
+			return
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	nexNodes := _test.StartNexus(t, ctx, server.ClientURL(), 1, false)
+	be.Equal(t, 1, len(nexNodes))
+
+	nc, err := nats.Connect(server.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	client, err := NewClient(context.Background(), nc, "user")
+	be.NilErr(t, err)
+
+	ar, err := client.Auction("inmem", map[string]string{})
+	be.NilErr(t, err)
+	be.Equal(t, 1, len(ar))
+
+	sr, err := client.StartWorkload(ar[0].BidderId, "tester", "My test workload", "{}", "inmem", models.WorkloadLifecycleService, nil, WithDryRun())
+	be.NilErr(t, err)
+	be.Equal(t, "tester", sr.Name)
+	be.Nonzero(t, sr.Id)
+
+	wl, err := client.ListWorkloads(nil)
+	be.NilErr(t, err)
+	totalCount := 0
+	for _, w := range wl {
+		totalCount += len(*w)
+	}
+	be.Equal(t, 0, totalCount)
+
+	_, err = client.StartWorkload(ar[0].BidderId, "tester", "My test workload", "{}", "unknown", models.WorkloadLifecycleService, nil, WithDryRun())
+	be.In(t, "workload type not found", err.Error())
+
+	for _, node := range nexNodes {
+		be.NilErr(t, node.Shutdown())
+	}
+}
+
+func TestNexClient_AsyncStartWorkload(t *testing.T) {
+	workDir := t.TempDir()
+	server := _test.StartNatsServer(t, workDir)
+	defer func() {
+		for server.NumClients() == 0 {
+			server.Shutdown()
+			return
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	nexNodes := _test.StartNexus(t, ctx, server.ClientURL(), 1, false)
+	be.Equal(t, 1, len(nexNodes))
+
+	nc, err := nats.Connect(server.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	client, err := NewClient(context.Background(), nc, "user")
+	be.NilErr(t, err)
+
+	ar, err := client.Auction("inmem", map[string]string{})
+	be.NilErr(t, err)
+	be.Equal(t, 1, len(ar))
+
+	sr, err := client.StartWorkload(ar[0].BidderId, "tester", "My test workload", "{}", "inmem", models.WorkloadLifecycleService, nil, WithAsync())
+	be.NilErr(t, err)
+	be.Nonzero(t, sr.Id)
+	be.Nonzero(t, sr.OperationId)
+
+	status, err := client.WaitForOperation(sr.OperationId)
+	be.NilErr(t, err)
+	be.Equal(t, models.OperationStatusStateRunning, status.State)
+	be.Equal(t, sr.Id, status.WorkloadId)
+	be.Equal(t, "user", status.Namespace)
+
+	// finished operations can still be queried
+	status, err = client.WaitForOperation(sr.OperationId)
+	be.NilErr(t, err)
+	be.Equal(t, models.OperationStatusStateRunning, status.State)
+
+	for _, node := range nexNodes {
+		be.NilErr(t, node.Shutdown())
+	}
+}
+
+func TestNexClient_ExpectedResponders(t *testing.T) {
+	workDir := t.TempDir()
+	server := _test.StartNatsServer(t, workDir)
+	defer server.Shutdown()
+
+	nexNodes := _test.StartNexus(t, t.Context(), server.ClientURL(), 3, false)
+	defer func() {
+		for _, node := range nexNodes {
+			be.NilErr(t, node.Shutdown())
+		}
+	}()
+
+	nc, err := nats.Connect(server.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	client, err := NewClient(context.Background(), nc, "user", WithAuctionStall(5*time.Second), WithRequestManyStall(5*time.Second))
+	be.NilErr(t, err)
+	be.Equal(t, 3, client.liveNodes(time.Second))
+
+	start := time.Now()
+	ar, err := client.Auction("inmem", map[string]string{})
+	be.NilErr(t, err)
+	be.Equal(t, 3, len(ar))
+
+	// nodes that do not bid send empty replies
+	ar, err = client.Auction("inmem", map[string]string{"foo": "baz"})
+	be.NilErr(t, err)
+	be.Equal(t, 0, len(ar))
+
+	nodes, err := client.ListNodes(map[string]string{"foo": "baz"})
+	be.NilErr(t, err)
+	be.Equal(t, 0, len(nodes))
+
+	_, err = client.ListWorkloads(nil)
+	be.NilErr(t, err)
+	be.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestNexClient_AuctionConstraints(t *testing.T) {
+	workDir := t.TempDir()
+	server := _test.StartNatsServer(t, workDir)
+	defer server.Shutdown()
+
+	nexNodes := _test.StartNexus(t, t.Context(), server.ClientURL(), 2, false)
+	defer func() {
+		for _, node := range nexNodes {
+			be.NilErr(t, node.Shutdown())
+		}
+	}()
+
+	nc, err := nats.Connect(server.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	client, err := NewClient(context.Background(), nc, "user")
+	be.NilErr(t, err)
+
+	// agent versions are only matched once the agents are healthy
+	for range 20 {
+		ar, err := client.Auction("inmem", nil)
+		be.NilErr(t, err)
+		if len(ar) == 2 {
+			break
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+
+	ar, err := client.Auction("inmem", nil, WithAuctionConstraints("foo in (bar, baz)", "nex.cpucount >= 1", "nex.agent.version >= 0.0.0", "nex.lameduck != true", "gpu !exists"))
+	be.NilErr(t, err)
+	be.Equal(t, 2, len(ar))
+
+	ar, err = client.Auction("inmem", nil, WithAuctionConstraints("nex.agent.version > v0.0.0"))
+	be.NilErr(t, err)
+	be.Equal(t, 0, len(ar))
+
+	_, err = client.Auction("inmem", nil, WithAuctionConstraints("nex.cpucount >= lots"))
+	be.Nonzero(t, err)
+
+	sysClient, err := NewClient(context.Background(), nc, "system")
+	be.NilErr(t, err)
+
+	nodes, err := sysClient.ListNodes(nil, WithNodeConstraints("foo != bar"))
+	be.NilErr(t, err)
+	be.Equal(t, 0, len(nodes))
+
+	nodes, err = sysClient.ListNodes(nil, WithNodeConstraints("nex.agent.inmem.version exists"))
+	be.NilErr(t, err)
+	be.Equal(t, 2, len(nodes))
+}
+
+func TestNexClient_Affinity(t *testing.T) {
+	workDir := t.TempDir()
+	server := _test.StartNatsServer(t, workDir)
+	defer server.Shutdown()
+
+	nexNodes := _test.StartNexus(t, t.Context(), server.ClientURL(), 2, false)
+	defer func() {
+		for _, node := range nexNodes {
+			be.NilErr(t, node.Shutdown())
+		}
+	}()
+
+	nc, err := nats.Connect(server.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	client, err := NewClient(context.Background(), nc, "user")
+	be.NilErr(t, err)
+
+	var ar []*models.AuctionResponse
+	for range 20 {
+		ar, err = client.Auction("inmem", nil)
+		be.NilErr(t, err)
+		if len(ar) == 2 {
+			break
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	be.Equal(t, 2, len(ar))
+
+	spread := &models.WorkloadAffinity{AntiAffinity: []models.WorkloadAffinityRule{{Group: "web"}}}
+	_, err = client.StartWorkload(ar[0].BidderId, "web-1", "", "{}", "inmem", models.WorkloadLifecycleService, nil, WithAffinity(spread), WithGroup("web"))
+	be.NilErr(t, err)
+
+	ar, err = client.Auction("inmem", nil, WithAuctionAffinity(spread))
+	be.NilErr(t, err)
+	be.Equal(t, 1, len(ar))
+	_, err = client.StartWorkload(ar[0].BidderId, "web-2", "", "{}", "inmem", models.WorkloadLifecycleService, nil, WithAffinity(spread), WithGroup("web"))
+	be.NilErr(t, err)
+
+	// every node runs a replica
+	ar, err = client.Auction("inmem", nil, WithAuctionAffinity(spread))
+	be.NilErr(t, err)
+	be.Equal(t, 0, len(ar))
+
+	sidecar := &models.WorkloadAffinity{Affinity: []models.WorkloadAffinityRule{{Name: "web-1"}}}
+	ar, err = client.Auction("inmem", nil, WithAuctionAffinity(sidecar))
+	be.NilErr(t, err)
+	be.Equal(t, 1, len(ar))
+
+	// the deploy is checked again in case workloads changed after the auction
+	bidder := ar[0].BidderId
+	_, err = client.StartWorkload(bidder, "sidecar", "", "{}", "inmem", models.WorkloadLifecycleService, nil, WithAffinity(&models.WorkloadAffinity{
+		AntiAffinity: []models.WorkloadAffinityRule{{Name: "web-1"}},
+	}))
+	be.Nonzero(t, err)
+	be.In(t, "anti-affinity name=web-1", err.Error())
+}
+
 func TestNexClient_CloneWorkload(t *testing.T) {
 	nodeSize := []struct {
 		name string
@@ -506,3 +804,523 @@ func TestNexClient_StopWorkload(t *testing.T) {
 		})
 	}
 }
+
+func TestNexClient_Secrets(t *testing.T) {
+	workDir := t.TempDir()
+	server := _test.StartNatsServer(t, workDir)
+	defer func() {
+		for server.NumClients() == 0 {
+			server.Shutdown()
+			return
+		}
+	}()
+
+	nc, err := nats.Connect(server.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	xkp, err := nkeys.CreateCurveKeys()
+	be.NilErr(t, err)
+
+	store, err := secretstore.NewNatsKVSecretStore(nc, "nex-secrets", xkp, nil)
+	be.NilErr(t, err)
+
+	// secrets are only retrieved from nodes with a control authorizer
+	adminKp, err := nkeys.CreateUser()
+	be.NilErr(t, err)
+	adminPub, err := adminKp.PublicKey()
+	be.NilErr(t, err)
+	authorizer, err := cauthorizer.NewPolicyAuthorizer(&cauthorizer.ControlPolicy{
+		Users: []cauthorizer.ControlPolicyUser{{Name: "admin", Nkey: adminPub, Namespaces: []string{"*"}, Actions: []models.ControlAction{"*"}}},
+	})
+	be.NilErr(t, err)
+
+	node, err := nex.NewNexNode(
+		nex.WithContext(t.Context()),
+		nex.WithNatsConn(nc),
+		nex.WithNexus("testnexus"),
+		nex.WithSecretStore(store),
+		nex.WithControlAuthorizer(authorizer),
+	)
+	be.NilErr(t, err)
+	be.NilErr(t, node.Start())
+	defer func() {
+		be.NilErr(t, node.Shutdown())
+	}()
+
+	client, err := NewClient(context.Background(), nc, "user", WithSigningKey(adminKp))
+	be.NilErr(t, err)
+
+	resp, err := client.PutSecret("dbpass", []byte("supersecret"))
+	be.NilErr(t, err)
+	be.True(t, resp.Success)
+	be.Nonzero(t, resp.Revision)
+
+	value, err := client.GetSecret("dbpass")
+	be.NilErr(t, err)
+	be.Equal(t, "supersecret", string(value))
+
+	// the value is only sent encrypted for the requester xkey
+	_, err = client.secretRequest(models.SecretOperationGet, &models.SecretRequest{Key: "dbpass"})
+	be.Nonzero(t, err)
+
+	keys, err := client.ListSecrets()
+	be.NilErr(t, err)
+	be.AllEqual(t, []string{"dbpass"}, keys)
+
+	// secrets are scoped to the namespace of the request
+	otherClient, err := NewClient(context.Background(), nc, "other", WithSigningKey(adminKp))
+	be.NilErr(t, err)
+	_, err = otherClient.GetSecret("dbpass")
+	be.Nonzero(t, err)
+
+	be.NilErr(t, client.DeleteSecret("dbpass"))
+	_, err = client.GetSecret("dbpass")
+	be.Nonzero(t, err)
+}
+
+func TestNexClient_AuditLog(t *testing.T) {
+	workDir := t.TempDir()
+	server := _test.StartNatsServer(t, workDir)
+	defer func() {
+		for server.NumClients() == 0 {
+			server.Shutdown()
+			return
+		}
+	}()
+
+	nc, err := nats.Connect(server.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	xkp, err := nkeys.CreateCurveKeys()
+	be.NilErr(t, err)
+
+	store, err := secretstore.NewNatsKVSecretStore(nc, "nex-secrets", xkp, nil)
+	be.NilErr(t, err)
+
+	auditLog, err := audit.NewJetStreamAuditLog(t.Context(), nc, models.DefaultAuditStream, 0)
+	be.NilErr(t, err)
+
+	node, err := nex.NewNexNode(
+		nex.WithContext(t.Context()),
+		nex.WithNatsConn(nc),
+		nex.WithNexus("testnexus"),
+		nex.WithSecretStore(store),
+		nex.WithAuditLog(auditLog),
+	)
+	be.NilErr(t, err)
+	be.NilErr(t, node.Start())
+	defer func() {
+		be.NilErr(t, node.Shutdown())
+	}()
+
+	start := time.Now()
+
+	client, err := NewClient(context.Background(), nc, "user")
+	be.NilErr(t, err)
+	otherClient, err := NewClient(context.Background(), nc, "other")
+	be.NilErr(t, err)
+	systemClient, err := NewClient(context.Background(), nc, models.SystemNamespace)
+	be.NilErr(t, err)
+
+	_, err = client.PutSecret("dbpass", []byte("supersecret"))
+	be.NilErr(t, err)
+	// nodes without a control authorizer refuse to hand out secrets
+	_, err = client.GetSecret("dbpass")
+	be.Nonzero(t, err)
+	be.NilErr(t, client.DeleteSecret("dbpass"))
+	_, err = otherClient.PutSecret("apikey", []byte("supersecret"))
+	be.NilErr(t, err)
+
+	// records are written once the handler has responded
+	records, err := systemClient.ListAuditRecords(models.DefaultAuditStream, start)
+	for i := 0; err == nil && len(records) < 3 && i < 20; i++ {
+		time.Sleep(50 * time.Millisecond)
+		records, err = systemClient.ListAuditRecords(models.DefaultAuditStream, start)
+	}
+	be.NilErr(t, err)
+	be.Equal(t, 3, len(records))
+
+	// reads are not recorded and namespaces only see their own records
+	records, err = client.ListAuditRecords(models.DefaultAuditStream, start)
+	be.NilErr(t, err)
+	be.Equal(t, 2, len(records))
+	for _, rec := range records {
+		be.Equal(t, "user", rec.Namespace)
+		be.Equal(t, string(models.ControlActionSecretWrite), rec.Action)
+		be.Equal(t, "dbpass", rec.Target)
+		be.Equal(t, models.AuditRecordOutcomeSuccess, rec.Outcome)
+		be.Nonzero(t, rec.RequestDigest)
+	}
+
+	records, err = systemClient.ListAuditRecords(models.DefaultAuditStream, time.Now().Add(time.Minute))
+	be.NilErr(t, err)
+	be.Equal(t, 0, len(records))
+
+	// records cannot be removed from the audit stream
+	js, err := jetstream.New(nc)
+	be.NilErr(t, err)
+	stream, err := js.Stream(t.Context(), models.DefaultAuditStream)
+	be.NilErr(t, err)
+	be.Nonzero(t, stream.DeleteMsg(t.Context(), 1))
+	be.Nonzero(t, stream.Purge(t.Context()))
+}
+
+func TestNexClient_Schedules(t *testing.T) {
+	workDir := t.TempDir()
+	server := _test.StartNatsServer(t, workDir)
+	defer func() {
+		for server.NumClients() == 0 {
+			server.Shutdown()
+			return
+		}
+	}()
+
+	nc, err := nats.Connect(server.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	node, err := nex.NewNexNode(
+		nex.WithContext(t.Context()),
+		nex.WithNatsConn(nc),
+		nex.WithNexus("testnexus"),
+		nex.WithJobScheduler("nex-schedules", NewLauncher(nc)),
+	)
+	be.NilErr(t, err)
+	be.NilErr(t, node.Start())
+	defer func() {
+		be.NilErr(t, node.Shutdown())
+	}()
+
+	client, err := NewClient(context.Background(), nc, "user")
+	be.NilErr(t, err)
+
+	workload := models.StartWorkloadRequest{
+		Name:         "report",
+		RunRequest:   "{}",
+		Tags:         models.NodeTags{},
+		WorkloadType: "native",
+	}
+
+	be.Nonzero(t, client.PutSchedule("nex-schedules", &models.JobSchedule{Name: "nightly.report", Cron: "@daily", Workload: workload}))
+	be.Nonzero(t, client.PutSchedule("nex-schedules", &models.JobSchedule{Name: "nightly", Cron: "0 25 * * *", Workload: workload}))
+	be.Nonzero(t, client.PutSchedule("nex-schedules", &models.JobSchedule{Name: "nightly", Cron: "@daily", Timezone: "Mars/Olympus", Workload: workload}))
+
+	be.NilErr(t, client.PutSchedule("nex-schedules", &models.JobSchedule{
+		Name:              "nightly",
+		Cron:              "30 2 * * *",
+		Timezone:          "Europe/Berlin",
+		ConcurrencyPolicy: models.JobScheduleConcurrencyPolicyForbid,
+		Workload:          workload,
+	}))
+
+	schedules, err := client.ListSchedules("nex-schedules")
+	be.NilErr(t, err)
+	be.Equal(t, 1, len(schedules))
+	be.Equal(t, "nightly", schedules[0].Name)
+	be.Equal(t, "user", schedules[0].Namespace)
+	be.Equal(t, "user", schedules[0].Workload.Namespace)
+	be.Equal(t, models.WorkloadLifecycleJob, schedules[0].Workload.WorkloadLifecycle)
+	be.Nonzero(t, schedules[0].Created)
+	be.Zero(t, schedules[0].Signature)
+
+	// schedules stored with a signing key are signed by the caller, so runs can
+	// be authorized as the caller
+	callerKp, err := nkeys.CreateUser()
+	be.NilErr(t, err)
+	callerPub, err := callerKp.PublicKey()
+	be.NilErr(t, err)
+	signingClient, err := NewClient(context.Background(), nc, "user", WithSigningKey(callerKp))
+	be.NilErr(t, err)
+	be.NilErr(t, signingClient.PutSchedule("nex-schedules", &models.JobSchedule{Name: "signed", Cron: "@daily", Workload: workload}))
+	schedules, err = client.ListSchedules("nex-schedules")
+	be.NilErr(t, err)
+	be.Equal(t, 2, len(schedules))
+	signed := schedules[slices.IndexFunc(schedules, func(s *models.JobSchedule) bool { return s.Name == "signed" })]
+	be.Equal(t, callerPub, signed.Caller)
+	input, err := signed.SigningInput()
+	be.NilErr(t, err)
+	sig, err := base64.RawURLEncoding.DecodeString(signed.Signature)
+	be.NilErr(t, err)
+	be.NilErr(t, callerKp.Verify(input, sig))
+	be.NilErr(t, client.DeleteSchedule("nex-schedules", "signed"))
+
+	// schedules are scoped to the namespace
+	otherClient, err := NewClient(context.Background(), nc, "other")
+	be.NilErr(t, err)
+	schedules, err = otherClient.ListSchedules("nex-schedules")
+	be.NilErr(t, err)
+	be.Equal(t, 0, len(schedules))
+	be.Nonzero(t, otherClient.DeleteSchedule("nex-schedules", "nightly"))
+
+	runs, err := client.ListJobRuns("nex-schedules", "nightly")
+	be.NilErr(t, err)
+	be.Equal(t, 0, len(runs))
+
+	be.NilErr(t, client.DeleteSchedule("nex-schedules", "nightly"))
+	schedules, err = client.ListSchedules("nex-schedules")
+	be.NilErr(t, err)
+	be.Equal(t, 0, len(schedules))
+}
+
+func TestNexClient_LazyFunctions(t *testing.T) {
+	workDir := t.TempDir()
+	server := _test.StartNatsServer(t, workDir)
+	defer func() {
+		for server.NumClients() == 0 {
+			server.Shutdown()
+			return
+		}
+	}()
+
+	nc, err := nats.Connect(server.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	node, err := nex.NewNexNode(
+		nex.WithContext(t.Context()),
+		nex.WithNatsConn(nc),
+		nex.WithNexus("testnexus"),
+		nex.WithFunctionActivator("nex-functions", NewLauncher(nc)),
+	)
+	be.NilErr(t, err)
+	be.NilErr(t, node.Start())
+	defer func() {
+		be.NilErr(t, node.Shutdown())
+	}()
+
+	client, err := NewClient(context.Background(), nc, "user")
+	be.NilErr(t, err)
+
+	workload := models.StartWorkloadRequest{
+		RunRequest:   `{"trigger_subjects":["greet.>"]}`,
+		Tags:         models.NodeTags{},
+		WorkloadType: "native",
+	}
+
+	be.Nonzero(t, client.PutLazyFunction("nex-functions", &models.LazyFunction{Name: "greet.er", Workload: workload}))
+	be.Nonzero(t, client.PutLazyFunction("nex-functions", &models.LazyFunction{Name: "greeter", IdleTimeout: "soon", Workload: workload}))
+	be.Nonzero(t, client.PutLazyFunction("nex-functions", &models.LazyFunction{Name: "greeter", Workload: models.StartWorkloadRequest{RunRequest: "{}"}}))
+	be.Nonzero(t, client.PutLazyFunction("nex-functions", &models.LazyFunction{Name: "greeter", Workload: models.StartWorkloadRequest{
+		RunRequest: `{"trigger_subjects":["orders"],"trigger_stream":{"stream":"ORDERS"}}`,
+	}}))
+
+	be.NilErr(t, client.PutLazyFunction("nex-functions", &models.LazyFunction{
+		Name:        "greeter",
+		IdleTimeout: "10m",
+		Workload:    workload,
+	}))
+
+	functions, err := client.ListLazyFunctions("nex-functions")
+	be.NilErr(t, err)
+	be.Equal(t, 1, len(functions))
+	be.Equal(t, "greeter", functions[0].Name)
+	be.Equal(t, "user", functions[0].Namespace)
+	be.AllEqual(t, []string{"greet.>"}, functions[0].TriggerSubjects)
+	be.Equal(t, "greeter", functions[0].Workload.Name)
+	be.Equal(t, models.WorkloadLifecycleFunction, functions[0].Workload.WorkloadLifecycle)
+	be.Nonzero(t, functions[0].Created)
+	be.Zero(t, functions[0].Signature)
+
+	// functions stored with a signing key are signed by the caller, so
+	// instances can be authorized as the caller
+	callerKp, err := nkeys.CreateUser()
+	be.NilErr(t, err)
+	callerPub, err := callerKp.PublicKey()
+	be.NilErr(t, err)
+	signingClient, err := NewClient(context.Background(), nc, "user", WithSigningKey(callerKp))
+	be.NilErr(t, err)
+	be.NilErr(t, signingClient.PutLazyFunction("nex-functions", &models.LazyFunction{Name: "signed", Workload: workload}))
+	functions, err = client.ListLazyFunctions("nex-functions")
+	be.NilErr(t, err)
+	be.Equal(t, 2, len(functions))
+	signed := functions[slices.IndexFunc(functions, func(f *models.LazyFunction) bool { return f.Name == "signed" })]
+	be.Equal(t, callerPub, signed.Caller)
+	input, err := signed.SigningInput()
+	be.NilErr(t, err)
+	sig, err := base64.RawURLEncoding.DecodeString(signed.Signature)
+	be.NilErr(t, err)
+	be.NilErr(t, callerKp.Verify(input, sig))
+	be.NilErr(t, client.DeleteLazyFunction("nex-functions", "signed"))
+
+	// functions are scoped to the namespace
+	otherClient, err := NewClient(context.Background(), nc, "other")
+	be.NilErr(t, err)
+	functions, err = otherClient.ListLazyFunctions("nex-functions")
+	be.NilErr(t, err)
+	be.Equal(t, 0, len(functions))
+	be.Nonzero(t, otherClient.DeleteLazyFunction("nex-functions", "greeter"))
+
+	instances, err := client.ListFunctionInstances("nex-functions")
+	be.NilErr(t, err)
+	be.Equal(t, 0, len(instances))
+
+	be.NilErr(t, client.DeleteLazyFunction("nex-functions", "greeter"))
+	functions, err = client.ListLazyFunctions("nex-functions")
+	be.NilErr(t, err)
+	be.Equal(t, 0, len(functions))
+}
+
+func TestNexClient_AutoscalingPolicies(t *testing.T) {
+	workDir := t.TempDir()
+	server := _test.StartNatsServer(t, workDir)
+	defer func() {
+		for server.NumClients() == 0 {
+			server.Shutdown()
+			return
+		}
+	}()
+
+	nc, err := nats.Connect(server.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	node, err := nex.NewNexNode(
+		nex.WithContext(t.Context()),
+		nex.WithNatsConn(nc),
+		nex.WithNexus("testnexus"),
+		nex.WithAutoscaler("nex-autoscalers", NewLauncher(nc)),
+	)
+	be.NilErr(t, err)
+	be.NilErr(t, node.Start())
+	defer func() {
+		be.NilErr(t, node.Shutdown())
+	}()
+
+	client, err := NewClient(context.Background(), nc, "user")
+	be.NilErr(t, err)
+
+	policy := func() *models.AutoscalingPolicy {
+		return &models.AutoscalingPolicy{
+			Name:         "worker",
+			MinInstances: 1,
+			MaxInstances: 5,
+			Target:       100,
+			Consumer:     &models.AutoscalingPolicyConsumer{Stream: "ORDERS", Consumer: "workers"},
+			Workload: models.StartWorkloadRequest{
+				RunRequest:   "{}",
+				Tags:         models.NodeTags{},
+				WorkloadType: "native",
+			},
+		}
+	}
+
+	invalid := policy()
+	invalid.Name = "work.er"
+	be.Nonzero(t, client.PutAutoscalingPolicy("nex-autoscalers", invalid))
+	invalid = policy()
+	invalid.MinInstances = 6
+	be.Nonzero(t, client.PutAutoscalingPolicy("nex-autoscalers", invalid))
+	invalid = policy()
+	invalid.Metric = &models.AutoscalingPolicyMetric{Name: "queued"}
+	be.Nonzero(t, client.PutAutoscalingPolicy("nex-autoscalers", invalid))
+
+	be.NilErr(t, client.PutAutoscalingPolicy("nex-autoscalers", policy()))
+
+	policies, err := client.ListAutoscalingPolicies("nex-autoscalers")
+	be.NilErr(t, err)
+	be.Equal(t, 1, len(policies))
+	be.Equal(t, "worker", policies[0].Name)
+	be.Equal(t, "user", policies[0].Namespace)
+	be.Equal(t, "worker", policies[0].Workload.Name)
+	be.Equal(t, models.WorkloadLifecycleService, policies[0].Workload.WorkloadLifecycle)
+	be.Nonzero(t, policies[0].Created)
+	be.Zero(t, policies[0].Signature)
+
+	// policies stored with a signing key are signed by the caller, so scaling
+	// can be authorized as the caller
+	callerKp, err := nkeys.CreateUser()
+	be.NilErr(t, err)
+	callerPub, err := callerKp.PublicKey()
+	be.NilErr(t, err)
+	signingClient, err := NewClient(context.Background(), nc, "user", WithSigningKey(callerKp))
+	be.NilErr(t, err)
+	signedPolicy := policy()
+	signedPolicy.Name = "signed"
+	be.NilErr(t, signingClient.PutAutoscalingPolicy("nex-autoscalers", signedPolicy))
+	policies, err = client.ListAutoscalingPolicies("nex-autoscalers")
+	be.NilErr(t, err)
+	be.Equal(t, 2, len(policies))
+	signed := policies[slices.IndexFunc(policies, func(p *models.AutoscalingPolicy) bool { return p.Name == "signed" })]
+	be.Equal(t, callerPub, signed.Caller)
+	input, err := signed.SigningInput()
+	be.NilErr(t, err)
+	sig, err := base64.RawURLEncoding.DecodeString(signed.Signature)
+	be.NilErr(t, err)
+	be.NilErr(t, callerKp.Verify(input, sig))
+	be.NilErr(t, client.DeleteAutoscalingPolicy("nex-autoscalers", "signed"))
+
+	// policies are scoped to the namespace
+	otherClient, err := NewClient(context.Background(), nc, "other")
+	be.NilErr(t, err)
+	policies, err = otherClient.ListAutoscalingPolicies("nex-autoscalers")
+	be.NilErr(t, err)
+	be.Equal(t, 0, len(policies))
+	be.Nonzero(t, otherClient.DeleteAutoscalingPolicy("nex-autoscalers", "worker"))
+
+	statuses, err := client.ListAutoscalingStatus("nex-autoscalers")
+	be.NilErr(t, err)
+	be.Equal(t, 0, len(statuses))
+
+	be.NilErr(t, client.DeleteAutoscalingPolicy("nex-autoscalers", "worker"))
+	policies, err = client.ListAutoscalingPolicies("nex-autoscalers")
+	be.NilErr(t, err)
+	be.Equal(t, 0, len(policies))
+}
+
+func TestNexClient_InvokeFunction(t *testing.T) {
+	workDir := t.TempDir()
+	server := _test.StartNatsServer(t, workDir)
+	defer func() {
+		for server.NumClients() == 0 {
+			server.Shutdown()
+			return
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	nexNodes := _test.StartNexus(t, ctx, server.ClientURL(), 1, false)
+	defer func() {
+		for _, node := range nexNodes {
+			be.NilErr(t, node.Shutdown())
+		}
+	}()
+
+	nc, err := nats.Connect(server.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	client, err := NewClient(context.Background(), nc, "user", WithAuctionStall(1*time.Second))
+	be.NilErr(t, err)
+
+	ar, err := client.Auction("inmem", map[string]string{})
+	be.NilErr(t, err)
+	be.Equal(t, 1, len(ar))
+
+	fn, err := client.StartWorkload(ar[0].BidderId, "greeter", "", `{"trigger_subjects":["greet.*","greet.hello"]}`, "inmem", models.WorkloadLifecycleFunction, nil)
+	be.NilErr(t, err)
+	svc, err := client.StartWorkload(ar[0].BidderId, "server", "", "{}", "inmem", models.WorkloadLifecycleService, nil)
+	be.NilErr(t, err)
+
+	for _, workload := range []string{"greeter", fn.Id} {
+		resp, err := client.InvokeFunction(t.Context(), workload, []byte("hi"), nats.Header{"trace": []string{"abc"}})
+		be.NilErr(t, err)
+		be.Equal(t, "greet.hello", resp.Subject)
+		be.Equal(t, fn.Id, resp.WorkloadId)
+		be.Equal(t, "Function executed successfully", string(resp.Data))
+		be.Zero(t, resp.Error)
+		be.Nonzero(t, resp.Duration)
+	}
+
+	resp, err := client.InvokeFunction(t.Context(), "greeter", nil, nil, WithInvokeSubject("greet.other"))
+	be.NilErr(t, err)
+	be.Equal(t, "greet.other", resp.Subject)
+
+	_, err = client.InvokeFunction(t.Context(), svc.Id, nil, nil)
+	be.Nonzero(t, err)
+	_, err = client.InvokeFunction(t.Context(), "missing", nil, nil)
+	be.Nonzero(t, err)
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+
+	"github.com/nats-io/nats.go"
+	"github.com/synadia-io/nex/models"
+)
+
+var _ models.WorkloadScaler = (*launcher)(nil)
+
+// launcher starts and stops the runs of job schedules and the instances of lazy
+// functions and autoscaled workloads through the control API, the way nex
+// workload start and stop do
+type launcher struct {
+	nc   *nats.Conn
+	opts []ClientOption
+}
+
+// NewLauncher returns the launcher nodes running the job scheduler, function
+// activator or autoscaler start workloads with. Pass WithSigningKey so nodes
+// requiring signed control requests accept them
+func NewLauncher(nc *nats.Conn, opts ...ClientOption) *launcher {
+	return &launcher{nc: nc, opts: opts}
+}
+
+func (l *launcher) DeployJob(ctx context.Context, req *models.StartWorkloadRequest, constraints []string) (*models.StartWorkloadResponse, error) {
+	c, err := l.client(ctx, req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	// the group is a workload tag, not one of the node tags bid on
+	auctionTags := maps.Clone(req.Tags)
+	delete(auctionTags, models.TagWorkloadGroup)
+
+	bids, err := c.Auction(req.WorkloadType, auctionTags,
+		WithAuctionAffinity(req.Affinity),
+		WithAuctionConstraints(constraints...),
+		WithAuctionResources(req.Resources),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(bids) == 0 {
+		return nil, errors.New("no agents available for workload placement")
+	}
+
+	winner := bids[rand.Intn(len(bids))]
+	return c.StartWorkload(winner.BidderId, req.Name, req.Description, req.RunRequest, req.WorkloadType, req.WorkloadLifecycle, req.Tags,
+		WithAsync(),
+		WithAffinity(req.Affinity),
+		WithPermissions(req.Permissions),
+		WithResources(req.Resources),
+	)
+}
+
+func (l *launcher) WaitForOperation(ctx context.Context, namespace, operationID string) (*models.OperationStatus, error) {
+	c, err := l.client(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	return c.WaitForOperation(operationID)
+}
+
+func (l *launcher) StopJob(ctx context.Context, namespace, workloadID string) error {
+	c, err := l.client(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	resp, err := c.StopWorkload(workloadID)
+	if err != nil {
+		return err
+	}
+	if !resp.Stopped {
+		return fmt.Errorf("failed to stop workload %s: %s", workloadID, resp.Message)
+	}
+	return nil
+}
+
+func (l *launcher) ListInstances(ctx context.Context, namespace, name string) ([]string, error) {
+	c, err := l.client(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	workloads, err := c.ListWorkloads([]string{})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, resp := range workloads {
+		for _, w := range *resp {
+			if w.Name != name {
+				continue
+			}
+			// instances being stopped no longer count
+			if w.WorkloadState == models.WorkloadStateStarting || w.WorkloadState == models.WorkloadStateRunning {
+				ids = append(ids, w.Id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// client returns a client of the namespace whose requests end with ctx
+func (l *launcher) client(ctx context.Context, namespace string) (*nexClient, error) {
+	return NewClient(ctx, l.nc, namespace, l.opts...)
+}
@@ -1,7 +1,11 @@
 package client
 
 import (
+	"errors"
 	"time"
+
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/nex/models"
 )
 
 type ClientOption func(*nexClient) error
@@ -35,3 +39,168 @@ func WithRequestManyStall(stall time.Duration) ClientOption {
 		return nil
 	}
 }
+
+// WithFullStall waits out the stall of requests sent to every node instead of
+// returning once every live node has answered
+func WithFullStall() ClientOption {
+	return func(c *nexClient) error {
+		c.fullStall = true
+		return nil
+	}
+}
+
+// WithSigningKey signs control requests with a user nkey so nodes can
+// authorize the caller
+func WithSigningKey(kp nkeys.KeyPair) ClientOption {
+	return func(c *nexClient) error {
+		pub, err := kp.PublicKey()
+		if err != nil {
+			return err
+		}
+		if !nkeys.IsValidPublicUserKey(pub) {
+			return errors.New("control requests must be signed with a user nkey")
+		}
+		c.signer = kp
+		return nil
+	}
+}
+
+type StartWorkloadOption func(*startWorkloadOptions)
+
+type startWorkloadOptions struct {
+	dryRun      bool
+	async       bool
+	affinity    *models.WorkloadAffinity
+	group       string
+	permissions *models.WorkloadPermissions
+	resources   *models.WorkloadResources
+}
+
+// WithDryRun has the node validate the start request, check admission and
+// quotas and mint credentials without starting the workload. The response
+// holds the id the workload would have been given
+func WithDryRun() StartWorkloadOption {
+	return func(o *startWorkloadOptions) {
+		o.dryRun = true
+	}
+}
+
+// WithAsync returns as soon as the node accepts the deploy instead of waiting
+// for the workload to start. Use WaitForOperation with the operation id of the
+// response to follow the start
+func WithAsync() StartWorkloadOption {
+	return func(o *startWorkloadOptions) {
+		o.async = true
+	}
+}
+
+// WithAffinity has the node check the affinity rules against the workloads it
+// runs before starting the workload. Pass the same rules to Auction with
+// WithAuctionAffinity so only nodes that satisfy them bid
+func WithAffinity(affinity *models.WorkloadAffinity) StartWorkloadOption {
+	return func(o *startWorkloadOptions) {
+		o.affinity = affinity
+	}
+}
+
+// WithGroup puts the workload in a group that affinity rules of other
+// workloads can select
+func WithGroup(group string) StartWorkloadOption {
+	return func(o *startWorkloadOptions) {
+		o.group = group
+	}
+}
+
+// WithPermissions requests NATS permissions for the workload. The node rejects
+// the workload if the permissions exceed the namespace policy or it cannot mint
+// credentials limited to them
+func WithPermissions(perms *models.WorkloadPermissions) StartWorkloadOption {
+	return func(o *startWorkloadOptions) {
+		o.permissions = perms
+	}
+}
+
+// WithResources declares the resources the workload uses. The resources are
+// counted against the namespace quota
+func WithResources(res *models.WorkloadResources) StartWorkloadOption {
+	return func(o *startWorkloadOptions) {
+		o.resources = res
+	}
+}
+
+type AuctionOption func(*auctionOptions)
+
+type auctionOptions struct {
+	affinity    *models.WorkloadAffinity
+	constraints []string
+	resources   *models.WorkloadResources
+}
+
+// WithAuctionAffinity has only the nodes whose workloads satisfy the affinity
+// rules bid, e.g. to spread the replicas of a service across nodes or to run a
+// sidecar next to its workload
+func WithAuctionAffinity(affinity *models.WorkloadAffinity) AuctionOption {
+	return func(o *auctionOptions) {
+		o.affinity = affinity
+	}
+}
+
+// WithAuctionConstraints has only the nodes whose attributes satisfy the
+// constraint expressions bid, e.g. nex.cpucount >= 8 or nex.agent.version >= 1.2.0
+func WithAuctionConstraints(constraints ...string) AuctionOption {
+	return func(o *auctionOptions) {
+		o.constraints = constraints
+	}
+}
+
+// WithAuctionResources declares the resources the workload uses. Nodes enforcing
+// namespace quotas do not bid when the workload would exceed the quota and
+// respond with the reason instead
+func WithAuctionResources(res *models.WorkloadResources) AuctionOption {
+	return func(o *auctionOptions) {
+		o.resources = res
+	}
+}
+
+type ListNodesOption func(*listNodesOptions)
+
+type listNodesOptions struct {
+	constraints []string
+}
+
+// WithNodeConstraints lists only the nodes whose attributes satisfy the
+// constraint expressions
+func WithNodeConstraints(constraints ...string) ListNodesOption {
+	return func(o *listNodesOptions) {
+		o.constraints = constraints
+	}
+}
+
+type LameduckOption func(*lameduckOptions)
+
+type lameduckOptions struct {
+	constraints []string
+}
+
+// WithLameduckConstraints puts the node into lameduck mode only if its
+// attributes satisfy the constraint expressions
+func WithLameduckConstraints(constraints ...string) LameduckOption {
+	return func(o *lameduckOptions) {
+		o.constraints = constraints
+	}
+}
+
+type InvokeFunctionOption func(*invokeFunctionOptions)
+
+type invokeFunctionOptions struct {
+	subject string
+}
+
+// WithInvokeSubject sends the invocation to the subject instead of the trigger
+// subject resolved from the start request, e.g. to address a function whose
+// trigger subjects have wildcards
+func WithInvokeSubject(subject string) InvokeFunctionOption {
+	return func(o *invokeFunctionOptions) {
+		o.subject = subject
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/synadia-io/nex/client"
+)
+
+type Audit struct {
+	List ListAudit `cmd:"" name:"list" help:"List audit records of control plane mutations in the namespace" aliases:"ls"`
+}
+
+type ListAudit struct {
+	Since  string `name:"since" help:"Only list records newer than a duration or RFC3339 timestamp" placeholder:"24h"`
+	Stream string `name:"stream" help:"JetStream stream holding the audit log" default:"NEX_AUDIT"`
+}
+
+func (l *ListAudit) Validate() error {
+	_, err := l.sinceTime()
+	return err
+}
+
+// sinceTime parses --since as either a duration before now or a timestamp
+func (l *ListAudit) sinceTime() (time.Time, error) {
+	if l.Since == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(l.Since); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, l.Since)
+	if err != nil {
+		return time.Time{}, errors.New("since must be a duration or an RFC3339 timestamp")
+	}
+	return t, nil
+}
+
+func (l *ListAudit) Run(ctx context.Context, globals *Globals) error {
+	nc, err := configureNatsConnection(globals)
+	if err != nil {
+		return err
+	}
+
+	if nc == nil {
+		return errors.New("no NATS connection available")
+	}
+
+	since, err := l.sinceTime()
+	if err != nil {
+		return err
+	}
+
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
+	}
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	if err != nil {
+		return err
+	}
+	records, err := nexClient.ListAuditRecords(l.Stream, since)
+	if err != nil {
+		return err
+	}
+
+	if globals.JSON {
+		recordsB, err := json.Marshal(records)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(recordsB))
+		return nil
+	}
+
+	if len(records) == 0 {
+		fmt.Println("No audit records found")
+		return nil
+	}
+
+	tW := table.NewWriter()
+	tW.SetStyle(table.StyleRounded)
+	tW.Style().Title.Align = text.AlignCenter
+	tW.Style().Format.Header = text.FormatDefault
+	tW.SetTitle("Audit Log - " + globals.Namespace)
+	tW.AppendHeader(table.Row{"Time", "Namespace", "Action", "Target", "Caller", "Outcome", "Node", "Error"})
+	for _, r := range records {
+		tW.AppendRow(table.Row{r.Timestamp.Local().Format(time.DateTime), r.Namespace, r.Action, r.Target, r.Caller, r.Outcome, r.NodeId, r.Error})
+	}
+	fmt.Println(tW.Render())
+	return nil
+}
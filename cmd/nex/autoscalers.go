@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/synadia-io/nex/client"
+	"github.com/synadia-io/nex/models"
+)
+
+type (
+	ListAutoscalers struct {
+		Bucket string `name:"bucket" help:"KV bucket used by the autoscaler" default:"nex-autoscalers"`
+	}
+	DeleteAutoscaler struct {
+		Name   string `arg:"" name:"name" help:"Name of the autoscaled service"`
+		Bucket string `name:"bucket" help:"KV bucket used by the autoscaler" default:"nex-autoscalers"`
+	}
+)
+
+func (l *ListAutoscalers) Run(ctx context.Context, globals *Globals) error {
+	nc, err := configureNatsConnection(globals)
+	if err != nil {
+		return err
+	}
+
+	if nc == nil {
+		return errors.New("no NATS connection available")
+	}
+
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
+	}
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	if err != nil {
+		return err
+	}
+	policies, err := nexClient.ListAutoscalingPolicies(l.Bucket)
+	if err != nil {
+		return err
+	}
+	statuses, err := nexClient.ListAutoscalingStatus(l.Bucket)
+	if err != nil {
+		return err
+	}
+
+	evaluated := make(map[string]*models.AutoscalingStatus)
+	for _, s := range statuses {
+		evaluated[s.Name] = s
+	}
+
+	if globals.JSON {
+		respB, err := json.Marshal(struct {
+			Policies []*models.AutoscalingPolicy `json:"policies"`
+			Status   []*models.AutoscalingStatus `json:"status"`
+		}{policies, statuses})
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(respB))
+		return nil
+	}
+
+	if len(policies) == 0 {
+		fmt.Println("No autoscaling policies found")
+		return nil
+	}
+
+	tW := table.NewWriter()
+	tW.SetStyle(table.StyleRounded)
+	tW.Style().Title.Align = text.AlignCenter
+	tW.Style().Format.Header = text.FormatDefault
+	tW.SetTitle("Autoscalers - " + globals.Namespace)
+	tW.AppendHeader(table.Row{"Name", "Source", "Target", "Min", "Max", "Instances", "Desired", "Value", "Error"})
+	for _, p := range policies {
+		source := "--"
+		switch {
+		case p.Consumer != nil:
+			source = p.Consumer.Stream + "/" + p.Consumer.Consumer
+		case p.Metric != nil:
+			source = "metric " + p.Metric.Name
+		}
+
+		instances, desired, value, errMsg := "--", "--", "--", ""
+		if s, ok := evaluated[p.Name]; ok {
+			instances = strconv.Itoa(s.Instances)
+			desired = strconv.Itoa(s.Desired)
+			value = strconv.FormatFloat(s.MetricValue, 'f', -1, 64)
+			errMsg = s.Error
+		}
+		tW.AppendRow(table.Row{p.Name, source, p.Target, p.MinInstances, p.MaxInstances, instances, desired, value, errMsg})
+	}
+	fmt.Println(tW.Render())
+	return nil
+}
+
+func (d *DeleteAutoscaler) Run(ctx context.Context, globals *Globals) error {
+	nc, err := configureNatsConnection(globals)
+	if err != nil {
+		return err
+	}
+
+	if nc == nil {
+		return errors.New("no NATS connection available")
+	}
+
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
+	}
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	if err != nil {
+		return err
+	}
+	err = nexClient.DeleteAutoscalingPolicy(d.Bucket, d.Name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Autoscaling policy %s removed\n", d.Name)
+	return nil
+}
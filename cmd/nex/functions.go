@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/synadia-io/nex/client"
+	"github.com/synadia-io/nex/models"
+)
+
+type (
+	ListLazyFunctions struct {
+		Bucket string `name:"bucket" help:"KV bucket used by the function activator" default:"nex-functions"`
+	}
+	DeleteLazyFunction struct {
+		Name   string `arg:"" name:"name" help:"Name of the lazy function"`
+		Bucket string `name:"bucket" help:"KV bucket used by the function activator" default:"nex-functions"`
+	}
+)
+
+func (l *ListLazyFunctions) Run(ctx context.Context, globals *Globals) error {
+	nc, err := configureNatsConnection(globals)
+	if err != nil {
+		return err
+	}
+
+	if nc == nil {
+		return errors.New("no NATS connection available")
+	}
+
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
+	}
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	if err != nil {
+		return err
+	}
+	functions, err := nexClient.ListLazyFunctions(l.Bucket)
+	if err != nil {
+		return err
+	}
+	instances, err := nexClient.ListFunctionInstances(l.Bucket)
+	if err != nil {
+		return err
+	}
+
+	running := make(map[string]*models.FunctionInstance)
+	for _, i := range instances {
+		running[i.Function] = i
+	}
+
+	if globals.JSON {
+		respB, err := json.Marshal(struct {
+			Functions []*models.LazyFunction     `json:"functions"`
+			Instances []*models.FunctionInstance `json:"instances"`
+		}{functions, instances})
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(respB))
+		return nil
+	}
+
+	if len(functions) == 0 {
+		fmt.Println("No lazy functions found")
+		return nil
+	}
+
+	tW := table.NewWriter()
+	tW.SetStyle(table.StyleRounded)
+	tW.Style().Title.Align = text.AlignCenter
+	tW.Style().Format.Header = text.FormatDefault
+	tW.SetTitle("Lazy Functions - " + globals.Namespace)
+	tW.AppendHeader(table.Row{"Name", "Trigger Subjects", "Idle Timeout", "Type", "Instance", "Node", "Started"})
+	for _, f := range functions {
+		instance, node, started := "--", "--", "--"
+		if i, ok := running[f.Name]; ok {
+			instance = i.Id
+			started = i.Started.Format(time.RFC3339)
+			if i.NodeId != "" {
+				node = i.NodeId
+			}
+		}
+		tW.AppendRow(table.Row{f.Name, strings.Join(f.TriggerSubjects, ", "), f.IdleTimeout, f.Workload.WorkloadType, instance, node, started})
+	}
+	fmt.Println(tW.Render())
+	return nil
+}
+
+func (d *DeleteLazyFunction) Run(ctx context.Context, globals *Globals) error {
+	nc, err := configureNatsConnection(globals)
+	if err != nil {
+		return err
+	}
+
+	if nc == nil {
+		return errors.New("no NATS connection available")
+	}
+
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
+	}
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	if err != nil {
+		return err
+	}
+	err = nexClient.DeleteLazyFunction(d.Bucket, d.Name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Lazy function %s removed\n", d.Name)
+	return nil
+}
@@ -18,6 +18,7 @@ type Globals struct {
 	AutoUpgrade         bool             `name:"auto-upgrade" env:"NEX_AUTO_UPGRADE" help:"Automatically upgrade the nex CLI when a new version is available"`
 	DevMode             bool             `name:"dev-mode" default:"false" help:"Enable development mode"`
 	JSON                bool             `name:"json" help:"Displays any output in JSON format"`
+	SigningKey          string           `name:"signing-key" env:"NEX_SIGNING_KEY" help:"User nkey seed file used to sign control requests" type:"existingfile" placeholder:"user.nk"`
 }
 
 type GlobalLogger struct {
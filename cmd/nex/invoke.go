@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/synadia-io/nex/client"
+)
+
+type InvokeWorkload struct {
+	Workload string            `arg:"" name:"workload" help:"ID or name of the function workload"`
+	Data     string            `name:"data" short:"d" help:"Payload of the invocation; @file reads it from a file, @- from stdin" placeholder:"@payload.json"`
+	Headers  map[string]string `name:"header" short:"H" help:"Header to send with the invocation; may be repeated" placeholder:"key=value"`
+	Subject  string            `name:"subject" help:"Subject to invoke the function on instead of its trigger subject"`
+	Timeout  time.Duration     `name:"timeout" help:"How long to wait for the reply" default:"10s"`
+}
+
+func (i *InvokeWorkload) Run(ctx context.Context, globals *Globals) error {
+	nc, err := configureNatsConnection(globals)
+	if err != nil {
+		return err
+	}
+
+	if nc == nil {
+		return errors.New("no NATS connection available")
+	}
+
+	payload, err := invokePayload(i.Data)
+	if err != nil {
+		return err
+	}
+
+	headers := nats.Header{}
+	for k, v := range i.Headers {
+		headers.Set(k, v)
+	}
+
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
+	}
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	if err != nil {
+		return err
+	}
+
+	var invokeOpts []client.InvokeFunctionOption
+	if i.Subject != "" {
+		invokeOpts = append(invokeOpts, client.WithInvokeSubject(i.Subject))
+	}
+
+	invokeCtx, cancel := context.WithTimeout(ctx, i.Timeout)
+	defer cancel()
+	resp, err := nexClient.InvokeFunction(invokeCtx, i.Workload, payload, headers, invokeOpts...)
+	if err != nil {
+		return err
+	}
+
+	if globals.JSON {
+		respB, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(respB))
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Invoked %s on %s in %s\n", resp.WorkloadId, resp.Subject, resp.Duration.Round(time.Microsecond))
+	_, err = os.Stdout.Write(resp.Data)
+	if err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("function failed: %s", resp.Error)
+	}
+	return nil
+}
+
+// invokePayload reads the payload of an invocation given as a literal, @file
+// or @- for stdin
+func invokePayload(data string) ([]byte, error) {
+	path, ok := strings.CutPrefix(data, "@")
+	if !ok {
+		return []byte(data), nil
+	}
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
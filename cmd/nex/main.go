@@ -23,6 +23,15 @@ type NexCLI struct {
 
 	Node     Node     `cmd:"" help:"Interact with execution engine nodes"`
 	Workload Workload `cmd:"" help:"Interact with workloads" aliases:"workloads"`
+	Secret   Secret   `cmd:"" help:"Manage namespace secrets" aliases:"secrets"`
+	Audit    Audit    `cmd:"" help:"Query the control plane audit log"`
+	Quota    Quota    `cmd:"" help:"Manage namespace quotas enforced by the quota auctioneer" aliases:"quotas"`
+}
+
+// defaultConfigPaths are the config files loaded when --config is not given,
+// in order of precedence
+func defaultConfigPaths(userResourcePath string) []string {
+	return []string{"/etc/nex/config.json", filepath.Join(userResourcePath, "config.json"), "./config.json"}
 }
 
 func main() {
@@ -43,7 +52,7 @@ func main() {
 		kong.Description("The NATS Execution Engine\n"+banner),
 		kong.UsageOnError(),
 		kong.ConfigureHelp(kong.HelpOptions{Compact: true, NoExpandSubcommands: true, FlagsLast: true}),
-		kong.Configuration(kong.JSON, "/etc/nex/config.json", filepath.Join(userResourcePath, "config.json"), "./config.json"),
+		kong.Configuration(kong.JSON, defaultConfigPaths(userResourcePath)...),
 		kong.Vars{
 			"version":             fmt.Sprintf("%s [%s] | Built: %s", VERSION, COMMIT, BUILDDATE),
 			"versionOnly":         VERSION,
@@ -4,9 +4,11 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/carlmjohnson/be"
+	"github.com/synadia-io/nex/models"
 )
 
 var kongVars = map[string]string{
@@ -70,3 +72,137 @@ func TestCLIWithConfig(t *testing.T) {
 	be.Equal(t, "derp", nex.Globals.Namespace)
 	be.Equal(t, 2, len(nex.Node.Up.Agents))
 }
+
+func TestCLIScheduleJob(t *testing.T) {
+	nex := NexCLI{}
+
+	parser := kong.Must(&nex,
+		kong.Vars(kongVars),
+		kong.Bind(&nex.Globals),
+	)
+
+	_, err := parser.Parse([]string{"workload", "start", "--name", "report", "--lifecycle", "job", "--start-request", "{}", "--schedule", "0 2 * * *", "--timezone", "Europe/Berlin", "--concurrency-policy", "forbid", "--group", "reports"})
+	be.NilErr(t, err)
+
+	sched, err := nex.Workload.Start.jobSchedule(models.Nexfile{}, nil)
+	be.NilErr(t, err)
+	be.Equal(t, "report", sched.Name)
+	be.Equal(t, "0 2 * * *", sched.Cron)
+	be.Equal(t, "Europe/Berlin", sched.Timezone)
+	be.Equal(t, models.JobScheduleConcurrencyPolicyForbid, sched.ConcurrencyPolicy)
+	be.Equal(t, 10, sched.HistoryLimit)
+	be.Equal(t, "{}", sched.Workload.RunRequest)
+	be.Equal(t, "reports", sched.Workload.Tags[models.TagWorkloadGroup])
+
+	_, err = parser.Parse([]string{"workload", "start", "--name", "web", "--start-request", "{}", "--schedule", "@hourly"})
+	be.NilErr(t, err)
+	_, err = nex.Workload.Start.jobSchedule(models.Nexfile{}, nil)
+	be.Nonzero(t, err)
+
+	_, err = parser.Parse([]string{"workload", "runs", "report"})
+	be.NilErr(t, err)
+	be.Equal(t, "report", nex.Workload.Runs.Name)
+	be.Equal(t, "nex-schedules", nex.Workload.Runs.Bucket)
+}
+
+func TestCLILazyFunction(t *testing.T) {
+	nex := NexCLI{}
+
+	parser := kong.Must(&nex,
+		kong.Vars(kongVars),
+		kong.Bind(&nex.Globals),
+	)
+
+	_, err := parser.Parse([]string{"workload", "start", "--name", "resize", "--lifecycle", "function", "--start-request", `{"trigger_subjects":["images.resize"]}`, "--lazy", "--idle-timeout", "90s"})
+	be.NilErr(t, err)
+
+	fn, err := nex.Workload.Start.lazyFunction(models.Nexfile{}, nil)
+	be.NilErr(t, err)
+	be.Equal(t, "resize", fn.Name)
+	be.Equal(t, "1m30s", fn.IdleTimeout)
+	be.Equal(t, "resize", fn.Workload.Name)
+	be.Equal(t, models.WorkloadLifecycleFunction, fn.Workload.WorkloadLifecycle)
+	be.Equal(t, "nex-functions", nex.Workload.Start.FunctionBucket)
+
+	_, err = parser.Parse([]string{"workload", "start", "--name", "web", "--start-request", "{}", "--lazy"})
+	be.NilErr(t, err)
+	_, err = nex.Workload.Start.lazyFunction(models.Nexfile{}, nil)
+	be.Nonzero(t, err)
+
+	_, err = parser.Parse([]string{"workload", "start", "--name", "resize", "--lifecycle", "function", "--start-request", "{}", "--lazy", "--schedule", "@hourly"})
+	be.Nonzero(t, err)
+
+	_, err = parser.Parse([]string{"workload", "remove-function", "resize"})
+	be.NilErr(t, err)
+	be.Equal(t, "resize", nex.Workload.RemoveFunction.Name)
+	be.Equal(t, "nex-functions", nex.Workload.RemoveFunction.Bucket)
+}
+
+func TestCLIAutoscaler(t *testing.T) {
+	nex := NexCLI{}
+
+	parser := kong.Must(&nex,
+		kong.Vars(kongVars),
+		kong.Bind(&nex.Globals),
+	)
+
+	_, err := parser.Parse([]string{"workload", "start", "--name", "worker", "--start-request", "{}", "--max-instances", "10", "--min-instances", "0", "--scale-target", "100", "--scale-stream", "ORDERS", "--scale-consumer", "workers", "--scale-in-cooldown", "10m"})
+	be.NilErr(t, err)
+
+	policy, err := nex.Workload.Start.autoscalingPolicy(models.Nexfile{}, nil)
+	be.NilErr(t, err)
+	be.Equal(t, "worker", policy.Name)
+	be.Equal(t, 0, policy.MinInstances)
+	be.Equal(t, 10, policy.MaxInstances)
+	be.Equal(t, float64(100), policy.Target)
+	be.Equal(t, "ORDERS", policy.Consumer.Stream)
+	be.Equal(t, "workers", policy.Consumer.Consumer)
+	be.True(t, policy.Metric == nil)
+	be.Equal(t, "1m0s", policy.ScaleOutCooldown)
+	be.Equal(t, "10m0s", policy.ScaleInCooldown)
+	be.Equal(t, models.WorkloadLifecycleService, policy.Workload.WorkloadLifecycle)
+	be.Equal(t, "nex-autoscalers", nex.Workload.Start.AutoscaleBucket)
+
+	_, err = parser.Parse([]string{"workload", "start", "--name", "report", "--lifecycle", "job", "--start-request", "{}", "--max-instances", "3"})
+	be.NilErr(t, err)
+	_, err = nex.Workload.Start.autoscalingPolicy(models.Nexfile{}, nil)
+	be.Nonzero(t, err)
+
+	_, err = parser.Parse([]string{"workload", "start", "--name", "report", "--lifecycle", "job", "--start-request", "{}", "--max-instances", "3", "--schedule", "@hourly"})
+	be.Nonzero(t, err)
+
+	_, err = parser.Parse([]string{"workload", "remove-autoscaler", "worker"})
+	be.NilErr(t, err)
+	be.Equal(t, "worker", nex.Workload.RemoveAutoscaler.Name)
+	be.Equal(t, "nex-autoscalers", nex.Workload.RemoveAutoscaler.Bucket)
+}
+
+func TestCLIInvokeWorkload(t *testing.T) {
+	nex := NexCLI{}
+
+	parser := kong.Must(&nex,
+		kong.Vars(kongVars),
+		kong.Bind(&nex.Globals),
+	)
+
+	payload := filepath.Join(t.TempDir(), "payload.json")
+	be.NilErr(t, os.WriteFile(payload, []byte(`{"size":"small"}`), 0o600))
+
+	_, err := parser.Parse([]string{"workload", "invoke", "resize", "--data", "@" + payload, "--header", "trace=abc", "-H", "tenant=x"})
+	be.NilErr(t, err)
+	be.Equal(t, "resize", nex.Workload.Invoke.Workload)
+	be.Equal(t, "abc", nex.Workload.Invoke.Headers["trace"])
+	be.Equal(t, "x", nex.Workload.Invoke.Headers["tenant"])
+	be.Equal(t, 10*time.Second, nex.Workload.Invoke.Timeout)
+
+	data, err := invokePayload(nex.Workload.Invoke.Data)
+	be.NilErr(t, err)
+	be.Equal(t, `{"size":"small"}`, string(data))
+
+	data, err = invokePayload("hello")
+	be.NilErr(t, err)
+	be.Equal(t, "hello", string(data))
+
+	_, err = invokePayload("@" + filepath.Join(t.TempDir(), "missing"))
+	be.Nonzero(t, err)
+}
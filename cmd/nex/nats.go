@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"os"
 	"strings"
 
 	"github.com/nats-io/jsm.go/natscontext"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/nex/client"
 )
 
 func configureNatsConnection(cfg *Globals) (*nats.Conn, error) {
@@ -64,3 +67,25 @@ func configureNatsConnection(cfg *Globals) (*nats.Conn, error) {
 
 	return nc, nil
 }
+
+// clientOptions returns the nex client options configured by the global flags
+func clientOptions(cfg *Globals) ([]client.ClientOption, error) {
+	var opts []client.ClientOption
+	if cfg.NatsTimeout > 0 {
+		opts = append(opts, client.WithDefaultTimeout(cfg.NatsTimeout))
+	}
+
+	if cfg.SigningKey != "" {
+		seed, err := os.ReadFile(cfg.SigningKey)
+		if err != nil {
+			return nil, err
+		}
+		kp, err := nkeys.FromSeed(bytes.TrimSpace(seed))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, client.WithSigningKey(kp))
+	}
+
+	return opts, nil
+}
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -11,8 +12,10 @@ import (
 	"math/rand"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"slices"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
@@ -24,23 +27,35 @@ import (
 	"github.com/synadia-io/nex"
 	"github.com/synadia-io/nex/agents/native"
 	"github.com/synadia-io/nex/client"
+	"github.com/synadia-io/nex/internal/admission"
+	"github.com/synadia-io/nex/internal/aregistrar"
+	"github.com/synadia-io/nex/internal/auctioneer"
+	"github.com/synadia-io/nex/internal/audit"
+	"github.com/synadia-io/nex/internal/cauthorizer"
+	"github.com/synadia-io/nex/internal/constraints"
 	"github.com/synadia-io/nex/internal/credentials"
 	eventemitter "github.com/synadia-io/nex/internal/event_emitter"
+	secretstore "github.com/synadia-io/nex/internal/secret_store"
 	"github.com/synadia-io/nex/internal/state"
+	"github.com/synadia-io/nex/internal/tagprovider"
 	"github.com/synadia-io/nex/models"
 )
 
 type Node struct {
-	Up       Up       `cmd:"up" help:"Bring a node up"`
-	LameDuck LameDuck `cmd:"lameduck" name:"lameduck" help:"Command a node to enter lame duck mode" aliases:"down"`
-	List     List     `cmd:"list" aliases:"ls" help:"List running nodes"`
-	Info     Info     `cmd:"info" help:"Provide information about a running node"`
+	Up        Up        `cmd:"up" help:"Bring a node up"`
+	LameDuck  LameDuck  `cmd:"lameduck" name:"lameduck" help:"Command a node to enter lame duck mode" aliases:"down"`
+	List      List      `cmd:"list" aliases:"ls" help:"List running nodes"`
+	Info      Info      `cmd:"info" help:"Provide information about a running node"`
+	JoinToken JoinToken `cmd:"join-token" help:"Issue a token that lets a remote agent key register with nodes using an agent policy"`
+	Tag       Tag       `cmd:"tag" help:"Change the tags of a running node" aliases:"tags"`
 }
 
 type (
 	Up struct {
 		Agents                       AgentConfigs      `name:"agents" help:"Workload types configurations for nex node to initialize"`
 		AgentRestartLimit            int               `name:"agent-restart-limit" help:"Maximum number of times an agent can be restarted before it is stopped permanently" default:"3"`
+		DeployWorkers                int               `name:"deploy-workers" help:"Number of workloads the node starts at once" default:"4"`
+		DeployQueueSize              int               `name:"deploy-queue-size" help:"Number of accepted deploys that may wait for a deploy worker" default:"64"`
 		DisableNativeStart           bool              `name:"disable-native-start" help:"Disable native start agent" default:"false"`
 		AllowRemoteAgentRegistration bool              `name:"allow-remote-agent-registration" help:"Allow agents to register with the node after start" default:"false"`
 		ShowWorkloadLogs             bool              `name:"show-workload-logs" help:"Hide logs from workloads" default:"false"`
@@ -50,25 +65,70 @@ type (
 		NodeXKeySeed                 string            `name:"node-xkey-seed" help:"Node XKey Seed used for encryption.  Default is generated" placeholder:"XAIHERHS..."`
 		ResourceDir                  string            `name:"resource-directory" default:"${defaultResourcePath}"`
 		Tags                         map[string]string `name:"tags" placeholder:"nex:iscool;..." help:"Tags to be used for nex node"`
+		TagProviders                 []string          `name:"tag-provider" help:"Command that prints key=value node tags; run every tag refresh interval" placeholder:"/etc/nex/rack-tags.sh" sep:"none"`
+		TagRefreshInterval           time.Duration     `name:"tag-refresh-interval" help:"How often host facts and tag provider tags are refreshed" default:"30s"`
 		State                        string            `name:"state" help:"Adds persistence; for usecase such as disaster recovery" enum:",kv" default:""`
 		EventEmitter                 string            `name:"events" help:"Emit events" enum:",nats,logs" default:""`
+		SecretStore                  string            `name:"secret-store" help:"Store workload secrets; managed with 'nex secret'" enum:",kv" default:""`
+		SecretStoreBucket            string            `name:"secret-store-bucket" help:"KV bucket used by the kv secret store" default:"nex-secrets"`
+		SecretStoreXKeySeed          string            `name:"secret-store-xkey-seed" help:"XKey Seed used to encrypt secrets.  Required by the kv secret store and must be shared by all nodes using the bucket" placeholder:"XAIHERHS..."`
+		AuditLog                     string            `name:"audit-log" help:"Record control plane mutations; query with 'nex audit ls'" enum:",jetstream" default:""`
+		AuditStream                  string            `name:"audit-stream" help:"JetStream stream used by the jetstream audit log" default:"NEX_AUDIT"`
+		AuditMaxAge                  time.Duration     `name:"audit-max-age" help:"How long audit records are kept; 0 keeps them forever" default:"0s"`
+		Auctioneer                   string            `name:"auctioneer" help:"Decline auctions and deploys that exceed namespace quotas; managed with 'nex quota'" enum:",quota" default:""`
+		QuotaBucket                  string            `name:"quota-bucket" help:"KV bucket used by the quota auctioneer" default:"nex-quotas"`
+		JobScheduler                 bool              `name:"job-scheduler" help:"Run the job schedules of the nexus; one node running the scheduler is elected to start the runs. Runs are authorized as the caller that signed the schedule and started with --signing-key" default:"false"`
+		ScheduleBucket               string            `name:"schedule-bucket" help:"KV bucket used by the job scheduler" default:"nex-schedules"`
+		FunctionActivator            bool              `name:"function-activator" help:"Start the lazy functions of the nexus on demand and stop them when idle; one node running the activator is elected to listen for their triggers. Instances are started with --signing-key" default:"false"`
+		FunctionBucket               string            `name:"function-bucket" help:"KV bucket used by the function activator" default:"nex-functions"`
+		Autoscaler                   bool              `name:"autoscaler" help:"Keep the autoscaled services of the nexus between their minimum and maximum instances; one node running the autoscaler is elected to scale them. Instances are started and stopped with --signing-key" default:"false"`
+		AutoscaleBucket              string            `name:"autoscale-bucket" help:"KV bucket used by the autoscaler" default:"nex-autoscalers"`
+		AdmissionPolicyFile          string            `name:"admission-policy" help:"JSON policy of the artifacts, arguments, lifecycles and tags start requests must follow in each namespace" type:"existingfile" placeholder:"/etc/nex/admission-policy.json"`
+		AdmissionPolicyBucket        string            `name:"admission-policy-bucket" help:"KV bucket holding admission rules for each namespace; checked after --admission-policy" placeholder:"nex-admission"`
+		AgentPolicyFile              string            `name:"agent-policy" help:"JSON policy of the agent keys and join token issuers allowed to register remote agents; tokens signed by the node key are always trusted" type:"existingfile" placeholder:"/etc/nex/agent-policy.json"`
+		ControlPolicyFile            string            `name:"control-policy" help:"JSON policy mapping user nkeys to the namespaces and actions they may use; control requests must be signed when set" type:"existingfile" placeholder:"/etc/nex/control-policy.json"`
 		InternalNatsServerConf       string            `name:"inats-config" help:"Path to the NATS configuration file" type:"existingfile" placeholder:"/etc/nex/nats.conf"`
 		IssuerSigningKey             string            `group:"Credential Issuer Nexlet/Workload Auth" name:"issuer-signing-key" help:"SIGNING KEY | Seed key for signing" placeholder:"SASIGNINGKEY..."`
 		IssuerRootAccountKey         string            `group:"Credential Issuer Nexlet/Workload Auth" name:"issuer-signing-key-root-account" help:"SIGNING KEY | Public key for root account" placeholder:"AAMYACCOUNT..."`
 		IssuerNkey                   string            `group:"Credential Issuer Nexlet/Workload Auth" name:"issuer-nkey" help:"NKEY | User Nkey used in credential vendor" placeholder:"UMYNKEY..."`
 		IssuerNkeySeed               string            `group:"Credential Issuer Nexlet/Workload Auth" name:"issuer-nkey-seed" help:"NKEY | User Nkey Seed Used in credential vendor" placeholder:"SUMYNKEYSEED..."`
+		IssuerOperatorSigningKey     string            `group:"Credential Issuer Nexlet/Workload Auth" name:"issuer-operator-signing-key" help:"OPERATOR | Operator signing seed used to create an account for each namespace; requires a signing key for the nex account" placeholder:"SOSIGNINGKEY..."`
+		IssuerNamespaceAccounts      map[string]string `group:"Credential Issuer Nexlet/Workload Auth" name:"issuer-namespace-accounts" help:"OPERATOR | Existing accounts for namespaces; requires a signing key for the nex account" placeholder:"demo=AAMYACCOUNT...:SASIGNINGKEY...;..."`
+		IssuerResolverCreds          string            `group:"Credential Issuer Nexlet/Workload Auth" name:"issuer-resolver-creds" help:"OPERATOR | Credentials of a NATS system account user used to publish namespace accounts; defaults to the node connection" type:"existingfile" placeholder:"sys.creds"`
+		WorkloadCredTTL              time.Duration     `group:"Credential Issuer Nexlet/Workload Auth" name:"workload-cred-ttl" help:"SIGNING KEY | How long workload credentials are valid before they must be renewed; credentials of stopped workloads stop working within this time" default:"1h"`
+		NamespacePolicyBucket        string            `group:"Credential Issuer Nexlet/Workload Auth" name:"namespace-policy-bucket" help:"SIGNING KEY | KV bucket holding namespace policies that expand workload permissions" placeholder:"nex-policies"`
 	}
 	Info struct {
 		NodeID string `arg:"node-id" required:"" help:"Node ID to query" placeholder:"NBTAFHAKW..."`
 		Full   bool   `name:"full" help:"Show full information about the nodes agents" default:"false"`
 	}
 	LameDuck struct {
-		Delay  time.Duration     `name:"delay" help:"Delay before stopping workloads.  Allows for user to migrate workloads" default:"1m"`
-		Tag    map[string]string `name:"tag" help:"Put all nodes with tag in lameduck.  Only 1 tag allowed" placeholder:"nex.nexus=mynexus"`
-		NodeID string            `name:"node-id" arg:"" help:"Node ID to command into lame duck mode" placeholder:"NBTAFHAKW..."`
+		Delay       time.Duration     `name:"delay" help:"Delay before stopping workloads.  Allows for user to migrate workloads" default:"1m"`
+		Tag         map[string]string `name:"tag" help:"Put all nodes with tag in lameduck.  Only 1 tag allowed" placeholder:"nex.nexus=mynexus"`
+		Constraints []string          `name:"constraint" help:"Only put the node in lameduck if it satisfies the constraint expression; may be repeated" placeholder:"nex.lameduck != true" sep:"none"`
+		NodeID      string            `name:"node-id" arg:"" help:"Node ID to command into lame duck mode" placeholder:"NBTAFHAKW..."`
+	}
+	JoinToken struct {
+		AgentKey      string        `arg:"" help:"Public user nkey of the remote agent" placeholder:"UAGENTKEY..."`
+		IssuerSeed    string        `name:"issuer-seed" required:"" help:"File containing the node or operator seed the token is signed with" type:"existingfile" placeholder:"issuer.nk"`
+		RegisterTypes []string      `name:"type" required:"" help:"Register types the agent may register; * allows every type"`
+		TTL           time.Duration `name:"ttl" help:"How long the token is valid; 0 never expires" default:"24h"`
+	}
+	Tag struct {
+		Set    TagSet    `cmd:"set" help:"Add or overwrite tags on a running node"`
+		Remove TagRemove `cmd:"rm" name:"rm" aliases:"remove" help:"Remove tags from a running node"`
+	}
+	TagSet struct {
+		NodeID string   `arg:"" help:"Node ID to tag" placeholder:"NBTAFHAKW..."`
+		Tags   []string `arg:"" help:"Tags to set" placeholder:"key=value"`
+	}
+	TagRemove struct {
+		NodeID string   `arg:"" help:"Node ID to remove tags from" placeholder:"NBTAFHAKW..."`
+		Keys   []string `arg:"" help:"Keys of the tags to remove; key=value is also accepted" placeholder:"key"`
 	}
 	List struct {
-		Filter map[string]string `name:"filter" help:"Filter the list of nodes on tags. Node must match all provided tags to be returned" placeholder:"nex.nexus=mynexus"`
+		Filter      map[string]string `name:"filter" help:"Filter the list of nodes on tags. Node must match all provided tags to be returned" placeholder:"nex.nexus=mynexus"`
+		Constraints []string          `name:"constraint" help:"Filter the list of nodes on a constraint expression, e.g. 'nex.cpucount >= 8'; may be repeated" sep:"none"`
 	}
 )
 
@@ -94,6 +154,23 @@ func (u Up) Validate() error {
 		errs = errors.Join(errs, errors.New("signing-key must be provided if root-account-key is provided"))
 	}
 
+	if (u.IssuerOperatorSigningKey != "" || len(u.IssuerNamespaceAccounts) > 0) && u.IssuerSigningKey == "" {
+		errs = errors.Join(errs, errors.New("signing-key must be provided if operator-signing-key or namespace-accounts are provided"))
+	}
+
+	for ns, acct := range u.IssuerNamespaceAccounts {
+		pub, seed, ok := strings.Cut(acct, ":")
+		if !ok || !nkeys.IsValidPublicAccountKey(pub) {
+			errs = errors.Join(errs, fmt.Errorf("namespace account for %s must be formatted as ACCOUNT:SIGNINGSEED", ns))
+			continue
+		}
+		prefix, _, err := nkeys.DecodeSeed([]byte(seed))
+		errs = errors.Join(errs, err)
+		if err == nil && prefix != nkeys.PrefixByteAccount {
+			errs = errors.Join(errs, fmt.Errorf("namespace account signing key for %s must be an account seed", ns))
+		}
+	}
+
 	if u.IssuerNkey != "" && u.IssuerNkeySeed == "" {
 		errs = errors.Join(errs, errors.New("nkey-seed must be provided if nkey is provided"))
 	}
@@ -110,6 +187,19 @@ func (u Up) Validate() error {
 		}
 	}
 
+	// secrets encrypted with a generated key are lost when the node restarts
+	if u.SecretStore == "kv" && u.SecretStoreXKeySeed == "" {
+		errs = errors.Join(errs, errors.New("kv secret store requires --secret-store-xkey-seed"))
+	}
+
+	if u.SecretStoreXKeySeed != "" {
+		prefix, _, err := nkeys.DecodeSeed([]byte(u.SecretStoreXKeySeed))
+		errs = errors.Join(errs, err)
+		if prefix != nkeys.PrefixByteCurve {
+			errs = errors.Join(errs, errors.New("secret store xkey seed must be a curve seed"))
+		}
+	}
+
 	if u.InternalNatsServerConf != "" {
 		_, err := server.ProcessConfigFile(u.InternalNatsServerConf)
 		errs = errors.Join(errs, err)
@@ -182,10 +272,120 @@ func (u Up) Run(ctx context.Context, globals *Globals) error {
 		nex.WithNodeKeyPair(nodeKeyPair),
 		nex.WithNodeXKeyPair(nodeXkeyPair),
 		nex.WithAgentRestartLimit(u.AgentRestartLimit),
+		nex.WithDeployWorkers(u.DeployWorkers, u.DeployQueueSize),
+	}
+
+	var secretStore models.SecretStore
+	switch u.SecretStore {
+	case "kv":
+		if nc == nil {
+			return errors.New("kv secret store requires a NATS connection")
+		}
+
+		secretXkeyPair, err := nkeys.FromCurveSeed([]byte(u.SecretStoreXKeySeed))
+		if err != nil {
+			return err
+		}
+
+		secretStore, err = secretstore.NewNatsKVSecretStore(nc, u.SecretStoreBucket, secretXkeyPair, logger.WithGroup("secret-store"))
+		if err != nil {
+			return err
+		}
+		opts = append(opts, nex.WithSecretStore(secretStore))
+	}
+
+	switch u.AuditLog {
+	case "jetstream":
+		if nc == nil {
+			return errors.New("jetstream audit log requires a NATS connection")
+		}
+
+		auditLog, err := audit.NewJetStreamAuditLog(ctx, nc, u.AuditStream, u.AuditMaxAge)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, nex.WithAuditLog(auditLog))
+	}
+
+	switch u.Auctioneer {
+	case "quota":
+		if nc == nil {
+			return errors.New("quota auctioneer requires a NATS connection")
+		}
+
+		quotaAuctioneer, err := auctioneer.NewQuotaAuctioneer(ctx, nc, u.QuotaBucket, logger.WithGroup("auctioneer"))
+		if err != nil {
+			return err
+		}
+		opts = append(opts, nex.WithAuctioneer(quotaAuctioneer))
+	}
+
+	if u.JobScheduler {
+		if nc == nil {
+			return errors.New("job scheduler requires a NATS connection")
+		}
+
+		launcherOpts, err := clientOptions(globals)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, nex.WithJobScheduler(u.ScheduleBucket, client.NewLauncher(nc, launcherOpts...)))
+	}
+
+	if u.FunctionActivator {
+		if nc == nil {
+			return errors.New("function activator requires a NATS connection")
+		}
+
+		launcherOpts, err := clientOptions(globals)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, nex.WithFunctionActivator(u.FunctionBucket, client.NewLauncher(nc, launcherOpts...)))
+	}
+
+	if u.Autoscaler {
+		if nc == nil {
+			return errors.New("autoscaler requires a NATS connection")
+		}
+
+		launcherOpts, err := clientOptions(globals)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, nex.WithAutoscaler(u.AutoscaleBucket, client.NewLauncher(nc, launcherOpts...)))
+	}
+
+	if u.AdmissionPolicyFile != "" {
+		admitter, err := admission.NewPolicyFileAdmitter(u.AdmissionPolicyFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, nex.WithWorkloadAdmitter(admitter))
+	}
+
+	if u.AdmissionPolicyBucket != "" {
+		if nc == nil {
+			return errors.New("admission policy bucket requires a NATS connection")
+		}
+
+		admitter, err := admission.NewNatsKVAdmitter(ctx, nc, u.AdmissionPolicyBucket)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, nex.WithWorkloadAdmitter(admitter))
+	}
+
+	if u.ControlPolicyFile != "" {
+		authorizer, err := cauthorizer.NewPolicyFileAuthorizer(u.ControlPolicyFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, nex.WithControlAuthorizer(authorizer))
 	}
 
 	if !u.DisableNativeStart {
-		nativeAgent, err := native.NewNativeWorkloadRunner(ctx, u.NexusName, nodePub, logger.WithGroup("native-agent"), nil)
+		nativeAgent, err := native.NewNativeWorkloadRunner(ctx, u.NexusName, nodePub, logger.WithGroup("native-agent"), secretStore)
 		if err != nil {
 			return err
 		}
@@ -196,6 +396,14 @@ func (u Up) Run(ctx context.Context, globals *Globals) error {
 		opts = append(opts, nex.WithAllowRemoteAgentRegistration())
 	}
 
+	if u.AgentPolicyFile != "" {
+		registrar, err := aregistrar.NewPolicyFileRegistrar(u.AgentPolicyFile, nodePub)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, nex.WithAgentRegistrar(registrar))
+	}
+
 	switch u.State {
 	case "kv":
 		kvState, err := state.NewNatsKVState(nc, fmt.Sprintf("nex-%s", nodePub), logger)
@@ -250,6 +458,46 @@ func (u Up) Run(ctx context.Context, globals *Globals) error {
 	}
 
 	switch {
+	case u.IssuerSigningKey != "" && (u.IssuerOperatorSigningKey != "" || len(u.IssuerNamespaceAccounts) > 0):
+		minter := &credentials.OperatorMinter{
+			NodeId:              nodePub,
+			Nexus:               u.NexusName,
+			NatsServers:         globals.NatsServers,
+			SystemAccountKey:    u.IssuerRootAccountKey,
+			SystemSigningSeed:   u.IssuerSigningKey,
+			OperatorSigningSeed: u.IssuerOperatorSigningKey,
+			Accounts:            make(map[string]credentials.NamespaceAccount),
+
+			WorkloadCredTTL: u.WorkloadCredTTL,
+		}
+		for ns, acct := range u.IssuerNamespaceAccounts {
+			pub, seed, _ := strings.Cut(acct, ":")
+			minter.Accounts[ns] = credentials.NamespaceAccount{PublicKey: pub, SigningSeed: seed}
+		}
+		if u.IssuerOperatorSigningKey != "" {
+			resolverNc := nc
+			if u.IssuerResolverCreds != "" {
+				resolverNc, err = nats.Connect(strings.Join(globals.NatsServers, ","), nats.UserCredentials(u.IssuerResolverCreds), nats.Name("nex-account-resolver"))
+				if err != nil {
+					return fmt.Errorf("failed to connect account resolver: %w", err)
+				}
+				defer resolverNc.Close()
+			}
+			if resolverNc == nil {
+				return errors.New("namespace accounts require a NATS connection")
+			}
+			minter.Resolver = &credentials.NatsAccountResolver{Conn: resolverNc}
+		}
+		if u.NamespacePolicyBucket != "" {
+			if nc == nil {
+				return errors.New("namespace policies require a NATS connection")
+			}
+			minter.Policies, err = credentials.NewNatsKVPolicyStore(nc, u.NamespacePolicyBucket)
+			if err != nil {
+				return err
+			}
+		}
+		opts = append(opts, nex.WithMinter(minter))
 	case u.IssuerSigningKey != "" && u.IssuerRootAccountKey != "":
 		minter := &credentials.SigningKeyMinter{
 			NodeId:         nodePub,
@@ -257,6 +505,17 @@ func (u Up) Run(ctx context.Context, globals *Globals) error {
 			NatsServers:    globals.NatsServers,
 			RootAccountKey: u.IssuerRootAccountKey,
 			SigningSeed:    u.IssuerSigningKey,
+
+			WorkloadCredTTL: u.WorkloadCredTTL,
+		}
+		if u.NamespacePolicyBucket != "" {
+			if nc == nil {
+				return errors.New("namespace policies require a NATS connection")
+			}
+			minter.Policies, err = credentials.NewNatsKVPolicyStore(nc, u.NamespacePolicyBucket)
+			if err != nil {
+				return err
+			}
 		}
 		opts = append(opts, nex.WithMinter(minter))
 	case u.IssuerNkey != "":
@@ -296,6 +555,15 @@ func (u Up) Run(ctx context.Context, globals *Globals) error {
 		opts = append(opts, nex.WithTag(k, v))
 	}
 
+	opts = append(opts, nex.WithResourceDirectory(u.ResourceDir), nex.WithTagRefreshInterval(u.TagRefreshInterval))
+	for _, provider := range u.TagProviders {
+		argv := strings.Fields(provider)
+		if len(argv) == 0 {
+			return errors.New("tag provider command is empty")
+		}
+		opts = append(opts, nex.WithTagProvider(tagprovider.NewExecProvider(u.TagRefreshInterval, argv[0], argv[1:]...)))
+	}
+
 	nex, err := nex.NewNexNode(opts...)
 	if err != nil {
 		return err
@@ -320,9 +588,77 @@ func (u Up) Run(ctx context.Context, globals *Globals) error {
 		}
 	}()
 
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			path := configPath(globals)
+			if path == "" {
+				logger.Warn("No config file to reload tags from")
+				continue
+			}
+			tags, err := configTags(path)
+			if err != nil {
+				logger.Error("Failed to reload tags", "error", err, "config", path)
+				continue
+			}
+			_, err = nex.ReplaceTags(tags)
+			if err != nil {
+				logger.Error("Failed to reload tags", "error", err, "config", path)
+			}
+		}
+	}()
+
 	return nex.WaitForShutdown()
 }
 
+// configPath returns the config file the node was started with: the --config
+// flag, or else the first default config file that exists
+func configPath(globals *Globals) string {
+	if globals.Config != "" {
+		return string(globals.Config)
+	}
+
+	userConfigPath, err := os.UserConfigDir()
+	if err != nil {
+		userConfigPath = "."
+	}
+	for _, path := range defaultConfigPaths(filepath.Join(userConfigPath, "nex")) {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// configTags reads the node tags from a config file, either under node.up.tags
+// or at the top level
+func configTags(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config := struct {
+		Tags map[string]string `json:"tags"`
+		Node struct {
+			Up struct {
+				Tags map[string]string `json:"tags"`
+			} `json:"up"`
+		} `json:"node"`
+	}{}
+	err = json.NewDecoder(f).Decode(&config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	if config.Node.Up.Tags != nil {
+		return config.Node.Up.Tags, nil
+	}
+	return config.Tags, nil
+}
+
 func (i Info) Run(ctx context.Context, globals *Globals) error {
 	nc, err := configureNatsConnection(globals)
 	if err != nil {
@@ -333,9 +669,9 @@ func (i Info) Run(ctx context.Context, globals *Globals) error {
 		return errors.New("no NATS connection available")
 	}
 
-	var opts []client.ClientOption
-	if globals.NatsTimeout > 0 {
-		opts = append(opts, client.WithDefaultTimeout(globals.NatsTimeout))
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
 	}
 	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
 	if err != nil {
@@ -414,15 +750,15 @@ func (l LameDuck) Run(ctx context.Context, globals *Globals) error {
 		return errors.New("no NATS connection available")
 	}
 
-	var opts []client.ClientOption
-	if globals.NatsTimeout > 0 {
-		opts = append(opts, client.WithDefaultTimeout(globals.NatsTimeout))
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
 	}
 	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
 	if err != nil {
 		return err
 	}
-	ldr, err := nexClient.SetLameduck(l.NodeID, l.Delay, l.Tag)
+	ldr, err := nexClient.SetLameduck(l.NodeID, l.Delay, l.Tag, client.WithLameduckConstraints(l.Constraints...))
 	if err != nil {
 		return err
 	}
@@ -445,6 +781,121 @@ func (l LameDuck) Run(ctx context.Context, globals *Globals) error {
 	return nil
 }
 
+func (t TagSet) Validate() error {
+	_, err := t.tags()
+	return err
+}
+
+func (t TagSet) tags() (map[string]string, error) {
+	tags := make(map[string]string, len(t.Tags))
+	for _, tag := range t.Tags {
+		k, v, ok := strings.Cut(tag, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid tag %q; expected key=value", tag)
+		}
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+func (t TagSet) Run(ctx context.Context, globals *Globals) error {
+	tags, err := t.tags()
+	if err != nil {
+		return err
+	}
+	return updateNodeTags(ctx, globals, t.NodeID, tags, nil)
+}
+
+func (t TagRemove) Run(ctx context.Context, globals *Globals) error {
+	keys := make([]string, 0, len(t.Keys))
+	for _, key := range t.Keys {
+		k, _, _ := strings.Cut(key, "=")
+		keys = append(keys, k)
+	}
+	return updateNodeTags(ctx, globals, t.NodeID, nil, keys)
+}
+
+func updateNodeTags(ctx context.Context, globals *Globals, nodeID string, set map[string]string, remove []string) error {
+	nc, err := configureNatsConnection(globals)
+	if err != nil {
+		return err
+	}
+
+	if nc == nil {
+		return errors.New("no NATS connection available")
+	}
+
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
+	}
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	if err != nil {
+		return err
+	}
+	resp, err := nexClient.UpdateNodeTags(nodeID, set, remove)
+	if err != nil {
+		return err
+	}
+
+	if globals.JSON {
+		respB, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(respB))
+		return nil
+	}
+
+	tags := make([]string, 0, len(resp.Tags))
+	for k, v := range resp.Tags {
+		tags = append(tags, fmt.Sprintf("%s=%s", k, v))
+	}
+	slices.Sort(tags)
+
+	fmt.Printf("Tags of node %s updated\n", resp.NodeId)
+	for _, tag := range tags {
+		fmt.Println(" ", tag)
+	}
+	return nil
+}
+
+func (l LameDuck) Validate() error {
+	_, err := constraints.ParseAll(l.Constraints)
+	return err
+}
+
+func (j JoinToken) Validate() error {
+	if !nkeys.IsValidPublicUserKey(j.AgentKey) {
+		return errors.New("agent key must be a public user nkey")
+	}
+	return nil
+}
+
+func (j JoinToken) Run(ctx context.Context, globals *Globals) error {
+	seed, err := os.ReadFile(j.IssuerSeed)
+	if err != nil {
+		return err
+	}
+	issuer, err := nkeys.FromSeed(bytes.TrimSpace(seed))
+	if err != nil {
+		return err
+	}
+
+	token, err := aregistrar.NewJoinToken(issuer, j.AgentKey, j.RegisterTypes, j.TTL)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(token)
+	return nil
+}
+
+func (l List) Validate() error {
+	_, err := constraints.ParseAll(l.Constraints)
+	return err
+}
+
 func (l List) Run(ctx context.Context, globals *Globals) error {
 	nc, err := configureNatsConnection(globals)
 	if err != nil {
@@ -455,15 +906,15 @@ func (l List) Run(ctx context.Context, globals *Globals) error {
 		return errors.New("no NATS connection available")
 	}
 
-	var opts []client.ClientOption
-	if globals.NatsTimeout > 0 {
-		opts = append(opts, client.WithDefaultTimeout(globals.NatsTimeout))
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
 	}
 	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
 	if err != nil {
 		return err
 	}
-	resp, err := nexClient.ListNodes(l.Filter)
+	resp, err := nexClient.ListNodes(l.Filter, client.WithNodeConstraints(l.Constraints...))
 	if err != nil {
 		return err
 	}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
@@ -47,6 +48,13 @@ func TestNodeCommandDefaults(t *testing.T) {
 		be.Zero(t, nex.Node.Up.InternalNatsServerConf)
 		be.Zero(t, nex.Node.Up.IssuerSigningKey)
 		be.Zero(t, nex.Node.Up.IssuerRootAccountKey)
+		be.Equal(t, time.Hour, nex.Node.Up.WorkloadCredTTL)
+		be.False(t, nex.Node.Up.JobScheduler)
+		be.Equal(t, "nex-schedules", nex.Node.Up.ScheduleBucket)
+		be.False(t, nex.Node.Up.FunctionActivator)
+		be.Equal(t, "nex-functions", nex.Node.Up.FunctionBucket)
+		be.False(t, nex.Node.Up.Autoscaler)
+		be.Equal(t, "nex-autoscalers", nex.Node.Up.AutoscaleBucket)
 	})
 
 	t.Run("InfoCommand", func(t *testing.T) {
@@ -71,6 +79,58 @@ func TestNodeCommandDefaults(t *testing.T) {
 
 		be.DeepEqual(t, map[string]string(nil), nex.Node.List.Filter)
 	})
+
+	t.Run("TagCommands", func(t *testing.T) {
+		_, err := parser.Parse([]string{"node", "tag", "set", TestServerPublicKey, "zone=a", "pool=gpu"})
+		be.NilErr(t, err)
+
+		tags, err := nex.Node.Tag.Set.tags()
+		be.NilErr(t, err)
+		be.DeepEqual(t, map[string]string{"zone": "a", "pool": "gpu"}, tags)
+
+		_, err = parser.Parse([]string{"node", "tag", "set", TestServerPublicKey, "zone"})
+		be.Nonzero(t, err)
+
+		_, err = parser.Parse([]string{"node", "tag", "rm", TestServerPublicKey, "zone"})
+		be.NilErr(t, err)
+		be.AllEqual(t, []string{"zone"}, nex.Node.Tag.Remove.Keys)
+	})
+}
+
+func TestNodeUpSecretStoreRequiresSeed(t *testing.T) {
+	nex := NexCLI{}
+	parser := kong.Must(&nex,
+		kong.Vars(kongVars),
+		kong.Bind(&nex.Globals),
+	)
+
+	_, err := parser.Parse([]string{"node", "up", "--secret-store", "kv"})
+	be.Nonzero(t, err)
+
+	seed, err := nkeys.CreateCurveKeys()
+	be.NilErr(t, err)
+	xkeySeed, err := seed.Seed()
+	be.NilErr(t, err)
+	_, err = parser.Parse([]string{"node", "up", "--secret-store", "kv", "--secret-store-xkey-seed", string(xkeySeed)})
+	be.NilErr(t, err)
+}
+
+func TestConfigTags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	be.NilErr(t, os.WriteFile(path, []byte(`{"node":{"up":{"tags":{"zone":"a"}}}}`), 0o600))
+	tags, err := configTags(path)
+	be.NilErr(t, err)
+	be.DeepEqual(t, map[string]string{"zone": "a"}, tags)
+
+	be.NilErr(t, os.WriteFile(path, []byte(`{"tags":{"zone":"b"}}`), 0o600))
+	tags, err = configTags(path)
+	be.NilErr(t, err)
+	be.DeepEqual(t, map[string]string{"zone": "b"}, tags)
+
+	be.NilErr(t, os.WriteFile(path, []byte(`{"node":`), 0o600))
+	_, err = configTags(path)
+	be.Nonzero(t, err)
 }
 
 func TestNodeUp(t *testing.T) {
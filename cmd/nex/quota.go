@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/synadia-io/nex/client"
+	"github.com/synadia-io/nex/models"
+)
+
+type Quota struct {
+	Set SetQuota `cmd:"" name:"set" help:"Set the quota of the namespace"`
+	Get GetQuota `cmd:"" name:"get" help:"Show the quota of the namespace and its usage"`
+}
+
+type (
+	SetQuota struct {
+		MaxWorkloads        int            `name:"max-workloads" help:"Maximum number of workloads in the namespace; 0 is unlimited" default:"0"`
+		MaxWorkloadsPerType map[string]int `name:"max-workloads-per-type" help:"Maximum number of workloads in the namespace for an agent type" placeholder:"native=5;..."`
+		MaxCpus             float64        `name:"max-cpus" help:"Maximum CPUs declared by the workloads in the namespace; 0 is unlimited" default:"0"`
+		MaxMemoryMb         int            `name:"max-memory-mb" help:"Maximum memory in megabytes declared by the workloads in the namespace; 0 is unlimited" default:"0"`
+		Bucket              string         `name:"bucket" help:"KV bucket used by the quota auctioneer" default:"nex-quotas"`
+	}
+	GetQuota struct {
+		Bucket string `name:"bucket" help:"KV bucket used by the quota auctioneer" default:"nex-quotas"`
+	}
+)
+
+func (s *SetQuota) Validate() error {
+	var errs error
+	if s.MaxWorkloads < 0 || s.MaxCpus < 0 || s.MaxMemoryMb < 0 {
+		errs = errors.Join(errs, errors.New("quota limits cannot be negative"))
+	}
+	for typ, limit := range s.MaxWorkloadsPerType {
+		if limit < 0 {
+			errs = errors.Join(errs, fmt.Errorf("quota limit for %s workloads cannot be negative", typ))
+		}
+	}
+	return errs
+}
+
+func (s *SetQuota) Run(ctx context.Context, globals *Globals) error {
+	nc, err := configureNatsConnection(globals)
+	if err != nil {
+		return err
+	}
+
+	if nc == nil {
+		return errors.New("no NATS connection available")
+	}
+
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
+	}
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	if err != nil {
+		return err
+	}
+
+	quota := &models.NamespaceQuota{
+		MaxWorkloads:        s.MaxWorkloads,
+		MaxWorkloadsPerType: s.MaxWorkloadsPerType,
+		MaxCpus:             s.MaxCpus,
+		MaxMemoryMb:         s.MaxMemoryMb,
+	}
+	err = nexClient.SetQuota(s.Bucket, quota)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Quota set for namespace %s\n", globals.Namespace)
+	return nil
+}
+
+func (g *GetQuota) Run(ctx context.Context, globals *Globals) error {
+	nc, err := configureNatsConnection(globals)
+	if err != nil {
+		return err
+	}
+
+	if nc == nil {
+		return errors.New("no NATS connection available")
+	}
+
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
+	}
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	if err != nil {
+		return err
+	}
+	quota, usage, err := nexClient.GetQuota(g.Bucket)
+	if err != nil {
+		return err
+	}
+
+	if globals.JSON {
+		respB, err := json.Marshal(map[string]any{"quota": quota, "usage": usage})
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(respB))
+		return nil
+	}
+
+	if quota == nil {
+		fmt.Printf("No quota set for namespace %s\n", globals.Namespace)
+		quota = new(models.NamespaceQuota)
+	}
+
+	limit := func(l any) any {
+		switch v := l.(type) {
+		case int:
+			if v == 0 {
+				return "unlimited"
+			}
+		case float64:
+			if v == 0 {
+				return "unlimited"
+			}
+		}
+		return l
+	}
+
+	tW := table.NewWriter()
+	tW.SetStyle(table.StyleRounded)
+	tW.Style().Title.Align = text.AlignCenter
+	tW.Style().Format.Header = text.FormatDefault
+	tW.SetTitle("Quota - " + globals.Namespace)
+	tW.AppendHeader(table.Row{"Limit", "Used", "Quota"})
+	tW.AppendRow(table.Row{"Workloads", usage.Workloads, limit(quota.MaxWorkloads)})
+
+	types := []string{}
+	for typ := range quota.MaxWorkloadsPerType {
+		types = append(types, typ)
+	}
+	for typ := range usage.WorkloadsPerType {
+		if _, ok := quota.MaxWorkloadsPerType[typ]; !ok {
+			types = append(types, typ)
+		}
+	}
+	sort.Strings(types)
+	for _, typ := range types {
+		l, ok := quota.MaxWorkloadsPerType[typ]
+		if !ok {
+			tW.AppendRow(table.Row{typ + " workloads", usage.WorkloadsPerType[typ], "unlimited"})
+			continue
+		}
+		tW.AppendRow(table.Row{typ + " workloads", usage.WorkloadsPerType[typ], l})
+	}
+
+	tW.AppendRow(table.Row{"CPUs", usage.Cpus, limit(quota.MaxCpus)})
+	tW.AppendRow(table.Row{"Memory (MB)", usage.MemoryMb, limit(quota.MaxMemoryMb)})
+	fmt.Println(tW.Render())
+	return nil
+}
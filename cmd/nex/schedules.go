@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/synadia-io/nex/client"
+	"github.com/synadia-io/nex/models"
+)
+
+type (
+	ListSchedules struct {
+		Bucket string `name:"bucket" help:"KV bucket used by the job scheduler" default:"nex-schedules"`
+	}
+	DeleteSchedule struct {
+		Name   string `arg:"" name:"name" help:"Name of the job schedule"`
+		Bucket string `name:"bucket" help:"KV bucket used by the job scheduler" default:"nex-schedules"`
+	}
+	ListJobRuns struct {
+		Name   string `arg:"" name:"name" help:"Name of the job schedule"`
+		Bucket string `name:"bucket" help:"KV bucket used by the job scheduler" default:"nex-schedules"`
+	}
+)
+
+func (l *ListSchedules) Run(ctx context.Context, globals *Globals) error {
+	nc, err := configureNatsConnection(globals)
+	if err != nil {
+		return err
+	}
+
+	if nc == nil {
+		return errors.New("no NATS connection available")
+	}
+
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
+	}
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	if err != nil {
+		return err
+	}
+	schedules, err := nexClient.ListSchedules(l.Bucket)
+	if err != nil {
+		return err
+	}
+
+	if globals.JSON {
+		respB, err := json.Marshal(schedules)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(respB))
+		return nil
+	}
+
+	if len(schedules) == 0 {
+		fmt.Println("No job schedules found")
+		return nil
+	}
+
+	tW := table.NewWriter()
+	tW.SetStyle(table.StyleRounded)
+	tW.Style().Title.Align = text.AlignCenter
+	tW.Style().Format.Header = text.FormatDefault
+	tW.SetTitle("Job Schedules - " + globals.Namespace)
+	tW.AppendHeader(table.Row{"Name", "Cron", "Timezone", "Concurrency Policy", "History Limit", "Type", "Created"})
+	for _, s := range schedules {
+		tz := s.Timezone
+		if tz == "" {
+			tz = "UTC"
+		}
+		tW.AppendRow(table.Row{s.Name, s.Cron, tz, s.ConcurrencyPolicy, s.HistoryLimit, s.Workload.WorkloadType, s.Created.Format(time.RFC3339)})
+	}
+	fmt.Println(tW.Render())
+	return nil
+}
+
+func (d *DeleteSchedule) Run(ctx context.Context, globals *Globals) error {
+	nc, err := configureNatsConnection(globals)
+	if err != nil {
+		return err
+	}
+
+	if nc == nil {
+		return errors.New("no NATS connection available")
+	}
+
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
+	}
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	if err != nil {
+		return err
+	}
+	err = nexClient.DeleteSchedule(d.Bucket, d.Name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Job schedule %s removed\n", d.Name)
+	return nil
+}
+
+func (l *ListJobRuns) Run(ctx context.Context, globals *Globals) error {
+	nc, err := configureNatsConnection(globals)
+	if err != nil {
+		return err
+	}
+
+	if nc == nil {
+		return errors.New("no NATS connection available")
+	}
+
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
+	}
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	if err != nil {
+		return err
+	}
+	runs, err := nexClient.ListJobRuns(l.Bucket, l.Name)
+	if err != nil {
+		return err
+	}
+
+	if globals.JSON {
+		respB, err := json.Marshal(runs)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(respB))
+		return nil
+	}
+
+	if len(runs) == 0 {
+		fmt.Printf("No runs found for job schedule %s\n", l.Name)
+		return nil
+	}
+
+	tW := table.NewWriter()
+	tW.SetStyle(table.StyleRounded)
+	tW.Style().Title.Align = text.AlignCenter
+	tW.Style().Format.Header = text.FormatDefault
+	tW.SetTitle("Job Runs - " + l.Name)
+	tW.AppendHeader(table.Row{"Id", "State", "Scheduled", "Started", "Ended", "Exit Code", "Node", "Error"})
+	for _, r := range runs {
+		tW.AppendRow(jobRunRow(r))
+	}
+	fmt.Println(tW.Render())
+	return nil
+}
+
+func jobRunRow(r *models.JobRun) table.Row {
+	ended, exitCode, node, errMsg := "--", "--", "--", "--"
+	if r.EndTime != nil {
+		ended = r.EndTime.Format(time.RFC3339)
+	}
+	if r.ExitCode != nil {
+		exitCode = strconv.Itoa(*r.ExitCode)
+	}
+	if r.NodeId != "" {
+		node = r.NodeId
+	}
+	if r.Error != "" {
+		errMsg = r.Error
+	}
+	return table.Row{r.Id, r.State, r.ScheduledTime.Format(time.RFC3339), r.StartTime.Format(time.RFC3339), ended, exitCode, node, errMsg}
+}
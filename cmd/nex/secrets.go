@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/synadia-io/nex/client"
+)
+
+type Secret struct {
+	Put    PutSecret    `cmd:"" name:"put" help:"Store a secret in the namespace" aliases:"set"`
+	Get    GetSecret    `cmd:"" name:"get" help:"Retrieve a secret from the namespace; requires nodes with a control policy"`
+	List   ListSecret   `cmd:"" name:"list" help:"List secrets in the namespace" aliases:"ls"`
+	Delete DeleteSecret `cmd:"" name:"delete" help:"Remove a secret from the namespace" aliases:"rm"`
+}
+
+type (
+	PutSecret struct {
+		Key   string   `arg:"" name:"key" help:"Key of the secret"`
+		Value string   `arg:"" name:"value" optional:"" help:"Value of the secret; use --file to read from a file or stdin"`
+		File  *os.File `name:"file" short:"f" placeholder:"secret.txt" help:"File to read the secret value from; '-' reads from stdin"`
+	}
+	GetSecret struct {
+		Key string `arg:"" name:"key" help:"Key of the secret"`
+	}
+	ListSecret   struct{}
+	DeleteSecret struct {
+		Key string `arg:"" name:"key" help:"Key of the secret"`
+	}
+)
+
+func (p *PutSecret) Validate() error {
+	if p.Value != "" && p.File != nil {
+		return errors.New("provide either a secret value or --file, not both")
+	}
+	return nil
+}
+
+func (p *PutSecret) Run(ctx context.Context, globals *Globals) error {
+	nc, err := configureNatsConnection(globals)
+	if err != nil {
+		return err
+	}
+
+	if nc == nil {
+		return errors.New("no NATS connection available")
+	}
+
+	value := []byte(p.Value)
+	if p.File != nil {
+		defer p.File.Close()
+		value, err = io.ReadAll(p.File)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(value) == 0 {
+		return errors.New("secret value cannot be empty")
+	}
+
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
+	}
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	if err != nil {
+		return err
+	}
+	resp, err := nexClient.PutSecret(p.Key, value)
+	if err != nil {
+		return err
+	}
+
+	if globals.JSON {
+		respB, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(respB))
+		return nil
+	}
+
+	fmt.Printf("Secret %s stored in namespace %s [revision %d]\n", resp.Key, globals.Namespace, resp.Revision)
+	return nil
+}
+
+func (g *GetSecret) Run(ctx context.Context, globals *Globals) error {
+	nc, err := configureNatsConnection(globals)
+	if err != nil {
+		return err
+	}
+
+	if nc == nil {
+		return errors.New("no NATS connection available")
+	}
+
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
+	}
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	if err != nil {
+		return err
+	}
+	value, err := nexClient.GetSecret(g.Key)
+	if err != nil {
+		return err
+	}
+
+	if globals.JSON {
+		respB, err := json.Marshal(map[string]string{"key": g.Key, "value": string(value)})
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(respB))
+		return nil
+	}
+
+	fmt.Println(string(value))
+	return nil
+}
+
+func (l *ListSecret) Run(ctx context.Context, globals *Globals) error {
+	nc, err := configureNatsConnection(globals)
+	if err != nil {
+		return err
+	}
+
+	if nc == nil {
+		return errors.New("no NATS connection available")
+	}
+
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
+	}
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	if err != nil {
+		return err
+	}
+	keys, err := nexClient.ListSecrets()
+	if err != nil {
+		return err
+	}
+
+	if globals.JSON {
+		keysB, err := json.Marshal(keys)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(keysB))
+		return nil
+	}
+
+	if len(keys) == 0 {
+		fmt.Println("No secrets found")
+		return nil
+	}
+
+	tW := table.NewWriter()
+	tW.SetStyle(table.StyleRounded)
+	tW.Style().Title.Align = text.AlignCenter
+	tW.Style().Format.Header = text.FormatDefault
+	tW.SetTitle("Secrets - " + globals.Namespace)
+	tW.AppendHeader(table.Row{"Key"})
+	for _, k := range keys {
+		tW.AppendRow(table.Row{k})
+	}
+	fmt.Println(tW.Render())
+	return nil
+}
+
+func (d *DeleteSecret) Run(ctx context.Context, globals *Globals) error {
+	nc, err := configureNatsConnection(globals)
+	if err != nil {
+		return err
+	}
+
+	if nc == nil {
+		return errors.New("no NATS connection available")
+	}
+
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
+	}
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	if err != nil {
+		return err
+	}
+	err = nexClient.DeleteSecret(d.Key)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Secret %s removed from namespace %s\n", d.Key, globals.Namespace)
+	return nil
+}
@@ -7,15 +7,19 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"math/rand"
 	"os"
 	"slices"
+	"strings"
+	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/jedib0t/go-pretty/v6/text"
 	"github.com/santhosh-tekuri/jsonschema/v6"
 	"github.com/stretchr/testify/assert/yaml"
 	"github.com/synadia-io/nex/client"
+	"github.com/synadia-io/nex/internal/constraints"
 	"github.com/synadia-io/nex/models"
 )
 
@@ -23,8 +27,20 @@ type Workload struct {
 	Start StartWorkload `cmd:"" name:"start" help:"Run a workload on a target node" aliases:"run,deploy"`
 	Stop  StopWorkload  `cmd:"" name:"stop" help:"Stop a running workload" aliases:"undeploy"`
 	List  ListWorkload  `cmd:"" name:"list" help:"List workloads" aliases:"ls"`
+	Wait  WaitWorkload  `cmd:"" name:"wait" help:"Wait for a workload start operation to finish"`
 	// Info  InfoWorkload  `cmd:"" name:"info" help:"Get information about a workload"`
-	Copy CloneWorkload `cmd:"" name:"clone" help:"Copy a workload to another node" aliases:"cp,copy"`
+	Copy   CloneWorkload  `cmd:"" name:"clone" help:"Copy a workload to another node" aliases:"cp,copy"`
+	Invoke InvokeWorkload `cmd:"" name:"invoke" help:"Invoke a function workload and print its reply" aliases:"call"`
+	// Jobs started on a cron schedule
+	Schedules  ListSchedules  `cmd:"" name:"schedules" help:"List job schedules"`
+	Unschedule DeleteSchedule `cmd:"" name:"unschedule" help:"Remove a job schedule"`
+	Runs       ListJobRuns    `cmd:"" name:"runs" help:"List the runs of a job schedule"`
+	// Functions started on their first message
+	Functions      ListLazyFunctions  `cmd:"" name:"functions" help:"List lazy functions and their running instances"`
+	RemoveFunction DeleteLazyFunction `cmd:"" name:"remove-function" help:"Remove a lazy function and stop its instance"`
+	// Services kept between a minimum and maximum number of instances
+	Autoscalers      ListAutoscalers  `cmd:"" name:"autoscalers" help:"List autoscaling policies and their last evaluation"`
+	RemoveAutoscaler DeleteAutoscaler `cmd:"" name:"remove-autoscaler" help:"Remove an autoscaling policy; its instances keep running"`
 	// Bundle BundleWorkload `cmd:"" help:"Bundles a workload into an OCI artifact" aliases:"build,package"`
 }
 
@@ -32,6 +48,11 @@ type (
 	StartWorkload struct {
 		// Options for auction starting a workload
 		AuctionTags map[string]string `name:"tags" help:"Node tags to run the workload on; --node-id will take precedence"`
+		Constraints []string          `name:"constraint" help:"Constraint expression the node must satisfy, e.g. 'nex.cpucount >= 8'; may be repeated" sep:"none"`
+		// Placement relative to the workloads already running on a node
+		Group        string   `name:"group" help:"Group of the workload; affinity rules of other workloads can select it"`
+		Affinity     []string `name:"affinity" help:"Only place the workload on nodes running a matching workload; may be repeated" placeholder:"name=db" sep:"none"`
+		AntiAffinity []string `name:"anti-affinity" help:"Only place the workload on nodes not running a matching workload; may be repeated" placeholder:"group=web" sep:"none"`
 
 		AgentType           string `name:"type" help:"Type of workload" default:"native"`
 		WorkloadName        string `name:"name" help:"Name of the workload"`
@@ -41,6 +62,31 @@ type (
 		// This will need to validate against start request provided by agent at registration
 		WorkloadStartRequest json.RawMessage `name:"start-request" placeholder:"{}" help:"Start request for the workload"`
 		WorkloadNexfile      *os.File        `name:"nexfile" short:"f" placeholder:"Nexfile" help:"Nexfile for the workload; overrides all other workload options"`
+		DryRun               bool            `name:"dry-run" help:"Run the auction and validate the workload on the winning node without starting it" default:"false"`
+		NoWait               bool            `name:"no-wait" help:"Return once the node accepts the workload instead of waiting for it to start" default:"false"`
+
+		// Options for running a job on a schedule instead of once
+		Schedule          string `name:"schedule" help:"Cron expression to run the job on, e.g. '0 2 * * *'; stores the schedule instead of starting the job" placeholder:"@daily"`
+		Timezone          string `name:"timezone" help:"Time zone the schedule is evaluated in" default:"UTC"`
+		ConcurrencyPolicy string `name:"concurrency-policy" help:"What to do when a run is due while an earlier run is still running: allow, forbid, replace" default:"allow" enum:"allow,forbid,replace"`
+		HistoryLimit      int    `name:"history-limit" help:"Number of finished runs to keep" default:"10"`
+		ScheduleBucket    string `name:"schedule-bucket" help:"KV bucket used by the job scheduler" default:"nex-schedules"`
+
+		// Options for starting a function on its first message instead of now
+		Lazy           bool          `name:"lazy" help:"Store the function and start it when a message arrives on one of its trigger subjects; it is stopped again when idle" default:"false"`
+		IdleTimeout    time.Duration `name:"idle-timeout" help:"How long a lazy function may go without an invocation before it is stopped" default:"5m"`
+		FunctionBucket string        `name:"function-bucket" help:"KV bucket used by the function activator" default:"nex-functions"`
+
+		// Options for keeping a service between a minimum and maximum number of instances instead of starting one
+		MaxInstances     int           `name:"max-instances" help:"Store an autoscaling policy keeping at most this many instances of the service running instead of starting one"`
+		MinInstances     int           `name:"min-instances" help:"Fewest instances the autoscaler keeps running" default:"1"`
+		ScaleTarget      float64       `name:"scale-target" help:"Pending messages or metric value one instance handles"`
+		ScaleStream      string        `name:"scale-stream" help:"Stream of the consumer whose pending messages drive the autoscaler"`
+		ScaleConsumer    string        `name:"scale-consumer" help:"Durable consumer whose pending messages drive the autoscaler"`
+		ScaleMetric      string        `name:"scale-metric" help:"Metric emitted by the instances that drives the autoscaler, summed over all instances"`
+		ScaleOutCooldown time.Duration `name:"scale-out-cooldown" help:"Time after a scale out before the next one" default:"1m"`
+		ScaleInCooldown  time.Duration `name:"scale-in-cooldown" help:"Time after any scaling before a scale in" default:"5m"`
+		AutoscaleBucket  string        `name:"autoscale-bucket" help:"KV bucket used by the autoscaler" default:"nex-autoscalers"`
 	}
 	StopWorkload struct {
 		WorkloadId string `arg:"" name:"id" help:"ID of the workload to stop"`
@@ -50,6 +96,9 @@ type (
 		ShowMetadata bool     `name:"show-metadata" default:"false" help:"Show metadata for workloads"`
 		Filter       []string `name:"filter" help:"Workload filter sent to agent for processing" placeholder:"state"`
 	}
+	WaitWorkload struct {
+		OperationId string `arg:"" name:"operation-id" help:"ID of the start operation returned by the node"`
+	}
 	// InfoWorkload struct{}
 	CloneWorkload struct {
 		WorkloadId  string            `arg:"" name:"id" help:"ID of the workload to stop"`
@@ -68,11 +117,11 @@ func (r *StartWorkload) Run(ctx context.Context, globals *Globals) error {
 		return errors.New("no NATS connection available")
 	}
 
-	var opts []client.ClientOption
-	if globals.NatsTimeout > 0 {
-		opts = append(opts, client.WithDefaultTimeout(globals.NatsTimeout))
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
 	}
-	client, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
 	if err != nil {
 		return err
 	}
@@ -104,13 +153,109 @@ func (r *StartWorkload) Run(ctx context.Context, globals *Globals) error {
 			if err != nil {
 				return errors.New("failed to unmarshal Nexfile")
 			}
+
+			// permissions and resources are generated models without yaml tags; decode them through json
+			var yamlModels struct {
+				Permissions map[string]any `yaml:"permissions"`
+				Resources   map[string]any `yaml:"resources"`
+				Affinity    map[string]any `yaml:"affinity"`
+			}
+			err = yaml.Unmarshal(data, &yamlModels)
+			if err != nil {
+				return errors.New("failed to unmarshal Nexfile")
+			}
+			nexfile.Permissions = nil
+			if yamlModels.Permissions != nil {
+				permsB, err := json.Marshal(yamlModels.Permissions)
+				if err != nil {
+					return err
+				}
+				nexfile.Permissions = new(models.WorkloadPermissions)
+				err = json.Unmarshal(permsB, nexfile.Permissions)
+				if err != nil {
+					return errors.New("failed to unmarshal Nexfile permissions")
+				}
+			}
+			nexfile.Resources = nil
+			if yamlModels.Resources != nil {
+				resB, err := json.Marshal(yamlModels.Resources)
+				if err != nil {
+					return err
+				}
+				nexfile.Resources = new(models.WorkloadResources)
+				err = json.Unmarshal(resB, nexfile.Resources)
+				if err != nil {
+					return errors.New("failed to unmarshal Nexfile resources")
+				}
+			}
+			nexfile.Affinity = nil
+			if yamlModels.Affinity != nil {
+				affB, err := json.Marshal(yamlModels.Affinity)
+				if err != nil {
+					return err
+				}
+				nexfile.Affinity = new(models.WorkloadAffinity)
+				err = json.Unmarshal(affB, nexfile.Affinity)
+				if err != nil {
+					return errors.New("failed to unmarshal Nexfile affinity")
+				}
+			}
 		}
 
 		r.WorkloadName = nexfile.Name
 		r.WorkloadDescription = nexfile.Description
 		r.AuctionTags = nexfile.AuctionTags
+		r.Constraints = nexfile.Constraints
+		r.Group = nexfile.Group
 		r.AgentType = nexfile.Type
 		r.WorkloadLifecycle = nexfile.Lifecycle
+		if nexfile.Schedule != nil {
+			r.Schedule = nexfile.Schedule.Cron
+			if nexfile.Schedule.Timezone != "" {
+				r.Timezone = nexfile.Schedule.Timezone
+			}
+			if nexfile.Schedule.ConcurrencyPolicy != "" {
+				r.ConcurrencyPolicy = string(nexfile.Schedule.ConcurrencyPolicy)
+			}
+			if nexfile.Schedule.HistoryLimit != 0 {
+				r.HistoryLimit = nexfile.Schedule.HistoryLimit
+			}
+		}
+		if nexfile.Lazy != nil {
+			r.Lazy = true
+			if nexfile.Lazy.IdleTimeout != "" {
+				r.IdleTimeout, err = time.ParseDuration(nexfile.Lazy.IdleTimeout)
+				if err != nil {
+					return fmt.Errorf("invalid Nexfile idle timeout: %w", err)
+				}
+			}
+		}
+		if nexfile.Autoscale != nil {
+			r.MaxInstances = nexfile.Autoscale.MaxInstances
+			if nexfile.Autoscale.MinInstances != nil {
+				r.MinInstances = *nexfile.Autoscale.MinInstances
+			}
+			r.ScaleTarget = nexfile.Autoscale.Target
+			if nexfile.Autoscale.Consumer != nil {
+				r.ScaleStream = nexfile.Autoscale.Consumer.Stream
+				r.ScaleConsumer = nexfile.Autoscale.Consumer.Consumer
+			}
+			if nexfile.Autoscale.Metric != nil {
+				r.ScaleMetric = nexfile.Autoscale.Metric.Name
+			}
+			if nexfile.Autoscale.ScaleOutCooldown != "" {
+				r.ScaleOutCooldown, err = time.ParseDuration(nexfile.Autoscale.ScaleOutCooldown)
+				if err != nil {
+					return fmt.Errorf("invalid Nexfile scale out cooldown: %w", err)
+				}
+			}
+			if nexfile.Autoscale.ScaleInCooldown != "" {
+				r.ScaleInCooldown, err = time.ParseDuration(nexfile.Autoscale.ScaleInCooldown)
+				if err != nil {
+					return fmt.Errorf("invalid Nexfile scale in cooldown: %w", err)
+				}
+			}
+		}
 
 		srB, err := json.Marshal(nexfile.StartRequest)
 		if err != nil {
@@ -119,7 +264,62 @@ func (r *StartWorkload) Run(ctx context.Context, globals *Globals) error {
 		r.WorkloadStartRequest = json.RawMessage(srB)
 	}
 
-	aucResp, err := client.Auction(r.AgentType, r.AuctionTags)
+	_, err = constraints.ParseAll(r.Constraints)
+	if err != nil {
+		return err
+	}
+
+	affinity := nexfile.Affinity
+	if affinity == nil {
+		affinity, err = r.workloadAffinity()
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.Schedule != "" {
+		sched, err := r.jobSchedule(nexfile, affinity)
+		if err != nil {
+			return err
+		}
+		err = nexClient.PutSchedule(r.ScheduleBucket, sched)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Job %s scheduled: %s (%s)\n", sched.Name, sched.Cron, sched.Timezone)
+		return nil
+	}
+
+	if r.Lazy {
+		fn, err := r.lazyFunction(nexfile, affinity)
+		if err != nil {
+			return err
+		}
+		err = nexClient.PutLazyFunction(r.FunctionBucket, fn)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Function %s will start on its first message on %s\n", fn.Name, strings.Join(fn.TriggerSubjects, ", "))
+		return nil
+	}
+
+	if r.MaxInstances > 0 {
+		policy, err := r.autoscalingPolicy(nexfile, affinity)
+		if err != nil {
+			return err
+		}
+		err = nexClient.PutAutoscalingPolicy(r.AutoscaleBucket, policy)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Service %s will be kept between %d and %d instances\n", policy.Name, policy.MinInstances, policy.MaxInstances)
+		return nil
+	}
+
+	aucResp, err := nexClient.Auction(r.AgentType, r.AuctionTags, client.WithAuctionConstraints(r.Constraints...), client.WithAuctionAffinity(affinity), client.WithAuctionResources(nexfile.Resources))
 	if err != nil {
 		return err
 	}
@@ -130,35 +330,111 @@ func (r *StartWorkload) Run(ctx context.Context, globals *Globals) error {
 
 	randomNode := aucResp[rand.Intn(len(aucResp))]
 
-	if !slices.Contains(randomNode.SupportedLifecycles, models.WorkloadLifecycle(r.WorkloadLifecycle)) {
-		return errors.New("agent does not support requested lifecycle")
+	startOpts := []client.StartWorkloadOption{
+		client.WithAffinity(affinity),
+		client.WithGroup(r.Group),
+		client.WithPermissions(nexfile.Permissions),
+		client.WithResources(nexfile.Resources),
 	}
 
-	compiler := jsonschema.NewCompiler()
-	sch, err := jsonschema.UnmarshalJSON(bytes.NewReader([]byte(randomNode.StartRequestSchema)))
+	wsrB, err := r.validateStartRequest(randomNode)
+	if r.DryRun {
+		var startResponse *models.StartWorkloadResponse
+		if err == nil {
+			startResponse, err = nexClient.StartWorkload(randomNode.BidderId, r.WorkloadName, r.WorkloadDescription, string(wsrB), r.AgentType, models.WorkloadLifecycle(r.WorkloadLifecycle), r.AuctionTags, append(startOpts, client.WithDryRun())...)
+		}
+		return r.dryRunReport(globals, aucResp, randomNode, startResponse, err)
+	}
 	if err != nil {
 		return err
 	}
-	err = compiler.AddResource("schema.json", sch)
+
+	if r.NoWait {
+		startOpts = append(startOpts, client.WithAsync())
+	}
+
+	startResponse, err := nexClient.StartWorkload(randomNode.BidderId, r.WorkloadName, r.WorkloadDescription, string(wsrB), r.AgentType, models.WorkloadLifecycle(r.WorkloadLifecycle), r.AuctionTags, startOpts...)
 	if err != nil {
 		return err
 	}
 
-	schema, err := compiler.Compile("schema.json")
+	if r.NoWait && startResponse.OperationId != "" {
+		fmt.Printf("Workload %s [%s] accepted; operation %s\n", startResponse.Name, startResponse.Id, startResponse.OperationId)
+		return nil
+	}
+
+	fmt.Printf("Workload %s [%s] successfully started\n", startResponse.Name, startResponse.Id)
+	return nil
+}
+
+func (w *WaitWorkload) Run(ctx context.Context, globals *Globals) error {
+	nc, err := configureNatsConnection(globals)
 	if err != nil {
 		return err
 	}
 
+	if nc == nil {
+		return errors.New("no NATS connection available")
+	}
+
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
+	}
+	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
+	if err != nil {
+		return err
+	}
+
+	status, err := nexClient.WaitForOperation(w.OperationId)
+	if globals.JSON && status != nil {
+		statusB, mErr := json.Marshal(status)
+		if mErr != nil {
+			return mErr
+		}
+		fmt.Println(string(statusB))
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Workload %s successfully started\n", status.WorkloadId)
+	return nil
+}
+
+// validateStartRequest checks the start request against the lifecycles and
+// schema of the winning bid and returns the encoded start request
+func (r *StartWorkload) validateStartRequest(bid *models.AuctionResponse) ([]byte, error) {
+	if !slices.Contains(bid.SupportedLifecycles, models.WorkloadLifecycle(r.WorkloadLifecycle)) {
+		return nil, errors.New("agent does not support requested lifecycle")
+	}
+
+	compiler := jsonschema.NewCompiler()
+	sch, err := jsonschema.UnmarshalJSON(bytes.NewReader([]byte(bid.StartRequestSchema)))
+	if err != nil {
+		return nil, err
+	}
+	err = compiler.AddResource("schema.json", sch)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := compiler.Compile("schema.json")
+	if err != nil {
+		return nil, err
+	}
+
 	if r.WorkloadStartRequest != nil {
 		var startRequest any
 		err = json.Unmarshal(r.WorkloadStartRequest, &startRequest)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		err = schema.Validate(startRequest)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	} else if r.WorkloadStartRequest == nil && r.WorkloadNexfile == nil {
 		// TODO: create an interactive mode to fill out start request
@@ -169,28 +445,261 @@ func (r *StartWorkload) Run(ctx context.Context, globals *Globals) error {
 		// 	fmt.Printf("%s: %s\n", fieldName, fieldSchema.Types.String())
 		// }
 
-		return errors.New("interactive start request not yet implemented; please provide a Nexfile or start request")
+		return nil, errors.New("interactive start request not yet implemented; please provide a Nexfile or start request")
 	}
 
-	wsrB, err := json.Marshal(r.WorkloadStartRequest)
-	if err != nil {
-		return err
+	return json.Marshal(r.WorkloadStartRequest)
+}
+
+// dryRunReport reports the bids and the outcome of a dry run. It fails if the
+// workload would not start
+func (r *StartWorkload) dryRunReport(globals *Globals, bids []*models.AuctionResponse, winner *models.AuctionResponse, startResponse *models.StartWorkloadResponse, dryRunErr error) error {
+	result := struct {
+		Bidders    []string `json:"bidders"`
+		Winner     string   `json:"winner"`
+		WorkloadId string   `json:"workload_id,omitempty"`
+		Errors     []string `json:"errors"`
+	}{
+		Winner: winner.BidderId,
+		Errors: []string{},
+	}
+	for _, b := range bids {
+		result.Bidders = append(result.Bidders, b.BidderId)
+	}
+	if dryRunErr != nil {
+		result.Errors = append(result.Errors, dryRunErr.Error())
+	} else {
+		result.WorkloadId = startResponse.Id
 	}
 
-	startResponse, err := client.StartWorkload(randomNode.BidderId, r.WorkloadName, r.WorkloadDescription, string(wsrB), r.AgentType, models.WorkloadLifecycle(r.WorkloadLifecycle), r.AuctionTags)
-	if err != nil {
-		return err
+	if globals.JSON {
+		resultB, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(resultB))
+	} else {
+		tW := table.NewWriter()
+		tW.SetStyle(table.StyleRounded)
+		tW.Style().Title.Align = text.AlignCenter
+		tW.Style().Format.Header = text.FormatDefault
+		tW.SetTitle("Dry Run - " + r.WorkloadName)
+		tW.AppendHeader(table.Row{"Bidder", "Winner"})
+		for _, b := range result.Bidders {
+			tW.AppendRow(table.Row{b, b == result.Winner})
+		}
+		fmt.Println(tW.Render())
+
+		for _, e := range result.Errors {
+			fmt.Println("Error: " + e)
+		}
+		if len(result.Errors) == 0 {
+			fmt.Printf("Workload %s would be started as %s\n", r.WorkloadName, result.WorkloadId)
+		}
 	}
 
-	fmt.Printf("Workload %s [%s] successfully started\n", startResponse.Name, startResponse.Id)
+	if len(result.Errors) > 0 {
+		return errors.New("dry run failed; workload would not start")
+	}
 	return nil
 }
 
 func (r *StartWorkload) Validate() error {
 	var errs error
+	_, err := r.workloadAffinity()
+	errs = errors.Join(errs, err)
+	if r.HistoryLimit < 1 {
+		errs = errors.Join(errs, errors.New("history limit must be at least 1"))
+	}
+	if r.IdleTimeout <= 0 {
+		errs = errors.Join(errs, errors.New("idle timeout must be positive"))
+	}
+	if r.Lazy && r.Schedule != "" {
+		errs = errors.Join(errs, errors.New("a workload cannot be both scheduled and lazy"))
+	}
+	if r.MaxInstances > 0 && (r.Lazy || r.Schedule != "") {
+		errs = errors.Join(errs, errors.New("scheduled jobs and lazy functions cannot be autoscaled"))
+	}
+	if r.ScaleOutCooldown < 0 || r.ScaleInCooldown < 0 {
+		errs = errors.Join(errs, errors.New("cooldowns must not be negative"))
+	}
 	return errs
 }
 
+// jobSchedule returns the schedule the job scheduler of the nexus runs the job
+// on. Every run is auctioned, so the start request is validated by the agent
+// when the run starts
+func (r *StartWorkload) jobSchedule(nexfile models.Nexfile, affinity *models.WorkloadAffinity) (*models.JobSchedule, error) {
+	if models.WorkloadLifecycle(r.WorkloadLifecycle) != models.WorkloadLifecycleJob {
+		return nil, errors.New("only jobs can be scheduled; use --lifecycle job")
+	}
+	if r.WorkloadStartRequest == nil {
+		return nil, errors.New("scheduled jobs require a Nexfile or start request")
+	}
+	if r.DryRun {
+		return nil, errors.New("dry run is not supported for scheduled jobs")
+	}
+
+	tags := models.NodeTags{}
+	maps.Copy(tags, r.AuctionTags)
+	if r.Group != "" {
+		tags[models.TagWorkloadGroup] = r.Group
+	}
+
+	return &models.JobSchedule{
+		ConcurrencyPolicy: models.JobScheduleConcurrencyPolicy(r.ConcurrencyPolicy),
+		Constraints:       r.Constraints,
+		Cron:              r.Schedule,
+		HistoryLimit:      r.HistoryLimit,
+		Name:              r.WorkloadName,
+		Timezone:          r.Timezone,
+		Workload: models.StartWorkloadRequest{
+			Affinity:          affinity,
+			Description:       r.WorkloadDescription,
+			Name:              r.WorkloadName,
+			Permissions:       nexfile.Permissions,
+			Resources:         nexfile.Resources,
+			RunRequest:        string(r.WorkloadStartRequest),
+			Tags:              tags,
+			WorkloadLifecycle: models.WorkloadLifecycleJob,
+			WorkloadType:      r.AgentType,
+		},
+	}, nil
+}
+
+// lazyFunction returns the function the activator of the nexus starts on its
+// first message. Every instance is auctioned, so the start request is
+// validated by the agent when an instance starts
+func (r *StartWorkload) lazyFunction(nexfile models.Nexfile, affinity *models.WorkloadAffinity) (*models.LazyFunction, error) {
+	if models.WorkloadLifecycle(r.WorkloadLifecycle) != models.WorkloadLifecycleFunction {
+		return nil, errors.New("only functions can be lazy; use --lifecycle function")
+	}
+	if r.WorkloadStartRequest == nil {
+		return nil, errors.New("lazy functions require a Nexfile or start request")
+	}
+	if r.DryRun {
+		return nil, errors.New("dry run is not supported for lazy functions")
+	}
+
+	tags := models.NodeTags{}
+	maps.Copy(tags, r.AuctionTags)
+	if r.Group != "" {
+		tags[models.TagWorkloadGroup] = r.Group
+	}
+
+	return &models.LazyFunction{
+		Constraints: r.Constraints,
+		IdleTimeout: r.IdleTimeout.String(),
+		Name:        r.WorkloadName,
+		Workload: models.StartWorkloadRequest{
+			Affinity:          affinity,
+			Description:       r.WorkloadDescription,
+			Name:              r.WorkloadName,
+			Permissions:       nexfile.Permissions,
+			Resources:         nexfile.Resources,
+			RunRequest:        string(r.WorkloadStartRequest),
+			Tags:              tags,
+			WorkloadLifecycle: models.WorkloadLifecycleFunction,
+			WorkloadType:      r.AgentType,
+		},
+	}, nil
+}
+
+// autoscalingPolicy returns the policy the autoscaler of the nexus keeps the
+// instances of the service with. Every instance is auctioned, so the start
+// request is validated by the agent when an instance starts
+func (r *StartWorkload) autoscalingPolicy(nexfile models.Nexfile, affinity *models.WorkloadAffinity) (*models.AutoscalingPolicy, error) {
+	if models.WorkloadLifecycle(r.WorkloadLifecycle) != models.WorkloadLifecycleService {
+		return nil, errors.New("only services can be autoscaled; use --lifecycle service")
+	}
+	if r.WorkloadStartRequest == nil {
+		return nil, errors.New("autoscaled services require a Nexfile or start request")
+	}
+	if r.DryRun {
+		return nil, errors.New("dry run is not supported for autoscaled services")
+	}
+
+	tags := models.NodeTags{}
+	maps.Copy(tags, r.AuctionTags)
+	if r.Group != "" {
+		tags[models.TagWorkloadGroup] = r.Group
+	}
+
+	policy := &models.AutoscalingPolicy{
+		Constraints:      r.Constraints,
+		MaxInstances:     r.MaxInstances,
+		MinInstances:     r.MinInstances,
+		Name:             r.WorkloadName,
+		ScaleInCooldown:  r.ScaleInCooldown.String(),
+		ScaleOutCooldown: r.ScaleOutCooldown.String(),
+		Target:           r.ScaleTarget,
+		Workload: models.StartWorkloadRequest{
+			Affinity:          affinity,
+			Description:       r.WorkloadDescription,
+			Name:              r.WorkloadName,
+			Permissions:       nexfile.Permissions,
+			Resources:         nexfile.Resources,
+			RunRequest:        string(r.WorkloadStartRequest),
+			Tags:              tags,
+			WorkloadLifecycle: models.WorkloadLifecycleService,
+			WorkloadType:      r.AgentType,
+		},
+	}
+	if r.ScaleStream != "" || r.ScaleConsumer != "" {
+		policy.Consumer = &models.AutoscalingPolicyConsumer{Consumer: r.ScaleConsumer, Stream: r.ScaleStream}
+	}
+	if r.ScaleMetric != "" {
+		policy.Metric = &models.AutoscalingPolicyMetric{Name: r.ScaleMetric}
+	}
+	return policy, nil
+}
+
+// workloadAffinity reads the affinity flags. Each flag is one rule made of
+// comma separated selectors: name=<name>, group=<group> or tag.<key>=<value>
+func (r *StartWorkload) workloadAffinity() (*models.WorkloadAffinity, error) {
+	if len(r.Affinity) == 0 && len(r.AntiAffinity) == 0 {
+		return nil, nil
+	}
+
+	parse := func(specs []string) ([]models.WorkloadAffinityRule, error) {
+		rules := []models.WorkloadAffinityRule{}
+		for _, spec := range specs {
+			rule := models.WorkloadAffinityRule{}
+			for selector := range strings.SplitSeq(spec, ",") {
+				k, v, ok := strings.Cut(strings.TrimSpace(selector), "=")
+				if !ok || v == "" {
+					return nil, fmt.Errorf("invalid affinity rule %q: selectors are name=, group= or tag.<key>=", spec)
+				}
+				switch {
+				case k == "name":
+					rule.Name = v
+				case k == "group":
+					rule.Group = v
+				case strings.HasPrefix(k, "tag.") && len(k) > len("tag."):
+					if rule.Tags == nil {
+						rule.Tags = models.NodeTags{}
+					}
+					rule.Tags[strings.TrimPrefix(k, "tag.")] = v
+				default:
+					return nil, fmt.Errorf("invalid affinity rule %q: unknown selector %s", spec, k)
+				}
+			}
+			rules = append(rules, rule)
+		}
+		return rules, nil
+	}
+
+	affinity, err := parse(r.Affinity)
+	if err != nil {
+		return nil, err
+	}
+	antiAffinity, err := parse(r.AntiAffinity)
+	if err != nil {
+		return nil, err
+	}
+	return &models.WorkloadAffinity{Affinity: affinity, AntiAffinity: antiAffinity}, nil
+}
+
 func (s *StopWorkload) Run(ctx context.Context, globals *Globals) error {
 	nc, err := configureNatsConnection(globals)
 	if err != nil {
@@ -201,9 +710,9 @@ func (s *StopWorkload) Run(ctx context.Context, globals *Globals) error {
 		return errors.New("no NATS connection available")
 	}
 
-	var opts []client.ClientOption
-	if globals.NatsTimeout > 0 {
-		opts = append(opts, client.WithDefaultTimeout(globals.NatsTimeout))
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
 	}
 	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
 	if err != nil {
@@ -237,9 +746,9 @@ func (r *ListWorkload) Run(ctx context.Context, globals *Globals) error {
 		return errors.New("no NATS connection available")
 	}
 
-	var opts []client.ClientOption
-	if globals.NatsTimeout > 0 {
-		opts = append(opts, client.WithDefaultTimeout(globals.NatsTimeout))
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
 	}
 	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
 	if err != nil {
@@ -312,9 +821,9 @@ func (r *CloneWorkload) Run(ctx context.Context, globals *Globals) error {
 	if nc == nil {
 		return errors.New("no NATS connection available")
 	}
-	var opts []client.ClientOption
-	if globals.NatsTimeout > 0 {
-		opts = append(opts, client.WithDefaultTimeout(globals.NatsTimeout))
+	opts, err := clientOptions(globals)
+	if err != nil {
+		return err
 	}
 	nexClient, err := client.NewClient(ctx, nc, globals.Namespace, opts...)
 	if err != nil {
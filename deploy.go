@@ -0,0 +1,186 @@
+package nex
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go/micro"
+	"github.com/synadia-io/nex/models"
+)
+
+// operationRetention is how long a finished operation can still be queried
+const operationRetention = 5 * time.Minute
+
+// deployJob is an accepted deploy waiting to be started by an agent
+type deployJob struct {
+	operationID string
+	workloadID  string
+	agentID     string
+	req         *models.StartWorkloadRequest
+	aReqB       []byte
+	// releases the quota reservation of the workload if it fails to start
+	reserver models.WorkloadReserver
+}
+
+// operation is a deploy tracked by this node
+type operation struct {
+	status  models.OperationStatus
+	agentID string
+	// the start request, so affinity rules see workloads that are still starting
+	req *models.StartWorkloadRequest
+}
+
+// errDeployCanceled fails the deploys still queued when the node shuts down
+var errDeployCanceled = errors.New("node shut down before the workload was started")
+
+// deployWorker starts queued workloads until the node shuts down
+func (n *NexNode) deployWorker() {
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-n.deployStop:
+			return
+		case job := <-n.deployQueue:
+			n.runDeploy(job)
+		}
+	}
+}
+
+// cancelQueuedDeploys fails the deploys no worker started before shutdown.
+// Operations only live in memory, so clients waiting on them learn the outcome
+// before the node goes away
+func (n *NexNode) cancelQueuedDeploys() {
+	for {
+		select {
+		case job := <-n.deployQueue:
+			n.failDeploy(job, errDeployCanceled)
+		default:
+			return
+		}
+	}
+}
+
+func (n *NexNode) runDeploy(job *deployJob) {
+	err := func() error {
+		resp, err := n.nc.Request(models.AgentAPIStartWorkloadRequestSubject(n.id, job.agentID, job.workloadID), job.aReqB, time.Minute)
+		if err != nil {
+			return err
+		}
+		if errMsg := resp.Header.Get(micro.ErrorHeader); errMsg != "" {
+			return errors.New(errMsg)
+		}
+		return nil
+	}()
+	if err != nil {
+		n.failDeploy(job, err)
+		return
+	}
+
+	err = n.state.StoreWorkload(job.workloadID, *job.req)
+	if err != nil {
+		n.logger.Warn("failed to store node state", slog.String("err", err.Error()))
+	}
+	n.updateOperation(job.operationID, models.OperationStatusStateRunning, "")
+}
+
+// failDeploy releases what was held for a deploy that did not start and marks
+// its operation failed
+func (n *NexNode) failDeploy(job *deployJob, err error) {
+	n.logger.Error("failed to start workload", slog.String("err", err.Error()), slog.String("workload_id", job.workloadID), slog.String("operation_id", job.operationID))
+	n.registeredAgents.RemoveWorkload(job.workloadID)
+	if job.reserver != nil {
+		err := job.reserver.ReleaseWorkload(job.req.Namespace, job.workloadID)
+		if err != nil {
+			n.logger.Error("failed to release workload reservation", slog.String("err", err.Error()), slog.String("workload_id", job.workloadID))
+		}
+	}
+	n.updateOperation(job.operationID, models.OperationStatusStateFailed, err.Error())
+}
+
+// trackOperation records a new deploy operation and publishes it as queued
+func (n *NexNode) trackOperation(operationID, workloadID, agentID string, req *models.StartWorkloadRequest) {
+	n.operationsMu.Lock()
+	n.operations[operationID] = &operation{
+		status: models.OperationStatus{
+			Namespace:   req.Namespace,
+			NodeId:      n.id,
+			OperationId: operationID,
+			State:       models.OperationStatusStateQueued,
+			Timestamp:   time.Now().UTC(),
+			WorkloadId:  workloadID,
+		},
+		agentID: agentID,
+		req:     req,
+	}
+	status := n.operations[operationID].status
+	n.operationsMu.Unlock()
+
+	n.publishOperation(status)
+}
+
+// untrackOperation forgets an operation that never made it onto the queue
+func (n *NexNode) untrackOperation(operationID string) {
+	n.operationsMu.Lock()
+	defer n.operationsMu.Unlock()
+	delete(n.operations, operationID)
+}
+
+// updateOperation moves an operation to a new state and publishes it. Finished
+// operations keep their state and are forgotten after the retention period
+func (n *NexNode) updateOperation(operationID string, state models.OperationStatusState, errMsg string) {
+	n.operationsMu.Lock()
+	op, ok := n.operations[operationID]
+	if !ok {
+		n.operationsMu.Unlock()
+		return
+	}
+	if operationFinished(op.status.State) {
+		// late progress from the agent does not reopen a finished operation
+		n.operationsMu.Unlock()
+		return
+	}
+	op.status.State = state
+	op.status.Error = errMsg
+	op.status.Timestamp = time.Now().UTC()
+	status := op.status
+	n.operationsMu.Unlock()
+
+	if operationFinished(state) {
+		time.AfterFunc(operationRetention, func() {
+			n.untrackOperation(operationID)
+		})
+	}
+
+	n.publishOperation(status)
+}
+
+func (n *NexNode) getOperation(operationID string) (*operation, bool) {
+	n.operationsMu.RLock()
+	defer n.operationsMu.RUnlock()
+	op, ok := n.operations[operationID]
+	if !ok {
+		return nil, false
+	}
+	ret := *op
+	return &ret, true
+}
+
+func (n *NexNode) publishOperation(status models.OperationStatus) {
+	statusB, err := json.Marshal(status)
+	if err != nil {
+		n.logger.Error("failed to marshal operation status", slog.String("err", err.Error()))
+		return
+	}
+
+	err = n.nc.Publish(models.OperationSubject(status.Namespace, status.OperationId), statusB)
+	if err != nil {
+		n.logger.Error("failed to publish operation status", slog.String("err", err.Error()), slog.String("operation_id", status.OperationId))
+	}
+}
+
+func operationFinished(state models.OperationStatusState) bool {
+	return state == models.OperationStatusStateRunning || state == models.OperationStatusStateFailed
+}
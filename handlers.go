@@ -1,6 +1,7 @@
 package nex
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,6 +14,8 @@ import (
 
 	"disorder.dev/shandler"
 	"github.com/synadia-io/nex/internal"
+	"github.com/synadia-io/nex/internal/cauthorizer"
+	"github.com/synadia-io/nex/internal/constraints"
 	"github.com/synadia-io/nex/models"
 	"github.com/synadia-io/orbit.go/natsext"
 
@@ -23,6 +26,10 @@ import (
 
 func (n *NexNode) handlePing() func(micro.Request) {
 	return func(r micro.Request) {
+		// $NEX.SVC.<namespace>.control.PING[.<nodeid>]
+		splitSub := strings.SplitN(r.Subject(), ".", 5)
+		namespace := splitSub[2]
+
 		rep := new(models.NodePingRequest)
 		err := json.Unmarshal(r.Data(), rep)
 		if err != nil {
@@ -30,10 +37,18 @@ func (n *NexNode) handlePing() func(micro.Request) {
 			return
 		}
 
-		for k, v := range rep.Filter {
-			if tV, ok := n.tags[k]; !ok || tV != v {
-				return
-			}
+		unsatisfied, err := constraints.Unsatisfied(n.nodeAttributes(""), rep.Filter, rep.Constraints)
+		if err != nil {
+			n.handlerError(r, err, "100", "invalid ping constraint")
+			return
+		}
+		if unsatisfied != "" {
+			skipRequest(r)
+			return
+		}
+
+		if !n.authorizeControl(r, namespace, models.ControlActionPing) {
+			return
 		}
 
 		pubKey, err := n.nodeKeypair.PublicKey()
@@ -51,7 +66,7 @@ func (n *NexNode) handlePing() func(micro.Request) {
 		err = r.RespondJSON(models.NodePingResponse{
 			AgentCount: n.registeredAgents.Count(),
 			NodeId:     pubKey,
-			Tags:       n.tags,
+			Tags:       n.nodeTags(),
 			StartTime:  n.startTime,
 			Version:    n.version,
 			Xkey:       pubXKey,
@@ -66,6 +81,14 @@ func (n *NexNode) handlePing() func(micro.Request) {
 
 func (n *NexNode) handleLameduck() func(micro.Request) {
 	return func(r micro.Request) {
+		// $NEX.SVC.<namespace>.control.LAMEDUCK.<nodeid>
+		splitSub := strings.SplitN(r.Subject(), ".", 5)
+		namespace := splitSub[2]
+
+		if !n.authorizeControl(r, namespace, models.ControlActionLameduck) {
+			return
+		}
+
 		req := new(models.LameduckRequest)
 		err := json.Unmarshal(r.Data(), req)
 		if err != nil {
@@ -79,13 +102,15 @@ func (n *NexNode) handleLameduck() func(micro.Request) {
 			return
 		}
 
-		if req.Tag != nil {
-			for k, v := range req.Tag {
-				if tV, ok := n.tags[k]; !ok || tV != v {
-					n.logger.Debug("workload tag not satisfied during lameduck", slog.String("node_id", pubKey), slog.String("tag", k), slog.String("value", v))
-					return
-				}
-			}
+		unsatisfied, err := constraints.Unsatisfied(n.nodeAttributes(""), req.Tag, req.Constraints)
+		if err != nil {
+			n.handlerError(r, err, "100", "invalid lameduck constraint")
+			return
+		}
+		if unsatisfied != "" {
+			n.logger.Debug("constraint not satisfied during lameduck", slog.String("node_id", pubKey), slog.String("constraint", unsatisfied))
+			skipRequest(r)
+			return
 		}
 
 		delay, err := time.ParseDuration(req.Delay)
@@ -95,8 +120,9 @@ func (n *NexNode) handleLameduck() func(micro.Request) {
 		}
 
 		ldReq := models.LameduckRequest{
-			Delay: delay.String(),
-			Tag:   req.Tag,
+			Constraints: req.Constraints,
+			Delay:       delay.String(),
+			Tag:         req.Tag,
 		}
 
 		ldReqB, err := json.Marshal(ldReq)
@@ -145,7 +171,7 @@ func (n *NexNode) handleLameduck() func(micro.Request) {
 		n.enterLameduck(delay)
 
 		n.logger.Info("node entering lameduck mode", slog.Any("shutdown_at", time.Now().Add(delay).Format(time.DateTime)))
-		n.tags[models.TagLameDuck] = "true"
+		n.setTag(models.TagLameDuck, "true")
 		err = r.RespondJSON(models.LameduckResponse{
 			Success: true,
 			Message: fmt.Sprintf("node entering lameduck mode, will shutdown at %s", time.Now().Add(delay).Format(time.DateTime)),
@@ -159,6 +185,14 @@ func (n *NexNode) handleLameduck() func(micro.Request) {
 
 func (n *NexNode) handleNodeInfo() func(micro.Request) {
 	return func(r micro.Request) {
+		// $NEX.SVC.<namespace>.control.INFO.<nodeid>
+		splitSub := strings.SplitN(r.Subject(), ".", 5)
+		namespace := splitSub[2]
+
+		if !n.authorizeControl(r, namespace, models.ControlActionInfo) {
+			return
+		}
+
 		pubKey, err := n.nodeKeypair.PublicKey()
 		if err != nil {
 			n.handlerError(r, err, "100", "failed to get public key from keypair")
@@ -175,7 +209,7 @@ func (n *NexNode) handleNodeInfo() func(micro.Request) {
 			NodeAgentSummaries: n.registeredAgents.AgentSummaries(),
 			NodeId:             pubKey,
 			Xkey:               pubXKey,
-			Tags:               n.tags,
+			Tags:               n.nodeTags(),
 			Uptime:             time.Since(n.startTime).String(),
 			Version:            n.version,
 		})
@@ -186,12 +220,50 @@ func (n *NexNode) handleNodeInfo() func(micro.Request) {
 	}
 }
 
+func (n *NexNode) handleTags() func(micro.Request) {
+	return func(r micro.Request) {
+		// $NEX.SVC.<namespace>.control.TAGS.<nodeid>
+		splitSub := strings.SplitN(r.Subject(), ".", 5)
+		namespace := splitSub[2]
+
+		if !n.authorizeControl(r, namespace, models.ControlActionTags) {
+			return
+		}
+
+		req := new(models.NodeTagsRequest)
+		err := json.Unmarshal(r.Data(), req)
+		if err != nil {
+			n.handlerError(r, err, "100", "failed to unmarshal tags request")
+			return
+		}
+
+		tags, err := n.UpdateTags(req.Set, req.Remove)
+		if err != nil {
+			n.handlerError(r, err, "100", "failed to update node tags")
+			return
+		}
+
+		err = r.RespondJSON(models.NodeTagsResponse{
+			NodeId: n.id,
+			Tags:   tags,
+		})
+		if err != nil {
+			n.logger.Error("failed to respond to tags request", slog.String("err", err.Error()))
+			return
+		}
+	}
+}
+
 func (n *NexNode) handleAuction() func(micro.Request) {
 	return func(r micro.Request) {
 		// $NEX.SVC.<namespace>.control.AUCTION
 		splitSub := strings.SplitN(r.Subject(), ".", 5)
 		namespace := splitSub[2]
 
+		if !n.authorizeControl(r, namespace, models.ControlActionAuction) {
+			return
+		}
+
 		req := new(models.AuctionRequest)
 		err := json.Unmarshal(r.Data(), req)
 		if err != nil {
@@ -203,21 +275,42 @@ func (n *NexNode) handleAuction() func(micro.Request) {
 		reg, err := n.registeredAgents.GetByRegisterType(req.AgentType)
 		if err != nil {
 			n.logger.Log(n.ctx, shandler.LevelTrace, "no valid agents found for this workload", slog.String("agent_type", req.AgentType))
+			skipRequest(r)
 			return
 		}
 
-		// If all auction tags aren't satisfied, request is thrown away
-		for k, v := range req.Tags {
-			if tV, ok := n.tags[k]; !ok || tV != v {
-				n.logger.Log(n.ctx, shandler.LevelTrace, "workload tag not satisfied during auction", slog.String("tag", k), slog.String("value", v))
-				return
-			}
+		// If all auction tags and constraints aren't satisfied, request is thrown away
+		unsatisfied, err := constraints.Unsatisfied(n.nodeAttributes(req.AgentType), req.Tags, req.Constraints)
+		if err != nil {
+			n.handlerError(r, err, "100", "invalid auction constraint")
+			return
+		}
+		if unsatisfied != "" {
+			n.logger.Log(n.ctx, shandler.LevelTrace, "constraint not satisfied during auction", slog.String("constraint", unsatisfied))
+			skipRequest(r)
+			return
+		}
+
+		// If the workloads on this node break the affinity rules, request is thrown away
+		unsatisfied, err = n.checkAffinity(namespace, req.Affinity)
+		if err != nil {
+			n.handlerError(r, err, "100", "failed to check workload affinity")
+			return
+		}
+		if unsatisfied != "" {
+			n.logger.Log(n.ctx, shandler.LevelTrace, "affinity not satisfied during auction", slog.String("rule", unsatisfied))
+			skipRequest(r)
+			return
 		}
 
 		if n.auctioneer != nil {
-			err = n.auctioneer.Auction(namespace, req.AgentType, req.Tags)
+			if ra, ok := n.auctioneer.(models.ResourceAuctioneer); ok {
+				err = ra.AuctionResources(namespace, req.AgentType, req.Tags, req.Resources)
+			} else {
+				err = n.auctioneer.Auction(namespace, req.AgentType, req.Tags)
+			}
 			if err != nil {
-				n.logger.Error("auctioneer failed to pass auction", slog.String("err", err.Error()))
+				n.handlerError(r, err, "100", "auction declined")
 				return
 			}
 		}
@@ -250,6 +343,16 @@ func (n *NexNode) handleAuctionDeployWorkload() func(micro.Request) {
 			return
 		}
 
+		if !n.authorizeControl(r, namespace, models.ControlActionDeploy) {
+			return
+		}
+
+		// a dry run stops before the workload is started and changes nothing
+		dryRun := r.Headers().Get(models.DryRunHeader) == "true"
+		if dryRun {
+			auditSkip(r)
+		}
+
 		req := new(models.StartWorkloadRequest)
 		err := json.Unmarshal(r.Data(), req)
 		if err != nil {
@@ -280,20 +383,85 @@ func (n *NexNode) handleAuctionDeployWorkload() func(micro.Request) {
 			return
 		}
 
-		pubKey, err := n.nodeKeypair.PublicKey()
+		for _, admitter := range n.admitters {
+			err = admitter.AdmitWorkload(req)
+			if err != nil {
+				auditDenied(r)
+				n.handlerError(r, err, models.AdmissionRejectedCode, "workload rejected by admission policy: "+err.Error())
+				return
+			}
+		}
+
+		unsatisfied, err := n.checkAffinity(req.Namespace, req.Affinity)
 		if err != nil {
-			n.handlerError(r, err, "100", "failed to get public key from keypair")
+			n.handlerError(r, err, "100", "failed to check workload affinity")
+			return
+		}
+		if unsatisfied != "" {
+			n.handlerError(r, errors.New("affinity not satisfied"), "100", "workload placement not satisfied: "+unsatisfied)
 			return
 		}
 
+		if req.Permissions != nil {
+			sv, ok := n.minter.(models.ScopedCredVendor)
+			if !ok {
+				n.handlerError(r, errors.New("node cannot mint scoped workload credentials"), "100", "requested permissions rejected: node cannot mint scoped workload credentials")
+				return
+			}
+			err = sv.CheckPermissions(req.Namespace, req.Permissions)
+			if err != nil {
+				n.handlerError(r, err, "100", "requested permissions rejected: "+err.Error())
+				return
+			}
+		}
+
 		workloadID := n.idgen.Generate(req)
-		wlNatsConn, err := n.minter.Mint(models.WorkloadCred, namespace, workloadID)
+		auditTarget(r, workloadID)
+
+		// Once the deploy is queued the worker owns the reservation
+		accepted := false
+		reserver, _ := n.auctioneer.(models.WorkloadReserver)
+		if reserver != nil {
+			err = reserver.ReserveWorkload(workloadID, req)
+			if err != nil {
+				n.handlerError(r, err, "100", "workload declined by auctioneer")
+				return
+			}
+			defer func() {
+				if accepted {
+					return
+				}
+				err := reserver.ReleaseWorkload(req.Namespace, workloadID)
+				if err != nil {
+					n.logger.Error("failed to release workload reservation", slog.String("err", err.Error()), slog.String("workload_id", workloadID))
+				}
+			}()
+		}
+
+		wlNatsConn, err := n.mintWorkloadCreds(req.Namespace, workloadID, req.Permissions)
 		if err != nil {
 			n.handlerError(r, err, "100", "failed to mint workload nats connection")
 			return
 		}
 
+		if dryRun {
+			respB, err := json.Marshal(models.StartWorkloadResponse{Id: workloadID, Name: req.Name})
+			if err != nil {
+				n.handlerError(r, err, "100", "failed to marshal dry run response")
+				return
+			}
+
+			err = r.Respond(respB)
+			if err != nil {
+				n.logger.Error("failed to respond to dry run deploy workload request", slog.String("err", err.Error()))
+			}
+			return
+		}
+
+		operationID := n.idgen.Generate(nil)
+
 		aReq := new(models.AgentStartWorkloadRequest)
+		aReq.OperationId = operationID
 		aReq.Request = *req
 		aReq.WorkloadCreds = *wlNatsConn
 
@@ -303,21 +471,38 @@ func (n *NexNode) handleAuctionDeployWorkload() func(micro.Request) {
 			return
 		}
 
-		auctionDeploy, err := n.nc.Request(models.AgentAPIStartWorkloadRequestSubject(pubKey, reg.ID, workloadID), aReqB, time.Minute)
+		// Tracked before the start request so the agent can resolve secrets while starting
+		err = n.registeredAgents.AddWorkload(reg.ID, workloadID, req.Namespace)
 		if err != nil {
-			n.handlerError(r, err, "100", "failed to publish start workload request")
+			n.handlerError(r, err, "100", "failed to track workload")
 			return
 		}
 
-		err = r.Respond(auctionDeploy.Data, micro.WithHeaders(micro.Headers(auctionDeploy.Header)))
-		if err != nil {
-			n.logger.Error("failed to respond to auction deploy workload request", slog.String("err", err.Error()))
+		n.trackOperation(operationID, workloadID, reg.ID, req)
+		select {
+		case n.deployQueue <- &deployJob{
+			operationID: operationID,
+			workloadID:  workloadID,
+			agentID:     reg.ID,
+			req:         req,
+			aReqB:       aReqB,
+			reserver:    reserver,
+		}:
+			accepted = true
+		default:
+			n.untrackOperation(operationID)
+			n.registeredAgents.RemoveWorkload(workloadID)
+			n.handlerError(r, errors.New("deploy queue is full"), "100", "node is too busy to start the workload")
 			return
 		}
 
-		err = n.state.StoreWorkload(workloadID, *req)
+		err = r.RespondJSON(models.StartWorkloadResponse{
+			Id:          workloadID,
+			Name:        req.Name,
+			OperationId: operationID,
+		})
 		if err != nil {
-			n.logger.Warn("failed to store node state", slog.String("err", err.Error()))
+			n.logger.Error("failed to respond to auction deploy workload request", slog.String("err", err.Error()))
 			return
 		}
 	}
@@ -329,6 +514,10 @@ func (n *NexNode) handleStopWorkload() func(micro.Request) {
 		namespace := splitSub[2]
 		workloadID := splitSub[5]
 
+		if !n.authorizeControl(r, namespace, models.ControlActionUndeploy) {
+			return
+		}
+
 		req := new(models.StopWorkloadRequest)
 		err := json.Unmarshal(r.Data(), req)
 		if err != nil {
@@ -377,12 +566,20 @@ func (n *NexNode) handleStopWorkload() func(micro.Request) {
 			return true
 		})
 
+		if !ret.Stopped {
+			auditSkip(r)
+		}
+
 		err = r.RespondJSON(ret)
 		if err != nil {
 			n.logger.Error("failed to respond to stop workload request", slog.String("err", err.Error()))
 			return
 		}
 
+		if ret.Stopped {
+			n.registeredAgents.RemoveWorkload(workloadID)
+		}
+
 		err = n.state.RemoveWorkload(ret.WorkloadType, workloadID)
 		if err != nil {
 			n.logger.Warn("failed to delete node state", slog.String("err", err.Error()))
@@ -397,6 +594,10 @@ func (n *NexNode) handleCloneWorkload() func(micro.Request) {
 		namespace := splitSub[2]
 		workloadID := splitSub[5]
 
+		if !n.authorizeControl(r, namespace, models.ControlActionClone) {
+			return
+		}
+
 		req := new(models.CloneWorkloadRequest)
 		err := json.Unmarshal(r.Data(), req)
 		if err != nil {
@@ -439,6 +640,10 @@ func (n *NexNode) handleNamespacePing() func(micro.Request) {
 		splitSub := strings.SplitN(r.Subject(), ".", 4)
 		namespace := splitSub[2]
 
+		if !n.authorizeControl(r, namespace, models.ControlActionList) {
+			return
+		}
+
 		req := new(models.AgentListWorkloadsRequest)
 		err := json.Unmarshal(r.Data(), req)
 		if err != nil {
@@ -517,10 +722,13 @@ func (n *NexNode) handleRegisterAgent() func(micro.Request) {
 			return
 		}
 
-		err = n.aregistrar.RegisterAgent(r.Headers(), registrationRequest)
-		if err != nil {
-			n.handlerError(r, err, "100", "failed agent registrar check")
-			return
+		// agents started by this node do not need to be checked by the registrar
+		if !n.isLaunchedAgent(agentID) {
+			err = n.aregistrar.RegisterAgent(registrarHeaders(r, agentID), registrationRequest)
+			if err != nil {
+				n.handlerError(r, err, "100", "failed agent registrar check")
+				return
+			}
 		}
 
 		rawSchema, err := jsonschema.UnmarshalJSON(strings.NewReader(registrationRequest.StartRequestSchema))
@@ -577,7 +785,7 @@ func (n *NexNode) handleRegisterAgent() func(micro.Request) {
 
 		state := models.RegisterAgentResponseExistingState{}
 		for workloadID, swr := range agentState {
-			natsConn, err := n.minter.Mint(models.WorkloadCred, swr.Namespace, workloadID)
+			natsConn, err := n.mintWorkloadCreds(swr.Namespace, workloadID, swr.Permissions)
 			if err != nil {
 				n.logger.Warn("failed to mint workload nats connection", slog.String("err", err.Error()), slog.String("namespace", swr.Namespace), slog.String("workload_id", workloadID))
 				continue
@@ -587,6 +795,11 @@ func (n *NexNode) handleRegisterAgent() func(micro.Request) {
 				WorkloadCreds: *natsConn,
 			}
 			state[workloadID] = aswr
+
+			err = n.registeredAgents.AddWorkload(agentID, workloadID, swr.Namespace)
+			if err != nil {
+				n.logger.Warn("failed to track restored workload", slog.String("err", err.Error()), slog.String("workload_id", workloadID))
+			}
 		}
 
 		err = r.RespondJSON(models.RegisterAgentResponse{
@@ -612,13 +825,15 @@ func (n *NexNode) handleRegisterRemoteAgent() func(micro.Request) {
 			return
 		}
 
-		err = n.aregistrar.RegisterRemoteInit(r.Headers(), req)
+		agentID := n.idgen.Generate(nil)
+		auditTarget(r, agentID)
+
+		err = n.aregistrar.RegisterRemoteInit(registrarHeaders(r, agentID), req)
 		if err != nil {
 			n.handlerError(r, err, "100", "failed agent registrar check")
 			return
 		}
 
-		agentID := n.idgen.Generate(nil)
 		pubNodeKey, err := n.nodeKeypair.PublicKey()
 		if err != nil {
 			n.handlerError(r, err, "100", "failed to get public key from keypair")
@@ -647,6 +862,10 @@ func (n *NexNode) handleRegisterRemoteAgent() func(micro.Request) {
 
 func (n *NexNode) handleGetAgentIDByName() func(micro.Request) {
 	return func(r micro.Request) {
+		if !n.authorizeControl(r, models.SystemNamespace, models.ControlActionInfo) {
+			return
+		}
+
 		agentName := string(r.Data())
 		if agentName == "" {
 			n.handlerError(r, errors.New("agent name is required"), "100", "agent name is required")
@@ -663,6 +882,267 @@ func (n *NexNode) handleGetAgentIDByName() func(micro.Request) {
 	}
 }
 
+func (n *NexNode) handleAgentSecret() func(micro.Request) {
+	return func(r micro.Request) {
+		// $NEX.SVC.<nodeid>.agent.SECRET.<agentid>
+		splitSub := strings.SplitN(r.Subject(), ".", 6)
+		agentID := splitSub[5]
+
+		req := new(models.AgentSecretRequest)
+		err := json.Unmarshal(r.Data(), req)
+		if err != nil {
+			n.handlerError(r, err, "100", "failed to unmarshal agent secret request")
+			return
+		}
+
+		// Agents may only read secrets from namespaces they are running workloads in
+		if !n.registeredAgents.HasNamespace(agentID, req.Namespace) {
+			n.handlerError(r, fmt.Errorf("agent %s is not running workloads in namespace %s", agentID, req.Namespace), "100", "unauthorized agent secret request")
+			return
+		}
+
+		value, err := n.secretStore.GetSecret(req.Namespace, req.Key)
+		if err != nil {
+			n.handlerError(r, err, "100", "failed to retrieve secret")
+			return
+		}
+
+		encValue, err := n.nodeXKeypair.Seal(value, req.Xkey)
+		if err != nil {
+			n.handlerError(r, err, "100", "failed to encrypt secret")
+			return
+		}
+
+		pubXKey, err := n.nodeXKeypair.PublicKey()
+		if err != nil {
+			n.handlerError(r, err, "100", "failed to get public xkey from xkeypair")
+			return
+		}
+
+		err = r.RespondJSON(models.AgentSecretResponse{
+			Value: base64.StdEncoding.EncodeToString(encValue),
+			Xkey:  pubXKey,
+		})
+		if err != nil {
+			n.logger.Error("failed to respond to agent secret request", slog.String("err", err.Error()))
+			return
+		}
+	}
+}
+
+func (n *NexNode) handleAgentOperation() func(micro.Request) {
+	return func(r micro.Request) {
+		// $NEX.SVC.<nodeid>.agent.OPERATION.<agentid>
+		splitSub := strings.SplitN(r.Subject(), ".", 6)
+		agentID := splitSub[5]
+
+		update := new(models.AgentOperationUpdate)
+		err := json.Unmarshal(r.Data(), update)
+		if err != nil {
+			n.handlerError(r, err, "100", "failed to unmarshal agent operation update")
+			return
+		}
+
+		// Agents may only report on operations they were asked to run
+		op, ok := n.getOperation(update.OperationId)
+		if !ok || op.agentID != agentID {
+			n.handlerError(r, fmt.Errorf("agent %s is not running operation %s", agentID, update.OperationId), "100", "unauthorized agent operation update")
+			return
+		}
+
+		// Agents only report progress; the node decides whether the workload
+		// runs or failed
+		switch update.State {
+		case models.AgentOperationUpdateStateFetchingArtifact, models.AgentOperationUpdateStateStarting:
+		default:
+			n.handlerError(r, fmt.Errorf("invalid operation state %q", update.State), "100", "invalid agent operation update")
+			return
+		}
+
+		n.updateOperation(update.OperationId, models.OperationStatusState(update.State), "")
+
+		err = r.Respond([]byte{})
+		if err != nil {
+			n.logger.Error("failed to respond to agent operation update", slog.String("err", err.Error()))
+			return
+		}
+	}
+}
+
+func (n *NexNode) handleOperationStatus() func(micro.Request) {
+	return func(r micro.Request) {
+		// $NEX.SVC.<namespace>.control.OPERATION.<operationid>
+		splitSub := strings.SplitN(r.Subject(), ".", 6)
+		namespace := splitSub[2]
+		operationID := splitSub[5]
+
+		op, ok := n.getOperation(operationID)
+		if !ok || (op.status.Namespace != namespace && namespace != models.SystemNamespace) {
+			// not this nodes operation, throw away request
+			return
+		}
+
+		if !n.authorizeControl(r, namespace, models.ControlActionDeploy) {
+			return
+		}
+
+		err := r.RespondJSON(op.status)
+		if err != nil {
+			n.logger.Error("failed to respond to operation status request", slog.String("err", err.Error()))
+			return
+		}
+	}
+}
+
+func (n *NexNode) handleSecret(sm models.SecretManager) func(micro.Request) {
+	return func(r micro.Request) {
+		// $NEX.SVC.<namespace>.control.SECRET.<operation>
+		splitSub := strings.SplitN(r.Subject(), ".", 6)
+		namespace := splitSub[2]
+		operation := splitSub[5]
+
+		action := models.ControlActionSecretRead
+		if operation == models.SecretOperationPut || operation == models.SecretOperationDelete {
+			action = models.ControlActionSecretWrite
+		}
+		auditAction(r, string(action))
+		if !n.authorizeControl(r, namespace, action) {
+			return
+		}
+
+		req := new(models.SecretRequest)
+		err := json.Unmarshal(r.Data(), req)
+		if err != nil {
+			n.handlerError(r, err, "100", "failed to unmarshal secret request")
+			return
+		}
+
+		resp := models.SecretResponse{
+			Key:     req.Key,
+			Success: true,
+		}
+
+		auditTarget(r, req.Key)
+		if action == models.ControlActionSecretRead {
+			auditSkip(r)
+		}
+
+		switch operation {
+		case models.SecretOperationPut:
+			value, err := base64.StdEncoding.DecodeString(req.Value)
+			if err != nil {
+				n.handlerError(r, err, "100", "failed to decode secret value")
+				return
+			}
+			rev, err := sm.PutSecret(namespace, req.Key, value)
+			if err != nil {
+				n.handlerError(r, err, "100", "failed to store secret")
+				return
+			}
+			resp.Revision = int(rev)
+			n.logger.Info("secret stored", slog.String("namespace", namespace), slog.String("key", req.Key), slog.Uint64("revision", rev))
+		case models.SecretOperationGet:
+			// without a control policy anyone on the bus could read every
+			// namespace's secrets
+			if _, ok := n.cauthorizer.(*cauthorizer.AllowAllAuthorizer); ok {
+				n.handlerError(r, errors.New("retrieving secrets requires a control authorizer"), "100", "secret retrieval disabled")
+				return
+			}
+			if req.Xkey == "" {
+				n.handlerError(r, errors.New("xkey is required to retrieve a secret"), "100", "invalid secret request")
+				return
+			}
+			value, err := sm.GetSecret(namespace, req.Key)
+			if err != nil {
+				n.handlerError(r, err, "100", "failed to retrieve secret")
+				return
+			}
+			// the value is encrypted for the requester so it is never sent in
+			// the clear
+			encValue, err := n.nodeXKeypair.Seal(value, req.Xkey)
+			if err != nil {
+				n.handlerError(r, err, "100", "failed to encrypt secret")
+				return
+			}
+			resp.Xkey, err = n.nodeXKeypair.PublicKey()
+			if err != nil {
+				n.handlerError(r, err, "100", "failed to get public xkey from xkeypair")
+				return
+			}
+			resp.Value = base64.StdEncoding.EncodeToString(encValue)
+		case models.SecretOperationList:
+			resp.Keys, err = sm.ListSecrets(namespace)
+			if err != nil {
+				n.handlerError(r, err, "100", "failed to list secrets")
+				return
+			}
+		case models.SecretOperationDelete:
+			err = sm.DeleteSecret(namespace, req.Key)
+			if err != nil {
+				n.handlerError(r, err, "100", "failed to delete secret")
+				return
+			}
+			n.logger.Info("secret deleted", slog.String("namespace", namespace), slog.String("key", req.Key))
+		default:
+			n.handlerError(r, errors.New("unknown secret operation"), "100", fmt.Sprintf("unknown secret operation: %s", operation))
+			return
+		}
+
+		err = r.RespondJSON(resp)
+		if err != nil {
+			n.logger.Error("failed to respond to secret request", slog.String("err", err.Error()))
+			return
+		}
+	}
+}
+
+// registrarHeaders returns the request headers for the agent registrar with the
+// agent id assigned by the node, replacing any agent id sent by the caller
+func registrarHeaders(r micro.Request, agentID string) map[string][]string {
+	headers := nats.Header{}
+	for k, v := range r.Headers() {
+		headers[k] = v
+	}
+	headers.Set(models.AgentIdHeader, agentID)
+	return headers
+}
+
+// authorizeControl consults the control authorizer with the identity of the
+// caller and responds with an error when the request is denied
+func (n *NexNode) authorizeControl(r micro.Request, namespace string, action models.ControlAction) bool {
+	caller, err := n.cauthorizer.AuthorizeControl(r.Subject(), r.Headers(), r.Data(), namespace, action)
+	auditCaller(r, caller)
+	if err != nil {
+		auditDenied(r)
+		n.handlerError(r, err, "100", "control request not authorized: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// nodeAttributes are the values constraints are matched against: the node tags
+// and the version of each healthy agent. When agentType is set, the version of
+// that agent is also available as nex.agent.version
+func (n *NexNode) nodeAttributes(agentType string) map[string]string {
+	attrs := n.nodeTags()
+	for typ, version := range n.registeredAgents.AgentVersions() {
+		attrs[models.AgentVersionTag(typ)] = version
+		if typ == agentType {
+			attrs[models.TagAgentVersion] = version
+		}
+	}
+	return attrs
+}
+
+// skipRequest answers a request this node ignores with an empty reply when the
+// caller waits for every live node to answer
+func skipRequest(r micro.Request) {
+	if r.Headers().Get(models.ExpectReplyHeader) != "true" {
+		return
+	}
+	_ = r.Respond([]byte{})
+}
+
 func (n *NexNode) handlerError(r micro.Request, err error, code, msg string) {
 	if msg != "" {
 		n.logger.Error(msg, slog.String("err", err.Error()))
@@ -686,3 +1166,50 @@ func (n *NexNode) handlerError(r micro.Request, err error, code, msg string) {
 		n.logger.Error("failed to send micro request error message", slog.String("err", err.Error()))
 	}
 }
+
+// handleRenewWorkloadCreds re-signs the JWT sent by a workload. Only workloads
+// this node is still running can renew, so the credentials of stopped workloads
+// lapse when their JWT expires
+func (n *NexNode) handleRenewWorkloadCreds(cr models.CredRenewer) func(micro.Request) {
+	return func(r micro.Request) {
+		// $NEX.SVC.<namespace>.control.RENEWCREDS.<nodeid>.<workloadid>
+		splitSub := strings.SplitN(r.Subject(), ".", 7)
+		namespace := splitSub[2]
+		workloadID := splitSub[6]
+
+		if !n.authorizeControl(r, namespace, models.ControlActionRenewCreds) {
+			return
+		}
+
+		if !n.registeredAgents.HasWorkload(namespace, workloadID) {
+			n.handlerError(r, models.ErrCredentialsNotFound, "100", "workload is not running on this node")
+			return
+		}
+
+		connData, err := cr.Renew(namespace, workloadID, string(r.Data()))
+		if err != nil {
+			n.handlerError(r, err, "100", "failed to renew workload credentials")
+			return
+		}
+
+		err = r.RespondJSON(connData)
+		if err != nil {
+			n.logger.Error("failed to respond to renew workload credentials request", slog.String("err", err.Error()))
+			return
+		}
+	}
+}
+
+// mintWorkloadCreds limits the workload credentials to the permissions the
+// workload requested. Minters that cannot scope credentials would grant more than
+// was requested, so requesting permissions from them is an error
+func (n *NexNode) mintWorkloadCreds(namespace, workloadID string, perms *models.WorkloadPermissions) (*models.NatsConnectionData, error) {
+	if perms == nil {
+		return n.minter.Mint(models.WorkloadCred, namespace, workloadID)
+	}
+	sv, ok := n.minter.(models.ScopedCredVendor)
+	if !ok {
+		return nil, errors.New("node cannot mint scoped workload credentials")
+	}
+	return sv.MintScoped(namespace, workloadID, perms)
+}
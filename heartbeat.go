@@ -3,39 +3,121 @@ package nex
 import (
 	"encoding/json"
 	"log/slog"
+	"strings"
 	"time"
 
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
 	"github.com/synadia-io/nex/models"
 )
 
+const (
+	heartbeatInterval = 10 * time.Second
+	// nodes that miss this many heartbeats are no longer counted as live
+	missedHeartbeats = 3
+)
+
 type hb struct {
 	Registrations string `json:"registrations"`
+	// Stopping is set on the last heartbeat of a node that is shutting down
+	Stopping bool `json:"stopping,omitempty"`
 }
 
 func (n *NexNode) heartbeat() {
-	pubKey, err := n.nodeKeypair.PublicKey()
+	n.publishHeartbeat(false)
+	for range time.Tick(heartbeatInterval) {
+		if n.nc.IsClosed() {
+			return
+		}
+		n.publishHeartbeat(false)
+	}
+}
+
+func (n *NexNode) publishHeartbeat(stopping bool) {
+	beat := hb{
+		Registrations: n.registeredAgents.String(),
+		Stopping:      stopping,
+	}
+
+	hbB, err := json.Marshal(beat)
 	if err != nil {
-		n.logger.Error("failed to get public key for heartbeat", slog.String("err", err.Error()))
+		n.logger.Error("failed to Marshal heartbeat", slog.String("err", err.Error()))
 		return
 	}
 
-	for range time.Tick(10 * time.Second) {
-		if n.nc.IsClosed() {
+	err = n.nc.Publish(models.NodeEmitHeartbeatSubject(n.id), hbB)
+	if err != nil {
+		n.logger.Error("failed to publish heartbeat", slog.String("err", err.Error()))
+	}
+}
+
+// watchMembership tracks the live nodes from their heartbeats. A node seen for
+// the first time is answered with a heartbeat so it learns about this node
+// without waiting for the next interval
+func (n *NexNode) watchMembership() error {
+	_, err := n.nc.Subscribe(models.NodeHeartbeatSubscribeSubject(), func(m *nats.Msg) {
+		// $NEX.SVC.system.control.HEARTBEAT.<nodeid>
+		nodeID := m.Subject[strings.LastIndex(m.Subject, ".")+1:]
+		if nodeID == n.id {
 			return
 		}
 
-		beat := hb{
-			Registrations: n.registeredAgents.String(),
+		beat := hb{}
+		err := json.Unmarshal(m.Data, &beat)
+		if err != nil {
+			n.logger.Debug("failed to unmarshal heartbeat", slog.String("err", err.Error()), slog.String("node_id", nodeID))
+			return
 		}
 
-		hbB, err := json.Marshal(beat)
-		if err != nil {
-			n.logger.Error("failed to Marshal heartbeat", slog.String("err", err.Error()))
+		n.membersMu.Lock()
+		lastSeen, known := n.members[nodeID]
+		known = known && time.Since(lastSeen) < missedHeartbeats*heartbeatInterval
+		if beat.Stopping {
+			delete(n.members, nodeID)
+		} else {
+			n.members[nodeID] = time.Now()
+		}
+		n.membersMu.Unlock()
+
+		if !known && !beat.Stopping {
+			n.publishHeartbeat(false)
 		}
+	})
+	return err
+}
+
+// liveNodes counts the nodes that sent a heartbeat recently, including this node
+func (n *NexNode) liveNodes() int {
+	n.membersMu.Lock()
+	defer n.membersMu.Unlock()
 
-		err = n.nc.Publish(models.NodeEmitHeartbeatSubject(pubKey), hbB)
+	live := 1
+	for id, lastSeen := range n.members {
+		if time.Since(lastSeen) >= missedHeartbeats*heartbeatInterval {
+			delete(n.members, id)
+			continue
+		}
+		live++
+	}
+	return live
+}
+
+func (n *NexNode) handleMembership() func(micro.Request) {
+	return func(r micro.Request) {
+		// $NEX.SVC.<namespace>.control.MEMBERSHIP
+		splitSub := strings.SplitN(r.Subject(), ".", 5)
+		namespace := splitSub[2]
+
+		if !n.authorizeControl(r, namespace, models.ControlActionPing) {
+			return
+		}
+
+		err := r.RespondJSON(models.NexusMembershipResponse{
+			NodeCount: n.liveNodes(),
+		})
 		if err != nil {
-			n.logger.Error("failed to publish heartbeat", slog.String("err", err.Error()))
+			n.logger.Error("failed to respond to membership request", slog.String("err", err.Error()))
+			return
 		}
 	}
 }
@@ -0,0 +1,265 @@
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/synadia-io/nex/models"
+)
+
+// DefaultRulesKey is the key of the rules applied to namespaces without rules
+// of their own in an admission policy bucket
+const DefaultRulesKey = "default"
+
+var _ models.WorkloadAdmitter = (*PolicyAdmitter)(nil)
+
+var ErrDigestRequired = errors.New("run request must pin the artifact digest")
+
+// AdmissionPolicy holds the admission rules of each namespace. Namespaces
+// without rules of their own use the default rules; with no default rules
+// every start request is admitted
+type AdmissionPolicy struct {
+	Default    *AdmissionRules           `json:"default,omitempty"`
+	Namespaces map[string]AdmissionRules `json:"namespaces,omitempty"`
+}
+
+// AdmissionRules restrict the start requests of a namespace. Artifact rules
+// apply to the uri, digest and argv fields of the run request, which agents
+// such as the native nexlet use for the artifact they start. Empty rules
+// allow everything
+type AdmissionRules struct {
+	// AllowedURISchemes are the artifact URI schemes that may be started, e.g. nats
+	AllowedURISchemes []string `json:"allowed_uri_schemes,omitempty"`
+	// AllowedURIPrefixes are the prefixes the artifact URI must start with. The
+	// scheme and host must match and the cleaned path must be the prefix path or
+	// lie below it, so nats://bucket/app allows nats://bucket/app/v2 but not
+	// nats://bucket/app-evil or nats://bucket/app/../other
+	AllowedURIPrefixes []string `json:"allowed_uri_prefixes,omitempty"`
+	// RequireDigest rejects run requests that do not pin the artifact digest
+	RequireDigest bool `json:"require_digest,omitempty"`
+	// DeniedArgvPatterns are regular expressions no argument may match
+	DeniedArgvPatterns []string `json:"denied_argv_patterns,omitempty"`
+	// AllowedLifecycles are the workload lifecycles that may be started
+	AllowedLifecycles []models.WorkloadLifecycle `json:"allowed_lifecycles,omitempty"`
+	// RequiredTags must be set on the start request; an empty value only
+	// requires the tag to be present
+	RequiredTags map[string]string `json:"required_tags,omitempty"`
+
+	deniedArgv  []*regexp.Regexp
+	uriPrefixes []*url.URL
+}
+
+// compile parses the denied argv patterns and allowed uri prefixes of the rules
+func (r *AdmissionRules) compile() error {
+	r.uriPrefixes = make([]*url.URL, 0, len(r.AllowedURIPrefixes))
+	for _, p := range r.AllowedURIPrefixes {
+		u, err := url.Parse(p)
+		if err != nil || u.Scheme == "" || u.Opaque != "" {
+			return fmt.Errorf("invalid allowed uri prefix %q", p)
+		}
+		r.uriPrefixes = append(r.uriPrefixes, u)
+	}
+
+	r.deniedArgv = make([]*regexp.Regexp, 0, len(r.DeniedArgvPatterns))
+	for _, p := range r.DeniedArgvPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("invalid denied argv pattern %q: %w", p, err)
+		}
+		r.deniedArgv = append(r.deniedArgv, re)
+	}
+	return nil
+}
+
+// runRequestArtifact is the part of a run request the artifact rules apply to
+type runRequestArtifact struct {
+	Uri    string   `json:"uri"`
+	Digest string   `json:"digest"`
+	Argv   []string `json:"argv"`
+}
+
+// Admit returns the reason the start request breaks the rules
+func (r *AdmissionRules) Admit(req *models.StartWorkloadRequest) error {
+	if len(r.AllowedLifecycles) > 0 && !slices.Contains(r.AllowedLifecycles, req.WorkloadLifecycle) {
+		return fmt.Errorf("lifecycle %s is not allowed in namespace %s", req.WorkloadLifecycle, req.Namespace)
+	}
+
+	for k, v := range r.RequiredTags {
+		tag, ok := req.Tags[k]
+		if !ok {
+			return fmt.Errorf("tag %s is required in namespace %s", k, req.Namespace)
+		}
+		if v != "" && tag != v {
+			return fmt.Errorf("tag %s must be %s in namespace %s", k, v, req.Namespace)
+		}
+	}
+
+	if len(r.AllowedURISchemes) == 0 && len(r.AllowedURIPrefixes) == 0 && !r.RequireDigest && len(r.deniedArgv) == 0 {
+		return nil
+	}
+
+	artifact := new(runRequestArtifact)
+	err := json.Unmarshal([]byte(req.RunRequest), artifact)
+	if err != nil {
+		return fmt.Errorf("failed to read run request artifact: %w", err)
+	}
+
+	if len(r.AllowedURISchemes) > 0 {
+		scheme, _, found := strings.Cut(artifact.Uri, "://")
+		if !found || !slices.Contains(r.AllowedURISchemes, scheme) {
+			return fmt.Errorf("artifact uri %q does not use an allowed scheme: %s", artifact.Uri, strings.Join(r.AllowedURISchemes, ", "))
+		}
+	}
+
+	if len(r.uriPrefixes) > 0 && !uriHasPrefix(artifact.Uri, r.uriPrefixes) {
+		return fmt.Errorf("artifact uri %q does not start with an allowed prefix: %s", artifact.Uri, strings.Join(r.AllowedURIPrefixes, ", "))
+	}
+
+	if r.RequireDigest && artifact.Digest == "" {
+		return ErrDigestRequired
+	}
+
+	for _, arg := range artifact.Argv {
+		for _, re := range r.deniedArgv {
+			if re.MatchString(arg) {
+				return fmt.Errorf("argument %q matches denied pattern %q", arg, re.String())
+			}
+		}
+	}
+
+	return nil
+}
+
+// uriHasPrefix reports whether the uri has the scheme and host of one of the
+// prefixes and its cleaned path is the prefix path or a path below it
+func uriHasPrefix(uri string, prefixes []*url.URL) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Opaque != "" {
+		return false
+	}
+	uriPath := path.Clean("/" + u.Path)
+
+	return slices.ContainsFunc(prefixes, func(p *url.URL) bool {
+		if u.Scheme != p.Scheme || !strings.EqualFold(u.Host, p.Host) || u.User.String() != p.User.String() {
+			return false
+		}
+		prefixPath := path.Clean("/" + p.Path)
+		return prefixPath == "/" || uriPath == prefixPath || strings.HasPrefix(uriPath, prefixPath+"/")
+	})
+}
+
+// PolicyAdmitter admits start requests that follow the admission rules of
+// their namespace
+type PolicyAdmitter struct {
+	rules func(namespace string) (*AdmissionRules, error)
+}
+
+// NewPolicyFileAdmitter loads a JSON admission policy from path
+func NewPolicyFileAdmitter(path string) (*PolicyAdmitter, error) {
+	policyB, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := new(AdmissionPolicy)
+	err = json.Unmarshal(policyB, policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse admission policy: %w", err)
+	}
+
+	return NewPolicyAdmitter(policy)
+}
+
+func NewPolicyAdmitter(policy *AdmissionPolicy) (*PolicyAdmitter, error) {
+	if policy.Default != nil {
+		err := policy.Default.compile()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	namespaces := make(map[string]*AdmissionRules, len(policy.Namespaces))
+	for ns, rules := range policy.Namespaces {
+		err := rules.compile()
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %w", ns, err)
+		}
+		namespaces[ns] = &rules
+	}
+
+	return &PolicyAdmitter{
+		rules: func(namespace string) (*AdmissionRules, error) {
+			if rules, ok := namespaces[namespace]; ok {
+				return rules, nil
+			}
+			return policy.Default, nil
+		},
+	}, nil
+}
+
+// NewNatsKVAdmitter reads the admission rules of each namespace from a KV
+// bucket on every start request, so changes apply without restarting nodes.
+// Rules are stored under namespaces.<namespace>; the default key holds the
+// default rules
+func NewNatsKVAdmitter(ctx context.Context, nc *nats.Conn, bucket string) (*PolicyAdmitter, error) {
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      bucket,
+		Description: "Nex workload admission rules",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create admission policy bucket: %w", err)
+	}
+
+	get := func(key string) (*AdmissionRules, error) {
+		entry, err := kv.Get(ctx, key)
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rules := new(AdmissionRules)
+		err = json.Unmarshal(entry.Value(), rules)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse admission rules %s: %w", key, err)
+		}
+		return rules, rules.compile()
+	}
+
+	return &PolicyAdmitter{
+		rules: func(namespace string) (*AdmissionRules, error) {
+			rules, err := get("namespaces." + namespace)
+			if err != nil || rules != nil {
+				return rules, err
+			}
+			return get(DefaultRulesKey)
+		},
+	}, nil
+}
+
+func (p *PolicyAdmitter) AdmitWorkload(req *models.StartWorkloadRequest) error {
+	rules, err := p.rules(req.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to load admission rules: %w", err)
+	}
+	if rules == nil {
+		return nil
+	}
+	return rules.Admit(req)
+}
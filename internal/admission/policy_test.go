@@ -0,0 +1,119 @@
+package admission
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/carlmjohnson/be"
+	"github.com/synadia-io/nex/models"
+)
+
+func startRequest(namespace, runRequest string, lifecycle models.WorkloadLifecycle, tags models.NodeTags) *models.StartWorkloadRequest {
+	return &models.StartWorkloadRequest{
+		Namespace:         namespace,
+		RunRequest:        runRequest,
+		WorkloadLifecycle: lifecycle,
+		WorkloadType:      "native",
+		Tags:              tags,
+	}
+}
+
+func TestPolicyAdmitter(t *testing.T) {
+	a, err := NewPolicyAdmitter(&AdmissionPolicy{
+		Default: &AdmissionRules{
+			AllowedURISchemes: []string{"nats"},
+			RequireDigest:     true,
+		},
+		Namespaces: map[string]AdmissionRules{
+			"demo": {
+				AllowedURIPrefixes: []string{"nats://demo-artifacts/"},
+				DeniedArgvPatterns: []string{"^-c$"},
+				AllowedLifecycles:  []models.WorkloadLifecycle{models.WorkloadLifecycleService},
+				RequiredTags:       map[string]string{"team": "", "env": "dev"},
+			},
+			"open": {},
+		},
+	})
+	be.NilErr(t, err)
+
+	demoTags := models.NodeTags{"team": "a", "env": "dev"}
+
+	t.Run("default rules", func(t *testing.T) {
+		be.NilErr(t, a.AdmitWorkload(startRequest("other", `{"uri":"nats://bin/app","digest":"abc"}`, models.WorkloadLifecycleJob, nil)))
+
+		err := a.AdmitWorkload(startRequest("other", `{"uri":"file:///bin/sh"}`, models.WorkloadLifecycleJob, nil))
+		be.In(t, "allowed scheme", err.Error())
+
+		err = a.AdmitWorkload(startRequest("other", `{"uri":"nats://bin/app"}`, models.WorkloadLifecycleJob, nil))
+		be.Equal(t, ErrDigestRequired, err)
+	})
+
+	t.Run("namespace rules", func(t *testing.T) {
+		be.NilErr(t, a.AdmitWorkload(startRequest("demo", `{"uri":"nats://demo-artifacts/app","argv":["--port","8080"]}`, models.WorkloadLifecycleService, demoTags)))
+
+		err := a.AdmitWorkload(startRequest("demo", `{"uri":"nats://other/app"}`, models.WorkloadLifecycleService, demoTags))
+		be.In(t, "allowed prefix", err.Error())
+
+		err = a.AdmitWorkload(startRequest("demo", `{"uri":"nats://demo-artifacts-evil/app"}`, models.WorkloadLifecycleService, demoTags))
+		be.In(t, "allowed prefix", err.Error())
+
+		err = a.AdmitWorkload(startRequest("demo", `{"uri":"nats://demo-artifacts/sh","argv":["-c","id"]}`, models.WorkloadLifecycleService, demoTags))
+		be.In(t, "denied pattern", err.Error())
+
+		err = a.AdmitWorkload(startRequest("demo", `{"uri":"nats://demo-artifacts/app"}`, models.WorkloadLifecycleJob, demoTags))
+		be.In(t, "lifecycle job", err.Error())
+
+		err = a.AdmitWorkload(startRequest("demo", `{"uri":"nats://demo-artifacts/app"}`, models.WorkloadLifecycleService, models.NodeTags{"env": "dev"}))
+		be.In(t, "tag team is required", err.Error())
+
+		err = a.AdmitWorkload(startRequest("demo", `{"uri":"nats://demo-artifacts/app"}`, models.WorkloadLifecycleService, models.NodeTags{"team": "a", "env": "prod"}))
+		be.In(t, "tag env must be dev", err.Error())
+	})
+
+	t.Run("uri prefix path", func(t *testing.T) {
+		a, err := NewPolicyAdmitter(&AdmissionPolicy{
+			Default: &AdmissionRules{AllowedURIPrefixes: []string{"nats://artifacts/demo"}},
+		})
+		be.NilErr(t, err)
+
+		for _, uri := range []string{"nats://artifacts/demo", "nats://artifacts/demo/app", "nats://artifacts/lib/../demo/app"} {
+			be.NilErr(t, a.AdmitWorkload(startRequest("any", `{"uri":"`+uri+`"}`, models.WorkloadLifecycleJob, nil)))
+		}
+		for _, uri := range []string{"nats://artifacts/demo-evil/app", "nats://artifacts/demo/../other/app", "nats://artifacts/demo/%2e%2e/other/app", "nats://other/demo/app", "file://artifacts/demo/app", "nats:artifacts/demo/app"} {
+			err := a.AdmitWorkload(startRequest("any", `{"uri":"`+uri+`"}`, models.WorkloadLifecycleJob, nil))
+			be.Nonzero(t, err)
+			be.In(t, "allowed prefix", err.Error())
+		}
+
+		_, err = NewPolicyAdmitter(&AdmissionPolicy{
+			Default: &AdmissionRules{AllowedURIPrefixes: []string{"demo-artifacts/"}},
+		})
+		be.Nonzero(t, err)
+	})
+
+	t.Run("empty rules", func(t *testing.T) {
+		be.NilErr(t, a.AdmitWorkload(startRequest("open", `{"uri":"file:///bin/sh","argv":["-c","id"]}`, models.WorkloadLifecycleJob, nil)))
+	})
+
+	t.Run("no default", func(t *testing.T) {
+		a, err := NewPolicyAdmitter(&AdmissionPolicy{})
+		be.NilErr(t, err)
+		be.NilErr(t, a.AdmitWorkload(startRequest("any", `{"uri":"file:///bin/sh"}`, models.WorkloadLifecycleJob, nil)))
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := NewPolicyAdmitter(&AdmissionPolicy{Default: &AdmissionRules{DeniedArgvPatterns: []string{"("}}})
+		be.Nonzero(t, err)
+	})
+}
+
+func TestPolicyFileAdmitter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admission.json")
+	be.NilErr(t, os.WriteFile(path, []byte(`{"namespaces":{"demo":{"allowed_lifecycles":["job"]}}}`), 0o600))
+
+	a, err := NewPolicyFileAdmitter(path)
+	be.NilErr(t, err)
+	be.NilErr(t, a.AdmitWorkload(startRequest("demo", `{"uri":"file:///bin/app"}`, models.WorkloadLifecycleJob, nil)))
+	be.Nonzero(t, a.AdmitWorkload(startRequest("demo", `{"uri":"file:///bin/app"}`, models.WorkloadLifecycleService, nil)))
+}
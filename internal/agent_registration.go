@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -62,8 +63,14 @@ type (
 		HealthStatus      AgentHealthStatus            `json:"health_status"`
 		lastHeartbeat     time.Time                    `json:"-"`
 		lastHeartbeatData models.AgentSummary          `json:"-"`
+		workloads         map[string]trackedWorkload   `json:"-"` // maps workloadID to namespace
 		rwLock            sync.RWMutex                 `json:"-"`
 	}
+	// trackedWorkload is a workload an agent was asked to start
+	trackedWorkload struct {
+		namespace string
+		added     time.Time
+	}
 	AgentRegistrations struct {
 		ctx    context.Context `json:"-"`
 		rwLock sync.RWMutex    `json:"-"`
@@ -158,6 +165,22 @@ func (ar *AgentRegistrations) GetByRegisterType(registerType string) (*AgentRegi
 	return nil, fmt.Errorf("no agent registrations found for type: %s", registerType)
 }
 
+// AgentVersions maps the register type of each healthy agent to its version
+func (ar *AgentRegistrations) AgentVersions() map[string]string {
+	ar.rwLock.RLock()
+	defer ar.rwLock.RUnlock()
+
+	ret := make(map[string]string, len(ar.Registrations))
+	for _, reg := range ar.Registrations {
+		reg.rwLock.RLock()
+		if reg.HealthStatus == AgentHealthy {
+			ret[reg.RegisterRequest.RegisterType] = reg.RegisterRequest.Version
+		}
+		reg.rwLock.RUnlock()
+	}
+	return ret
+}
+
 func (ar *AgentRegistrations) GetByRegisterName(registerName string) (*AgentRegistration, error) {
 	ar.rwLock.RLock()
 	defer ar.rwLock.RUnlock()
@@ -187,12 +210,136 @@ func (ar *AgentRegistrations) Add(reg *AgentRegistration) error {
 	reg.rwLock = sync.RWMutex{}                   // Ensure the registration has its own lock
 	reg.HealthStatus = AgentUnknown               // Default health status when adding a new registration
 	reg.lastHeartbeatData = models.AgentSummary{} // Initialize last heartbeat data
+	reg.workloads = make(map[string]trackedWorkload)
 	go ar.startAgentHeartbeatMonitor(reg)
 
 	ar.Registrations[reg.ID] = reg
 	return nil
 }
 
+// AddWorkload records that the agent is running (or starting) a workload in the given namespace
+func (ar *AgentRegistrations) AddWorkload(agentID, workloadID, namespace string) error {
+	ar.rwLock.RLock()
+	defer ar.rwLock.RUnlock()
+
+	reg, ok := ar.Registrations[agentID]
+	if !ok {
+		return fmt.Errorf("agent %s is not registered", agentID)
+	}
+
+	reg.rwLock.Lock()
+	reg.workloads[workloadID] = trackedWorkload{namespace: namespace, added: time.Now()}
+	reg.rwLock.Unlock()
+	return nil
+}
+
+// RemoveWorkload removes the workload from whichever agent was running it
+func (ar *AgentRegistrations) RemoveWorkload(workloadID string) {
+	ar.rwLock.RLock()
+	defer ar.rwLock.RUnlock()
+
+	for _, reg := range ar.Registrations {
+		reg.rwLock.Lock()
+		delete(reg.workloads, workloadID)
+		reg.rwLock.Unlock()
+	}
+}
+
+// HasNamespace returns true if the agent is running at least one workload in the namespace
+func (ar *AgentRegistrations) HasNamespace(agentID, namespace string) bool {
+	ar.rwLock.RLock()
+	defer ar.rwLock.RUnlock()
+
+	reg, ok := ar.Registrations[agentID]
+	if !ok {
+		return false
+	}
+
+	reg.rwLock.RLock()
+	defer reg.rwLock.RUnlock()
+	for _, w := range reg.workloads {
+		if w.namespace == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// HasWorkload returns true if any agent is running (or starting) the workload in the namespace
+func (ar *AgentRegistrations) HasWorkload(namespace, workloadID string) bool {
+	ar.rwLock.RLock()
+	defer ar.rwLock.RUnlock()
+
+	for _, reg := range ar.Registrations {
+		reg.rwLock.RLock()
+		w, ok := reg.workloads[workloadID]
+		reg.rwLock.RUnlock()
+		if ok && w.namespace == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// AgentsInNamespace returns the IDs of the agents running at least one
+// workload in the namespace
+func (ar *AgentRegistrations) AgentsInNamespace(namespace string) []string {
+	ar.rwLock.RLock()
+	defer ar.rwLock.RUnlock()
+
+	ids := []string{}
+	for id, reg := range ar.Registrations {
+		reg.rwLock.RLock()
+		for _, w := range reg.workloads {
+			if w.namespace == namespace {
+				ids = append(ids, id)
+				break
+			}
+		}
+		reg.rwLock.RUnlock()
+	}
+	return ids
+}
+
+// WorkloadNamespaces returns the namespaces of the workloads of all agents
+func (ar *AgentRegistrations) WorkloadNamespaces() []string {
+	ar.rwLock.RLock()
+	defer ar.rwLock.RUnlock()
+
+	namespaces := []string{}
+	for _, reg := range ar.Registrations {
+		reg.rwLock.RLock()
+		for _, w := range reg.workloads {
+			if !slices.Contains(namespaces, w.namespace) {
+				namespaces = append(namespaces, w.namespace)
+			}
+		}
+		reg.rwLock.RUnlock()
+	}
+	return namespaces
+}
+
+// PruneWorkloads removes the workloads of the namespace that were added before
+// the given time and are not among the live workloads. Workloads that exit on
+// their own are only noticed this way
+func (ar *AgentRegistrations) PruneWorkloads(namespace string, live []string, before time.Time) []string {
+	ar.rwLock.RLock()
+	defer ar.rwLock.RUnlock()
+
+	pruned := []string{}
+	for _, reg := range ar.Registrations {
+		reg.rwLock.Lock()
+		for id, w := range reg.workloads {
+			if w.namespace == namespace && w.added.Before(before) && !slices.Contains(live, id) {
+				delete(reg.workloads, id)
+				pruned = append(pruned, id)
+			}
+		}
+		reg.rwLock.Unlock()
+	}
+	return pruned
+}
+
 func (ar *AgentRegistrations) startAgentHeartbeatMonitor(a *AgentRegistration) {
 	sub, err := ar.nc.Subscribe(models.AgentAPIHeartbeatSubject(ar.nodeID, a.ID), func(msg *nats.Msg) {
 		var agentHeartbeat models.AgentHeartbeat
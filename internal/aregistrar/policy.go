@@ -0,0 +1,240 @@
+package aregistrar
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/nex/internal"
+	"github.com/synadia-io/nex/models"
+)
+
+// DefaultRegistrationWindow is how long a remote agent has to send its REGISTER
+// request after it was assigned an agent id
+const DefaultRegistrationWindow = time.Minute
+
+var _ models.AgentRegistrar = (*PolicyRegistrar)(nil)
+
+var (
+	ErrMissingAgentKey       = errors.New("remote agent did not provide a public key")
+	ErrAgentNotAllowed       = errors.New("remote agent key is not allowed to register")
+	ErrInvalidJoinToken      = errors.New("invalid agent join token")
+	ErrUnknownRegistration   = errors.New("agent id was not assigned to a remote agent or has expired")
+	ErrInvalidAgentSignature = errors.New("invalid agent registration signature")
+)
+
+// AgentPolicy lists the remote agents allowed to register with a node and the
+// issuers whose join tokens the node accepts
+type AgentPolicy struct {
+	Agents []AgentPolicyAgent `json:"agents"`
+	// TrustedIssuers are the public keys, usually a node or operator key, that
+	// may sign join tokens
+	TrustedIssuers []string `json:"trusted_issuers"`
+}
+
+type AgentPolicyAgent struct {
+	Name string `json:"name,omitempty"`
+	// PublicKey is the public user nkey the agent identifies with
+	PublicKey string `json:"public_key"`
+	// RegisterTypes the agent may register; * allows every type
+	RegisterTypes []string `json:"register_types"`
+}
+
+// PolicyRegistrar only lets remote agents register when their key is in the
+// AgentPolicy or they present a join token from a trusted issuer. The agent
+// proves it owns the key by signing the agent id the node assigned to it
+type PolicyRegistrar struct {
+	policy  *AgentPolicy
+	issuers []string
+
+	mu      sync.Mutex
+	pending *internal.TTLMap
+}
+
+// NewPolicyFileRegistrar loads a JSON agent policy from path. Additional
+// trusted issuers, such as the node key, are added to the policy issuers
+func NewPolicyFileRegistrar(path string, issuers ...string) (*PolicyRegistrar, error) {
+	policyB, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := new(AgentPolicy)
+	err = json.Unmarshal(policyB, policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse agent policy: %w", err)
+	}
+
+	return NewPolicyRegistrar(policy, issuers...)
+}
+
+func NewPolicyRegistrar(policy *AgentPolicy, issuers ...string) (*PolicyRegistrar, error) {
+	for _, a := range policy.Agents {
+		if !nkeys.IsValidPublicUserKey(a.PublicKey) {
+			return nil, fmt.Errorf("agent policy agent %q does not have a valid user nkey", a.Name)
+		}
+	}
+
+	trusted := slices.Concat(policy.TrustedIssuers, issuers)
+	for _, i := range trusted {
+		if !nkeys.IsValidPublicServerKey(i) && !nkeys.IsValidPublicOperatorKey(i) {
+			return nil, fmt.Errorf("trusted issuer %s is not a valid server or operator key", i)
+		}
+	}
+
+	return &PolicyRegistrar{
+		policy:  policy,
+		issuers: trusted,
+		pending: internal.NewTTLMap(DefaultRegistrationWindow),
+	}, nil
+}
+
+// NewJoinToken returns a join token that lets the agent with the public key
+// agentKey register the given types until the token expires. A ttl of 0 issues
+// a token that does not expire
+func NewJoinToken(issuer nkeys.KeyPair, agentKey string, registerTypes []string, ttl time.Duration) (string, error) {
+	if !nkeys.IsValidPublicUserKey(agentKey) {
+		return "", errors.New("agent key must be a public user nkey")
+	}
+	if len(registerTypes) == 0 {
+		return "", errors.New("at least one register type is required")
+	}
+
+	claims := jwt.NewGenericClaims(agentKey)
+	claims.Name = "nex agent join token"
+	if ttl > 0 {
+		claims.Expires = time.Now().Add(ttl).Unix()
+	}
+	claims.Data["type"] = models.AgentJoinTokenType
+	claims.Data["register_types"] = registerTypes
+
+	return claims.Encode(issuer)
+}
+
+func (p *PolicyRegistrar) RegisterRemoteInit(headers map[string][]string, _ *models.RegisterRemoteAgentRequest) error {
+	agentID := header(headers, models.AgentIdHeader)
+	agentKey := header(headers, models.AgentKeyHeader)
+	if agentKey == "" {
+		return ErrMissingAgentKey
+	}
+	if !nkeys.IsValidPublicUserKey(agentKey) {
+		return ErrAgentNotAllowed
+	}
+
+	var registerTypes []string
+	for _, a := range p.policy.Agents {
+		if a.PublicKey == agentKey {
+			registerTypes = append(registerTypes, a.RegisterTypes...)
+		}
+	}
+
+	if token := header(headers, models.AgentTokenHeader); token != "" {
+		tokenTypes, err := p.verifyToken(token, agentKey)
+		if err != nil {
+			return err
+		}
+		registerTypes = append(registerTypes, tokenTypes...)
+	}
+
+	if len(registerTypes) == 0 {
+		return ErrAgentNotAllowed
+	}
+
+	agentKp, err := nkeys.FromPublicKey(agentKey)
+	if err != nil {
+		return ErrAgentNotAllowed
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending.Put(agentID, strings.Join(registerTypes, ","), agentKp)
+
+	return nil
+}
+
+func (p *PolicyRegistrar) RegisterAgent(headers map[string][]string, req *models.RegisterAgentRequest) error {
+	agentID := header(headers, models.AgentIdHeader)
+
+	// the agent id is only good for one registration attempt
+	p.mu.Lock()
+	registerTypes, agentKp := p.pending.Get(agentID)
+	p.pending.Delete(agentID)
+	p.mu.Unlock()
+	if agentKp == nil {
+		return ErrUnknownRegistration
+	}
+
+	agentKey, err := agentKp.PublicKey()
+	if err != nil {
+		return err
+	}
+	if header(headers, models.AgentKeyHeader) != agentKey {
+		return ErrInvalidAgentSignature
+	}
+
+	sigB, err := base64.RawURLEncoding.DecodeString(header(headers, models.AgentSignatureHeader))
+	if err != nil || len(sigB) == 0 {
+		return ErrInvalidAgentSignature
+	}
+	err = agentKp.Verify([]byte(agentID), sigB)
+	if err != nil {
+		return ErrInvalidAgentSignature
+	}
+
+	allowed := strings.Split(registerTypes, ",")
+	if !slices.Contains(allowed, "*") && !slices.Contains(allowed, req.RegisterType) {
+		return fmt.Errorf("agent %s is not allowed to register type %s", agentKey, req.RegisterType)
+	}
+
+	return nil
+}
+
+// verifyToken checks a join token was issued for agentKey by a trusted issuer
+// and returns the register types it allows
+func (p *PolicyRegistrar) verifyToken(token, agentKey string) ([]string, error) {
+	claims, err := jwt.DecodeGeneric(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJoinToken, err)
+	}
+
+	if claims.Data["type"] != models.AgentJoinTokenType || claims.Subject != agentKey {
+		return nil, ErrInvalidJoinToken
+	}
+	if !slices.Contains(p.issuers, claims.Issuer) {
+		return nil, fmt.Errorf("%w: issuer %s is not trusted", ErrInvalidJoinToken, claims.Issuer)
+	}
+
+	vr := jwt.CreateValidationResults()
+	claims.Validate(vr)
+	if vr.IsBlocking(true) {
+		return nil, fmt.Errorf("%w: token is expired", ErrInvalidJoinToken)
+	}
+
+	rawTypes, ok := claims.Data["register_types"].([]any)
+	if !ok {
+		return nil, ErrInvalidJoinToken
+	}
+	registerTypes := make([]string, 0, len(rawTypes))
+	for _, rt := range rawTypes {
+		if s, ok := rt.(string); ok {
+			registerTypes = append(registerTypes, s)
+		}
+	}
+
+	return registerTypes, nil
+}
+
+func header(headers map[string][]string, key string) string {
+	if v := headers[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
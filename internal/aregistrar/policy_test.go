@@ -0,0 +1,149 @@
+package aregistrar
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/carlmjohnson/be"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/nex/models"
+)
+
+func initHeaders(t testing.TB, kp nkeys.KeyPair, agentID, token string) map[string][]string {
+	t.Helper()
+
+	pub, err := kp.PublicKey()
+	be.NilErr(t, err)
+
+	headers := map[string][]string{
+		models.AgentIdHeader:  {agentID},
+		models.AgentKeyHeader: {pub},
+	}
+	if token != "" {
+		headers[models.AgentTokenHeader] = []string{token}
+	}
+	return headers
+}
+
+func registerHeaders(t testing.TB, kp nkeys.KeyPair, agentID string) map[string][]string {
+	t.Helper()
+
+	pub, err := kp.PublicKey()
+	be.NilErr(t, err)
+	sig, err := kp.Sign([]byte(agentID))
+	be.NilErr(t, err)
+
+	return map[string][]string{
+		models.AgentIdHeader:        {agentID},
+		models.AgentKeyHeader:       {pub},
+		models.AgentSignatureHeader: {base64.RawURLEncoding.EncodeToString(sig)},
+	}
+}
+
+func TestPolicyRegistrar(t *testing.T) {
+	agentKp, err := nkeys.CreateUser()
+	be.NilErr(t, err)
+	agentPub, err := agentKp.PublicKey()
+	be.NilErr(t, err)
+	strangerKp, err := nkeys.CreateUser()
+	be.NilErr(t, err)
+
+	r, err := NewPolicyRegistrar(&AgentPolicy{
+		Agents: []AgentPolicyAgent{
+			{Name: "edge", PublicKey: agentPub, RegisterTypes: []string{"native"}},
+		},
+	})
+	be.NilErr(t, err)
+
+	native := &models.RegisterAgentRequest{RegisterType: "native"}
+
+	be.NilErr(t, r.RegisterRemoteInit(initHeaders(t, agentKp, "agent1", ""), nil))
+	be.NilErr(t, r.RegisterAgent(registerHeaders(t, agentKp, "agent1"), native))
+
+	t.Run("single use", func(t *testing.T) {
+		be.Equal(t, ErrUnknownRegistration, r.RegisterAgent(registerHeaders(t, agentKp, "agent1"), native))
+	})
+
+	t.Run("not allowlisted", func(t *testing.T) {
+		be.Equal(t, ErrAgentNotAllowed, r.RegisterRemoteInit(initHeaders(t, strangerKp, "agent2", ""), nil))
+		be.Equal(t, ErrMissingAgentKey, r.RegisterRemoteInit(map[string][]string{models.AgentIdHeader: {"agent2"}}, nil))
+	})
+
+	t.Run("register type", func(t *testing.T) {
+		be.NilErr(t, r.RegisterRemoteInit(initHeaders(t, agentKp, "agent3", ""), nil))
+		be.Nonzero(t, r.RegisterAgent(registerHeaders(t, agentKp, "agent3"), &models.RegisterAgentRequest{RegisterType: "wasm"}))
+	})
+
+	t.Run("wrong signer", func(t *testing.T) {
+		be.NilErr(t, r.RegisterRemoteInit(initHeaders(t, agentKp, "agent4", ""), nil))
+		be.Equal(t, ErrInvalidAgentSignature, r.RegisterAgent(registerHeaders(t, strangerKp, "agent4"), native))
+	})
+
+	t.Run("signed other agent id", func(t *testing.T) {
+		be.NilErr(t, r.RegisterRemoteInit(initHeaders(t, agentKp, "agent5", ""), nil))
+		headers := registerHeaders(t, agentKp, "agent6")
+		headers[models.AgentIdHeader] = []string{"agent5"}
+		be.Equal(t, ErrInvalidAgentSignature, r.RegisterAgent(headers, native))
+	})
+}
+
+func TestPolicyRegistrarJoinToken(t *testing.T) {
+	nodeKp, err := nkeys.CreateServer()
+	be.NilErr(t, err)
+	nodePub, err := nodeKp.PublicKey()
+	be.NilErr(t, err)
+	operatorKp, err := nkeys.CreateOperator()
+	be.NilErr(t, err)
+	operatorPub, err := operatorKp.PublicKey()
+	be.NilErr(t, err)
+	untrustedKp, err := nkeys.CreateOperator()
+	be.NilErr(t, err)
+	agentKp, err := nkeys.CreateUser()
+	be.NilErr(t, err)
+	agentPub, err := agentKp.PublicKey()
+	be.NilErr(t, err)
+	otherKp, err := nkeys.CreateUser()
+	be.NilErr(t, err)
+
+	r, err := NewPolicyRegistrar(&AgentPolicy{TrustedIssuers: []string{operatorPub}}, nodePub)
+	be.NilErr(t, err)
+
+	t.Run("node issued", func(t *testing.T) {
+		token, err := NewJoinToken(nodeKp, agentPub, []string{"wasm"}, time.Minute)
+		be.NilErr(t, err)
+
+		be.NilErr(t, r.RegisterRemoteInit(initHeaders(t, agentKp, "agent1", token), nil))
+		be.NilErr(t, r.RegisterAgent(registerHeaders(t, agentKp, "agent1"), &models.RegisterAgentRequest{RegisterType: "wasm"}))
+	})
+
+	t.Run("operator issued", func(t *testing.T) {
+		token, err := NewJoinToken(operatorKp, agentPub, []string{"*"}, 0)
+		be.NilErr(t, err)
+
+		be.NilErr(t, r.RegisterRemoteInit(initHeaders(t, agentKp, "agent2", token), nil))
+		be.NilErr(t, r.RegisterAgent(registerHeaders(t, agentKp, "agent2"), &models.RegisterAgentRequest{RegisterType: "native"}))
+	})
+
+	t.Run("untrusted issuer", func(t *testing.T) {
+		token, err := NewJoinToken(untrustedKp, agentPub, []string{"wasm"}, time.Minute)
+		be.NilErr(t, err)
+
+		be.True(t, errors.Is(r.RegisterRemoteInit(initHeaders(t, agentKp, "agent3", token), nil), ErrInvalidJoinToken))
+	})
+
+	t.Run("issued for another key", func(t *testing.T) {
+		token, err := NewJoinToken(nodeKp, agentPub, []string{"wasm"}, time.Minute)
+		be.NilErr(t, err)
+
+		be.True(t, errors.Is(r.RegisterRemoteInit(initHeaders(t, otherKp, "agent4", token), nil), ErrInvalidJoinToken))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		token, err := NewJoinToken(nodeKp, agentPub, []string{"wasm"}, time.Second)
+		be.NilErr(t, err)
+		time.Sleep(2100 * time.Millisecond)
+		be.True(t, errors.Is(r.RegisterRemoteInit(initHeaders(t, agentKp, "agent5", token), nil), ErrInvalidJoinToken))
+	})
+}
@@ -0,0 +1,297 @@
+package auctioneer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/synadia-io/nex/models"
+)
+
+const (
+	quotaQueueGroup     = "nex-quota"
+	maxUsageUpdateTries = 10
+)
+
+var (
+	_ models.Auctioneer         = (*QuotaAuctioneer)(nil)
+	_ models.ResourceAuctioneer = (*QuotaAuctioneer)(nil)
+	_ models.WorkloadReserver   = (*QuotaAuctioneer)(nil)
+)
+
+var ErrUsageConflict = errors.New("namespace quota usage changed too often while updating")
+
+// quotaWorkload is what a reserved workload counts against its namespace quota,
+// kept so the usage can be released when the workload stops
+type quotaWorkload struct {
+	WorkloadType string                    `json:"workload_type"`
+	Resources    *models.WorkloadResources `json:"resources,omitempty"`
+}
+
+// QuotaAuctioneer declines auctions and deployments that would take a namespace
+// over its quota. Quotas and usage live in a KV bucket shared by every node in
+// the nexus; usage is released when a WorkloadStoppedEvent is received
+type QuotaAuctioneer struct {
+	ctx    context.Context
+	kv     jetstream.KeyValue
+	logger *slog.Logger
+	sub    *nats.Subscription
+}
+
+// NewQuotaAuctioneer creates the quota bucket if it does not exist and listens
+// for stopped workloads until ctx is done. Agents must emit events over NATS
+// for usage to be released
+func NewQuotaAuctioneer(ctx context.Context, nc *nats.Conn, bucket string, logger *slog.Logger) (*QuotaAuctioneer, error) {
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      bucket,
+		Description: "Nex namespace quotas",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quota bucket: %w", err)
+	}
+
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	q := &QuotaAuctioneer{
+		ctx:    ctx,
+		kv:     kv,
+		logger: logger,
+	}
+
+	q.sub, err = nc.QueueSubscribe(models.EventAPIPrefix("*")+"."+models.WorkloadStoppedEvent{}.String(), quotaQueueGroup, q.handleWorkloadStopped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to workload stopped events: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = q.sub.Unsubscribe()
+	}()
+
+	return q, nil
+}
+
+func (q *QuotaAuctioneer) Auction(namespace, agentType string, auctionTags map[string]string) error {
+	return q.AuctionResources(namespace, agentType, auctionTags, nil)
+}
+
+func (q *QuotaAuctioneer) AuctionResources(namespace, agentType string, _ map[string]string, res *models.WorkloadResources) error {
+	quota, err := q.quota(namespace)
+	if err != nil || quota == nil {
+		return err
+	}
+
+	usage, _, err := q.usage(namespace)
+	if err != nil {
+		return err
+	}
+
+	return checkQuota(namespace, quota, usage, agentType, res)
+}
+
+func (q *QuotaAuctioneer) ReserveWorkload(workloadID string, req *models.StartWorkloadRequest) error {
+	// usage is counted without a quota so it is accurate once a quota is set
+	quota, err := q.quota(req.Namespace)
+	if err != nil {
+		return err
+	}
+	if quota == nil {
+		quota = new(models.NamespaceQuota)
+	}
+
+	err = q.updateUsage(req.Namespace, func(usage *models.NamespaceQuotaUsage) error {
+		err := checkQuota(req.Namespace, quota, usage, req.WorkloadType, req.Resources)
+		if err != nil {
+			return err
+		}
+		addUsage(usage, req.WorkloadType, req.Resources, 1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	wB, err := json.Marshal(quotaWorkload{WorkloadType: req.WorkloadType, Resources: req.Resources})
+	if err != nil {
+		return err
+	}
+
+	_, err = q.kv.Put(q.ctx, workloadKey(req.Namespace, workloadID), wB)
+	return err
+}
+
+func (q *QuotaAuctioneer) ReleaseWorkload(namespace, workloadID string) error {
+	entry, err := q.kv.Get(q.ctx, workloadKey(namespace, workloadID))
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		// not reserved by a quota auctioneer, or already released
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	w := new(quotaWorkload)
+	err = json.Unmarshal(entry.Value(), w)
+	if err != nil {
+		return err
+	}
+
+	// only the caller that removes the reservation releases its usage, so
+	// duplicate stop events are not counted twice
+	err = q.kv.Delete(q.ctx, workloadKey(namespace, workloadID), jetstream.LastRevision(entry.Revision()))
+	if revisionConflict(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return q.updateUsage(namespace, func(usage *models.NamespaceQuotaUsage) error {
+		addUsage(usage, w.WorkloadType, w.Resources, -1)
+		return nil
+	})
+}
+
+func (q *QuotaAuctioneer) handleWorkloadStopped(msg *nats.Msg) {
+	event := new(models.WorkloadStoppedEvent)
+	err := json.Unmarshal(msg.Data, event)
+	if err != nil {
+		q.logger.Warn("failed to unmarshal workload stopped event", slog.String("err", err.Error()))
+		return
+	}
+
+	err = q.ReleaseWorkload(event.Namespace, event.Id)
+	if err != nil {
+		q.logger.Error("failed to release workload quota", slog.String("err", err.Error()), slog.String("namespace", event.Namespace), slog.String("workload_id", event.Id))
+	}
+}
+
+func (q *QuotaAuctioneer) quota(namespace string) (*models.NamespaceQuota, error) {
+	entry, err := q.kv.Get(q.ctx, models.QuotaKey(namespace))
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	quota := new(models.NamespaceQuota)
+	err = json.Unmarshal(entry.Value(), quota)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal quota for namespace %s: %w", namespace, err)
+	}
+	return quota, nil
+}
+
+// usage returns the usage of a namespace and the revision it was read at; the
+// revision is 0 when nothing has been counted yet
+func (q *QuotaAuctioneer) usage(namespace string) (*models.NamespaceQuotaUsage, uint64, error) {
+	usage := &models.NamespaceQuotaUsage{WorkloadsPerType: make(models.NamespaceQuotaUsageWorkloadsPerType)}
+
+	entry, err := q.kv.Get(q.ctx, models.QuotaUsageKey(namespace))
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return usage, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = json.Unmarshal(entry.Value(), usage)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to unmarshal quota usage for namespace %s: %w", namespace, err)
+	}
+	if usage.WorkloadsPerType == nil {
+		usage.WorkloadsPerType = make(models.NamespaceQuotaUsageWorkloadsPerType)
+	}
+	return usage, entry.Revision(), nil
+}
+
+// updateUsage applies fn to the usage of a namespace and writes it back if no
+// other node changed it in the meantime, retrying on conflicts
+func (q *QuotaAuctioneer) updateUsage(namespace string, fn func(*models.NamespaceQuotaUsage) error) error {
+	for range maxUsageUpdateTries {
+		usage, rev, err := q.usage(namespace)
+		if err != nil {
+			return err
+		}
+
+		err = fn(usage)
+		if err != nil {
+			return err
+		}
+
+		usageB, err := json.Marshal(usage)
+		if err != nil {
+			return err
+		}
+
+		if rev == 0 {
+			_, err = q.kv.Create(q.ctx, models.QuotaUsageKey(namespace), usageB)
+		} else {
+			_, err = q.kv.Update(q.ctx, models.QuotaUsageKey(namespace), usageB, rev)
+		}
+
+		// a wrong last sequence is reported as ErrKeyExists by Create and Update
+		if errors.Is(err, jetstream.ErrKeyExists) {
+			continue
+		}
+		return err
+	}
+	return ErrUsageConflict
+}
+
+// revisionConflict reports whether a write failed because the key changed since
+// the revision it expected
+func revisionConflict(err error) bool {
+	var apiErr *jetstream.APIError
+	return errors.Is(err, jetstream.ErrKeyExists) ||
+		(errors.As(err, &apiErr) && apiErr.ErrorCode == jetstream.JSErrCodeStreamWrongLastSequence)
+}
+
+// checkQuota returns the reason a workload does not fit in the namespace quota
+func checkQuota(namespace string, quota *models.NamespaceQuota, usage *models.NamespaceQuotaUsage, workloadType string, res *models.WorkloadResources) error {
+	if quota.MaxWorkloads > 0 && usage.Workloads+1 > quota.MaxWorkloads {
+		return fmt.Errorf("namespace %s is at its quota of %d workloads", namespace, quota.MaxWorkloads)
+	}
+	if limit, ok := quota.MaxWorkloadsPerType[workloadType]; ok && usage.WorkloadsPerType[workloadType]+1 > limit {
+		return fmt.Errorf("namespace %s is at its quota of %d %s workloads", namespace, limit, workloadType)
+	}
+	if res == nil {
+		return nil
+	}
+	if quota.MaxCpus > 0 && usage.Cpus+res.Cpus > quota.MaxCpus {
+		return fmt.Errorf("namespace %s would exceed its quota of %g cpus; %g in use", namespace, quota.MaxCpus, usage.Cpus)
+	}
+	if quota.MaxMemoryMb > 0 && usage.MemoryMb+res.MemoryMb > quota.MaxMemoryMb {
+		return fmt.Errorf("namespace %s would exceed its quota of %d MB memory; %d MB in use", namespace, quota.MaxMemoryMb, usage.MemoryMb)
+	}
+	return nil
+}
+
+func addUsage(usage *models.NamespaceQuotaUsage, workloadType string, res *models.WorkloadResources, n int) {
+	usage.Workloads = max(usage.Workloads+n, 0)
+	usage.WorkloadsPerType[workloadType] = max(usage.WorkloadsPerType[workloadType]+n, 0)
+	if usage.WorkloadsPerType[workloadType] == 0 {
+		delete(usage.WorkloadsPerType, workloadType)
+	}
+	if res != nil {
+		usage.Cpus = max(usage.Cpus+float64(n)*res.Cpus, 0)
+		usage.MemoryMb = max(usage.MemoryMb+n*res.MemoryMb, 0)
+	}
+}
+
+func workloadKey(namespace, workloadID string) string {
+	return fmt.Sprintf("workloads.%s.%s", namespace, workloadID)
+}
@@ -0,0 +1,146 @@
+package auctioneer
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/carlmjohnson/be"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/synadia-io/nex/models"
+)
+
+func startNatsServer(t testing.TB, workDir string) *server.Server {
+	t.Helper()
+
+	server := server.New(&server.Options{
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  workDir,
+	})
+
+	server.Start()
+
+	return server
+}
+
+func putQuota(t testing.TB, nc *nats.Conn, bucket, namespace string, quota *models.NamespaceQuota) {
+	t.Helper()
+
+	js, err := jetstream.New(nc)
+	be.NilErr(t, err)
+	kv, err := js.KeyValue(context.TODO(), bucket)
+	be.NilErr(t, err)
+
+	quotaB, err := json.Marshal(quota)
+	be.NilErr(t, err)
+	_, err = kv.Put(context.TODO(), models.QuotaKey(namespace), quotaB)
+	be.NilErr(t, err)
+}
+
+func startRequest(namespace, typ string, res *models.WorkloadResources) *models.StartWorkloadRequest {
+	return &models.StartWorkloadRequest{
+		Namespace:    namespace,
+		WorkloadType: typ,
+		Resources:    res,
+	}
+}
+
+func TestQuotaAuctioneer(t *testing.T) {
+	server := startNatsServer(t, t.TempDir())
+	defer server.Shutdown()
+
+	nc, err := nats.Connect(server.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q, err := NewQuotaAuctioneer(ctx, nc, "test", nil)
+	be.NilErr(t, err)
+
+	t.Run("no quota", func(t *testing.T) {
+		be.NilErr(t, q.Auction("open", "native", nil))
+		be.NilErr(t, q.ReserveWorkload("w1", startRequest("open", "native", nil)))
+
+		usage, _, err := q.usage("open")
+		be.NilErr(t, err)
+		be.Equal(t, 1, usage.Workloads)
+	})
+
+	t.Run("workloads", func(t *testing.T) {
+		putQuota(t, nc, "test", "team-a", &models.NamespaceQuota{MaxWorkloads: 1})
+
+		be.NilErr(t, q.Auction("team-a", "native", nil))
+		be.NilErr(t, q.ReserveWorkload("w1", startRequest("team-a", "native", nil)))
+
+		err := q.Auction("team-a", "native", nil)
+		be.In(t, "quota of 1 workloads", err.Error())
+		be.Nonzero(t, q.ReserveWorkload("w2", startRequest("team-a", "native", nil)))
+
+		be.NilErr(t, q.ReleaseWorkload("team-a", "w1"))
+		be.NilErr(t, q.Auction("team-a", "native", nil))
+
+		// releasing twice does not free more than was reserved
+		be.NilErr(t, q.ReleaseWorkload("team-a", "w1"))
+		usage, _, err := q.usage("team-a")
+		be.NilErr(t, err)
+		be.Equal(t, 0, usage.Workloads)
+	})
+
+	t.Run("release conflict", func(t *testing.T) {
+		rev, err := q.kv.Put(ctx, workloadKey("team-a", "w3"), []byte("{}"))
+		be.NilErr(t, err)
+		_, err = q.kv.Put(ctx, workloadKey("team-a", "w3"), []byte("{}"))
+		be.NilErr(t, err)
+
+		// another caller released the workload first
+		err = q.kv.Delete(ctx, workloadKey("team-a", "w3"), jetstream.LastRevision(rev))
+		be.True(t, revisionConflict(err))
+		// other failures keep the reservation and are reported
+		be.False(t, revisionConflict(context.DeadlineExceeded))
+		be.False(t, revisionConflict(nil))
+	})
+
+	t.Run("workloads per type", func(t *testing.T) {
+		putQuota(t, nc, "test", "team-b", &models.NamespaceQuota{MaxWorkloadsPerType: models.NamespaceQuotaMaxWorkloadsPerType{"wasm": 1}})
+
+		be.NilErr(t, q.ReserveWorkload("w1", startRequest("team-b", "wasm", nil)))
+		err := q.Auction("team-b", "wasm", nil)
+		be.In(t, "quota of 1 wasm workloads", err.Error())
+		be.NilErr(t, q.Auction("team-b", "native", nil))
+	})
+
+	t.Run("resources", func(t *testing.T) {
+		putQuota(t, nc, "test", "team-c", &models.NamespaceQuota{MaxCpus: 2, MaxMemoryMb: 1024})
+
+		be.NilErr(t, q.ReserveWorkload("w1", startRequest("team-c", "native", &models.WorkloadResources{Cpus: 1.5, MemoryMb: 512})))
+
+		err := q.AuctionResources("team-c", "native", nil, &models.WorkloadResources{Cpus: 1})
+		be.In(t, "quota of 2 cpus", err.Error())
+		err = q.AuctionResources("team-c", "native", nil, &models.WorkloadResources{MemoryMb: 1024})
+		be.In(t, "quota of 1024 MB memory", err.Error())
+		be.NilErr(t, q.AuctionResources("team-c", "native", nil, &models.WorkloadResources{Cpus: 0.5, MemoryMb: 512}))
+	})
+
+	t.Run("workload stopped event", func(t *testing.T) {
+		putQuota(t, nc, "test", "team-d", &models.NamespaceQuota{MaxWorkloads: 1})
+		be.NilErr(t, q.ReserveWorkload("w1", startRequest("team-d", "native", nil)))
+
+		eventB, err := json.Marshal(models.WorkloadStoppedEvent{Id: "w1", Namespace: "team-d"})
+		be.NilErr(t, err)
+		be.NilErr(t, nc.Publish(models.EventAPIPrefix("team-d")+"."+models.WorkloadStoppedEvent{}.String(), eventB))
+
+		be.NilErr(t, nc.Flush())
+		time.Sleep(250 * time.Millisecond)
+
+		usage, _, err := q.usage("team-d")
+		be.NilErr(t, err)
+		be.Equal(t, 0, usage.Workloads)
+		be.NilErr(t, q.Auction("team-d", "native", nil))
+	})
+}
@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/synadia-io/nex/models"
+)
+
+var _ models.AuditLog = (*JetStreamAuditLog)(nil)
+
+// JetStreamAuditLog publishes audit records to a JetStream stream. The stream
+// denies deletes and purges so records cannot be removed before they age out
+type JetStreamAuditLog struct {
+	ctx context.Context
+	js  jetstream.JetStream
+}
+
+// NewJetStreamAuditLog creates the audit stream if it does not exist. A maxAge
+// of zero keeps records forever
+func NewJetStreamAuditLog(ctx context.Context, nc *nats.Conn, stream string, maxAge time.Duration) (*JetStreamAuditLog, error) {
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:        stream,
+		Description: "Nex control plane audit log",
+		Subjects:    []string{models.AuditSubscribeSubject()},
+		Storage:     jetstream.FileStorage,
+		MaxAge:      maxAge,
+		DenyDelete:  true,
+		DenyPurge:   true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit stream: %w", err)
+	}
+
+	return &JetStreamAuditLog{
+		ctx: ctx,
+		js:  js,
+	}, nil
+}
+
+func (a *JetStreamAuditLog) RecordAudit(rec models.AuditRecord) error {
+	recB, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.js.Publish(a.ctx, models.AuditRecordSubject(rec.Namespace, rec.Action), recB)
+	return err
+}
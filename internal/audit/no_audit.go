@@ -0,0 +1,12 @@
+// Package audit provides implementations of the AuditLog interface.
+package audit
+
+import "github.com/synadia-io/nex/models"
+
+var _ models.AuditLog = (*NoAudit)(nil)
+
+type NoAudit struct{}
+
+func (NoAudit) RecordAudit(_ models.AuditRecord) error {
+	return nil
+}
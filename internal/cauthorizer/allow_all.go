@@ -0,0 +1,21 @@
+package cauthorizer
+
+import "github.com/synadia-io/nex/models"
+
+var (
+	_ models.ControlAuthorizer    = (*AllowAllAuthorizer)(nil)
+	_ models.DefinitionAuthorizer = (*AllowAllAuthorizer)(nil)
+)
+
+// AllowAllAuthorizer is an implementation of models.ControlAuthorizer that
+// allows every control request and stored definition, signed or not. Callers
+// are not verified
+type AllowAllAuthorizer struct{}
+
+func (a *AllowAllAuthorizer) AuthorizeControl(_ string, _ map[string][]string, _ []byte, _ string, _ models.ControlAction) (string, error) {
+	return "", nil
+}
+
+func (a *AllowAllAuthorizer) AuthorizeDefinition(_, _ string, _ []byte, _ string, _ models.ControlAction) error {
+	return nil
+}
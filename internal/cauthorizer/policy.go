@@ -0,0 +1,206 @@
+package cauthorizer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/nex/internal"
+	"github.com/synadia-io/nex/models"
+)
+
+// DefaultNonceWindow is how far the time in a request nonce may drift from the
+// node clock before the request is rejected
+const DefaultNonceWindow = 5 * time.Minute
+
+var (
+	_ models.ControlAuthorizer    = (*PolicyAuthorizer)(nil)
+	_ models.DefinitionAuthorizer = (*PolicyAuthorizer)(nil)
+)
+
+var (
+	ErrUnsignedRequest    = errors.New("control request is not signed")
+	ErrUnsignedDefinition = errors.New("stored definition is not signed")
+	ErrInvalidSignature   = errors.New("invalid control request signature")
+	ErrNonceReused        = errors.New("control request nonce already used")
+	ErrNonceExpired       = errors.New("control request nonce expired")
+)
+
+// ControlPolicy maps the user nkeys allowed to call the control API to the
+// namespaces and actions they may use
+type ControlPolicy struct {
+	Users []ControlPolicyUser `json:"users"`
+}
+
+type ControlPolicyUser struct {
+	Name string `json:"name,omitempty"`
+	// Nkey is the public user nkey requests are signed with
+	Nkey string `json:"nkey"`
+	// Namespaces the user may send requests to; * allows every namespace
+	Namespaces []string `json:"namespaces"`
+	// Actions the user may perform; * allows every action
+	Actions []models.ControlAction `json:"actions"`
+}
+
+// PolicyAuthorizer verifies the caller signature of control requests and stored
+// definitions and checks the caller against a ControlPolicy. Nonces are
+// remembered for twice the nonce window so a signed request cannot be replayed
+type PolicyAuthorizer struct {
+	policy      *ControlPolicy
+	nonceWindow time.Duration
+
+	mu     sync.Mutex
+	nonces *internal.TTLMap
+}
+
+// NewPolicyFileAuthorizer loads a JSON control policy from path
+func NewPolicyFileAuthorizer(path string) (*PolicyAuthorizer, error) {
+	policyB, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := new(ControlPolicy)
+	err = json.Unmarshal(policyB, policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse control policy: %w", err)
+	}
+
+	return NewPolicyAuthorizer(policy)
+}
+
+func NewPolicyAuthorizer(policy *ControlPolicy) (*PolicyAuthorizer, error) {
+	for _, u := range policy.Users {
+		if !nkeys.IsValidPublicUserKey(u.Nkey) {
+			return nil, fmt.Errorf("control policy user %q does not have a valid user nkey", u.Name)
+		}
+	}
+
+	return &PolicyAuthorizer{
+		policy:      policy,
+		nonceWindow: DefaultNonceWindow,
+		nonces:      internal.NewTTLMap(2 * DefaultNonceWindow),
+	}, nil
+}
+
+func (p *PolicyAuthorizer) AuthorizeControl(subject string, headers map[string][]string, data []byte, namespace string, action models.ControlAction) (string, error) {
+	caller, err := p.verify(subject, headers, data)
+	if err != nil {
+		return "", err
+	}
+
+	// workloads renew their own credentials and are identified by the user key
+	// of the JWT they present rather than by the policy
+	if action == models.ControlActionRenewCreds {
+		claims, err := jwt.DecodeUserClaims(string(data))
+		if err == nil && claims.Subject == caller {
+			return caller, nil
+		}
+		return caller, fmt.Errorf("caller %s does not hold the credentials it renews", caller)
+	}
+
+	return caller, p.allowed(caller, namespace, action)
+}
+
+// AuthorizeDefinition verifies the caller signature of a stored definition and
+// checks the caller against the policy
+func (p *PolicyAuthorizer) AuthorizeDefinition(caller, signature string, input []byte, namespace string, action models.ControlAction) error {
+	if caller == "" || signature == "" {
+		return ErrUnsignedDefinition
+	}
+
+	callerKp, err := nkeys.FromPublicKey(caller)
+	if err != nil || !nkeys.IsValidPublicUserKey(caller) {
+		return ErrInvalidSignature
+	}
+
+	sigB, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	err = callerKp.Verify(input, sigB)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	return p.allowed(caller, namespace, action)
+}
+
+// allowed checks that the policy allows the caller the action in the namespace
+func (p *PolicyAuthorizer) allowed(caller, namespace string, action models.ControlAction) error {
+	for _, u := range p.policy.Users {
+		if u.Nkey != caller {
+			continue
+		}
+		if (slices.Contains(u.Namespaces, "*") || slices.Contains(u.Namespaces, namespace)) &&
+			(slices.Contains(u.Actions, "*") || slices.Contains(u.Actions, action)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("caller %s is not allowed to %s in namespace %s", caller, action, namespace)
+}
+
+// verify checks the caller signature and nonce of a request and returns the
+// public key of the caller
+func (p *PolicyAuthorizer) verify(subject string, headers map[string][]string, data []byte) (string, error) {
+	caller := header(headers, models.ControlCallerHeader)
+	nonce := header(headers, models.ControlNonceHeader)
+	sig := header(headers, models.ControlSignatureHeader)
+	if caller == "" || nonce == "" || sig == "" {
+		return "", ErrUnsignedRequest
+	}
+
+	callerKp, err := nkeys.FromPublicKey(caller)
+	if err != nil || !nkeys.IsValidPublicUserKey(caller) {
+		return "", ErrInvalidSignature
+	}
+
+	sigB, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	err = callerKp.Verify(models.ControlSigningInput(subject, nonce, headers, data), sigB)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	ts, _, ok := strings.Cut(nonce, ".")
+	if !ok {
+		return "", ErrNonceExpired
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", ErrNonceExpired
+	}
+	if drift := time.Since(time.Unix(unix, 0)); drift > p.nonceWindow || drift < -p.nonceWindow {
+		return "", ErrNonceExpired
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.nonces.Exists(caller + nonce) {
+		return "", ErrNonceReused
+	}
+	p.nonces.Put(caller+nonce, "", nil)
+
+	return caller, nil
+}
+
+func header(headers map[string][]string, key string) string {
+	if v := headers[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
@@ -0,0 +1,149 @@
+package cauthorizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/carlmjohnson/be"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/nex/models"
+)
+
+const testSubject = "$NEX.SVC.user.control.DEPLOY.bidder"
+
+func signedHeaders(t testing.TB, kp nkeys.KeyPair, nonce string, data []byte) map[string][]string {
+	t.Helper()
+
+	pub, err := kp.PublicKey()
+	be.NilErr(t, err)
+	sig, err := kp.Sign(models.ControlSigningInput(testSubject, nonce, nil, data))
+	be.NilErr(t, err)
+
+	return map[string][]string{
+		models.ControlCallerHeader:    {pub},
+		models.ControlNonceHeader:     {nonce},
+		models.ControlSignatureHeader: {base64.RawURLEncoding.EncodeToString(sig)},
+	}
+}
+
+func TestPolicyAuthorizer(t *testing.T) {
+	devKp, err := nkeys.CreateUser()
+	be.NilErr(t, err)
+	devPub, err := devKp.PublicKey()
+	be.NilErr(t, err)
+	adminKp, err := nkeys.CreateUser()
+	be.NilErr(t, err)
+	adminPub, err := adminKp.PublicKey()
+	be.NilErr(t, err)
+	strangerKp, err := nkeys.CreateUser()
+	be.NilErr(t, err)
+
+	a, err := NewPolicyAuthorizer(&ControlPolicy{
+		Users: []ControlPolicyUser{
+			{Name: "dev", Nkey: devPub, Namespaces: []string{"user"}, Actions: []models.ControlAction{models.ControlActionAuction, models.ControlActionDeploy}},
+			{Name: "admin", Nkey: adminPub, Namespaces: []string{"*"}, Actions: []models.ControlAction{"*"}},
+		},
+	})
+	be.NilErr(t, err)
+
+	data := []byte(`{"namespace":"user"}`)
+
+	be.NilErr(t, authErr(a.AuthorizeControl(testSubject, signedHeaders(t, devKp, models.NewControlNonce(), data), data, "user", models.ControlActionDeploy)))
+	be.Nonzero(t, authErr(a.AuthorizeControl(testSubject, signedHeaders(t, devKp, models.NewControlNonce(), data), data, "user", models.ControlActionUndeploy)))
+	be.Nonzero(t, authErr(a.AuthorizeControl(testSubject, signedHeaders(t, devKp, models.NewControlNonce(), data), data, "other", models.ControlActionDeploy)))
+	be.NilErr(t, authErr(a.AuthorizeControl(testSubject, signedHeaders(t, adminKp, models.NewControlNonce(), data), data, models.SystemNamespace, models.ControlActionLameduck)))
+	be.Nonzero(t, authErr(a.AuthorizeControl(testSubject, signedHeaders(t, strangerKp, models.NewControlNonce(), data), data, "user", models.ControlActionDeploy)))
+
+	t.Run("verified caller", func(t *testing.T) {
+		caller, err := a.AuthorizeControl(testSubject, signedHeaders(t, devKp, models.NewControlNonce(), data), data, "user", models.ControlActionUndeploy)
+		be.Nonzero(t, err)
+		be.Equal(t, devPub, caller)
+
+		headers := signedHeaders(t, devKp, models.NewControlNonce(), data)
+		headers[models.ControlCallerHeader] = []string{adminPub}
+		caller, err = a.AuthorizeControl(testSubject, headers, data, "user", models.ControlActionDeploy)
+		be.Equal(t, ErrInvalidSignature, err)
+		be.Zero(t, caller)
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		be.Equal(t, ErrUnsignedRequest, authErr(a.AuthorizeControl(testSubject, map[string][]string{}, data, "user", models.ControlActionDeploy)))
+	})
+
+	t.Run("tampered payload", func(t *testing.T) {
+		headers := signedHeaders(t, adminKp, models.NewControlNonce(), data)
+		be.Equal(t, ErrInvalidSignature, authErr(a.AuthorizeControl(testSubject, headers, []byte(`{"namespace":"other"}`), "user", models.ControlActionDeploy)))
+	})
+
+	t.Run("other subject", func(t *testing.T) {
+		headers := signedHeaders(t, adminKp, models.NewControlNonce(), data)
+		be.Equal(t, ErrInvalidSignature, authErr(a.AuthorizeControl("$NEX.SVC.user.control.UNDEPLOY.workload", headers, data, "user", models.ControlActionDeploy)))
+	})
+
+	t.Run("added header", func(t *testing.T) {
+		headers := signedHeaders(t, adminKp, models.NewControlNonce(), data)
+		headers[models.DryRunHeader] = []string{"true"}
+		be.Equal(t, ErrInvalidSignature, authErr(a.AuthorizeControl(testSubject, headers, data, "user", models.ControlActionDeploy)))
+	})
+
+	t.Run("renew own credentials", func(t *testing.T) {
+		workloadKp, err := nkeys.CreateUser()
+		be.NilErr(t, err)
+		claims := jwt.NewUserClaims(pubOf(t, workloadKp))
+		accountKp, err := nkeys.CreateAccount()
+		be.NilErr(t, err)
+		userJwt, err := claims.Encode(accountKp)
+		be.NilErr(t, err)
+
+		be.NilErr(t, authErr(a.AuthorizeControl(testSubject, signedHeaders(t, workloadKp, models.NewControlNonce(), []byte(userJwt)), []byte(userJwt), "user", models.ControlActionRenewCreds)))
+		be.Nonzero(t, authErr(a.AuthorizeControl(testSubject, signedHeaders(t, strangerKp, models.NewControlNonce(), []byte(userJwt)), []byte(userJwt), "user", models.ControlActionRenewCreds)))
+	})
+
+	t.Run("replayed nonce", func(t *testing.T) {
+		headers := signedHeaders(t, adminKp, models.NewControlNonce(), data)
+		be.NilErr(t, authErr(a.AuthorizeControl(testSubject, headers, data, "user", models.ControlActionDeploy)))
+		be.Equal(t, ErrNonceReused, authErr(a.AuthorizeControl(testSubject, headers, data, "user", models.ControlActionDeploy)))
+	})
+
+	t.Run("stale nonce", func(t *testing.T) {
+		nonce := fmt.Sprintf("%d.stale", time.Now().Add(-time.Hour).Unix())
+		be.Equal(t, ErrNonceExpired, authErr(a.AuthorizeControl(testSubject, signedHeaders(t, adminKp, nonce, data), data, "user", models.ControlActionDeploy)))
+	})
+
+	t.Run("stored definition", func(t *testing.T) {
+		sig, err := devKp.Sign(data)
+		be.NilErr(t, err)
+		sigB64 := base64.RawURLEncoding.EncodeToString(sig)
+
+		be.NilErr(t, a.AuthorizeDefinition(devPub, sigB64, data, "user", models.ControlActionDeploy))
+		// definitions are authorized before every start, so the same signature
+		// is accepted again
+		be.NilErr(t, a.AuthorizeDefinition(devPub, sigB64, data, "user", models.ControlActionDeploy))
+		be.Nonzero(t, a.AuthorizeDefinition(devPub, sigB64, data, "other", models.ControlActionDeploy))
+		be.Equal(t, ErrInvalidSignature, a.AuthorizeDefinition(adminPub, sigB64, data, "user", models.ControlActionDeploy))
+		be.Equal(t, ErrInvalidSignature, a.AuthorizeDefinition(devPub, sigB64, []byte(`{"namespace":"other"}`), "user", models.ControlActionDeploy))
+		be.Equal(t, ErrUnsignedDefinition, a.AuthorizeDefinition("", "", data, "user", models.ControlActionDeploy))
+	})
+}
+
+func TestPolicyAuthorizer_InvalidNkey(t *testing.T) {
+	_, err := NewPolicyAuthorizer(&ControlPolicy{
+		Users: []ControlPolicyUser{{Name: "bad", Nkey: "ABOMDDCH76P5CAEOFEC5AFRMUL3W62Y5SPBNL6R3GBYE5X4N6UDE5QQL"}},
+	})
+	be.Nonzero(t, err)
+}
+
+// authErr drops the verified caller returned by AuthorizeControl
+func authErr(_ string, err error) error {
+	return err
+}
+
+func pubOf(t testing.TB, kp nkeys.KeyPair) string {
+	t.Helper()
+	pub, err := kp.PublicKey()
+	be.NilErr(t, err)
+	return pub
+}
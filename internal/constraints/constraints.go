@@ -0,0 +1,217 @@
+package constraints
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Operator string
+
+const (
+	OpEqual        Operator = "=="
+	OpNotEqual     Operator = "!="
+	OpIn           Operator = "in"
+	OpNotIn        Operator = "notin"
+	OpExists       Operator = "exists"
+	OpNotExists    Operator = "!exists"
+	OpGreater      Operator = ">"
+	OpGreaterEqual Operator = ">="
+	OpLess         Operator = "<"
+	OpLessEqual    Operator = "<="
+)
+
+var (
+	keyPattern     = `([A-Za-z0-9_./-]+)`
+	existsRe       = regexp.MustCompile(`^` + keyPattern + `\s+(!?exists)$`)
+	setRe          = regexp.MustCompile(`^` + keyPattern + `\s+(in|notin)\s*\((.*)\)$`)
+	comparisonRe   = regexp.MustCompile(`^` + keyPattern + `\s*(==|!=|>=|<=|=|>|<)\s*(.+)$`)
+	orderedOps     = []Operator{OpGreater, OpGreaterEqual, OpLess, OpLessEqual}
+	errEmptyValues = errors.New("set must hold at least one value")
+)
+
+// Constraint is a condition on a node attribute, such as a tag or the version
+// of an agent. Constraints are written as expressions:
+//
+//	key == value, key = value, key != value
+//	key in (a, b), key notin (a, b)
+//	key exists, key !exists
+//	key > n, key >= n, key < n, key <= n
+//
+// Ordered comparisons are numeric, or semantic version comparisons when the
+// value starts with v or has more than one dot, e.g. nex.agent.version >= 1.2.0.
+// Negative constraints match nodes without the attribute
+type Constraint struct {
+	Key    string
+	Op     Operator
+	Values []string
+
+	version *version
+	number  float64
+}
+
+// Parse reads a constraint expression
+func Parse(expr string) (*Constraint, error) {
+	expr = strings.TrimSpace(expr)
+
+	if m := existsRe.FindStringSubmatch(expr); m != nil {
+		return &Constraint{Key: m[1], Op: Operator(m[2])}, nil
+	}
+
+	if m := setRe.FindStringSubmatch(expr); m != nil {
+		values := []string{}
+		for v := range strings.SplitSeq(m[3], ",") {
+			v = unquote(strings.TrimSpace(v))
+			if v != "" {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("invalid constraint %q: %w", expr, errEmptyValues)
+		}
+		return &Constraint{Key: m[1], Op: Operator(m[2]), Values: values}, nil
+	}
+
+	if m := comparisonRe.FindStringSubmatch(expr); m != nil {
+		c := &Constraint{Key: m[1], Op: Operator(m[2]), Values: []string{unquote(strings.TrimSpace(m[3]))}}
+		if c.Op == "=" {
+			c.Op = OpEqual
+		}
+		if !slices.Contains(orderedOps, c.Op) {
+			return c, nil
+		}
+
+		if isVersion(c.Values[0]) {
+			v, err := parseVersion(c.Values[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid constraint %q: %w", expr, err)
+			}
+			c.version = v
+			return c, nil
+		}
+
+		n, err := strconv.ParseFloat(c.Values[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid constraint %q: %s needs a number or version", expr, c.Op)
+		}
+		c.number = n
+		return c, nil
+	}
+
+	return nil, fmt.Errorf("invalid constraint %q", expr)
+}
+
+// ParseAll reads a list of constraint expressions
+func ParseAll(exprs []string) ([]*Constraint, error) {
+	ret := make([]*Constraint, 0, len(exprs))
+	for _, expr := range exprs {
+		c, err := Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, c)
+	}
+	return ret, nil
+}
+
+// Matches reports whether the attributes satisfy the constraint
+func (c *Constraint) Matches(attrs map[string]string) bool {
+	value, ok := attrs[c.Key]
+
+	switch c.Op {
+	case OpExists:
+		return ok
+	case OpNotExists:
+		return !ok
+	case OpEqual:
+		return ok && value == c.Values[0]
+	case OpNotEqual:
+		return !ok || value != c.Values[0]
+	case OpIn:
+		return ok && slices.Contains(c.Values, value)
+	case OpNotIn:
+		return !ok || !slices.Contains(c.Values, value)
+	}
+
+	if !ok {
+		return false
+	}
+
+	var cmp int
+	if c.version != nil {
+		v, err := parseVersion(value)
+		if err != nil {
+			return false
+		}
+		cmp = v.compare(c.version)
+	} else {
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		switch {
+		case n < c.number:
+			cmp = -1
+		case n > c.number:
+			cmp = 1
+		}
+	}
+
+	switch c.Op {
+	case OpGreater:
+		return cmp > 0
+	case OpGreaterEqual:
+		return cmp >= 0
+	case OpLess:
+		return cmp < 0
+	case OpLessEqual:
+		return cmp <= 0
+	}
+	return false
+}
+
+func (c *Constraint) String() string {
+	switch c.Op {
+	case OpExists, OpNotExists:
+		return fmt.Sprintf("%s %s", c.Key, c.Op)
+	case OpIn, OpNotIn:
+		return fmt.Sprintf("%s %s (%s)", c.Key, c.Op, strings.Join(c.Values, ", "))
+	default:
+		return fmt.Sprintf("%s %s %s", c.Key, c.Op, c.Values[0])
+	}
+}
+
+// Unsatisfied returns the first tag or constraint expression the attributes do
+// not satisfy, or an empty string if they satisfy all of them. Tags must match
+// exactly
+func Unsatisfied(attrs, tags map[string]string, exprs []string) (string, error) {
+	cs, err := ParseAll(exprs)
+	if err != nil {
+		return "", err
+	}
+
+	for k, v := range tags {
+		c := &Constraint{Key: k, Op: OpEqual, Values: []string{v}}
+		if !c.Matches(attrs) {
+			return c.String(), nil
+		}
+	}
+
+	for _, c := range cs {
+		if !c.Matches(attrs) {
+			return c.String(), nil
+		}
+	}
+
+	return "", nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
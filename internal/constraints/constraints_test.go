@@ -0,0 +1,98 @@
+package constraints
+
+import (
+	"testing"
+
+	"github.com/carlmjohnson/be"
+)
+
+func TestConstraintMatches(t *testing.T) {
+	attrs := map[string]string{
+		"env":               "prod",
+		"nex.cpucount":      "8",
+		"nex.agent.version": "v1.2.3",
+	}
+
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{"env == prod", true},
+		{"env = prod", true},
+		{"env=staging", false},
+		{"env != prod", false},
+		{"region != us", true},
+		{"env in (dev, prod)", true},
+		{"env in ('dev', \"staging\")", false},
+		{"env notin (dev, staging)", true},
+		{"region notin (us)", true},
+		{"env exists", true},
+		{"region exists", false},
+		{"region !exists", true},
+		{"nex.cpucount >= 8", true},
+		{"nex.cpucount > 8", false},
+		{"nex.cpucount < 16", true},
+		{"nex.cpucount <= 4", false},
+		{"region > 1", false},
+		{"env > 1", false},
+		{"nex.agent.version >= 1.2.0", true},
+		{"nex.agent.version >= v1.3", false},
+		{"nex.agent.version < 2.0.0", true},
+		{"nex.agent.version > 1.2.3-rc.1", true},
+		{"nex.agent.version <= v1.2.3", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := Parse(tt.expr)
+			be.NilErr(t, err)
+			be.Equal(t, tt.match, c.Matches(attrs))
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"env",
+		"env in ()",
+		"nex.cpucount >= many",
+		"nex.agent.version >= v1.x",
+		"env ~= prod",
+	} {
+		_, err := Parse(expr)
+		be.Nonzero(t, err)
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	order := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.1", "v2"}
+	for i := 0; i < len(order)-1; i++ {
+		a, err := parseVersion(order[i])
+		be.NilErr(t, err)
+		b, err := parseVersion(order[i+1])
+		be.NilErr(t, err)
+		be.Equal(t, -1, a.compare(b))
+		be.Equal(t, 1, b.compare(a))
+		be.Equal(t, 0, a.compare(a))
+	}
+}
+
+func TestUnsatisfied(t *testing.T) {
+	attrs := map[string]string{"env": "prod", "nex.cpucount": "4"}
+
+	failed, err := Unsatisfied(attrs, map[string]string{"env": "prod"}, []string{"nex.cpucount >= 2", "gpu !exists"})
+	be.NilErr(t, err)
+	be.Equal(t, "", failed)
+
+	failed, err = Unsatisfied(attrs, map[string]string{"env": "dev"}, nil)
+	be.NilErr(t, err)
+	be.Equal(t, "env == dev", failed)
+
+	failed, err = Unsatisfied(attrs, nil, []string{"nex.cpucount >= 8"})
+	be.NilErr(t, err)
+	be.Equal(t, "nex.cpucount >= 8", failed)
+
+	_, err = Unsatisfied(attrs, nil, []string{"nex.cpucount >="})
+	be.Nonzero(t, err)
+}
@@ -0,0 +1,100 @@
+package constraints
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// version is a semantic version; missing minor and patch numbers are 0
+type version struct {
+	parts      [3]int
+	prerelease []string
+}
+
+// isVersion reports whether a constraint value is written as a version rather
+// than a number
+func isVersion(s string) bool {
+	return strings.HasPrefix(s, "v") || strings.Count(s, ".") > 1
+}
+
+func parseVersion(s string) (*version, error) {
+	s = strings.TrimPrefix(s, "v")
+	s, _, _ = strings.Cut(s, "+")
+	core, pre, hasPre := strings.Cut(s, "-")
+
+	nums := strings.Split(core, ".")
+	if len(nums) > 3 {
+		return nil, fmt.Errorf("invalid version %q", s)
+	}
+
+	v := new(version)
+	for i, n := range nums {
+		p, err := strconv.Atoi(n)
+		if err != nil || p < 0 {
+			return nil, fmt.Errorf("invalid version %q", s)
+		}
+		v.parts[i] = p
+	}
+	if hasPre {
+		if pre == "" {
+			return nil, fmt.Errorf("invalid version %q", s)
+		}
+		v.prerelease = strings.Split(pre, ".")
+	}
+	return v, nil
+}
+
+// compare orders versions following the semantic versioning precedence rules
+func (v *version) compare(o *version) int {
+	for i := range v.parts {
+		if v.parts[i] != o.parts[i] {
+			if v.parts[i] < o.parts[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// a prerelease comes before the release
+	switch {
+	case len(v.prerelease) == 0 && len(o.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(o.prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.prerelease) && i < len(o.prerelease); i++ {
+		a, b := v.prerelease[i], o.prerelease[i]
+		if a == b {
+			continue
+		}
+		an, aErr := strconv.Atoi(a)
+		bn, bErr := strconv.Atoi(b)
+		switch {
+		case aErr == nil && bErr == nil:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		case a < b:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	switch {
+	case len(v.prerelease) < len(o.prerelease):
+		return -1
+	case len(v.prerelease) > len(o.prerelease):
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,436 @@
+package credentials
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/nex/models"
+)
+
+var (
+	_ models.CredRenewer      = (*OperatorMinter)(nil)
+	_ models.ScopedCredVendor = (*OperatorMinter)(nil)
+)
+
+// NamespaceAccount is an account managed outside of nex that a namespace is
+// mapped to. Users are signed with the signing key of the account
+type NamespaceAccount struct {
+	PublicKey   string
+	SigningSeed string
+}
+
+// AccountResolver publishes account JWTs so the NATS servers learn about
+// namespace accounts. LookupAccount returns the current JWT of an account
+type AccountResolver interface {
+	UpdateAccount(accountJwt string) error
+	LookupAccount(accountKey string) (string, error)
+}
+
+// OperatorMinter maps each namespace to its own NATS account. Agents are issued
+// into the system account while workloads are issued into the account of their
+// namespace. Namespaces missing from Accounts are given an account derived from
+// the operator signing key, so every node sharing that key maps a namespace to
+// the same account
+type OperatorMinter struct {
+	NodeId      string
+	NatsServers []string
+	Nexus       string
+
+	// SystemAccountKey is the account nodes and nexlets run in
+	SystemAccountKey string
+	// SystemSigningSeed is a signing key of the system account
+	SystemSigningSeed string
+	// OperatorSigningSeed signs the accounts derived for namespaces
+	OperatorSigningSeed string
+	// Accounts maps namespaces to preconfigured accounts
+	Accounts map[string]NamespaceAccount
+	// Resolver receives the JWTs of derived accounts
+	Resolver AccountResolver
+
+	WorkloadCredTTL time.Duration
+	Policies        models.NamespacePolicyStore
+
+	mu        sync.Mutex
+	system    *SigningKeyMinter
+	workloads map[string]*SigningKeyMinter
+
+	// serializes the read-modify-write of the system account imports
+	importMu sync.Mutex
+}
+
+func (m *OperatorMinter) MintRegister(agentId, nodeId string) (*models.NatsConnectionData, error) {
+	return m.systemMinter().MintRegister(agentId, nodeId)
+}
+
+func (m *OperatorMinter) Mint(typ models.CredType, namespace, id string) (*models.NatsConnectionData, error) {
+	if typ == models.AgentCred {
+		return m.systemMinter().Mint(typ, namespace, id)
+	}
+
+	nm, err := m.namespaceMinter(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return nm.Mint(typ, namespace, id)
+}
+
+func (m *OperatorMinter) MintScoped(namespace, id string, perms *models.WorkloadPermissions) (*models.NatsConnectionData, error) {
+	nm, err := m.namespaceMinter(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return nm.MintScoped(namespace, id, perms)
+}
+
+func (m *OperatorMinter) CheckPermissions(namespace string, perms *models.WorkloadPermissions) error {
+	// policies do not depend on the account, any minter can check them
+	return m.systemMinter().CheckPermissions(namespace, perms)
+}
+
+func (m *OperatorMinter) Renew(namespace, id, userJwt string) (*models.NatsConnectionData, error) {
+	nm, err := m.namespaceMinter(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return nm.Renew(namespace, id, userJwt)
+}
+
+// NamespaceAccountKey returns the public key of the account a namespace is mapped to
+func (m *OperatorMinter) NamespaceAccountKey(namespace string) (string, error) {
+	err := validateNamespace(namespace)
+	if err != nil {
+		return "", err
+	}
+
+	if acct, ok := m.Accounts[namespace]; ok {
+		return acct.PublicKey, nil
+	}
+
+	accountKp, _, err := m.deriveAccount(namespace)
+	if err != nil {
+		return "", err
+	}
+	return accountKp.PublicKey()
+}
+
+func (m *OperatorMinter) systemMinter() *SigningKeyMinter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.system == nil {
+		m.system = &SigningKeyMinter{
+			NodeId:          m.NodeId,
+			NatsServers:     m.NatsServers,
+			Nexus:           m.Nexus,
+			RootAccountKey:  m.SystemAccountKey,
+			SigningSeed:     m.SystemSigningSeed,
+			WorkloadCredTTL: m.WorkloadCredTTL,
+			Policies:        m.Policies,
+		}
+	}
+	return m.system
+}
+
+// namespaceMinter returns the minter that issues users into the account of the
+// namespace. Derived accounts are published to the resolver the first time they
+// are used by this node
+func (m *OperatorMinter) namespaceMinter(namespace string) (*SigningKeyMinter, error) {
+	err := validateNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	nm, ok := m.workloads[namespace]
+	m.mu.Unlock()
+	if ok {
+		return nm, nil
+	}
+
+	nm = &SigningKeyMinter{
+		NodeId:          m.NodeId,
+		NatsServers:     m.NatsServers,
+		Nexus:           m.Nexus,
+		WorkloadCredTTL: m.WorkloadCredTTL,
+		Policies:        m.Policies,
+	}
+
+	if acct, ok := m.Accounts[namespace]; ok {
+		nm.RootAccountKey = acct.PublicKey
+		nm.SigningSeed = acct.SigningSeed
+	} else {
+		accountJwt, accountPub, signingSeed, err := m.namespaceAccountJwt(namespace)
+		if err != nil {
+			return nil, err
+		}
+		// the resolver is called without holding the lock so minting for other
+		// namespaces is not blocked on NATS
+		if m.Resolver != nil {
+			err = m.Resolver.UpdateAccount(accountJwt)
+			if err != nil {
+				return nil, fmt.Errorf("failed to publish account for namespace %s: %w", namespace, err)
+			}
+			err = m.importNamespaceFeeds(namespace, accountPub)
+			if err != nil {
+				return nil, fmt.Errorf("failed to import feeds of namespace %s into the system account: %w", namespace, err)
+			}
+		}
+		nm.RootAccountKey = accountPub
+		nm.SigningSeed = signingSeed
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// another request may have published the account in the meantime
+	if existing, ok := m.workloads[namespace]; ok {
+		return existing, nil
+	}
+	if m.workloads == nil {
+		m.workloads = make(map[string]*SigningKeyMinter)
+	}
+	m.workloads[namespace] = nm
+	return nm, nil
+}
+
+// importNamespaceFeeds adds the metrics and events exported by a derived
+// namespace account to the imports of the system account, so nodes receive them
+func (m *OperatorMinter) importNamespaceFeeds(namespace, accountPub string) error {
+	m.importMu.Lock()
+	defer m.importMu.Unlock()
+
+	sysJwt, err := m.Resolver.LookupAccount(m.SystemAccountKey)
+	if err != nil {
+		return err
+	}
+	claims, err := jwt.DecodeAccountClaims(sysJwt)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, imp := range SystemAccountImports(namespace, accountPub) {
+		if !slices.ContainsFunc(claims.Imports, func(i *jwt.Import) bool {
+			return i.Account == imp.Account && i.Subject == imp.Subject
+		}) {
+			claims.Imports.Add(imp)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	opKp, err := nkeys.FromSeed([]byte(m.OperatorSigningSeed))
+	if err != nil {
+		return err
+	}
+	sysJwt, err = claims.Encode(opKp)
+	if err != nil {
+		return err
+	}
+	return m.Resolver.UpdateAccount(sysJwt)
+}
+
+func (m *OperatorMinter) namespaceAccountJwt(namespace string) (string, string, string, error) {
+	if m.OperatorSigningSeed == "" {
+		return "", "", "", fmt.Errorf("no account configured for namespace %s", namespace)
+	}
+
+	opKp, err := nkeys.FromSeed([]byte(m.OperatorSigningSeed))
+	if err != nil {
+		return "", "", "", err
+	}
+
+	accountKp, signingKp, err := m.deriveAccount(namespace)
+	if err != nil {
+		return "", "", "", err
+	}
+	accountPub, err := accountKp.PublicKey()
+	if err != nil {
+		return "", "", "", err
+	}
+	signingPub, err := signingKp.PublicKey()
+	if err != nil {
+		return "", "", "", err
+	}
+	signingSeed, err := signingKp.Seed()
+	if err != nil {
+		return "", "", "", err
+	}
+
+	claims := jwt.NewAccountClaims(accountPub)
+	claims.Name = namespace
+	claims.SigningKeys.Add(signingPub)
+	claims.Limits.JetStreamLimits.MemoryStorage = jwt.NoLimit
+	claims.Limits.JetStreamLimits.DiskStorage = jwt.NoLimit
+	claims.Imports = NamespaceAccountImports(namespace, m.SystemAccountKey)
+	claims.Exports = NamespaceAccountExports(namespace)
+
+	vr := jwt.CreateValidationResults()
+	claims.Validate(vr)
+	if vr.IsBlocking(true) {
+		return "", "", "", errors.Join(vr.Errors()...)
+	}
+
+	accountJwt, err := claims.Encode(opKp)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return accountJwt, accountPub, string(signingSeed), nil
+}
+
+// deriveAccount derives the account identity and signing keys of a namespace
+// from the operator signing seed
+func (m *OperatorMinter) deriveAccount(namespace string) (nkeys.KeyPair, nkeys.KeyPair, error) {
+	if m.OperatorSigningSeed == "" {
+		return nil, nil, fmt.Errorf("no account configured for namespace %s", namespace)
+	}
+
+	derive := func(label string) (nkeys.KeyPair, error) {
+		mac := hmac.New(sha256.New, []byte(m.OperatorSigningSeed))
+		mac.Write([]byte(label))
+		return nkeys.FromRawSeed(nkeys.PrefixByteAccount, mac.Sum(nil))
+	}
+
+	accountKp, err := derive("nex.account." + namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	signingKp, err := derive("nex.account.signing." + namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	return accountKp, signingKp, nil
+}
+
+// NamespaceAccountImports are the imports a namespace account needs from the
+// system account: the logs of its workloads and the credential renewal service
+func NamespaceAccountImports(namespace, systemAccount string) jwt.Imports {
+	return jwt.Imports{
+		&jwt.Import{
+			Name:    "nex-logs",
+			Subject: jwt.Subject(fmt.Sprintf("%s.>", models.LogAPIPrefix(namespace))),
+			Account: systemAccount,
+			Type:    jwt.Stream,
+		},
+		&jwt.Import{
+			Name:    "nex-renew-creds",
+			Subject: jwt.Subject(models.RenewWorkloadCredsRequestSubject(namespace, "*", "*")),
+			Account: systemAccount,
+			Type:    jwt.Service,
+		},
+	}
+}
+
+// NamespaceAccountExports are the feeds a namespace account shares with the
+// system account
+func NamespaceAccountExports(namespace string) jwt.Exports {
+	return jwt.Exports{
+		&jwt.Export{
+			Name:    "nex-metrics",
+			Subject: jwt.Subject(fmt.Sprintf("%s.>", models.MetricsAPIPrefix(namespace))),
+			Type:    jwt.Stream,
+		},
+		&jwt.Export{
+			Name:    "nex-events",
+			Subject: jwt.Subject(fmt.Sprintf("%s.>", models.EventAPIPrefix(namespace))),
+			Type:    jwt.Stream,
+		},
+	}
+}
+
+// SystemAccountImports are the imports the system account needs so nodes receive
+// the metrics and events of a namespace account
+func SystemAccountImports(namespace, namespaceAccount string) jwt.Imports {
+	return jwt.Imports{
+		&jwt.Import{
+			Name:    "nex-metrics-" + namespace,
+			Subject: jwt.Subject(fmt.Sprintf("%s.>", models.MetricsAPIPrefix(namespace))),
+			Account: namespaceAccount,
+			Type:    jwt.Stream,
+		},
+		&jwt.Import{
+			Name:    "nex-events-" + namespace,
+			Subject: jwt.Subject(fmt.Sprintf("%s.>", models.EventAPIPrefix(namespace))),
+			Account: namespaceAccount,
+			Type:    jwt.Stream,
+		},
+	}
+}
+
+// SystemAccountExports are the exports the system account needs so namespace
+// accounts can import their logs and renew credentials
+func SystemAccountExports() jwt.Exports {
+	return jwt.Exports{
+		&jwt.Export{
+			Name:    "nex-logs",
+			Subject: jwt.Subject(fmt.Sprintf("%s.>", models.LogAPIPrefix("*"))),
+			Type:    jwt.Stream,
+		},
+		&jwt.Export{
+			Name:    "nex-renew-creds",
+			Subject: jwt.Subject(models.RenewWorkloadCredsSubscribeSubject("*")),
+			Type:    jwt.Service,
+		},
+	}
+}
+
+// NatsAccountResolver pushes account JWTs to a NATS resolver. The connection
+// must belong to the NATS system account
+type NatsAccountResolver struct {
+	Conn *nats.Conn
+}
+
+func (r *NatsAccountResolver) UpdateAccount(accountJwt string) error {
+	msg, err := r.Conn.Request("$SYS.REQ.CLAIMS.UPDATE", []byte(accountJwt), 5*time.Second)
+	if err != nil {
+		return err
+	}
+
+	resp := struct {
+		Error *struct {
+			Description string `json:"description"`
+		} `json:"error"`
+	}{}
+	err = json.Unmarshal(msg.Data, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return errors.New(resp.Error.Description)
+	}
+	return nil
+}
+
+func (r *NatsAccountResolver) LookupAccount(accountKey string) (string, error) {
+	msg, err := r.Conn.Request(fmt.Sprintf("$SYS.REQ.ACCOUNT.%s.CLAIMS.LOOKUP", accountKey), nil, 5*time.Second)
+	if err != nil {
+		return "", err
+	}
+	if len(msg.Data) == 0 {
+		return "", fmt.Errorf("account %s not found", accountKey)
+	}
+	return string(msg.Data), nil
+}
+
+// validateNamespace rejects namespaces that would change the meaning of the
+// subjects and account names they are embedded in
+func validateNamespace(namespace string) error {
+	if namespace == "" || strings.ContainsAny(namespace, ".*>") || strings.IndexFunc(namespace, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("invalid namespace: %q", namespace)
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package credentials
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carlmjohnson/be"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/nex/models"
+)
+
+// memResolver stores accounts like a NATS resolver and pushes updates of
+// accounts the server already loaded
+type memResolver struct {
+	*server.MemAccResolver
+	s *server.Server
+}
+
+func (r memResolver) UpdateAccount(accountJwt string) error {
+	claims, err := jwt.DecodeAccountClaims(accountJwt)
+	if err != nil {
+		return err
+	}
+	err = r.Store(claims.Subject, accountJwt)
+	if err != nil {
+		return err
+	}
+	if acc, err := r.s.LookupAccount(claims.Subject); err == nil {
+		r.s.UpdateAccountClaims(acc, claims)
+	}
+	return nil
+}
+
+func (r memResolver) LookupAccount(accountKey string) (string, error) {
+	return r.Fetch(accountKey)
+}
+
+func seedOf(t testing.TB, kp nkeys.KeyPair) string {
+	t.Helper()
+	seed, err := kp.Seed()
+	be.NilErr(t, err)
+	return string(seed)
+}
+
+func pubOf(t testing.TB, kp nkeys.KeyPair) string {
+	t.Helper()
+	pub, err := kp.PublicKey()
+	be.NilErr(t, err)
+	return pub
+}
+
+// startOperatorServer starts a NATS server trusting a new operator. The system
+// account exports what namespace accounts import from nex
+func startOperatorServer(t testing.TB) (*server.Server, *OperatorMinter, nkeys.KeyPair) {
+	t.Helper()
+
+	opKp, err := nkeys.CreateOperator()
+	be.NilErr(t, err)
+	opSigningKp, err := nkeys.CreateOperator()
+	be.NilErr(t, err)
+
+	opClaims := jwt.NewOperatorClaims(pubOf(t, opKp))
+	opClaims.SigningKeys.Add(pubOf(t, opSigningKp))
+	opJwt, err := opClaims.Encode(opKp)
+	be.NilErr(t, err)
+	opClaims, err = jwt.DecodeOperatorClaims(opJwt)
+	be.NilErr(t, err)
+
+	sysKp, err := nkeys.CreateAccount()
+	be.NilErr(t, err)
+	sysSigningKp, err := nkeys.CreateAccount()
+	be.NilErr(t, err)
+
+	sysClaims := jwt.NewAccountClaims(pubOf(t, sysKp))
+	sysClaims.SigningKeys.Add(pubOf(t, sysSigningKp))
+	sysClaims.Exports = SystemAccountExports()
+	sysJwt, err := sysClaims.Encode(opKp)
+	be.NilErr(t, err)
+
+	resolver := &server.MemAccResolver{}
+	be.NilErr(t, resolver.Store(pubOf(t, sysKp), sysJwt))
+
+	s, err := server.NewServer(&server.Options{
+		Port:             -1,
+		TrustedOperators: []*jwt.OperatorClaims{opClaims},
+		AccountResolver:  resolver,
+		SystemAccount:    pubOf(t, sysKp),
+	})
+	be.NilErr(t, err)
+	s.Start()
+	be.True(t, s.ReadyForConnections(5*time.Second))
+
+	m := &OperatorMinter{
+		NodeId:              "nodeId",
+		Nexus:               "nexus",
+		NatsServers:         []string{s.ClientURL()},
+		SystemAccountKey:    pubOf(t, sysKp),
+		SystemSigningSeed:   seedOf(t, sysSigningKp),
+		OperatorSigningSeed: seedOf(t, opSigningKp),
+		Resolver:            memResolver{resolver, s},
+		Policies: staticPolicies{
+			"user":  {Publish: []string{"orders.>", "$NEX.FEED.{{namespace}}.metrics.>"}, Subscribe: []string{"orders.>"}},
+			"other": {Publish: []string{"orders.>"}, Subscribe: []string{"orders.>"}},
+		},
+	}
+
+	return s, m, sysSigningKp
+}
+
+func connect(t testing.TB, connData *models.NatsConnectionData) *nats.Conn {
+	t.Helper()
+	nc, err := nats.Connect(connData.NatsServers[0], nats.UserJWTAndSeed(connData.NatsUserJwt, connData.NatsUserSeed))
+	be.NilErr(t, err)
+	return nc
+}
+
+func TestOperatorMinter_NamespaceAccounts(t *testing.T) {
+	s, m, sysSigningKp := startOperatorServer(t)
+	defer s.Shutdown()
+
+	// unrestricted user in the system account standing in for the node
+	sysUserKp, err := nkeys.CreateUser()
+	be.NilErr(t, err)
+	sysUserClaims := jwt.NewUserClaims(pubOf(t, sysUserKp))
+	sysUserClaims.IssuerAccount = m.SystemAccountKey
+	sysUserJwt, err := sysUserClaims.Encode(sysSigningKp)
+	be.NilErr(t, err)
+	sysNc := connect(t, &models.NatsConnectionData{NatsServers: m.NatsServers, NatsUserJwt: sysUserJwt, NatsUserSeed: seedOf(t, sysUserKp)})
+	defer sysNc.Close()
+
+	agentCreds, err := m.Mint(models.AgentCred, "", "agentId")
+	be.NilErr(t, err)
+	agentClaims, err := jwt.DecodeUserClaims(agentCreds.NatsUserJwt)
+	be.NilErr(t, err)
+	be.Equal(t, m.SystemAccountKey, agentClaims.IssuerAccount)
+
+	userCreds, err := m.Mint(models.WorkloadCred, "user", "workload1")
+	be.NilErr(t, err)
+	userClaims, err := jwt.DecodeUserClaims(userCreds.NatsUserJwt)
+	be.NilErr(t, err)
+	userAccount, err := m.NamespaceAccountKey("user")
+	be.NilErr(t, err)
+	be.Equal(t, userAccount, userClaims.IssuerAccount)
+
+	otherCreds, err := m.Mint(models.WorkloadCred, "other", "workload2")
+	be.NilErr(t, err)
+	otherClaims, err := jwt.DecodeUserClaims(otherCreds.NatsUserJwt)
+	be.NilErr(t, err)
+	be.True(t, otherClaims.IssuerAccount != userClaims.IssuerAccount)
+
+	userNc := connect(t, userCreds)
+	defer userNc.Close()
+	otherNc := connect(t, otherCreds)
+	defer otherNc.Close()
+
+	// namespaces do not share subjects
+	otherSub, err := otherNc.SubscribeSync("orders.>")
+	be.NilErr(t, err)
+	userSub, err := userNc.SubscribeSync("orders.>")
+	be.NilErr(t, err)
+	be.NilErr(t, userNc.Flush())
+	be.NilErr(t, otherNc.Flush())
+	be.NilErr(t, userNc.Publish("orders.created", []byte("order")))
+	_, err = userSub.NextMsg(time.Second)
+	be.NilErr(t, err)
+	_, err = otherSub.NextMsg(250 * time.Millisecond)
+	be.Equal(t, nats.ErrTimeout, err)
+
+	// logs published in the system account reach the namespace account
+	logSub, err := userNc.SubscribeSync(models.LogAPIPrefix("user") + ".>")
+	be.NilErr(t, err)
+	be.NilErr(t, userNc.Flush())
+	time.Sleep(100 * time.Millisecond)
+	be.NilErr(t, sysNc.Publish(models.AgentEmitLogSubject("user", "workload1", models.LogOutStdout), []byte("hello")))
+	msg, err := logSub.NextMsg(time.Second)
+	be.NilErr(t, err)
+	be.Equal(t, "hello", string(msg.Data))
+
+	// metrics published in a namespace account reach the system account
+	metricSub, err := sysNc.SubscribeSync(models.MetricsAPIPrefix("user") + ".>")
+	be.NilErr(t, err)
+	be.NilErr(t, sysNc.Flush())
+	time.Sleep(100 * time.Millisecond)
+	be.NilErr(t, userNc.Publish(models.MetricsAPIPrefix("user")+".workload1", []byte(`{"queued":1}`)))
+	msg, err = metricSub.NextMsg(time.Second)
+	be.NilErr(t, err)
+	be.Equal(t, `{"queued":1}`, string(msg.Data))
+
+	// workloads renew credentials through the system account
+	_, err = sysNc.Subscribe(models.RenewWorkloadCredsSubscribeSubject(m.NodeId), func(msg *nats.Msg) {
+		_ = msg.Respond([]byte("renewed"))
+	})
+	be.NilErr(t, err)
+	be.NilErr(t, sysNc.Flush())
+	resp, err := userNc.Request(models.RenewWorkloadCredsRequestSubject("user", m.NodeId, "workload1"), nil, time.Second)
+	be.NilErr(t, err)
+	be.Equal(t, "renewed", string(resp.Data))
+
+	_, err = m.Renew("user", "workload1", userCreds.NatsUserJwt)
+	be.NilErr(t, err)
+	_, err = m.Renew("other", "workload1", userCreds.NatsUserJwt)
+	be.Equal(t, models.ErrCredentialsNotFound, err)
+}
+
+func TestOperatorMinter_DerivedAccounts(t *testing.T) {
+	opSigningKp, err := nkeys.CreateOperator()
+	be.NilErr(t, err)
+
+	m1 := &OperatorMinter{OperatorSigningSeed: seedOf(t, opSigningKp)}
+	m2 := &OperatorMinter{OperatorSigningSeed: seedOf(t, opSigningKp)}
+
+	acct1, err := m1.NamespaceAccountKey("user")
+	be.NilErr(t, err)
+	acct2, err := m2.NamespaceAccountKey("user")
+	be.NilErr(t, err)
+	be.Equal(t, acct1, acct2)
+	be.True(t, nkeys.IsValidPublicAccountKey(acct1))
+
+	other, err := m1.NamespaceAccountKey("other")
+	be.NilErr(t, err)
+	be.True(t, acct1 != other)
+
+	// namespaces are embedded in subjects
+	for _, ns := range []string{"", "a.b", "a*", "a>", "a b", "a\tb"} {
+		_, err = m1.NamespaceAccountKey(ns)
+		be.Nonzero(t, err)
+		_, err = m1.Mint(models.WorkloadCred, ns, "workload1")
+		be.Nonzero(t, err)
+	}
+}
+
+func TestOperatorMinter_ConfiguredAccounts(t *testing.T) {
+	acctKp, err := nkeys.CreateAccount()
+	be.NilErr(t, err)
+	acctSigningKp, err := nkeys.CreateAccount()
+	be.NilErr(t, err)
+
+	m := &OperatorMinter{
+		NatsServers: []string{"nats://localhost:4222"},
+		Accounts: map[string]NamespaceAccount{
+			"user": {PublicKey: pubOf(t, acctKp), SigningSeed: seedOf(t, acctSigningKp)},
+		},
+	}
+
+	connData, err := m.Mint(models.WorkloadCred, "user", "workload1")
+	be.NilErr(t, err)
+	claims, err := jwt.DecodeUserClaims(connData.NatsUserJwt)
+	be.NilErr(t, err)
+	be.Equal(t, pubOf(t, acctKp), claims.IssuerAccount)
+	be.Equal(t, pubOf(t, acctSigningKp), claims.Issuer)
+
+	// without an operator signing key, only configured namespaces are allowed
+	_, err = m.Mint(models.WorkloadCred, "other", "workload2")
+	be.Nonzero(t, err)
+}
@@ -0,0 +1,87 @@
+package credentials
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/synadia-io/nex/models"
+)
+
+// CheckWorkloadPermissions verifies that every permission requested by a workload
+// is covered by the namespace policy. {{namespace}} is expanded on both sides while
+// {{workload_id}} is compared literally since the workload id is not known yet
+func CheckWorkloadPermissions(namespace string, perms *models.WorkloadPermissions, policy *models.NamespacePolicy) error {
+	if perms == nil {
+		return nil
+	}
+	if policy == nil {
+		policy = new(models.NamespacePolicy)
+	}
+
+	expand := strings.NewReplacer("{{namespace}}", namespace)
+	expandAll := func(in []string) []string {
+		ret := make([]string, 0, len(in))
+		for _, s := range in {
+			ret = append(ret, expand.Replace(s))
+		}
+		return ret
+	}
+
+	denied := []string{}
+	for _, subject := range perms.Publish {
+		if !subjectAllowed(expand.Replace(subject), expandAll(policy.Publish)) {
+			denied = append(denied, "publish "+subject)
+		}
+	}
+	for _, subject := range perms.Subscribe {
+		if !subjectAllowed(expand.Replace(subject), expandAll(policy.Subscribe)) {
+			denied = append(denied, "subscribe "+subject)
+		}
+	}
+	for _, bucket := range perms.KvBuckets {
+		if !slices.Contains(expandAll(policy.KvBuckets), expand.Replace(bucket)) {
+			denied = append(denied, "kv bucket "+bucket)
+		}
+	}
+	for _, bucket := range perms.ObjectStores {
+		if !slices.Contains(expandAll(policy.ObjectStores), expand.Replace(bucket)) {
+			denied = append(denied, "object store "+bucket)
+		}
+	}
+
+	if len(denied) > 0 {
+		return fmt.Errorf("requested permissions exceed policy for namespace %s: %s", namespace, strings.Join(denied, ", "))
+	}
+	return nil
+}
+
+func subjectAllowed(subject string, allowed []string) bool {
+	for _, pattern := range allowed {
+		if subjectCovered(subject, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// subjectCovered reports whether every subject matched by subject is also matched
+// by pattern
+func subjectCovered(subject, pattern string) bool {
+	st := strings.Split(subject, ".")
+	pt := strings.Split(pattern, ".")
+
+	for i, p := range pt {
+		if p == ">" {
+			return len(st) > i
+		}
+		if i >= len(st) || st[i] == ">" {
+			return false
+		}
+		if p != "*" && p != st[i] {
+			return false
+		}
+	}
+
+	return len(st) == len(pt)
+}
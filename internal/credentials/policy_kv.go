@@ -0,0 +1,67 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/synadia-io/nex/models"
+)
+
+var _ models.NamespacePolicyStore = (*NatsKVPolicyStore)(nil)
+
+// NatsKVPolicyStore reads namespace policies from a JetStream KV bucket. Each
+// policy is stored as JSON under the name of the namespace it applies to
+type NatsKVPolicyStore struct {
+	kv jetstream.KeyValue
+}
+
+func NewNatsKVPolicyStore(nc *nats.Conn, bucketName string) (*NatsKVPolicyStore, error) {
+	jsCtx, err := jetstream.New(nc)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := jsCtx.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{
+		Bucket:      bucketName,
+		Description: "Nex namespace policies",
+	})
+	if errors.Is(err, jetstream.ErrBucketExists) {
+		kv, err = jsCtx.KeyValue(context.Background(), bucketName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &NatsKVPolicyStore{kv: kv}, nil
+}
+
+func (s *NatsKVPolicyStore) GetNamespacePolicy(namespace string) (*models.NamespacePolicy, error) {
+	entry, err := s.kv.Get(context.Background(), namespace)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	policy := new(models.NamespacePolicy)
+	err = json.Unmarshal(entry.Value(), policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+func (s *NatsKVPolicyStore) PutNamespacePolicy(namespace string, policy *models.NamespacePolicy) error {
+	policyB, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.kv.Put(context.Background(), namespace, policyB)
+	return err
+}
@@ -1,6 +1,10 @@
 package credentials
 
 import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/nats-io/jwt/v2"
@@ -30,12 +34,32 @@ NKEYs are sensitive and should be treated as secrets.
 `
 }
 
+// DefaultWorkloadCredTTL is how long minted workload credentials are valid when
+// the SigningKeyMinter has no WorkloadCredTTL configured. Credentials of a
+// stopped workload are no longer renewed, so they stop working within this time
+const DefaultWorkloadCredTTL = time.Hour
+
+// scopedCredTag marks workload credentials limited to the permissions the
+// workload requested, so renewals keep them instead of the namespace policy
+const scopedCredTag = "nex-scoped"
+
+var (
+	_ models.CredRenewer      = (*SigningKeyMinter)(nil)
+	_ models.ScopedCredVendor = (*SigningKeyMinter)(nil)
+)
+
 type SigningKeyMinter struct {
 	NodeId         string
 	NatsServers    []string
 	Nexus          string
 	RootAccountKey string
 	SigningSeed    string
+
+	// WorkloadCredTTL is how long workload credentials are valid before they
+	// must be renewed
+	WorkloadCredTTL time.Duration
+	// Policies expands the permissions of workload credentials per namespace
+	Policies models.NamespacePolicyStore
 }
 
 func (m *SigningKeyMinter) MintRegister(agentId, nodeId string) (*models.NatsConnectionData, error) {
@@ -82,11 +106,39 @@ func (m *SigningKeyMinter) MintRegister(agentId, nodeId string) (*models.NatsCon
 }
 
 func (m *SigningKeyMinter) Mint(typ models.CredType, namespace, id string) (*models.NatsConnectionData, error) {
-	pkp, err := nkeys.FromSeed([]byte(m.SigningSeed))
+	return m.mint(typ, namespace, id, nil)
+}
+
+// MintScoped mints workload credentials limited to the requested permissions
+// instead of everything the namespace policy allows
+func (m *SigningKeyMinter) MintScoped(namespace, id string, perms *models.WorkloadPermissions) (*models.NatsConnectionData, error) {
+	err := m.CheckPermissions(namespace, perms)
 	if err != nil {
 		return nil, err
 	}
+	return m.mint(models.WorkloadCred, namespace, id, perms)
+}
+
+// CheckPermissions verifies every requested permission is allowed by the
+// namespace policy
+func (m *SigningKeyMinter) CheckPermissions(namespace string, perms *models.WorkloadPermissions) error {
+	if perms == nil {
+		return nil
+	}
 
+	var policy *models.NamespacePolicy
+	if m.Policies != nil {
+		var err error
+		policy, err = m.Policies.GetNamespacePolicy(namespace)
+		if err != nil {
+			return fmt.Errorf("failed to get policy for namespace %s: %w", namespace, err)
+		}
+	}
+
+	return CheckWorkloadPermissions(namespace, perms, policy)
+}
+
+func (m *SigningKeyMinter) mint(typ models.CredType, namespace, id string, perms *models.WorkloadPermissions) (*models.NatsConnectionData, error) {
 	ret := new(models.NatsConnectionData)
 	ret.NatsServers = m.NatsServers
 
@@ -106,26 +158,142 @@ func (m *SigningKeyMinter) Mint(typ models.CredType, namespace, id string) (*mod
 		return nil, err
 	}
 
+	ret.NatsUserJwt, err = m.encodeClaims(typ, namespace, id, pubKp, perms)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// Renew signs a new JWT for the user key of the workload credentials in userJwt.
+// Ownership is derived from the presented JWT, which must have been signed by
+// this minter for the workload and allow renewing through this node, so renewals
+// keep working after the node restarts. The seed held by the workload stays
+// valid, so only the JWT is returned
+func (m *SigningKeyMinter) Renew(namespace, id, userJwt string) (*models.NatsConnectionData, error) {
+	claims, err := jwt.DecodeUserClaims(userJwt)
+	if err != nil {
+		return nil, models.ErrCredentialsNotFound
+	}
+
+	pkp, err := nkeys.FromSeed([]byte(m.SigningSeed))
+	if err != nil {
+		return nil, err
+	}
+	signingKey, err := pkp.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case claims.Issuer != signingKey, claims.IssuerAccount != m.RootAccountKey, claims.Name != id,
+		!slices.Contains(claims.Pub.Allow, models.RenewWorkloadCredsRequestSubject(namespace, m.NodeId, id)):
+		return nil, models.ErrCredentialsNotFound
+	case claims.Expires != 0 && time.Unix(claims.Expires, 0).Before(time.Now()):
+		return nil, errors.New("workload credentials have expired")
+	}
+
+	permissions, err := m.workloadPermissions(namespace, id, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	scoped := claims.Tags.Contains(scopedCredTag)
+	if scoped {
+		// the namespace policy may have been narrowed since the workload started
+		denied := []string{}
+		for _, subject := range claims.Pub.Allow {
+			if !subjectAllowed(subject, permissions.Pub.Allow) {
+				denied = append(denied, "publish "+subject)
+			}
+		}
+		for _, subject := range claims.Sub.Allow {
+			if !subjectAllowed(subject, permissions.Sub.Allow) {
+				denied = append(denied, "subscribe "+subject)
+			}
+		}
+		if len(denied) > 0 {
+			return nil, fmt.Errorf("requested permissions exceed policy for namespace %s: %s", namespace, strings.Join(denied, ", "))
+		}
+		permissions = claims.Permissions
+	}
+
+	renewedJwt, err := m.signClaims(models.WorkloadCred, id, claims.Subject, permissions, scoped)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.NatsConnectionData{
+		NatsServers: m.NatsServers,
+		NatsUserJwt: renewedJwt,
+	}, nil
+}
+
+func (m *SigningKeyMinter) encodeClaims(typ models.CredType, namespace, id, pubKp string, perms *models.WorkloadPermissions) (string, error) {
+	var permissions jwt.Permissions
+	switch typ {
+	case models.AgentCred:
+		permissions = AgentClaims(id, m.NodeId, m.Nexus)
+	case models.WorkloadCred:
+		var err error
+		permissions, err = m.workloadPermissions(namespace, id, perms)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return m.signClaims(typ, id, pubKp, permissions, perms != nil)
+}
+
+// workloadPermissions are the permissions requested by a workload, or everything
+// the namespace policy allows when it requested none
+func (m *SigningKeyMinter) workloadPermissions(namespace, id string, perms *models.WorkloadPermissions) (jwt.Permissions, error) {
+	var policy *models.NamespacePolicy
+	switch {
+	case perms != nil:
+		policy = &models.NamespacePolicy{
+			Publish:      perms.Publish,
+			Subscribe:    perms.Subscribe,
+			KvBuckets:    perms.KvBuckets,
+			ObjectStores: perms.ObjectStores,
+		}
+	case m.Policies != nil:
+		var err error
+		policy, err = m.Policies.GetNamespacePolicy(namespace)
+		if err != nil {
+			return jwt.Permissions{}, fmt.Errorf("failed to get policy for namespace %s: %w", namespace, err)
+		}
+	}
+	return WorkloadClaims(namespace, id, m.NodeId, policy), nil
+}
+
+func (m *SigningKeyMinter) signClaims(typ models.CredType, id, pubKp string, permissions jwt.Permissions, scoped bool) (string, error) {
+	pkp, err := nkeys.FromSeed([]byte(m.SigningSeed))
+	if err != nil {
+		return "", err
+	}
+
 	claims := jwt.NewUserClaims(pubKp)
 	claims.Subject = pubKp
 	claims.Expires = time.Now().Add(time.Hour * 24 * 365).Unix()
 	claims.Name = id
 	claims.IssuerAccount = m.RootAccountKey
+	claims.Permissions = permissions
 
-	switch typ {
-	case models.AgentCred:
-		claims.Permissions = AgentClaims(id, m.NodeId, m.Nexus)
-	case models.WorkloadCred:
-		claims.Permissions = WorkloadClaims(namespace, id)
+	if typ == models.WorkloadCred {
+		ttl := m.WorkloadCredTTL
+		if ttl <= 0 {
+			ttl = DefaultWorkloadCredTTL
+		}
+		claims.Expires = time.Now().Add(ttl).Unix()
+		if scoped {
+			claims.Tags.Add(scopedCredTag)
+		}
 	}
 
 	vr := jwt.CreateValidationResults()
 	claims.Validate(vr)
 
-	ret.NatsUserJwt, err = claims.Encode(pkp)
-	if err != nil {
-		return nil, err
-	}
-
-	return ret, nil
+	return claims.Encode(pkp)
 }
@@ -1,7 +1,9 @@
 package credentials
 
 import (
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/carlmjohnson/be"
 	"github.com/nats-io/jwt/v2"
@@ -56,7 +58,7 @@ func TestSigningKeyMinter_Mint(t *testing.T) {
 		perms jwt.Permissions
 	}{
 		{"Agent Cred", models.AgentCred, "", "agentId", AgentClaims("agentId", kpPub, "nexus")},
-		{"Workload Cred", models.WorkloadCred, "user", "workloadId", WorkloadClaims("user", "workloadId")},
+		{"Workload Cred", models.WorkloadCred, "user", "workloadId", WorkloadClaims("user", "workloadId", kpPub, nil)},
 	}
 
 	for _, tc := range tt {
@@ -83,3 +85,192 @@ func TestSigningKeyMinter_Mint(t *testing.T) {
 		})
 	}
 }
+
+type staticPolicies map[string]*models.NamespacePolicy
+
+func (p staticPolicies) GetNamespacePolicy(namespace string) (*models.NamespacePolicy, error) {
+	return p[namespace], nil
+}
+
+func TestSigningKeyMinter_Renew(t *testing.T) {
+	m := SigningKeyMinter{
+		NodeId:          "nodeId",
+		Nexus:           "nexus",
+		NatsServers:     []string{"nats://localhost:4222"},
+		RootAccountKey:  SigningKeyAccount,
+		SigningSeed:     SigningKey,
+		WorkloadCredTTL: time.Minute,
+	}
+
+	connData, err := m.Mint(models.WorkloadCred, "user", "workloadId")
+	be.NilErr(t, err)
+
+	claims, err := jwt.DecodeUserClaims(connData.NatsUserJwt)
+	be.NilErr(t, err)
+	be.True(t, claims.Expires <= time.Now().Add(time.Minute).Unix())
+	be.True(t, slices.Contains(claims.Pub.Allow, models.RenewWorkloadCredsRequestSubject("user", "nodeId", "workloadId")))
+
+	kp, err := nkeys.FromSeed([]byte(connData.NatsUserSeed))
+	be.NilErr(t, err)
+	userKey, err := kp.PublicKey()
+	be.NilErr(t, err)
+
+	renewed, err := m.Renew("user", "workloadId", connData.NatsUserJwt)
+	be.NilErr(t, err)
+	be.Zero(t, renewed.NatsUserSeed)
+
+	renewedClaims, err := jwt.DecodeUserClaims(renewed.NatsUserJwt)
+	be.NilErr(t, err)
+	be.Equal(t, userKey, renewedClaims.Subject)
+
+	// a minter without any record of the credentials, e.g. after a restart
+	restarted := m
+	_, err = restarted.Renew("user", "workloadId", renewed.NatsUserJwt)
+	be.NilErr(t, err)
+
+	_, err = m.Renew("other", "workloadId", connData.NatsUserJwt)
+	be.Equal(t, models.ErrCredentialsNotFound, err)
+	_, err = m.Renew("user", "workloadId2", connData.NatsUserJwt)
+	be.Equal(t, models.ErrCredentialsNotFound, err)
+	_, err = m.Renew("user", "workloadId", "not a jwt")
+	be.Equal(t, models.ErrCredentialsNotFound, err)
+
+	// credentials issued through another node are renewed by that node
+	otherNode := m
+	otherNode.NodeId = "otherNodeId"
+	_, err = otherNode.Renew("user", "workloadId", connData.NatsUserJwt)
+	be.Equal(t, models.ErrCredentialsNotFound, err)
+
+	// credentials signed by another key
+	otherKp, err := nkeys.CreateAccount()
+	be.NilErr(t, err)
+	otherSeed, err := otherKp.Seed()
+	be.NilErr(t, err)
+	otherSigner := m
+	otherSigner.SigningSeed = string(otherSeed)
+	_, err = otherSigner.Renew("user", "workloadId", connData.NatsUserJwt)
+	be.Equal(t, models.ErrCredentialsNotFound, err)
+}
+
+func TestSigningKeyMinter_DefaultWorkloadCredTTL(t *testing.T) {
+	m := SigningKeyMinter{
+		NodeId:         "nodeId",
+		Nexus:          "nexus",
+		NatsServers:    []string{"nats://localhost:4222"},
+		RootAccountKey: SigningKeyAccount,
+		SigningSeed:    SigningKey,
+	}
+
+	connData, err := m.Mint(models.WorkloadCred, "user", "workloadId")
+	be.NilErr(t, err)
+	claims, err := jwt.DecodeUserClaims(connData.NatsUserJwt)
+	be.NilErr(t, err)
+	be.True(t, claims.Expires > time.Now().Add(DefaultWorkloadCredTTL-time.Minute).Unix())
+	be.True(t, claims.Expires <= time.Now().Add(time.Hour).Unix())
+}
+
+func TestSigningKeyMinter_NamespacePolicy(t *testing.T) {
+	m := SigningKeyMinter{
+		NodeId:         "nodeId",
+		Nexus:          "nexus",
+		NatsServers:    []string{"nats://localhost:4222"},
+		RootAccountKey: SigningKeyAccount,
+		SigningSeed:    SigningKey,
+		Policies: staticPolicies{
+			"user": {
+				Publish:      []string{"orders.{{namespace}}.>"},
+				Subscribe:    []string{"jobs.{{workload_id}}"},
+				KvBuckets:    []string{"config"},
+				ObjectStores: []string{"assets"},
+			},
+		},
+	}
+
+	connData, err := m.Mint(models.WorkloadCred, "user", "workloadId")
+	be.NilErr(t, err)
+	claims, err := jwt.DecodeUserClaims(connData.NatsUserJwt)
+	be.NilErr(t, err)
+
+	be.True(t, slices.Contains(claims.Pub.Allow, "orders.user.>"))
+	be.True(t, slices.Contains(claims.Sub.Allow, "jobs.workloadId"))
+	be.True(t, slices.Contains(claims.Pub.Allow, "$KV.config.>"))
+	be.True(t, slices.Contains(claims.Pub.Allow, "$JS.API.STREAM.INFO.KV_config"))
+	be.True(t, slices.Contains(claims.Pub.Allow, "$O.assets.>"))
+	be.True(t, slices.Contains(claims.Pub.Allow, "$JS.API.STREAM.INFO.OBJ_assets"))
+
+	// namespaces without a policy get the default workload permissions
+	connData, err = m.Mint(models.WorkloadCred, "other", "workloadId2")
+	be.NilErr(t, err)
+	claims, err = jwt.DecodeUserClaims(connData.NatsUserJwt)
+	be.NilErr(t, err)
+	genClaims := WorkloadClaims("other", "workloadId2", "nodeId", nil)
+	be.AllEqual(t, genClaims.Pub.Allow, claims.Pub.Allow)
+	be.AllEqual(t, genClaims.Sub.Allow, claims.Sub.Allow)
+}
+
+func TestSigningKeyMinter_MintScoped(t *testing.T) {
+	m := SigningKeyMinter{
+		NodeId:         "nodeId",
+		Nexus:          "nexus",
+		NatsServers:    []string{"nats://localhost:4222"},
+		RootAccountKey: SigningKeyAccount,
+		SigningSeed:    SigningKey,
+		Policies: staticPolicies{
+			"user": {
+				Publish:   []string{"orders.{{namespace}}.>"},
+				Subscribe: []string{"jobs.*"},
+				KvBuckets: []string{"config", "cache"},
+			},
+		},
+	}
+
+	perms := &models.WorkloadPermissions{
+		Publish:   []string{"orders.user.created"},
+		Subscribe: []string{"jobs.{{workload_id}}"},
+		KvBuckets: []string{"config"},
+	}
+
+	connData, err := m.MintScoped("user", "workloadId", perms)
+	be.NilErr(t, err)
+	claims, err := jwt.DecodeUserClaims(connData.NatsUserJwt)
+	be.NilErr(t, err)
+
+	// only the requested permissions are granted
+	be.True(t, slices.Contains(claims.Pub.Allow, "orders.user.created"))
+	be.False(t, slices.Contains(claims.Pub.Allow, "orders.user.>"))
+	be.True(t, slices.Contains(claims.Sub.Allow, "jobs.workloadId"))
+	be.True(t, slices.Contains(claims.Pub.Allow, "$KV.config.>"))
+	be.False(t, slices.Contains(claims.Pub.Allow, "$KV.cache.>"))
+
+	renewed, err := m.Renew("user", "workloadId", connData.NatsUserJwt)
+	be.NilErr(t, err)
+	renewedClaims, err := jwt.DecodeUserClaims(renewed.NatsUserJwt)
+	be.NilErr(t, err)
+	be.AllEqual(t, claims.Pub.Allow, renewedClaims.Pub.Allow)
+
+	// narrowing the policy stops renewals of credentials it no longer covers
+	narrowed := m
+	narrowed.Policies = staticPolicies{"user": {Publish: []string{"orders.{{namespace}}.>"}}}
+	_, err = narrowed.Renew("user", "workloadId", renewed.NatsUserJwt)
+	be.Nonzero(t, err)
+
+	tt := []struct {
+		name  string
+		ns    string
+		perms *models.WorkloadPermissions
+	}{
+		{"Broader Subject", "user", &models.WorkloadPermissions{Publish: []string{"orders.>"}}},
+		{"Other Namespace Subject", "user", &models.WorkloadPermissions{Publish: []string{"orders.other.created"}}},
+		{"Wildcard Over Token", "user", &models.WorkloadPermissions{Subscribe: []string{"jobs.>"}}},
+		{"Unknown Bucket", "user", &models.WorkloadPermissions{KvBuckets: []string{"secrets"}}},
+		{"Unknown Object Store", "user", &models.WorkloadPermissions{ObjectStores: []string{"assets"}}},
+		{"No Policy", "other", &models.WorkloadPermissions{Publish: []string{"orders.other.created"}}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := m.MintScoped(tc.ns, "workloadId2", tc.perms)
+			be.Nonzero(t, err)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package credentials
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/nats-io/jwt/v2"
 	"github.com/nats-io/nats.go"
@@ -31,6 +32,8 @@ var (
 			Pub: jwt.Permission{
 				Allow: []string{
 					fmt.Sprintf("%s.HEARTBEAT.%s", models.AgentAPIPrefix(nodeId), id),
+					fmt.Sprintf("%s.SECRET.%s", models.AgentAPIPrefix(nodeId), id),
+					fmt.Sprintf("%s.OPERATION.%s", models.AgentAPIPrefix(nodeId), id),
 					fmt.Sprintf("%s.*", models.EventAPIPrefix(id)),
 					fmt.Sprintf("%s.*.stdout", models.LogAPIPrefix(id)), //
 					fmt.Sprintf("%s.*.stderr", models.LogAPIPrefix(id)), // workload logs
@@ -47,6 +50,7 @@ var (
 					fmt.Sprintf("%s.QUERYWORKLOADS", models.AgentAPIPrefix(nodeId)),
 					fmt.Sprintf("%s.PING", models.AgentAPIPrefix(nodeId)),
 					fmt.Sprintf("%s.SETLAMEDUCK", models.AgentAPIPrefix(nodeId)),
+					fmt.Sprintf("%s.%s.SECRETUPDATED", models.AgentAPIPrefix(nodeId), id),
 					fmt.Sprintf("%s.PINGWORKLOAD.*", models.AgentAPIPrefix(nexus)),
 					"$SRV.>",               // for micro
 					nats.InboxPrefix + ">", // responses
@@ -57,10 +61,11 @@ var (
 			},
 		}
 	}
-	WorkloadClaims func(string, string) jwt.Permissions = func(namespace, workloadId string) jwt.Permissions {
-		return jwt.Permissions{
+	WorkloadClaims func(string, string, string, *models.NamespacePolicy) jwt.Permissions = func(namespace, workloadId, nodeId string, policy *models.NamespacePolicy) jwt.Permissions {
+		perms := jwt.Permissions{
 			Pub: jwt.Permission{
 				Allow: []string{
+					models.RenewWorkloadCredsRequestSubject(namespace, nodeId, workloadId),
 					nats.InboxPrefix + ">", // responses
 				},
 			},
@@ -74,5 +79,44 @@ var (
 				MaxMsgs: 1,
 			},
 		}
+
+		if policy == nil {
+			return perms
+		}
+
+		expand := strings.NewReplacer("{{namespace}}", namespace, "{{workload_id}}", workloadId)
+		for _, subject := range policy.Publish {
+			perms.Pub.Allow = append(perms.Pub.Allow, expand.Replace(subject))
+		}
+		for _, subject := range policy.Subscribe {
+			perms.Sub.Allow = append(perms.Sub.Allow, expand.Replace(subject))
+		}
+		for _, bucket := range policy.KvBuckets {
+			perms.Pub.Allow = append(perms.Pub.Allow, fmt.Sprintf("$KV.%s.>", expand.Replace(bucket)))
+			perms.Pub.Allow = append(perms.Pub.Allow, jetstreamStreamSubjects("KV_"+expand.Replace(bucket))...)
+		}
+		for _, bucket := range policy.ObjectStores {
+			perms.Pub.Allow = append(perms.Pub.Allow, fmt.Sprintf("$O.%s.>", expand.Replace(bucket)))
+			perms.Pub.Allow = append(perms.Pub.Allow, jetstreamStreamSubjects("OBJ_"+expand.Replace(bucket))...)
+		}
+
+		return perms
 	}
 )
+
+// jetstreamStreamSubjects are the JetStream API subjects needed to read from and
+// write to the stream backing a key value bucket or object store
+func jetstreamStreamSubjects(stream string) []string {
+	return []string{
+		fmt.Sprintf("$JS.API.STREAM.INFO.%s", stream),
+		fmt.Sprintf("$JS.API.STREAM.MSG.GET.%s", stream),
+		fmt.Sprintf("$JS.API.STREAM.PURGE.%s", stream),
+		fmt.Sprintf("$JS.API.DIRECT.GET.%s", stream),
+		fmt.Sprintf("$JS.API.DIRECT.GET.%s.>", stream),
+		fmt.Sprintf("$JS.API.CONSUMER.CREATE.%s", stream),
+		fmt.Sprintf("$JS.API.CONSUMER.CREATE.%s.>", stream),
+		fmt.Sprintf("$JS.API.CONSUMER.DELETE.%s.>", stream),
+		fmt.Sprintf("$JS.FC.%s.>", stream),
+		fmt.Sprintf("$JS.ACK.%s.>", stream),
+	}
+}
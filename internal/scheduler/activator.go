@@ -0,0 +1,609 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/synadia-io/nex/models"
+	"github.com/synadia-io/nex/scheduling"
+	"github.com/synadia-io/nex/sdk/go/agent"
+)
+
+const (
+	// DefaultActivatorMaxPending is the number of messages buffered for a lazy
+	// function while its instance starts
+	DefaultActivatorMaxPending = 1000
+
+	// activatorForwardTimeout bounds forwarding a buffered message to a started
+	// instance and waiting for its reply
+	activatorForwardTimeout = 30 * time.Second
+)
+
+// Activator starts the lazy functions stored in a KV bucket on demand. Every
+// node running an activator competes for a lease in the bucket; the holder
+// subscribes to the trigger subjects of every function without a running
+// instance. The first message on them starts an instance through the launcher,
+// authorized as the caller that signed the function; messages are buffered
+// until it runs and then forwarded to it. Instances without invocations for the
+// idle timeout of their function are stopped
+type Activator struct {
+	ctx        context.Context
+	nc         *nats.Conn
+	kv         jetstream.KeyValue
+	launcher   models.JobLauncher
+	authorizer models.ControlAuthorizer
+	logger     *slog.Logger
+	nodeID     string
+	subs       []*nats.Subscription
+
+	interval   time.Duration
+	leaseTTL   time.Duration
+	maxPending int
+	now        func() time.Time
+
+	mu        sync.Mutex
+	leading   bool
+	functions map[string]*lazyFunction
+}
+
+// lazyFunction is the state the leading activator keeps for a function
+type lazyFunction struct {
+	def         *models.LazyFunction
+	revision    uint64
+	idleTimeout time.Duration
+
+	// subscriptions to the trigger subjects; nil while an instance runs
+	subs []*nats.Subscription
+	// messages waiting for the instance to start
+	pending []*nats.Msg
+	// messages forwarded to the instance and waiting for its reply. The
+	// activator does not subscribe meanwhile, or the forwarded messages could
+	// be delivered back to it instead of the instance
+	forwarding int
+
+	instance   *models.FunctionInstance
+	starting   bool
+	stopping   bool
+	lastActive time.Time
+}
+
+// NewActivator creates the function bucket if it does not exist and tracks the
+// invocations and exits of function instances until ctx is done. Agents must
+// emit events over NATS for idle instances to be detected
+func NewActivator(ctx context.Context, nc *nats.Conn, bucket, nodeID string, launcher models.JobLauncher, authorizer models.ControlAuthorizer, logger *slog.Logger) (*Activator, error) {
+	if launcher == nil {
+		return nil, errors.New("function launcher is nil")
+	}
+	if authorizer == nil {
+		return nil, errors.New("control authorizer is nil")
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      bucket,
+		Description: "Nex lazy functions and their instances",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create function bucket: %w", err)
+	}
+
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	a := &Activator{
+		ctx:        ctx,
+		nc:         nc,
+		kv:         kv,
+		launcher:   launcher,
+		authorizer: authorizer,
+		logger:     logger,
+		nodeID:     nodeID,
+		interval:   DefaultInterval,
+		leaseTTL:   DefaultLeaseTTL,
+		maxPending: DefaultActivatorMaxPending,
+		now:        time.Now,
+		functions:  make(map[string]*lazyFunction),
+	}
+
+	// every activator listens, but only the leader knows the instances
+	for event, handler := range map[string]nats.MsgHandler{
+		models.WorkloadTriggeredEvent{}.String(): a.handleWorkloadTriggered,
+		models.WorkloadStoppedEvent{}.String():   a.handleWorkloadStopped,
+	} {
+		sub, err := nc.Subscribe(models.EventAPIPrefix("*")+"."+event, handler)
+		if err != nil {
+			return nil, fmt.Errorf("failed to subscribe to workload events: %w", err)
+		}
+		a.subs = append(a.subs, sub)
+	}
+
+	go func() {
+		<-ctx.Done()
+		for _, sub := range a.subs {
+			_ = sub.Unsubscribe()
+		}
+		a.resign()
+	}()
+
+	return a, nil
+}
+
+// Run syncs the lazy functions and stops idle instances every interval until
+// the context is done
+func (a *Activator) Run() {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			a.tick()
+		}
+	}
+}
+
+func (a *Activator) tick() {
+	if !acquireLease(a.ctx, a.kv, a.nodeID, a.now(), a.leaseTTL, a.logger, "function activator") {
+		a.resign()
+		return
+	}
+
+	a.mu.Lock()
+	a.leading = true
+	a.mu.Unlock()
+
+	lister, err := a.kv.ListKeysFiltered(a.ctx, models.LazyFunctionKey("*", "*"))
+	if err != nil {
+		a.logger.Error("failed to list lazy functions", slog.String("err", err.Error()))
+		return
+	}
+
+	seen := make(map[string]bool)
+	for key := range lister.Keys() {
+		seen[key] = true
+		a.syncFunction(key)
+	}
+
+	a.mu.Lock()
+	for key, fn := range a.functions {
+		if !seen[key] {
+			a.unsubscribe(fn)
+			a.rejectPending(fn, errors.New("function was removed"))
+			delete(a.functions, key)
+		}
+	}
+	a.mu.Unlock()
+
+	a.stopOrphans(seen)
+}
+
+// syncFunction loads the function stored under the key and subscribes to its
+// trigger subjects if no instance runs. An idle instance is stopped
+func (a *Activator) syncFunction(key string) {
+	entry, err := a.kv.Get(a.ctx, key)
+	if err != nil {
+		return
+	}
+
+	def := new(models.LazyFunction)
+	err = json.Unmarshal(entry.Value(), def)
+	if err != nil {
+		a.logger.Warn("failed to read lazy function", slog.String("err", err.Error()), slog.String("key", key))
+		return
+	}
+	idleTimeout, err := scheduling.ParseIdleTimeout(def)
+	if err != nil {
+		a.logger.Warn("invalid lazy function", slog.String("err", err.Error()), slog.String("key", key))
+		return
+	}
+
+	a.mu.Lock()
+	fn, ok := a.functions[key]
+	a.mu.Unlock()
+	if !ok {
+		// an instance started by an earlier leader is adopted with a full idle
+		// timeout, since its last invocation is unknown
+		fn = &lazyFunction{
+			instance:   a.readInstance(def.Namespace, def.Name),
+			lastActive: a.now(),
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.functions[key] = fn
+
+	if fn.revision != entry.Revision() {
+		// changes apply to the subscriptions now and to the next instance
+		a.unsubscribe(fn)
+		fn.def = def
+		fn.revision = entry.Revision()
+		fn.idleTimeout = idleTimeout
+	}
+
+	switch {
+	case fn.instance == nil:
+		a.subscribe(key, fn)
+	case !fn.stopping && fn.forwarding == 0 && a.now().Sub(fn.lastActive) >= fn.idleTimeout:
+		// the subscriptions are back before the instance stops, so a message
+		// arriving meanwhile starts the next instance instead of being lost
+		fn.stopping = true
+		a.subscribe(key, fn)
+		go a.stopIdle(key, fn, fn.instance)
+	}
+}
+
+// subscribe listens on the trigger subjects of the function in the queue group
+// of its instances, unless messages are being forwarded to an instance. The
+// caller holds the lock
+func (a *Activator) subscribe(key string, fn *lazyFunction) {
+	if fn.subs != nil || fn.forwarding > 0 {
+		return
+	}
+
+	for _, subject := range fn.def.TriggerSubjects {
+		sub, err := a.nc.QueueSubscribe(subject, agent.TriggerQueueGroup(fn.def.Namespace, fn.def.Workload.Name), func(m *nats.Msg) {
+			a.handleTrigger(key, fn, m)
+		})
+		if err != nil {
+			a.logger.Error("failed to subscribe to trigger subject", slog.String("err", err.Error()), slog.String("subject", subject))
+			continue
+		}
+		fn.subs = append(fn.subs, sub)
+	}
+}
+
+// unsubscribe stops listening on the trigger subjects. The caller holds the
+// lock
+func (a *Activator) unsubscribe(fn *lazyFunction) {
+	for _, sub := range fn.subs {
+		_ = sub.Unsubscribe()
+	}
+	fn.subs = nil
+}
+
+func (a *Activator) handleTrigger(key string, fn *lazyFunction, m *nats.Msg) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if fn.instance != nil && !fn.stopping {
+		// delivered before the subscription was drained
+		fn.forwarding++
+		go a.forward(key, fn, m)
+		return
+	}
+
+	if len(fn.pending) >= a.maxPending {
+		a.logger.Warn("dropping trigger message; too many messages wait for the function to start", slog.String("key", key))
+		a.reject(m, fmt.Errorf("function %s is starting and has %d pending messages", fn.def.Name, len(fn.pending)))
+		return
+	}
+
+	fn.pending = append(fn.pending, m)
+	if !fn.starting && !fn.stopping {
+		fn.starting = true
+		go a.activate(key, fn)
+	}
+}
+
+// activate authorizes the function, starts an instance of it and forwards the
+// buffered messages to it once it runs
+func (a *Activator) activate(key string, fn *lazyFunction) {
+	a.mu.Lock()
+	def := fn.def
+	a.mu.Unlock()
+	logger := a.logger.With(slog.String("namespace", def.Namespace), slog.String("function", def.Name))
+
+	input, err := def.SigningInput()
+	if err == nil {
+		err = authorizeDefinition(a.authorizer, def.Caller, def.Signature, input, def.Namespace)
+	}
+	if err != nil {
+		logger.Warn("lazy function not authorized", slog.String("err", err.Error()), slog.String("caller", def.Caller))
+		a.mu.Lock()
+		fn.starting = false
+		a.rejectPending(fn, fmt.Errorf("function %s not authorized: %w", def.Name, err))
+		a.mu.Unlock()
+		return
+	}
+
+	req := def.Workload
+	req.Namespace = def.Namespace
+	req.WorkloadLifecycle = models.WorkloadLifecycleFunction
+
+	started := a.now().UTC()
+	resp, err := a.launcher.DeployJob(a.ctx, &req, def.Constraints)
+	var status *models.OperationStatus
+	if err == nil && resp.OperationId != "" {
+		status, err = a.launcher.WaitForOperation(a.ctx, def.Namespace, resp.OperationId)
+	}
+	if err != nil {
+		logger.Error("failed to start function instance", slog.String("err", err.Error()))
+		a.mu.Lock()
+		fn.starting = false
+		a.rejectPending(fn, fmt.Errorf("failed to start function %s: %w", def.Name, err))
+		a.mu.Unlock()
+		return
+	}
+
+	instance := &models.FunctionInstance{
+		Function:  def.Name,
+		Id:        resp.Id,
+		Namespace: def.Namespace,
+		Started:   started,
+	}
+	if status != nil {
+		instance.NodeId = status.NodeId
+	}
+	a.putInstance(instance)
+	logger.Info("started function instance", slog.String("workload_id", instance.Id))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	fn.instance = instance
+	fn.starting = false
+	fn.lastActive = a.now()
+	for _, sub := range fn.subs {
+		_ = sub.Drain()
+	}
+	fn.subs = nil
+	for _, m := range fn.pending {
+		fn.forwarding++
+		go a.forward(key, fn, m)
+	}
+	fn.pending = nil
+}
+
+// forward sends a trigger message to the running instance and relays its reply
+// to the sender. The caller counted the message in fn.forwarding
+func (a *Activator) forward(key string, fn *lazyFunction, m *nats.Msg) {
+	a.touch(fn)
+	defer a.forwarded(key, fn)
+
+	fwd := nats.NewMsg(m.Subject)
+	fwd.Data = m.Data
+	for k, v := range m.Header {
+		fwd.Header[k] = v
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, activatorForwardTimeout)
+	defer cancel()
+
+	reply, err := a.nc.RequestMsgWithContext(ctx, fwd)
+	if err != nil {
+		a.logger.Error("failed to forward trigger message", slog.String("err", err.Error()), slog.String("subject", m.Subject))
+		a.reject(m, fmt.Errorf("failed to forward message to function: %w", err))
+		return
+	}
+
+	if m.Reply == "" {
+		return
+	}
+	resp := nats.NewMsg(m.Reply)
+	resp.Data = reply.Data
+	resp.Header = reply.Header
+	if err := m.RespondMsg(resp); err != nil {
+		a.logger.Error("failed to relay function reply", slog.String("err", err.Error()))
+	}
+}
+
+// forwarded subscribes to the trigger subjects again once the last forward
+// finished, if the instance stopped or is stopping meanwhile
+func (a *Activator) forwarded(key string, fn *lazyFunction) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	fn.forwarding--
+	if fn.forwarding == 0 && (fn.instance == nil || fn.stopping) && a.functions[key] == fn {
+		a.subscribe(key, fn)
+	}
+}
+
+// stopIdle stops an instance that went without invocations for the idle
+// timeout of its function
+func (a *Activator) stopIdle(key string, fn *lazyFunction, instance *models.FunctionInstance) {
+	a.logger.Info("stopping idle function instance", slog.String("namespace", instance.Namespace), slog.String("function", instance.Function), slog.String("workload_id", instance.Id))
+
+	err := a.launcher.StopJob(a.ctx, instance.Namespace, instance.Id)
+	if err != nil {
+		// an instance that is gone counts as stopped
+		a.logger.Warn("failed to stop idle function instance", slog.String("err", err.Error()), slog.String("workload_id", instance.Id))
+	}
+	a.instanceStopped(key, fn, instance.Id)
+}
+
+// instanceStopped forgets the stopped instance, listens on the trigger
+// subjects again and starts the next instance if messages are waiting
+func (a *Activator) instanceStopped(key string, fn *lazyFunction, id string) {
+	a.mu.Lock()
+	if fn.instance == nil || fn.instance.Id != id {
+		a.mu.Unlock()
+		return
+	}
+	instance := fn.instance
+	fn.instance = nil
+	fn.stopping = false
+	if a.functions[key] == fn {
+		a.subscribe(key, fn)
+	}
+	if len(fn.pending) > 0 && !fn.starting {
+		fn.starting = true
+		go a.activate(key, fn)
+	}
+	a.mu.Unlock()
+
+	a.deleteInstance(instance)
+}
+
+// stopOrphans stops the instances of functions that were removed
+func (a *Activator) stopOrphans(functions map[string]bool) {
+	lister, err := a.kv.ListKeysFiltered(a.ctx, models.FunctionInstanceKey("*", "*"))
+	if err != nil {
+		return
+	}
+
+	for key := range lister.Keys() {
+		fnKey := "functions." + strings.TrimPrefix(key, "instances.")
+		if functions[fnKey] {
+			continue
+		}
+
+		entry, err := a.kv.Get(a.ctx, key)
+		if err != nil {
+			continue
+		}
+		instance := new(models.FunctionInstance)
+		if json.Unmarshal(entry.Value(), instance) != nil {
+			continue
+		}
+
+		// the record goes first so the next tick does not stop it again
+		a.deleteInstance(instance)
+		go func() {
+			a.logger.Info("stopping instance of removed function", slog.String("namespace", instance.Namespace), slog.String("function", instance.Function), slog.String("workload_id", instance.Id))
+			err := a.launcher.StopJob(a.ctx, instance.Namespace, instance.Id)
+			if err != nil {
+				a.logger.Warn("failed to stop instance of removed function", slog.String("err", err.Error()), slog.String("workload_id", instance.Id))
+			}
+		}()
+	}
+}
+
+// resign drops the subscriptions and state of a node that lost the lease.
+// Running instances are adopted by the next leader
+func (a *Activator) resign() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.leading {
+		return
+	}
+
+	a.logger.Info("lost function activator lease")
+	for _, fn := range a.functions {
+		a.unsubscribe(fn)
+	}
+	a.functions = make(map[string]*lazyFunction)
+	a.leading = false
+}
+
+func (a *Activator) handleWorkloadTriggered(m *nats.Msg) {
+	event := new(models.WorkloadTriggeredEvent)
+	if json.Unmarshal(m.Data, event) != nil {
+		return
+	}
+
+	if fn := a.instanceFunction(event.Namespace, event.Id); fn != nil {
+		a.touch(fn)
+	}
+}
+
+func (a *Activator) handleWorkloadStopped(m *nats.Msg) {
+	event := new(models.WorkloadStoppedEvent)
+	if json.Unmarshal(m.Data, event) != nil {
+		return
+	}
+
+	fn := a.instanceFunction(event.Namespace, event.Id)
+	if fn == nil {
+		return
+	}
+	a.mu.Lock()
+	key := models.LazyFunctionKey(fn.def.Namespace, fn.def.Name)
+	a.mu.Unlock()
+	go a.instanceStopped(key, fn, event.Id)
+}
+
+// instanceFunction returns the function the workload is the instance of, or
+// nil if it is not an instance known to this activator
+func (a *Activator) instanceFunction(namespace, workloadID string) *lazyFunction {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, fn := range a.functions {
+		if fn.instance != nil && fn.instance.Namespace == namespace && fn.instance.Id == workloadID {
+			return fn
+		}
+	}
+	return nil
+}
+
+func (a *Activator) touch(fn *lazyFunction) {
+	a.mu.Lock()
+	fn.lastActive = a.now()
+	a.mu.Unlock()
+}
+
+// rejectPending answers the buffered messages with the error. The caller holds
+// the lock
+func (a *Activator) rejectPending(fn *lazyFunction, err error) {
+	for _, m := range fn.pending {
+		a.reject(m, err)
+	}
+	fn.pending = nil
+}
+
+// reject answers a trigger message with an error the way a failed function
+// does; messages without a reply subject are dropped
+func (a *Activator) reject(m *nats.Msg, err error) {
+	if m.Reply == "" {
+		return
+	}
+	resp := nats.NewMsg(m.Reply)
+	resp.Header.Set("error", err.Error())
+	_ = m.RespondMsg(resp)
+}
+
+func (a *Activator) readInstance(namespace, name string) *models.FunctionInstance {
+	entry, err := a.kv.Get(a.ctx, models.FunctionInstanceKey(namespace, name))
+	if err != nil {
+		return nil
+	}
+	instance := new(models.FunctionInstance)
+	if json.Unmarshal(entry.Value(), instance) != nil {
+		return nil
+	}
+	return instance
+}
+
+func (a *Activator) putInstance(instance *models.FunctionInstance) {
+	instanceB, err := json.Marshal(instance)
+	if err != nil {
+		return
+	}
+	_, err = a.kv.Put(a.ctx, models.FunctionInstanceKey(instance.Namespace, instance.Function), instanceB)
+	if err != nil {
+		a.logger.Error("failed to record function instance", slog.String("err", err.Error()), slog.String("workload_id", instance.Id))
+	}
+}
+
+// deleteInstance removes the record of the instance unless a newer instance
+// of the function replaced it
+func (a *Activator) deleteInstance(instance *models.FunctionInstance) {
+	key := models.FunctionInstanceKey(instance.Namespace, instance.Function)
+	entry, err := a.kv.Get(a.ctx, key)
+	if err != nil {
+		return
+	}
+	current := new(models.FunctionInstance)
+	if json.Unmarshal(entry.Value(), current) == nil && current.Id != instance.Id {
+		return
+	}
+	err = a.kv.Purge(a.ctx, key, jetstream.LastRevision(entry.Revision()))
+	if err != nil {
+		a.logger.Warn("failed to remove function instance", slog.String("err", err.Error()), slog.String("key", key))
+	}
+}
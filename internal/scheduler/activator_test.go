@@ -0,0 +1,319 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/carlmjohnson/be"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/nex/internal/cauthorizer"
+	"github.com/synadia-io/nex/models"
+	"github.com/synadia-io/nex/scheduling"
+	"github.com/synadia-io/nex/sdk/go/agent"
+)
+
+// functionLauncher starts instances that answer on the trigger subject after
+// a short startup delay. Like nodes, it returns once the instance subscribed
+type functionLauncher struct {
+	testLauncher
+	nc      *nats.Conn
+	subject string
+	fail    bool
+	subs    map[string]*nats.Subscription
+}
+
+func (l *functionLauncher) DeployJob(ctx context.Context, req *models.StartWorkloadRequest, constraints []string) (*models.StartWorkloadResponse, error) {
+	if l.fail {
+		return nil, errors.New("no agents available for workload placement")
+	}
+	resp, err := l.testLauncher.DeployJob(ctx, req, constraints)
+	if err != nil {
+		return nil, err
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	sub, err := l.nc.QueueSubscribe(l.subject, agent.TriggerQueueGroup(req.Namespace, req.Name), func(m *nats.Msg) {
+		_ = m.Respond(append([]byte(resp.Id+": "), m.Data...))
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = l.nc.Flush()
+	if err != nil {
+		return nil, err
+	}
+	l.Lock()
+	l.subs[resp.Id] = sub
+	l.Unlock()
+	return resp, nil
+}
+
+func (l *functionLauncher) StopJob(ctx context.Context, namespace, workloadID string) error {
+	l.Lock()
+	if sub, ok := l.subs[workloadID]; ok {
+		_ = sub.Unsubscribe()
+	}
+	l.Unlock()
+	return l.testLauncher.StopJob(ctx, namespace, workloadID)
+}
+
+func newTestActivator(t testing.TB, ctx context.Context, nc *nats.Conn, bucket string, now *time.Time, l models.JobLauncher) *Activator {
+	t.Helper()
+	a, err := NewActivator(ctx, nc, bucket, "n1", l, &cauthorizer.AllowAllAuthorizer{}, nil)
+	be.NilErr(t, err)
+	var mu sync.Mutex
+	a.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return *now
+	}
+	return a
+}
+
+func putFunction(t testing.TB, a *Activator, fn *models.LazyFunction) {
+	t.Helper()
+	fnB, err := json.Marshal(fn)
+	be.NilErr(t, err)
+	_, err = a.kv.Put(context.TODO(), models.LazyFunctionKey(fn.Namespace, fn.Name), fnB)
+	be.NilErr(t, err)
+}
+
+func testFunction(name, subject string) *models.LazyFunction {
+	workload := testWorkload()
+	workload.Name = name
+	workload.WorkloadLifecycle = models.WorkloadLifecycleFunction
+	return &models.LazyFunction{
+		Name:            name,
+		Namespace:       "default",
+		TriggerSubjects: []string{subject},
+		IdleTimeout:     "1m",
+		Workload:        workload,
+		Created:         time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestActivator(t *testing.T) {
+	server := startNatsServer(t, t.TempDir())
+	defer server.Shutdown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("activate and idle", func(t *testing.T) {
+		nc := connect(t, server)
+		now := base
+		l := &functionLauncher{nc: nc, subject: "lazy.greet", subs: make(map[string]*nats.Subscription)}
+		a := newTestActivator(t, ctx, nc, "activate", &now, l)
+		putFunction(t, a, testFunction("greet", "lazy.greet"))
+		a.tick()
+
+		// both messages wait for the same instance
+		var wg sync.WaitGroup
+		replies := make(chan string, 2)
+		for _, payload := range []string{"hi", "hello"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := nc.Request("lazy.greet", []byte(payload), 5*time.Second)
+				if err == nil {
+					replies <- string(resp.Data)
+				}
+			}()
+		}
+		wg.Wait()
+		close(replies)
+		got := []string{}
+		for r := range replies {
+			got = append(got, r)
+		}
+		be.Equal(t, 2, len(got))
+		be.In(t, "job1: ", got[0])
+
+		instances, err := scheduling.ListFunctionInstances(ctx, a.kv, "default")
+		be.NilErr(t, err)
+		be.Equal(t, 1, len(instances))
+		be.Equal(t, "job1", instances[0].Id)
+		be.Equal(t, "node1", instances[0].NodeId)
+
+		// the running instance answers without the activator
+		resp, err := nc.Request("lazy.greet", []byte("again"), time.Second)
+		be.NilErr(t, err)
+		be.Equal(t, "job1: again", string(resp.Data))
+		deployed, _ := l.counts()
+		be.Equal(t, 1, deployed)
+
+		// invocations keep the instance running
+		now = base.Add(50 * time.Second)
+		ev, err := json.Marshal(models.WorkloadTriggeredEvent{Id: "job1", Namespace: "default"})
+		be.NilErr(t, err)
+		be.NilErr(t, nc.Publish(models.EventAPIPrefix("default")+"."+models.WorkloadTriggeredEvent{}.String(), ev))
+		be.NilErr(t, nc.Flush())
+		waitFor(t, func() bool {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			return a.functions[models.LazyFunctionKey("default", "greet")].lastActive.Equal(now)
+		})
+		now = base.Add(90 * time.Second)
+		a.tick()
+		_, stopped := l.counts()
+		be.Equal(t, 0, stopped)
+
+		now = base.Add(2 * time.Minute)
+		a.tick()
+		waitFor(t, func() bool {
+			instances, _ := scheduling.ListFunctionInstances(ctx, a.kv, "default")
+			return len(instances) == 0
+		})
+		_, stopped = l.counts()
+		be.Equal(t, 1, stopped)
+
+		resp, err = nc.Request("lazy.greet", []byte("back"), 5*time.Second)
+		be.NilErr(t, err)
+		be.Equal(t, "job2: back", string(resp.Data))
+	})
+
+	t.Run("instance exits", func(t *testing.T) {
+		nc := connect(t, server)
+		now := base
+		l := &functionLauncher{nc: nc, subject: "lazy.exit", subs: make(map[string]*nats.Subscription)}
+		a := newTestActivator(t, ctx, nc, "exit", &now, l)
+		putFunction(t, a, testFunction("exit", "lazy.exit"))
+		a.tick()
+
+		_, err := nc.Request("lazy.exit", nil, 5*time.Second)
+		be.NilErr(t, err)
+		be.NilErr(t, l.StopJob(ctx, "default", "job1"))
+
+		ev, err := json.Marshal(models.WorkloadStoppedEvent{Id: "job1", Namespace: "default"})
+		be.NilErr(t, err)
+		be.NilErr(t, nc.Publish(models.EventAPIPrefix("default")+"."+models.WorkloadStoppedEvent{}.String(), ev))
+		waitFor(t, func() bool {
+			instances, _ := scheduling.ListFunctionInstances(ctx, a.kv, "default")
+			return len(instances) == 0
+		})
+
+		resp, err := nc.Request("lazy.exit", []byte("restarted"), 5*time.Second)
+		be.NilErr(t, err)
+		be.Equal(t, "job2: restarted", string(resp.Data))
+	})
+
+	t.Run("start fails", func(t *testing.T) {
+		nc := connect(t, server)
+		now := base
+		l := &functionLauncher{nc: nc, subject: "lazy.fail", fail: true, subs: make(map[string]*nats.Subscription)}
+		a := newTestActivator(t, ctx, nc, "fail", &now, l)
+		putFunction(t, a, testFunction("fail", "lazy.fail"))
+		a.tick()
+
+		resp, err := nc.Request("lazy.fail", nil, 5*time.Second)
+		be.NilErr(t, err)
+		be.In(t, "no agents available", resp.Header.Get("error"))
+	})
+
+	t.Run("authorization", func(t *testing.T) {
+		nc := connect(t, server)
+		now := base
+
+		devKp, err := nkeys.CreateUser()
+		be.NilErr(t, err)
+		devPub, err := devKp.PublicKey()
+		be.NilErr(t, err)
+		policy, err := cauthorizer.NewPolicyAuthorizer(&cauthorizer.ControlPolicy{
+			Users: []cauthorizer.ControlPolicyUser{{Nkey: devPub, Namespaces: []string{"default"}, Actions: []models.ControlAction{models.ControlActionDeploy}}},
+		})
+		be.NilErr(t, err)
+		l := &functionLauncher{nc: nc, subject: "lazy.signed", subs: make(map[string]*nats.Subscription)}
+		a := newTestActivator(t, ctx, nc, "authorization", &now, l)
+		a.authorizer = policy
+
+		signed := testFunction("signed", "lazy.signed")
+		signed.Caller = devPub
+		input, err := signed.SigningInput()
+		be.NilErr(t, err)
+		sig, err := devKp.Sign(input)
+		be.NilErr(t, err)
+		signed.Signature = base64.RawURLEncoding.EncodeToString(sig)
+		putFunction(t, a, signed)
+
+		// a function stored by someone who may write to the bucket but did
+		// not sign it as an authorized caller
+		forged := *signed
+		forged.Name = "forged"
+		forged.TriggerSubjects = []string{"lazy.forged"}
+		forged.Workload.RunRequest = `{"argv":["--evil"]}`
+		putFunction(t, a, &forged)
+		a.tick()
+
+		resp, err := nc.Request("lazy.forged", nil, 5*time.Second)
+		be.NilErr(t, err)
+		be.In(t, "not authorized", resp.Header.Get("error"))
+		deployed, _ := l.counts()
+		be.Equal(t, 0, deployed)
+
+		resp, err = nc.Request("lazy.signed", []byte("hi"), 5*time.Second)
+		be.NilErr(t, err)
+		be.Equal(t, "job1: hi", string(resp.Data))
+	})
+
+	t.Run("forwarding", func(t *testing.T) {
+		nc := connect(t, server)
+		now := base
+		l := &functionLauncher{nc: nc, subject: "lazy.forward", subs: make(map[string]*nats.Subscription)}
+		a := newTestActivator(t, ctx, nc, "forward", &now, l)
+		putFunction(t, a, testFunction("forward", "lazy.forward"))
+		a.tick()
+
+		key := models.LazyFunctionKey("default", "forward")
+		a.mu.Lock()
+		fn := a.functions[key]
+		be.Equal(t, 1, len(fn.subs))
+
+		// an instance is stopping while a message is forwarded to it, so the
+		// activator must not take the forwarded message back
+		a.unsubscribe(fn)
+		fn.instance = &models.FunctionInstance{Function: "forward", Id: "job1", Namespace: "default"}
+		fn.stopping = true
+		fn.forwarding = 1
+		a.subscribe(key, fn)
+		be.Equal(t, 0, len(fn.subs))
+		a.mu.Unlock()
+
+		a.forwarded(key, fn)
+		a.mu.Lock()
+		be.Equal(t, 1, len(fn.subs))
+		a.mu.Unlock()
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		nc := connect(t, server)
+		now := base
+		l := &functionLauncher{nc: nc, subject: "lazy.removed", subs: make(map[string]*nats.Subscription)}
+		a := newTestActivator(t, ctx, nc, "removed", &now, l)
+		putFunction(t, a, testFunction("removed", "lazy.removed"))
+		a.tick()
+
+		_, err := nc.Request("lazy.removed", nil, 5*time.Second)
+		be.NilErr(t, err)
+
+		be.NilErr(t, a.kv.Purge(ctx, models.LazyFunctionKey("default", "removed")))
+		a.tick()
+		waitFor(t, func() bool {
+			_, stopped := l.counts()
+			return stopped == 1
+		})
+		instances, err := scheduling.ListFunctionInstances(ctx, a.kv, "default")
+		be.NilErr(t, err)
+		be.Equal(t, 0, len(instances))
+
+		_, err = nc.Request("lazy.removed", nil, 200*time.Millisecond)
+		be.True(t, errors.Is(err, nats.ErrNoResponders))
+	})
+}
@@ -0,0 +1,543 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/synadia-io/nex/models"
+	"github.com/synadia-io/nex/scheduling"
+)
+
+const (
+	// DefaultAutoscaleInterval is how often the leader evaluates the
+	// autoscaling policies
+	DefaultAutoscaleInterval = 5 * time.Second
+
+	// autoscaleMetricMaxAge is how long the metric emitted by an instance counts
+	autoscaleMetricMaxAge = time.Minute
+	// autoscaleRequestTimeout bounds reading a consumer and listing instances
+	autoscaleRequestTimeout = 10 * time.Second
+)
+
+// Autoscaler keeps the number of instances of the workloads with an
+// autoscaling policy in a KV bucket between their minimum and maximum. Every
+// node running an autoscaler competes for a lease in the bucket; only the
+// holder evaluates the policies, authorized as the caller that signed them.
+// Instances are started through the auction and stopped with undeploy requests,
+// and every decision is emitted as a WorkloadScaledEvent
+type Autoscaler struct {
+	ctx        context.Context
+	nc         *nats.Conn
+	js         jetstream.JetStream
+	kv         jetstream.KeyValue
+	scaler     models.WorkloadScaler
+	authorizer models.ControlAuthorizer
+	emitter    models.EventEmitter
+	logger     *slog.Logger
+	nodeID     string
+
+	interval time.Duration
+	leaseTTL time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	leading bool
+	// policies with an evaluation in progress
+	evaluating map[string]bool
+	// subscriptions to the metrics of the namespaces with metric policies
+	metricSubs map[string]*nats.Subscription
+	// latest metrics by namespace and workload ID, kept for the instances only
+	metrics map[string]instanceMetrics
+	// namespace and workload IDs of the instances of each policy, by policy key
+	instances map[string][]string
+}
+
+// instanceMetrics are the numeric fields of the last metrics payload of an
+// instance
+type instanceMetrics struct {
+	values   map[string]float64
+	received time.Time
+}
+
+// NewAutoscaler creates the autoscaler bucket if it does not exist. Scaling
+// decisions are emitted with the emitter; it may be nil
+func NewAutoscaler(ctx context.Context, nc *nats.Conn, bucket, nodeID string, scaler models.WorkloadScaler, authorizer models.ControlAuthorizer, emitter models.EventEmitter, logger *slog.Logger) (*Autoscaler, error) {
+	if scaler == nil {
+		return nil, errors.New("workload scaler is nil")
+	}
+	if authorizer == nil {
+		return nil, errors.New("control authorizer is nil")
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      bucket,
+		Description: "Nex autoscaling policies and their status",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create autoscaler bucket: %w", err)
+	}
+
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	a := &Autoscaler{
+		ctx:        ctx,
+		nc:         nc,
+		js:         js,
+		kv:         kv,
+		scaler:     scaler,
+		authorizer: authorizer,
+		emitter:    emitter,
+		logger:     logger,
+		nodeID:     nodeID,
+		interval:   DefaultAutoscaleInterval,
+		leaseTTL:   DefaultLeaseTTL,
+		now:        time.Now,
+		evaluating: make(map[string]bool),
+		metricSubs: make(map[string]*nats.Subscription),
+		metrics:    make(map[string]instanceMetrics),
+		instances:  make(map[string][]string),
+	}
+
+	go func() {
+		<-ctx.Done()
+		a.resign()
+	}()
+
+	return a, nil
+}
+
+// Run evaluates the autoscaling policies every interval until the context is
+// done
+func (a *Autoscaler) Run() {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			a.tick()
+		}
+	}
+}
+
+func (a *Autoscaler) tick() {
+	if !acquireLease(a.ctx, a.kv, a.nodeID, a.now(), a.leaseTTL, a.logger, "autoscaler") {
+		a.resign()
+		return
+	}
+
+	a.mu.Lock()
+	a.leading = true
+	a.mu.Unlock()
+
+	lister, err := a.kv.ListKeysFiltered(a.ctx, models.AutoscalingPolicyKey("*", "*"))
+	if err != nil {
+		a.logger.Error("failed to list autoscaling policies", slog.String("err", err.Error()))
+		return
+	}
+
+	namespaces := make(map[string]bool)
+	seen := make(map[string]bool)
+	for key := range lister.Keys() {
+		seen[key] = true
+		policy, err := a.readPolicy(key)
+		if err != nil {
+			a.logger.Warn("invalid autoscaling policy", slog.String("err", err.Error()), slog.String("key", key))
+			continue
+		}
+		if policy.Metric != nil {
+			namespaces[policy.Namespace] = true
+		}
+
+		a.mu.Lock()
+		busy := a.evaluating[key]
+		a.evaluating[key] = true
+		a.mu.Unlock()
+		if !busy {
+			go a.evaluate(key, policy)
+		}
+	}
+
+	a.mu.Lock()
+	for key := range a.instances {
+		if !seen[key] {
+			delete(a.instances, key)
+		}
+	}
+	a.mu.Unlock()
+
+	a.watchMetrics(namespaces)
+}
+
+func (a *Autoscaler) readPolicy(key string) (*models.AutoscalingPolicy, error) {
+	entry, err := a.kv.Get(a.ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := new(models.AutoscalingPolicy)
+	err = json.Unmarshal(entry.Value(), policy)
+	if err != nil {
+		return nil, err
+	}
+	_, _, err = scheduling.ParseAutoscalingPolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// evaluate compares the instances of the workload with the instances its
+// policy asks for and scales the workload once the cooldown passed. Falling
+// below the minimum or exceeding the maximum is corrected right away
+func (a *Autoscaler) evaluate(key string, policy *models.AutoscalingPolicy) {
+	defer func() {
+		a.mu.Lock()
+		delete(a.evaluating, key)
+		a.mu.Unlock()
+	}()
+
+	outCooldown, inCooldown, _ := scheduling.ParseAutoscalingPolicy(policy)
+	status := a.readStatus(policy.Namespace, policy.Name)
+	status.Updated = a.now().UTC()
+	defer a.putStatus(status)
+
+	input, err := policy.SigningInput()
+	if err == nil {
+		err = authorizeDefinition(a.authorizer, policy.Caller, policy.Signature, input, policy.Namespace)
+	}
+	if err != nil {
+		a.logger.Warn("autoscaling policy not authorized", slog.String("err", err.Error()), slog.String("key", key), slog.String("caller", policy.Caller))
+		status.Error = fmt.Sprintf("policy not authorized: %s", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, autoscaleRequestTimeout)
+	defer cancel()
+
+	ids, err := a.scaler.ListInstances(ctx, policy.Namespace, policy.Name)
+	if err != nil {
+		status.Error = fmt.Sprintf("failed to list instances: %s", err)
+		return
+	}
+	slices.Sort(ids)
+	status.Instances = len(ids)
+	a.trackInstances(key, policy.Namespace, ids)
+
+	status.Error = ""
+	value, err := a.observe(ctx, policy, ids)
+	if err != nil {
+		// without an observation the instances are only kept within bounds
+		status.Error = err.Error()
+		status.Desired = min(max(len(ids), policy.MinInstances), policy.MaxInstances)
+	} else {
+		status.MetricValue = value
+		status.Desired = DesiredInstances(policy, value)
+	}
+
+	now := a.now()
+	switch {
+	case status.Desired > len(ids):
+		if len(ids) >= policy.MinInstances && status.LastScaleOut != nil && now.Sub(*status.LastScaleOut) < outCooldown {
+			return
+		}
+		started := a.scaleOut(policy, status, len(ids))
+		a.trackInstances(key, policy.Namespace, append(ids, started...))
+	case status.Desired < len(ids):
+		if len(ids) <= policy.MaxInstances && lastScaled(status) != nil && now.Sub(*lastScaled(status)) < inCooldown {
+			return
+		}
+		stopped := a.scaleIn(policy, status, ids)
+		a.trackInstances(key, policy.Namespace, slices.DeleteFunc(ids, func(id string) bool {
+			return slices.Contains(stopped, id)
+		}))
+	}
+}
+
+// trackInstances records the instances of the policy, so only their metrics
+// are kept, and drops the metrics of workloads that are no instance of any
+// policy of the namespace
+func (a *Autoscaler) trackInstances(key, namespace string, ids []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tracked := make([]string, 0, len(ids))
+	for _, id := range ids {
+		tracked = append(tracked, namespace+"."+id)
+	}
+	a.instances[key] = tracked
+
+	for metricKey := range a.metrics {
+		if strings.HasPrefix(metricKey, namespace+".") && !a.isInstance(metricKey) {
+			delete(a.metrics, metricKey)
+		}
+	}
+}
+
+// isInstance reports whether the namespace and workload ID are an instance of
+// a policy. The caller holds the lock
+func (a *Autoscaler) isInstance(metricKey string) bool {
+	for _, tracked := range a.instances {
+		if slices.Contains(tracked, metricKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// observe returns the pending messages of the consumer or the sum of the
+// latest metric values of the instances
+func (a *Autoscaler) observe(ctx context.Context, policy *models.AutoscalingPolicy, ids []string) (float64, error) {
+	if policy.Consumer != nil {
+		consumer, err := a.js.Consumer(ctx, policy.Consumer.Stream, policy.Consumer.Consumer)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read consumer %s of stream %s: %w", policy.Consumer.Consumer, policy.Consumer.Stream, err)
+		}
+		info := consumer.CachedInfo()
+		return float64(info.NumPending) + float64(info.NumAckPending), nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	sum, reported := 0.0, 0
+	for _, id := range ids {
+		m, ok := a.metrics[policy.Namespace+"."+id]
+		if !ok || a.now().Sub(m.received) > autoscaleMetricMaxAge {
+			continue
+		}
+		if v, ok := m.values[policy.Metric.Name]; ok {
+			sum += v
+			reported++
+		}
+	}
+	if reported == 0 {
+		return 0, fmt.Errorf("no instance reported metric %s", policy.Metric.Name)
+	}
+	return sum, nil
+}
+
+// scaleOut starts instances until the desired number runs and returns the
+// started ones. It stops at the first instance that fails to start
+func (a *Autoscaler) scaleOut(policy *models.AutoscalingPolicy, status *models.AutoscalingStatus, current int) []string {
+	event := a.scaledEvent(policy, status, models.WorkloadScaledEventDirectionOut)
+
+	req := policy.Workload
+	req.Name = policy.Name
+	req.Namespace = policy.Namespace
+	req.WorkloadLifecycle = models.WorkloadLifecycleService
+
+	for range status.Desired - current {
+		resp, err := a.scaler.DeployJob(a.ctx, &req, policy.Constraints)
+		if err == nil && resp.OperationId != "" {
+			_, err = a.scaler.WaitForOperation(a.ctx, policy.Namespace, resp.OperationId)
+		}
+		if err != nil {
+			event.Error = fmt.Sprintf("failed to start instance: %s", err)
+			break
+		}
+		event.Started = append(event.Started, resp.Id)
+	}
+
+	event.To = current + len(event.Started)
+	if len(event.Started) > 0 {
+		scaled := a.now().UTC()
+		status.LastScaleOut = &scaled
+	}
+	a.emitScaled(status, event)
+	return event.Started
+}
+
+// scaleIn stops the instances beyond the desired number and returns the stopped
+// ones
+func (a *Autoscaler) scaleIn(policy *models.AutoscalingPolicy, status *models.AutoscalingStatus, ids []string) []string {
+	event := a.scaledEvent(policy, status, models.WorkloadScaledEventDirectionIn)
+
+	var errs error
+	for _, id := range ids[status.Desired:] {
+		err := a.scaler.StopJob(a.ctx, policy.Namespace, id)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		event.Stopped = append(event.Stopped, id)
+	}
+	if errs != nil {
+		event.Error = fmt.Sprintf("failed to stop instances: %s", errs)
+	}
+
+	event.To = len(ids) - len(event.Stopped)
+	if len(event.Stopped) > 0 {
+		scaled := a.now().UTC()
+		status.LastScaleIn = &scaled
+	}
+	a.emitScaled(status, event)
+	return event.Stopped
+}
+
+func (a *Autoscaler) scaledEvent(policy *models.AutoscalingPolicy, status *models.AutoscalingStatus, direction models.WorkloadScaledEventDirection) *models.WorkloadScaledEvent {
+	return &models.WorkloadScaledEvent{
+		Desired:     status.Desired,
+		Direction:   direction,
+		From:        status.Instances,
+		MetricValue: status.MetricValue,
+		Name:        policy.Name,
+		Namespace:   policy.Namespace,
+	}
+}
+
+func (a *Autoscaler) emitScaled(status *models.AutoscalingStatus, event *models.WorkloadScaledEvent) {
+	status.Instances = event.To
+	if event.Error != "" {
+		status.Error = event.Error
+	}
+
+	logger := a.logger.With(slog.String("namespace", event.Namespace), slog.String("workload", event.Name), slog.String("direction", string(event.Direction)))
+	if event.Error != "" {
+		logger.Error("failed to scale workload", slog.Int("from", event.From), slog.Int("to", event.To), slog.String("err", event.Error))
+	} else {
+		logger.Info("scaled workload", slog.Int("from", event.From), slog.Int("to", event.To), slog.Float64("metric_value", event.MetricValue))
+	}
+
+	if a.emitter == nil {
+		return
+	}
+	if err := a.emitter.EmitEvent(event.Namespace, *event); err != nil {
+		logger.Error("error emitting workload scaled event", slog.String("err", err.Error()))
+	}
+}
+
+// watchMetrics subscribes to the metrics of the namespaces with metric
+// policies and drops the subscriptions of the others
+func (a *Autoscaler) watchMetrics(namespaces map[string]bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for ns, sub := range a.metricSubs {
+		if !namespaces[ns] {
+			_ = sub.Unsubscribe()
+			delete(a.metricSubs, ns)
+		}
+	}
+	for ns := range namespaces {
+		if _, ok := a.metricSubs[ns]; ok {
+			continue
+		}
+		sub, err := a.nc.Subscribe(models.MetricsAPIPrefix(ns)+".*", a.handleMetrics)
+		if err != nil {
+			a.logger.Error("failed to subscribe to workload metrics", slog.String("err", err.Error()), slog.String("namespace", ns))
+			continue
+		}
+		a.metricSubs[ns] = sub
+	}
+
+	for key, m := range a.metrics {
+		if a.now().Sub(m.received) > autoscaleMetricMaxAge {
+			delete(a.metrics, key)
+		}
+	}
+}
+
+// handleMetrics keeps the numeric fields of a metrics payload published on
+// $NEX.FEED.<namespace>.metrics.<workload_id> by an instance of a policy
+func (a *Autoscaler) handleMetrics(m *nats.Msg) {
+	tokens := strings.Split(m.Subject, ".")
+	if len(tokens) != 5 {
+		return
+	}
+	metricKey := tokens[2] + "." + tokens[4]
+
+	payload := make(map[string]any)
+	if json.Unmarshal(m.Data, &payload) != nil {
+		return
+	}
+	values := make(map[string]float64)
+	for k, v := range payload {
+		if f, ok := v.(float64); ok {
+			values[k] = f
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.isInstance(metricKey) {
+		return
+	}
+	a.metrics[metricKey] = instanceMetrics{values: values, received: a.now()}
+}
+
+// resign drops the metric subscriptions of a node that lost the lease
+func (a *Autoscaler) resign() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.leading {
+		return
+	}
+
+	a.logger.Info("lost autoscaler lease")
+	for ns, sub := range a.metricSubs {
+		_ = sub.Unsubscribe()
+		delete(a.metricSubs, ns)
+	}
+	a.metrics = make(map[string]instanceMetrics)
+	a.instances = make(map[string][]string)
+	a.leading = false
+}
+
+func (a *Autoscaler) readStatus(namespace, name string) *models.AutoscalingStatus {
+	status := &models.AutoscalingStatus{Name: name, Namespace: namespace}
+	entry, err := a.kv.Get(a.ctx, models.AutoscalingStatusKey(namespace, name))
+	if err == nil {
+		_ = json.Unmarshal(entry.Value(), status)
+	}
+	return status
+}
+
+func (a *Autoscaler) putStatus(status *models.AutoscalingStatus) {
+	statusB, err := json.Marshal(status)
+	if err != nil {
+		return
+	}
+	_, err = a.kv.Put(a.ctx, models.AutoscalingStatusKey(status.Namespace, status.Name), statusB)
+	if err != nil {
+		a.logger.Error("failed to record autoscaling status", slog.String("err", err.Error()), slog.String("workload", status.Name))
+	}
+}
+
+// lastScaled returns when the workload was last scaled in either direction
+func lastScaled(status *models.AutoscalingStatus) *time.Time {
+	switch {
+	case status.LastScaleOut == nil:
+		return status.LastScaleIn
+	case status.LastScaleIn == nil || status.LastScaleOut.After(*status.LastScaleIn):
+		return status.LastScaleOut
+	default:
+		return status.LastScaleIn
+	}
+}
+
+// DesiredInstances returns the instances the policy asks for when the value is
+// observed, between the minimum and maximum of the policy
+func DesiredInstances(policy *models.AutoscalingPolicy, value float64) int {
+	desired := int(math.Ceil(value / policy.Target))
+	return min(max(desired, policy.MinInstances), policy.MaxInstances)
+}
@@ -0,0 +1,355 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/carlmjohnson/be"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/nex/internal/cauthorizer"
+	"github.com/synadia-io/nex/models"
+	"github.com/synadia-io/nex/scheduling"
+)
+
+// scalingLauncher lists the instances it started and did not stop
+type scalingLauncher struct {
+	testLauncher
+}
+
+func (l *scalingLauncher) ListInstances(_ context.Context, _, _ string) ([]string, error) {
+	l.Lock()
+	defer l.Unlock()
+	ids := []string{}
+	for _, id := range l.deployed {
+		if !slices.Contains(l.stopped, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+type testEmitter struct {
+	sync.Mutex
+	events []models.WorkloadScaledEvent
+}
+
+func (e *testEmitter) EmitEvent(_ string, event any) error {
+	e.Lock()
+	defer e.Unlock()
+	e.events = append(e.events, event.(models.WorkloadScaledEvent))
+	return nil
+}
+
+func (e *testEmitter) scaled() []models.WorkloadScaledEvent {
+	e.Lock()
+	defer e.Unlock()
+	return slices.Clone(e.events)
+}
+
+func newTestAutoscaler(t testing.TB, ctx context.Context, nc *nats.Conn, bucket string, now *time.Time, l models.WorkloadScaler, e models.EventEmitter) *Autoscaler {
+	t.Helper()
+	a, err := NewAutoscaler(ctx, nc, bucket, "n1", l, &cauthorizer.AllowAllAuthorizer{}, e, nil)
+	be.NilErr(t, err)
+	var mu sync.Mutex
+	a.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return *now
+	}
+	return a
+}
+
+func putPolicy(t testing.TB, a *Autoscaler, policy *models.AutoscalingPolicy) {
+	t.Helper()
+	policyB, err := json.Marshal(policy)
+	be.NilErr(t, err)
+	_, err = a.kv.Put(context.TODO(), models.AutoscalingPolicyKey(policy.Namespace, policy.Name), policyB)
+	be.NilErr(t, err)
+}
+
+// evaluated ticks the autoscaler and waits for the evaluation of the policy
+func evaluated(t testing.TB, a *Autoscaler, name string) *models.AutoscalingStatus {
+	t.Helper()
+	a.tick()
+	waitFor(t, func() bool {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return !a.evaluating[models.AutoscalingPolicyKey("default", name)]
+	})
+	return a.readStatus("default", name)
+}
+
+func testPolicy(name string) *models.AutoscalingPolicy {
+	workload := testWorkload()
+	workload.Name = name
+	return &models.AutoscalingPolicy{
+		Name:             name,
+		Namespace:        "default",
+		MinInstances:     1,
+		MaxInstances:     3,
+		Target:           10,
+		ScaleOutCooldown: "1m",
+		ScaleInCooldown:  "5m",
+		Workload:         workload,
+		Created:          time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestParseAutoscalingPolicy(t *testing.T) {
+	policy := testPolicy("p")
+	policy.Consumer = &models.AutoscalingPolicyConsumer{Stream: "ORDERS", Consumer: "workers"}
+	out, in, err := scheduling.ParseAutoscalingPolicy(policy)
+	be.NilErr(t, err)
+	be.Equal(t, time.Minute, out)
+	be.Equal(t, 5*time.Minute, in)
+
+	for _, tc := range []func(p *models.AutoscalingPolicy){
+		func(p *models.AutoscalingPolicy) { p.MaxInstances = 0 },
+		func(p *models.AutoscalingPolicy) { p.MinInstances = 4 },
+		func(p *models.AutoscalingPolicy) { p.Target = 0 },
+		func(p *models.AutoscalingPolicy) { p.Consumer = nil },
+		func(p *models.AutoscalingPolicy) { p.Metric = &models.AutoscalingPolicyMetric{Name: "queued"} },
+		func(p *models.AutoscalingPolicy) { p.Consumer.Stream = "" },
+		func(p *models.AutoscalingPolicy) { p.ScaleInCooldown = "soon" },
+		func(p *models.AutoscalingPolicy) { p.ScaleOutCooldown = "-1m" },
+		func(p *models.AutoscalingPolicy) {
+			p.Consumer, p.MinInstances = nil, 0
+			p.Metric = &models.AutoscalingPolicyMetric{Name: "queued"}
+		},
+	} {
+		invalid := testPolicy("p")
+		invalid.Consumer = &models.AutoscalingPolicyConsumer{Stream: "ORDERS", Consumer: "workers"}
+		tc(invalid)
+		_, _, err := scheduling.ParseAutoscalingPolicy(invalid)
+		be.Nonzero(t, err)
+	}
+
+	be.Equal(t, 1, DesiredInstances(policy, 0))
+	be.Equal(t, 2, DesiredInstances(policy, 11))
+	be.Equal(t, 3, DesiredInstances(policy, 1000))
+}
+
+func TestAutoscaler(t *testing.T) {
+	server := startNatsServer(t, t.TempDir())
+	defer server.Shutdown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("consumer pending", func(t *testing.T) {
+		nc := connect(t, server)
+		js, err := jetstream.New(nc)
+		be.NilErr(t, err)
+		_, err = js.CreateStream(ctx, jetstream.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}})
+		be.NilErr(t, err)
+		_, err = js.CreateOrUpdateConsumer(ctx, "ORDERS", jetstream.ConsumerConfig{Durable: "workers"})
+		be.NilErr(t, err)
+
+		now := base
+		l := new(scalingLauncher)
+		e := new(testEmitter)
+		a := newTestAutoscaler(t, ctx, nc, "consumer", &now, l, e)
+		policy := testPolicy("worker")
+		policy.Consumer = &models.AutoscalingPolicyConsumer{Stream: "ORDERS", Consumer: "workers"}
+		putPolicy(t, a, policy)
+
+		// the minimum starts right away
+		status := evaluated(t, a, "worker")
+		be.Equal(t, 1, status.Instances)
+		be.Equal(t, 1, status.Desired)
+		be.Equal(t, "", status.Error)
+
+		for range 25 {
+			_, err = js.Publish(ctx, "orders.new", nil)
+			be.NilErr(t, err)
+		}
+
+		// scaling out waits for the cooldown
+		now = base.Add(10 * time.Second)
+		status = evaluated(t, a, "worker")
+		be.Equal(t, 1, status.Instances)
+		be.Equal(t, 3, status.Desired)
+
+		now = base.Add(time.Minute)
+		status = evaluated(t, a, "worker")
+		be.Equal(t, 3, status.Instances)
+		be.Equal(t, float64(25), status.MetricValue)
+		events := e.scaled()
+		be.Equal(t, 2, len(events))
+		be.Equal(t, models.WorkloadScaledEventDirectionOut, events[1].Direction)
+		be.Equal(t, 1, events[1].From)
+		be.Equal(t, 3, events[1].To)
+		be.DeepEqual(t, []string{"job2", "job3"}, events[1].Started)
+
+		stream, err := js.Stream(ctx, "ORDERS")
+		be.NilErr(t, err)
+		be.NilErr(t, stream.Purge(ctx))
+
+		// scaling in waits for the cooldown since the last scaling
+		now = base.Add(2 * time.Minute)
+		status = evaluated(t, a, "worker")
+		be.Equal(t, 3, status.Instances)
+		be.Equal(t, 1, status.Desired)
+
+		now = base.Add(6 * time.Minute)
+		status = evaluated(t, a, "worker")
+		be.Equal(t, 1, status.Instances)
+		events = e.scaled()
+		be.Equal(t, 3, len(events))
+		be.Equal(t, models.WorkloadScaledEventDirectionIn, events[2].Direction)
+		be.DeepEqual(t, []string{"job2", "job3"}, events[2].Stopped)
+
+		statuses, err := scheduling.ListAutoscalingStatus(ctx, a.kv, "default")
+		be.NilErr(t, err)
+		be.Equal(t, 1, len(statuses))
+	})
+
+	t.Run("workload metric", func(t *testing.T) {
+		nc := connect(t, server)
+		now := base
+		l := new(scalingLauncher)
+		e := new(testEmitter)
+		a := newTestAutoscaler(t, ctx, nc, "metric", &now, l, e)
+		policy := testPolicy("queue")
+		policy.Metric = &models.AutoscalingPolicyMetric{Name: "queued"}
+		putPolicy(t, a, policy)
+
+		// the minimum starts before any instance reports the metric
+		status := evaluated(t, a, "queue")
+		be.In(t, "no instance reported", status.Error)
+		be.Equal(t, 1, status.Instances)
+		be.Equal(t, 1, len(e.scaled()))
+
+		now = base.Add(time.Minute)
+		// only the instances of the policy count
+		be.NilErr(t, nc.Publish(models.MetricsAPIPrefix("default")+".stranger", []byte(`{"queued":1000}`)))
+		be.NilErr(t, nc.Publish(models.MetricsAPIPrefix("default")+".job1", []byte(`{"queued":12,"label":"a"}`)))
+		be.NilErr(t, nc.Flush())
+		waitFor(t, func() bool {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			_, ok := a.metrics["default.job1"]
+			return ok
+		})
+		a.mu.Lock()
+		_, ok := a.metrics["default.stranger"]
+		a.mu.Unlock()
+		be.False(t, ok)
+
+		status = evaluated(t, a, "queue")
+		be.Equal(t, "", status.Error)
+		be.Equal(t, float64(12), status.MetricValue)
+		be.Equal(t, 2, status.Instances)
+
+		// the metric ages out and the instances are kept
+		now = base.Add(3 * time.Minute)
+		status = evaluated(t, a, "queue")
+		be.In(t, "no instance reported", status.Error)
+		be.Equal(t, 2, status.Instances)
+		be.Equal(t, 2, len(e.scaled()))
+	})
+
+	t.Run("stopped instance", func(t *testing.T) {
+		nc := connect(t, server)
+		now := base
+		l := new(scalingLauncher)
+		a := newTestAutoscaler(t, ctx, nc, "stopped", &now, l, nil)
+		policy := testPolicy("queue")
+		policy.Metric = &models.AutoscalingPolicyMetric{Name: "queued"}
+		putPolicy(t, a, policy)
+		evaluated(t, a, "queue")
+
+		be.NilErr(t, nc.Publish(models.MetricsAPIPrefix("default")+".job1", []byte(`{"queued":5}`)))
+		be.NilErr(t, nc.Flush())
+		waitFor(t, func() bool {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			_, ok := a.metrics["default.job1"]
+			return ok
+		})
+
+		// the sample of an instance that is gone is dropped at the next
+		// evaluation, which starts a replacement
+		be.NilErr(t, l.StopJob(ctx, "default", "job1"))
+		status := evaluated(t, a, "queue")
+		be.Equal(t, 1, status.Instances)
+		a.mu.Lock()
+		_, ok := a.metrics["default.job1"]
+		a.mu.Unlock()
+		be.False(t, ok)
+	})
+
+	t.Run("authorization", func(t *testing.T) {
+		nc := connect(t, server)
+		now := base
+		l := new(scalingLauncher)
+
+		devKp, err := nkeys.CreateUser()
+		be.NilErr(t, err)
+		devPub, err := devKp.PublicKey()
+		be.NilErr(t, err)
+		policy, err := cauthorizer.NewPolicyAuthorizer(&cauthorizer.ControlPolicy{
+			Users: []cauthorizer.ControlPolicyUser{{Nkey: devPub, Namespaces: []string{"default"}, Actions: []models.ControlAction{models.ControlActionDeploy}}},
+		})
+		be.NilErr(t, err)
+		a := newTestAutoscaler(t, ctx, nc, "authorization", &now, l, nil)
+		a.authorizer = policy
+
+		// a policy stored by someone who may write to the bucket but did not
+		// sign it as an authorized caller
+		forged := testPolicy("forged")
+		forged.Consumer = &models.AutoscalingPolicyConsumer{Stream: "ORDERS", Consumer: "workers"}
+		forged.Caller = devPub
+		forged.Signature = base64.RawURLEncoding.EncodeToString([]byte("forged"))
+		putPolicy(t, a, forged)
+		status := evaluated(t, a, "forged")
+		be.In(t, "not authorized", status.Error)
+		deployed, _ := l.counts()
+		be.Equal(t, 0, deployed)
+
+		signed := testPolicy("signed")
+		signed.Consumer = &models.AutoscalingPolicyConsumer{Stream: "ORDERS", Consumer: "workers"}
+		signed.Caller = devPub
+		input, err := signed.SigningInput()
+		be.NilErr(t, err)
+		sig, err := devKp.Sign(input)
+		be.NilErr(t, err)
+		signed.Signature = base64.RawURLEncoding.EncodeToString(sig)
+		putPolicy(t, a, signed)
+		status = evaluated(t, a, "signed")
+		be.Equal(t, 1, status.Instances)
+		deployed, _ = l.counts()
+		be.Equal(t, 1, deployed)
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		nc := connect(t, server)
+		now := base
+		l := new(scalingLauncher)
+		a := newTestAutoscaler(t, ctx, nc, "removed", &now, l, nil)
+		policy := testPolicy("gone")
+		policy.Metric = &models.AutoscalingPolicyMetric{Name: "queued"}
+		putPolicy(t, a, policy)
+		a.tick()
+		waitFor(t, func() bool {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			return len(a.metricSubs) == 1
+		})
+
+		be.NilErr(t, a.kv.Purge(ctx, models.AutoscalingPolicyKey("default", "gone")))
+		a.tick()
+		a.mu.Lock()
+		be.Equal(t, 0, len(a.metricSubs))
+		a.mu.Unlock()
+	})
+}
@@ -0,0 +1,511 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+	"github.com/synadia-io/nex/models"
+	"github.com/synadia-io/nex/scheduling"
+)
+
+const (
+	schedulerQueueGroup = "nex-scheduler"
+	leaderKey           = "leader"
+
+	// DefaultInterval is how often the leader checks for due runs
+	DefaultInterval = time.Second
+	// DefaultLeaseTTL is how long a leader keeps the lease without renewing it
+	DefaultLeaseTTL = 15 * time.Second
+	// DefaultRunStartGrace is how long a run may go without its workload being
+	// listed before a run due under the forbid policy finishes it as lost
+	DefaultRunStartGrace = time.Minute
+
+	maxRunUpdateTries = 10
+)
+
+// lease is held by the node that runs the schedules, or activates the lazy
+// functions, of the nexus
+type lease struct {
+	NodeID  string    `json:"node_id"`
+	Expires time.Time `json:"expires"`
+}
+
+// Scheduler starts the runs of the job schedules stored in a KV bucket. Every
+// node running a scheduler competes for a lease in the bucket; only the
+// holder starts runs. Each run is authorized as the caller that signed the
+// schedule, auctioned as a fresh job through the launcher and recorded in the
+// bucket until its WorkloadStoppedEvent arrives
+type Scheduler struct {
+	ctx        context.Context
+	kv         jetstream.KeyValue
+	launcher   models.WorkloadScaler
+	authorizer models.ControlAuthorizer
+	logger     *slog.Logger
+	nodeID     string
+	sub        *nats.Subscription
+
+	interval   time.Duration
+	leaseTTL   time.Duration
+	startGrace time.Duration
+	now        func() time.Time
+}
+
+// NewScheduler creates the schedule bucket if it does not exist and records
+// the outcome of runs until ctx is done. Agents must emit events over NATS for
+// runs to finish
+func NewScheduler(ctx context.Context, nc *nats.Conn, bucket, nodeID string, launcher models.WorkloadScaler, authorizer models.ControlAuthorizer, logger *slog.Logger) (*Scheduler, error) {
+	if launcher == nil {
+		return nil, errors.New("job launcher is nil")
+	}
+	if authorizer == nil {
+		return nil, errors.New("control authorizer is nil")
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      bucket,
+		Description: "Nex job schedules and runs",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schedule bucket: %w", err)
+	}
+
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	s := &Scheduler{
+		ctx:        ctx,
+		kv:         kv,
+		launcher:   launcher,
+		authorizer: authorizer,
+		logger:     logger,
+		nodeID:     nodeID,
+		interval:   DefaultInterval,
+		leaseTTL:   DefaultLeaseTTL,
+		startGrace: DefaultRunStartGrace,
+		now:        time.Now,
+	}
+
+	s.sub, err = nc.QueueSubscribe(models.EventAPIPrefix("*")+"."+models.WorkloadStoppedEvent{}.String(), schedulerQueueGroup, s.handleWorkloadStopped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to workload stopped events: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = s.sub.Unsubscribe()
+	}()
+
+	return s, nil
+}
+
+// Run checks for due runs every interval until the context is done
+func (s *Scheduler) Run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.tick()
+		}
+	}
+}
+
+func (s *Scheduler) tick() {
+	if !s.lead() {
+		return
+	}
+
+	lister, err := s.kv.ListKeysFiltered(s.ctx, models.ScheduleKey("*", "*"))
+	if err != nil {
+		s.logger.Error("failed to list job schedules", slog.String("err", err.Error()))
+		return
+	}
+	for key := range lister.Keys() {
+		s.startDue(key)
+	}
+}
+
+// lead acquires or renews the scheduler lease and reports whether this node
+// holds it
+func (s *Scheduler) lead() bool {
+	return acquireLease(s.ctx, s.kv, s.nodeID, s.now(), s.leaseTTL, s.logger, "job scheduler")
+}
+
+// acquireLease acquires or renews the lease stored in the bucket and reports
+// whether the node holds it. The lease is renewed once half of it has passed
+func acquireLease(ctx context.Context, kv jetstream.KeyValue, nodeID string, now time.Time, ttl time.Duration, logger *slog.Logger, holder string) bool {
+	leaseB, err := json.Marshal(lease{NodeID: nodeID, Expires: now.Add(ttl)})
+	if err != nil {
+		return false
+	}
+
+	entry, err := kv.Get(ctx, leaderKey)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		_, err = kv.Create(ctx, leaderKey, leaseB)
+		return err == nil
+	}
+	if err != nil {
+		logger.Error("failed to read "+holder+" lease", slog.String("err", err.Error()))
+		return false
+	}
+
+	current := new(lease)
+	if json.Unmarshal(entry.Value(), current) == nil {
+		if current.NodeID != nodeID && now.Before(current.Expires) {
+			return false
+		}
+		if current.NodeID == nodeID && current.Expires.Sub(now) > ttl/2 {
+			return true
+		}
+	}
+
+	_, err = kv.Update(ctx, leaderKey, leaseB, entry.Revision())
+	if err == nil && current.NodeID != nodeID {
+		logger.Info("acquired " + holder + " lease")
+	}
+	return err == nil
+}
+
+// authorizeDefinition authorizes the caller that signed a stored definition to
+// deploy its workloads in the namespace. Definitions are refused when the
+// control authorizer cannot authorize them
+func authorizeDefinition(authorizer models.ControlAuthorizer, caller, signature string, input []byte, namespace string) error {
+	da, ok := authorizer.(models.DefinitionAuthorizer)
+	if !ok {
+		return errors.New("control authorizer does not authorize stored definitions")
+	}
+	return da.AuthorizeDefinition(caller, signature, input, namespace, models.ControlActionDeploy)
+}
+
+// startDue starts a run of the schedule if a tick passed since its last run.
+// Ticks missed while no node held the lease are skipped; only the latest one
+// is run
+func (s *Scheduler) startDue(key string) {
+	entry, err := s.kv.Get(s.ctx, key)
+	if err != nil {
+		return
+	}
+
+	sched := new(models.JobSchedule)
+	err = json.Unmarshal(entry.Value(), sched)
+	if err != nil {
+		s.logger.Warn("failed to read job schedule", slog.String("err", err.Error()), slog.String("key", key))
+		return
+	}
+
+	cron, loc, err := scheduling.ParseSchedule(sched)
+	if err != nil {
+		s.logger.Warn("invalid job schedule", slog.String("err", err.Error()), slog.String("key", key))
+		return
+	}
+
+	tickKey := models.ScheduleTickKey(sched.Namespace, sched.Name)
+	last := sched.Created
+	var rev uint64
+	tickEntry, err := s.kv.Get(s.ctx, tickKey)
+	switch {
+	case errors.Is(err, jetstream.ErrKeyNotFound):
+	case err != nil:
+		s.logger.Error("failed to read last job schedule tick", slog.String("err", err.Error()), slog.String("key", tickKey))
+		return
+	default:
+		rev = tickEntry.Revision()
+		if t, err := time.Parse(time.RFC3339, string(tickEntry.Value())); err == nil && t.After(last) {
+			last = t
+		}
+	}
+
+	now := s.now()
+	var due time.Time
+	for next := cron.Next(last.In(loc)); !next.IsZero() && !next.After(now); next = cron.Next(next) {
+		due = next
+	}
+	if due.IsZero() {
+		return
+	}
+
+	// the tick is claimed with a compare and set so a run is started once, even
+	// if two nodes briefly believe they hold the lease
+	dueB := []byte(due.UTC().Format(time.RFC3339))
+	if rev == 0 {
+		_, err = s.kv.Create(s.ctx, tickKey, dueB)
+	} else {
+		_, err = s.kv.Update(s.ctx, tickKey, dueB, rev)
+	}
+	if err != nil {
+		s.logger.Debug("job schedule tick already claimed", slog.String("key", tickKey), slog.String("err", err.Error()))
+		return
+	}
+
+	go s.startRun(sched, due)
+}
+
+// startRun authorizes the schedule, applies its concurrency policy and starts
+// a run
+func (s *Scheduler) startRun(sched *models.JobSchedule, scheduled time.Time) {
+	logger := s.logger.With(slog.String("namespace", sched.Namespace), slog.String("schedule", sched.Name))
+	defer s.pruneRuns(sched)
+
+	run := &models.JobRun{
+		Namespace:     sched.Namespace,
+		Schedule:      sched.Name,
+		ScheduledTime: scheduled.UTC(),
+		StartTime:     s.now().UTC(),
+	}
+
+	input, err := sched.SigningInput()
+	if err == nil {
+		err = authorizeDefinition(s.authorizer, sched.Caller, sched.Signature, input, sched.Namespace)
+	}
+	if err != nil {
+		logger.Warn("job schedule not authorized", slog.String("err", err.Error()), slog.String("caller", sched.Caller))
+		run.Id = nuid.Next()
+		run.State = models.JobRunStateFailed
+		run.Error = fmt.Sprintf("schedule not authorized: %s", err)
+		run.EndTime = &run.StartTime
+		s.putRun(run)
+		return
+	}
+
+	runs, err := s.Runs(sched.Namespace, sched.Name)
+	if err != nil {
+		logger.Error("failed to list job runs", slog.String("err", err.Error()))
+		return
+	}
+	running := slices.DeleteFunc(runs, func(r *models.JobRun) bool {
+		return r.State != models.JobRunStateRunning
+	})
+
+	switch sched.ConcurrencyPolicy {
+	case models.JobScheduleConcurrencyPolicyForbid:
+		running = s.reconcileRuns(sched, running)
+		if len(running) > 0 {
+			logger.Info("skipping job run; an earlier run is still running", slog.String("run_id", running[0].Id))
+			run.Id = nuid.Next()
+			run.State = models.JobRunStateSkipped
+			run.Error = fmt.Sprintf("run %s is still running", running[0].Id)
+			run.EndTime = &run.StartTime
+			s.putRun(run)
+			return
+		}
+	case models.JobScheduleConcurrencyPolicyReplace:
+		for _, r := range running {
+			s.finishRun(sched.Namespace, sched.Name, r.Id, func(r *models.JobRun) {
+				r.State = models.JobRunStateReplaced
+			})
+			err := s.launcher.StopJob(s.ctx, sched.Namespace, r.Id)
+			if err != nil {
+				logger.Warn("failed to stop replaced job run", slog.String("err", err.Error()), slog.String("run_id", r.Id))
+			}
+		}
+	}
+
+	req := sched.Workload
+	req.Namespace = sched.Namespace
+	req.WorkloadLifecycle = models.WorkloadLifecycleJob
+
+	resp, err := s.launcher.DeployJob(s.ctx, &req, sched.Constraints)
+	if err != nil {
+		logger.Error("failed to start job run", slog.String("err", err.Error()))
+		run.Id = nuid.Next()
+		run.State = models.JobRunStateFailed
+		run.Error = err.Error()
+		run.EndTime = &run.StartTime
+		s.putRun(run)
+		return
+	}
+
+	run.Id = resp.Id
+	run.State = models.JobRunStateRunning
+	s.putRun(run)
+	logger.Info("started job run", slog.String("run_id", run.Id))
+
+	if resp.OperationId == "" {
+		return
+	}
+
+	status, err := s.launcher.WaitForOperation(s.ctx, sched.Namespace, resp.OperationId)
+	s.finishRun(sched.Namespace, sched.Name, run.Id, func(r *models.JobRun) {
+		if status != nil {
+			r.NodeId = status.NodeId
+		}
+		if err != nil {
+			r.State = models.JobRunStateFailed
+			r.Error = err.Error()
+		}
+	})
+}
+
+// reconcileRuns finishes the running runs whose workload is no longer listed,
+// so a run whose WorkloadStoppedEvent was missed does not block the schedule
+// forever. Runs started within the start grace may not be listed yet and are
+// kept. It returns the runs still running
+func (s *Scheduler) reconcileRuns(sched *models.JobSchedule, running []*models.JobRun) []*models.JobRun {
+	if len(running) == 0 {
+		return running
+	}
+
+	ids, err := s.launcher.ListInstances(s.ctx, sched.Namespace, sched.Workload.Name)
+	if err != nil {
+		s.logger.Warn("failed to list job run workloads", slog.String("err", err.Error()), slog.String("namespace", sched.Namespace), slog.String("schedule", sched.Name))
+		return running
+	}
+
+	cutoff := s.now().Add(-s.startGrace)
+	return slices.DeleteFunc(running, func(r *models.JobRun) bool {
+		if slices.Contains(ids, r.Id) || r.StartTime.After(cutoff) {
+			return false
+		}
+		s.finishRun(sched.Namespace, sched.Name, r.Id, func(r *models.JobRun) {
+			r.State = models.JobRunStateFailed
+			r.Error = "workload is no longer running"
+		})
+		return true
+	})
+}
+
+// Runs returns the recorded runs of a schedule, oldest first
+func (s *Scheduler) Runs(namespace, name string) ([]*models.JobRun, error) {
+	return scheduling.ListRuns(s.ctx, s.kv, namespace, name)
+}
+
+func (s *Scheduler) putRun(run *models.JobRun) {
+	runB, err := json.Marshal(run)
+	if err != nil {
+		return
+	}
+	_, err = s.kv.Put(s.ctx, models.JobRunKey(run.Namespace, run.Schedule, run.Id), runB)
+	if err != nil {
+		s.logger.Error("failed to record job run", slog.String("err", err.Error()), slog.String("run_id", run.Id))
+	}
+}
+
+// finishRun updates a running run; runs that already finished are left alone.
+// The end time is set when the update moves the run to a final state
+func (s *Scheduler) finishRun(namespace, name, runID string, update func(*models.JobRun)) {
+	key := models.JobRunKey(namespace, name, runID)
+	for range maxRunUpdateTries {
+		entry, err := s.kv.Get(s.ctx, key)
+		if err != nil {
+			return
+		}
+
+		run := new(models.JobRun)
+		if json.Unmarshal(entry.Value(), run) != nil || run.State != models.JobRunStateRunning {
+			return
+		}
+
+		update(run)
+		if run.State != models.JobRunStateRunning && run.EndTime == nil {
+			end := s.now().UTC()
+			run.EndTime = &end
+		}
+
+		runB, err := json.Marshal(run)
+		if err != nil {
+			return
+		}
+		_, err = s.kv.Update(s.ctx, key, runB, entry.Revision())
+		if err == nil {
+			return
+		}
+	}
+	s.logger.Warn("failed to update job run", slog.String("key", key))
+}
+
+// pruneRuns removes the oldest finished runs beyond the history limit
+func (s *Scheduler) pruneRuns(sched *models.JobSchedule) {
+	limit := sched.HistoryLimit
+	if limit <= 0 {
+		limit = models.DefaultJobHistoryLimit
+	}
+
+	runs, err := s.Runs(sched.Namespace, sched.Name)
+	if err != nil {
+		return
+	}
+	finished := slices.DeleteFunc(runs, func(r *models.JobRun) bool {
+		return r.State == models.JobRunStateRunning
+	})
+
+	for i := 0; i < len(finished)-limit; i++ {
+		err := s.kv.Purge(s.ctx, models.JobRunKey(sched.Namespace, sched.Name, finished[i].Id))
+		if err != nil {
+			s.logger.Warn("failed to remove job run", slog.String("err", err.Error()), slog.String("run_id", finished[i].Id))
+		}
+	}
+}
+
+func (s *Scheduler) handleWorkloadStopped(m *nats.Msg) {
+	event := new(models.WorkloadStoppedEvent)
+	err := json.Unmarshal(m.Data, event)
+	if err != nil {
+		return
+	}
+
+	go s.workloadStopped(event)
+}
+
+// workloadStopped finishes the run started as the stopped workload. A job may
+// stop before its run is recorded, so the run is looked up a few times
+func (s *Scheduler) workloadStopped(event *models.WorkloadStoppedEvent) {
+	for range 3 {
+		lister, err := s.kv.ListKeysFiltered(s.ctx, models.JobRunKey(event.Namespace, "*", event.Id))
+		if err != nil {
+			return
+		}
+
+		found := false
+		for key := range lister.Keys() {
+			found = true
+			run := new(models.JobRun)
+			entry, err := s.kv.Get(s.ctx, key)
+			if err != nil || json.Unmarshal(entry.Value(), run) != nil {
+				continue
+			}
+
+			s.finishRun(run.Namespace, run.Schedule, run.Id, func(r *models.JobRun) {
+				if event.Error == nil {
+					exitCode := 0
+					r.State = models.JobRunStateSucceeded
+					r.ExitCode = &exitCode
+					return
+				}
+
+				r.State = models.JobRunStateFailed
+				r.Error = event.Error.Message
+				if exitCode, err := strconv.Atoi(event.Error.Code); err == nil {
+					r.ExitCode = &exitCode
+				}
+			})
+		}
+		if found {
+			return
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/carlmjohnson/be"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/nex/internal/cauthorizer"
+	"github.com/synadia-io/nex/models"
+)
+
+func startNatsServer(t testing.TB, workDir string) *server.Server {
+	t.Helper()
+
+	server := server.New(&server.Options{
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  workDir,
+	})
+
+	server.Start()
+
+	return server
+}
+
+type testLauncher struct {
+	sync.Mutex
+	deployed []string
+	stopped  []string
+}
+
+func (l *testLauncher) DeployJob(_ context.Context, req *models.StartWorkloadRequest, _ []string) (*models.StartWorkloadResponse, error) {
+	l.Lock()
+	defer l.Unlock()
+	id := fmt.Sprintf("job%d", len(l.deployed)+1)
+	l.deployed = append(l.deployed, id)
+	return &models.StartWorkloadResponse{Id: id, Name: req.Name, OperationId: "op-" + id}, nil
+}
+
+func (l *testLauncher) WaitForOperation(_ context.Context, _, _ string) (*models.OperationStatus, error) {
+	return &models.OperationStatus{NodeId: "node1"}, nil
+}
+
+func (l *testLauncher) StopJob(_ context.Context, _, workloadID string) error {
+	l.Lock()
+	defer l.Unlock()
+	l.stopped = append(l.stopped, workloadID)
+	return nil
+}
+
+func (l *testLauncher) counts() (int, int) {
+	l.Lock()
+	defer l.Unlock()
+	return len(l.deployed), len(l.stopped)
+}
+
+func waitFor(t testing.TB, cond func() bool) {
+	t.Helper()
+	for range 100 {
+		if cond() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("condition not met")
+}
+
+func runStates(t testing.TB, s *Scheduler, name string) []models.JobRunState {
+	t.Helper()
+	runs, err := s.Runs("default", name)
+	be.NilErr(t, err)
+	states := []models.JobRunState{}
+	for _, r := range runs {
+		states = append(states, r.State)
+	}
+	return states
+}
+
+func putSchedule(t testing.TB, s *Scheduler, sched *models.JobSchedule) {
+	t.Helper()
+	schedB, err := json.Marshal(sched)
+	be.NilErr(t, err)
+	_, err = s.kv.Put(context.TODO(), models.ScheduleKey(sched.Namespace, sched.Name), schedB)
+	be.NilErr(t, err)
+}
+
+func testWorkload() models.StartWorkloadRequest {
+	return models.StartWorkloadRequest{
+		Name:              "report",
+		Namespace:         "default",
+		RunRequest:        "{}",
+		Tags:              models.NodeTags{},
+		WorkloadLifecycle: models.WorkloadLifecycleJob,
+		WorkloadType:      "native",
+	}
+}
+
+// connect returns a connection closed with the test, so the schedulers of a
+// test do not receive the events of the next one
+func connect(t testing.TB, server *server.Server) *nats.Conn {
+	t.Helper()
+	nc, err := nats.Connect(server.ClientURL())
+	be.NilErr(t, err)
+	t.Cleanup(nc.Close)
+	return nc
+}
+
+func newTestScheduler(t testing.TB, ctx context.Context, nc *nats.Conn, bucket, nodeID string, now *time.Time, l models.WorkloadScaler) *Scheduler {
+	t.Helper()
+	s, err := NewScheduler(ctx, nc, bucket, nodeID, l, &cauthorizer.AllowAllAuthorizer{}, nil)
+	be.NilErr(t, err)
+	var mu sync.Mutex
+	s.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return *now
+	}
+	return s
+}
+
+func TestScheduler(t *testing.T) {
+	server := startNatsServer(t, t.TempDir())
+	defer server.Shutdown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("forbid", func(t *testing.T) {
+		nc := connect(t, server)
+		now := base
+		l := new(scalingLauncher)
+		s := newTestScheduler(t, ctx, nc, "forbid", "n1", &now, l)
+
+		putSchedule(t, s, &models.JobSchedule{
+			Name:              "forbid",
+			Namespace:         "default",
+			Cron:              "*/5 * * * *",
+			Created:           base,
+			Workload:          testWorkload(),
+			ConcurrencyPolicy: models.JobScheduleConcurrencyPolicyForbid,
+			HistoryLimit:      1,
+		})
+
+		now = base.Add(4 * time.Minute)
+		s.tick()
+		time.Sleep(50 * time.Millisecond)
+		deployed, _ := l.counts()
+		be.Equal(t, 0, deployed)
+
+		now = base.Add(5 * time.Minute)
+		s.tick()
+		s.tick()
+		waitFor(t, func() bool {
+			runs, _ := s.Runs("default", "forbid")
+			return len(runs) == 1 && runs[0].NodeId == "node1"
+		})
+		deployed, _ = l.counts()
+		be.Equal(t, 1, deployed)
+
+		now = base.Add(10 * time.Minute)
+		s.tick()
+		waitFor(t, func() bool { return len(runStates(t, s, "forbid")) == 2 })
+		be.AllEqual(t, []models.JobRunState{models.JobRunStateRunning, models.JobRunStateSkipped}, runStates(t, s, "forbid"))
+
+		ev, err := json.Marshal(models.WorkloadStoppedEvent{
+			Id:        "job1",
+			Namespace: "default",
+			Error:     &models.WorkloadStoppedEventError{Code: "3", Message: "exit status 3"},
+		})
+		be.NilErr(t, err)
+		be.NilErr(t, nc.Publish(models.EventAPIPrefix("default")+"."+models.WorkloadStoppedEvent{}.String(), ev))
+
+		waitFor(t, func() bool {
+			runs, _ := s.Runs("default", "forbid")
+			return runs[0].State == models.JobRunStateFailed
+		})
+		runs, err := s.Runs("default", "forbid")
+		be.NilErr(t, err)
+		be.Equal(t, 3, *runs[0].ExitCode)
+		be.Nonzero(t, runs[0].EndTime)
+
+		// missed ticks are skipped; only the latest one is run and the
+		// oldest finished runs are pruned
+		now = base.Add(31 * time.Minute)
+		s.tick()
+		waitFor(t, func() bool {
+			deployed, _ := l.counts()
+			return deployed == 2 && len(runStates(t, s, "forbid")) == 2
+		})
+		runs, err = s.Runs("default", "forbid")
+		be.NilErr(t, err)
+		be.Equal(t, models.JobRunStateSkipped, runs[0].State)
+		be.Equal(t, "job2", runs[1].Id)
+		be.True(t, base.Add(30*time.Minute).Equal(runs[1].ScheduledTime))
+	})
+
+	t.Run("forbid lost run", func(t *testing.T) {
+		nc := connect(t, server)
+		now := base
+		l := new(scalingLauncher)
+		s := newTestScheduler(t, ctx, nc, "lost", "n1", &now, l)
+
+		putSchedule(t, s, &models.JobSchedule{
+			Name:              "lost",
+			Namespace:         "default",
+			Cron:              "@hourly",
+			Created:           base,
+			Workload:          testWorkload(),
+			ConcurrencyPolicy: models.JobScheduleConcurrencyPolicyForbid,
+		})
+
+		now = base.Add(time.Hour)
+		s.tick()
+		waitFor(t, func() bool { return len(runStates(t, s, "lost")) == 1 })
+
+		// the workload went away without its WorkloadStoppedEvent arriving
+		l.Lock()
+		l.stopped = append(l.stopped, "job1")
+		l.Unlock()
+
+		now = base.Add(2 * time.Hour)
+		s.tick()
+		waitFor(t, func() bool { return len(runStates(t, s, "lost")) == 2 })
+		be.AllEqual(t, []models.JobRunState{models.JobRunStateFailed, models.JobRunStateRunning}, runStates(t, s, "lost"))
+		runs, err := s.Runs("default", "lost")
+		be.NilErr(t, err)
+		be.Equal(t, "workload is no longer running", runs[0].Error)
+		be.Equal(t, "job2", runs[1].Id)
+	})
+
+	t.Run("authorization", func(t *testing.T) {
+		nc := connect(t, server)
+		now := base
+		l := new(scalingLauncher)
+
+		devKp, err := nkeys.CreateUser()
+		be.NilErr(t, err)
+		devPub, err := devKp.PublicKey()
+		be.NilErr(t, err)
+		policy, err := cauthorizer.NewPolicyAuthorizer(&cauthorizer.ControlPolicy{
+			Users: []cauthorizer.ControlPolicyUser{{Nkey: devPub, Namespaces: []string{"default"}, Actions: []models.ControlAction{models.ControlActionDeploy}}},
+		})
+		be.NilErr(t, err)
+		s := newTestScheduler(t, ctx, nc, "authorization", "n1", &now, l)
+		s.authorizer = policy
+
+		signed := &models.JobSchedule{
+			Name:      "signed",
+			Namespace: "default",
+			Cron:      "@hourly",
+			Created:   base,
+			Workload:  testWorkload(),
+			Caller:    devPub,
+		}
+		input, err := signed.SigningInput()
+		be.NilErr(t, err)
+		sig, err := devKp.Sign(input)
+		be.NilErr(t, err)
+		signed.Signature = base64.RawURLEncoding.EncodeToString(sig)
+		putSchedule(t, s, signed)
+
+		// a schedule stored by someone who may write to the bucket but did
+		// not sign it as an authorized caller
+		forged := *signed
+		forged.Name = "forged"
+		forged.Workload.RunRequest = `{"argv":["--evil"]}`
+		putSchedule(t, s, &forged)
+
+		now = base.Add(time.Hour)
+		s.tick()
+		waitFor(t, func() bool {
+			return len(runStates(t, s, "signed")) == 1 && len(runStates(t, s, "forged")) == 1
+		})
+		be.AllEqual(t, []models.JobRunState{models.JobRunStateRunning}, runStates(t, s, "signed"))
+		be.AllEqual(t, []models.JobRunState{models.JobRunStateFailed}, runStates(t, s, "forged"))
+		deployed, _ := l.counts()
+		be.Equal(t, 1, deployed)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		nc := connect(t, server)
+		now := base
+		l := new(scalingLauncher)
+		s := newTestScheduler(t, ctx, nc, "replace", "n1", &now, l)
+
+		putSchedule(t, s, &models.JobSchedule{
+			Name:              "replace",
+			Namespace:         "default",
+			Cron:              "@hourly",
+			Created:           base,
+			Workload:          testWorkload(),
+			ConcurrencyPolicy: models.JobScheduleConcurrencyPolicyReplace,
+		})
+
+		now = base.Add(time.Hour)
+		s.tick()
+		waitFor(t, func() bool { return len(runStates(t, s, "replace")) == 1 })
+
+		now = base.Add(2 * time.Hour)
+		s.tick()
+		waitFor(t, func() bool {
+			deployed, stopped := l.counts()
+			return deployed == 2 && stopped == 1
+		})
+		waitFor(t, func() bool { return len(runStates(t, s, "replace")) == 2 })
+		be.AllEqual(t, []models.JobRunState{models.JobRunStateReplaced, models.JobRunStateRunning}, runStates(t, s, "replace"))
+	})
+
+	t.Run("allow", func(t *testing.T) {
+		nc := connect(t, server)
+		now := base
+		l := new(scalingLauncher)
+		s := newTestScheduler(t, ctx, nc, "allow", "n1", &now, l)
+
+		putSchedule(t, s, &models.JobSchedule{
+			Name:      "allow",
+			Namespace: "default",
+			Cron:      "0 * * * *",
+			Timezone:  "America/New_York",
+			Created:   base,
+			Workload:  testWorkload(),
+		})
+
+		now = base.Add(time.Hour)
+		s.tick()
+		waitFor(t, func() bool { return len(runStates(t, s, "allow")) == 1 })
+		now = base.Add(2 * time.Hour)
+		s.tick()
+		waitFor(t, func() bool { return len(runStates(t, s, "allow")) == 2 })
+		be.AllEqual(t, []models.JobRunState{models.JobRunStateRunning, models.JobRunStateRunning}, runStates(t, s, "allow"))
+
+		ev, err := json.Marshal(models.WorkloadStoppedEvent{Id: "job2", Namespace: "default"})
+		be.NilErr(t, err)
+		be.NilErr(t, nc.Publish(models.EventAPIPrefix("default")+"."+models.WorkloadStoppedEvent{}.String(), ev))
+		waitFor(t, func() bool { return runStates(t, s, "allow")[1] == models.JobRunStateSucceeded })
+		runs, err := s.Runs("default", "allow")
+		be.NilErr(t, err)
+		be.Equal(t, 0, *runs[1].ExitCode)
+	})
+
+	t.Run("lease", func(t *testing.T) {
+		nc := connect(t, server)
+		now := base
+		l := new(scalingLauncher)
+		s := newTestScheduler(t, ctx, nc, "lease", "n1", &now, l)
+		other := newTestScheduler(t, ctx, nc, "lease", "n2", &now, l)
+
+		be.True(t, s.lead())
+		be.False(t, other.lead())
+
+		now = base.Add(DefaultLeaseTTL / 4)
+		be.True(t, s.lead())
+		be.False(t, other.lead())
+
+		// the lease moves once it expired without being renewed
+		now = base.Add(2 * DefaultLeaseTTL)
+		be.True(t, other.lead())
+		be.False(t, s.lead())
+	})
+}
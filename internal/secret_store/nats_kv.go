@@ -0,0 +1,317 @@
+package secretstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/nex/models"
+)
+
+var (
+	_ models.SecretManager = (*natsKVSecretStore)(nil)
+	_ models.SecretWatcher = (*natsKVSecretStore)(nil)
+)
+
+const (
+	secretKeyPrefix = "secrets"
+	xkeyKeyPrefix   = "xkeys"
+)
+
+var (
+	validNamespace = regexp.MustCompile(`^[-/_=a-zA-Z0-9]+$`)
+	validSecretID  = regexp.MustCompile(`^[-/_=a-zA-Z0-9]+(\.[-/_=a-zA-Z0-9]+)*$`)
+)
+
+// natsKVSecretStore stores secrets in a JetStream KV bucket. Each namespace is
+// assigned its own xkey that encrypts the values of that namespace. The namespace
+// xkeys are stored in the same bucket, encrypted with the xkey held by the node.
+// Nodes sharing a bucket must be configured with the same xkey
+type natsKVSecretStore struct {
+	sync.Mutex
+
+	ctx    context.Context
+	logger *slog.Logger
+	kv     jetstream.KeyValue
+
+	xkp           nkeys.KeyPair
+	xkpPub        string
+	namespaceKeys map[string]nkeys.KeyPair
+}
+
+func NewNatsKVSecretStore(nc *nats.Conn, bucketName string, xkp nkeys.KeyPair, logger *slog.Logger) (*natsKVSecretStore, error) {
+	if xkp == nil {
+		return nil, errors.New("secret store requires an xkey")
+	}
+
+	xkpPub, err := xkp.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if !nkeys.IsValidPublicCurveKey(xkpPub) {
+		return nil, errors.New("secret store key must be a curve key")
+	}
+
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	ret := &natsKVSecretStore{
+		ctx:           context.Background(),
+		logger:        logger,
+		xkp:           xkp,
+		xkpPub:        xkpPub,
+		namespaceKeys: make(map[string]nkeys.KeyPair),
+	}
+
+	jsCtx, err := jetstream.New(nc)
+	if err != nil {
+		return nil, err
+	}
+
+	ret.kv, err = jsCtx.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{
+		Bucket:       bucketName,
+		Description:  "Nex namespace secrets",
+		MaxBytes:     100_000_000, // 100MB
+		MaxValueSize: 64_000,      // 64KB
+	})
+	if err != nil && !errors.Is(err, jetstream.ErrBucketExists) {
+		return nil, err
+	}
+	if errors.Is(err, jetstream.ErrBucketExists) {
+		ret.kv, err = jsCtx.KeyValue(context.Background(), bucketName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+func (s *natsKVSecretStore) GetSecret(namespace string, secretID string) ([]byte, error) {
+	key, err := secretKey(namespace, secretID)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := s.kv.Get(s.ctx, key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, fmt.Errorf("secret %s not found in namespace %s", secretID, namespace)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nsKey, err := s.namespaceKey(namespace, false)
+	if err != nil {
+		return nil, err
+	}
+
+	nsKeyPub, err := nsKey.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := nsKey.Open(entry.Value(), nsKeyPub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret %s: %w", secretID, err)
+	}
+
+	return value, nil
+}
+
+func (s *natsKVSecretStore) PutSecret(namespace, secretID string, value []byte) (uint64, error) {
+	key, err := secretKey(namespace, secretID)
+	if err != nil {
+		return 0, err
+	}
+
+	nsKey, err := s.namespaceKey(namespace, true)
+	if err != nil {
+		return 0, err
+	}
+
+	nsKeyPub, err := nsKey.PublicKey()
+	if err != nil {
+		return 0, err
+	}
+
+	encValue, err := nsKey.Seal(value, nsKeyPub)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encrypt secret %s: %w", secretID, err)
+	}
+
+	return s.kv.Put(s.ctx, key, encValue)
+}
+
+func (s *natsKVSecretStore) DeleteSecret(namespace, secretID string) error {
+	key, err := secretKey(namespace, secretID)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.kv.Get(s.ctx, key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return fmt.Errorf("secret %s not found in namespace %s", secretID, namespace)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.kv.Purge(s.ctx, key)
+}
+
+func (s *natsKVSecretStore) ListSecrets(namespace string) ([]string, error) {
+	if !validNamespace.MatchString(namespace) {
+		return nil, fmt.Errorf("invalid namespace: %s", namespace)
+	}
+
+	prefix := fmt.Sprintf("%s.%s.", secretKeyPrefix, namespace)
+	kl, err := s.kv.ListKeysFiltered(s.ctx, prefix+">")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []string{}
+	for k := range kl.Keys() {
+		ret = append(ret, strings.TrimPrefix(k, prefix))
+	}
+	return ret, nil
+}
+
+func (s *natsKVSecretStore) WatchSecrets(ctx context.Context) (<-chan models.SecretUpdate, error) {
+	watcher, err := s.kv.Watch(ctx, secretKeyPrefix+".>", jetstream.UpdatesOnly())
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(chan models.SecretUpdate)
+	go func() {
+		defer close(ret)
+		defer func() {
+			_ = watcher.Stop()
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case entry, ok := <-watcher.Updates():
+				if !ok {
+					return
+				}
+				if entry == nil {
+					continue
+				}
+
+				// secrets.<namespace>.<secretID>
+				splitKey := strings.SplitN(entry.Key(), ".", 3)
+				if len(splitKey) != 3 {
+					continue
+				}
+
+				update := models.SecretUpdate{
+					Deleted:   entry.Operation() != jetstream.KeyValuePut,
+					Key:       splitKey[2],
+					Namespace: splitKey[1],
+					Revision:  int(entry.Revision()),
+				}
+
+				select {
+				case ret <- update:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ret, nil
+}
+
+// namespaceKey returns the xkey used to encrypt secrets in the given namespace.
+// If create is true and the namespace has no key yet, one is generated and stored
+func (s *natsKVSecretStore) namespaceKey(namespace string, create bool) (nkeys.KeyPair, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if kp, ok := s.namespaceKeys[namespace]; ok {
+		return kp, nil
+	}
+
+	key := fmt.Sprintf("%s.%s", xkeyKeyPrefix, namespace)
+	entry, err := s.kv.Get(s.ctx, key)
+	switch {
+	case err == nil:
+		kp, err := s.openNamespaceKey(entry.Value())
+		if err != nil {
+			return nil, err
+		}
+		s.namespaceKeys[namespace] = kp
+		return kp, nil
+	case !errors.Is(err, jetstream.ErrKeyNotFound):
+		return nil, err
+	case !create:
+		return nil, fmt.Errorf("no secrets found for namespace %s", namespace)
+	}
+
+	kp, err := nkeys.CreateCurveKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := kp.Seed()
+	if err != nil {
+		return nil, err
+	}
+
+	encSeed, err := s.xkp.Seal(seed, s.xkpPub)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.kv.Create(s.ctx, key, encSeed)
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		// another node created the namespace key first
+		entry, err = s.kv.Get(s.ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		kp, err = s.openNamespaceKey(entry.Value())
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug("created namespace secret key", slog.String("namespace", namespace))
+	s.namespaceKeys[namespace] = kp
+	return kp, nil
+}
+
+func (s *natsKVSecretStore) openNamespaceKey(encSeed []byte) (nkeys.KeyPair, error) {
+	seed, err := s.xkp.Open(encSeed, s.xkpPub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt namespace key; is the secret store xkey correct: %w", err)
+	}
+	return nkeys.FromCurveSeed(seed)
+}
+
+func secretKey(namespace, secretID string) (string, error) {
+	if !validNamespace.MatchString(namespace) {
+		return "", fmt.Errorf("invalid namespace: %s", namespace)
+	}
+	if !validSecretID.MatchString(secretID) {
+		return "", fmt.Errorf("invalid secret key: %s", secretID)
+	}
+	return fmt.Sprintf("%s.%s.%s", secretKeyPrefix, namespace, secretID), nil
+}
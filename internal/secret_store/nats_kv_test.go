@@ -0,0 +1,158 @@
+package secretstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/carlmjohnson/be"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nkeys"
+)
+
+func startNatsServer(t testing.TB, workDir string) *server.Server {
+	t.Helper()
+
+	server := server.New(&server.Options{
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  workDir,
+	})
+
+	server.Start()
+
+	return server
+}
+
+func TestNatsKVSecretStore(t *testing.T) {
+	server := startNatsServer(t, t.TempDir())
+	defer server.Shutdown()
+
+	nc, err := nats.Connect(server.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	xkp, err := nkeys.CreateCurveKeys()
+	be.NilErr(t, err)
+
+	s, err := NewNatsKVSecretStore(nc, "test", xkp, nil)
+	be.NilErr(t, err)
+
+	_, err = s.GetSecret("foo", "dbpass")
+	be.Nonzero(t, err)
+
+	rev, err := s.PutSecret("foo", "dbpass", []byte("supersecret"))
+	be.NilErr(t, err)
+	be.Nonzero(t, rev)
+
+	_, err = s.PutSecret("bar", "dbpass", []byte("othersecret"))
+	be.NilErr(t, err)
+
+	v, err := s.GetSecret("foo", "dbpass")
+	be.NilErr(t, err)
+	be.Equal(t, "supersecret", string(v))
+
+	v, err = s.GetSecret("bar", "dbpass")
+	be.NilErr(t, err)
+	be.Equal(t, "othersecret", string(v))
+
+	// values are never stored in plaintext
+	jsCtx, err := jetstream.New(nc)
+	be.NilErr(t, err)
+	kv, err := jsCtx.KeyValue(context.TODO(), "test")
+	be.NilErr(t, err)
+	entry, err := kv.Get(context.TODO(), "secrets.foo.dbpass")
+	be.NilErr(t, err)
+	be.True(t, string(entry.Value()) != "supersecret")
+
+	keys, err := s.ListSecrets("foo")
+	be.NilErr(t, err)
+	be.AllEqual(t, []string{"dbpass"}, keys)
+
+	be.NilErr(t, s.DeleteSecret("foo", "dbpass"))
+	_, err = s.GetSecret("foo", "dbpass")
+	be.Nonzero(t, err)
+	be.Nonzero(t, s.DeleteSecret("foo", "dbpass"))
+
+	keys, err = s.ListSecrets("foo")
+	be.NilErr(t, err)
+	be.Equal(t, 0, len(keys))
+
+	_, err = s.PutSecret("foo", "not a valid key", []byte("nope"))
+	be.Nonzero(t, err)
+}
+
+func TestNatsKVSecretStoreSharedKey(t *testing.T) {
+	server := startNatsServer(t, t.TempDir())
+	defer server.Shutdown()
+
+	nc, err := nats.Connect(server.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	xkp, err := nkeys.CreateCurveKeys()
+	be.NilErr(t, err)
+
+	s1, err := NewNatsKVSecretStore(nc, "test", xkp, nil)
+	be.NilErr(t, err)
+
+	_, err = s1.PutSecret("foo", "dbpass", []byte("supersecret"))
+	be.NilErr(t, err)
+
+	s2, err := NewNatsKVSecretStore(nc, "test", xkp, nil)
+	be.NilErr(t, err)
+
+	v, err := s2.GetSecret("foo", "dbpass")
+	be.NilErr(t, err)
+	be.Equal(t, "supersecret", string(v))
+
+	otherXkp, err := nkeys.CreateCurveKeys()
+	be.NilErr(t, err)
+
+	s3, err := NewNatsKVSecretStore(nc, "test", otherXkp, nil)
+	be.NilErr(t, err)
+
+	_, err = s3.GetSecret("foo", "dbpass")
+	be.Nonzero(t, err)
+}
+
+func TestNatsKVSecretStoreWatch(t *testing.T) {
+	server := startNatsServer(t, t.TempDir())
+	defer server.Shutdown()
+
+	nc, err := nats.Connect(server.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	xkp, err := nkeys.CreateCurveKeys()
+	be.NilErr(t, err)
+
+	s, err := NewNatsKVSecretStore(nc, "test", xkp, nil)
+	be.NilErr(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	updates, err := s.WatchSecrets(ctx)
+	be.NilErr(t, err)
+
+	rev, err := s.PutSecret("foo", "db.pass", []byte("supersecret"))
+	be.NilErr(t, err)
+
+	update := <-updates
+	be.Equal(t, "foo", update.Namespace)
+	be.Equal(t, "db.pass", update.Key)
+	be.Equal(t, int(rev), update.Revision)
+	be.False(t, update.Deleted)
+
+	be.NilErr(t, s.DeleteSecret("foo", "db.pass"))
+	update = <-updates
+	be.Equal(t, "db.pass", update.Key)
+	be.True(t, update.Deleted)
+
+	cancel()
+	for range updates {
+	}
+}
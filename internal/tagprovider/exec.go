@@ -0,0 +1,69 @@
+package tagprovider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/synadia-io/nex/models"
+)
+
+var _ models.TagProvider = (*ExecProvider)(nil)
+
+// ExecProvider runs an executable and reads tags from its output, one
+// key=value pair per line. Empty lines and lines starting with # are ignored
+type ExecProvider struct {
+	path    string
+	args    []string
+	timeout time.Duration
+}
+
+// NewExecProvider runs path with args; runs longer than timeout are killed
+func NewExecProvider(timeout time.Duration, path string, args ...string) *ExecProvider {
+	return &ExecProvider{
+		path:    path,
+		args:    args,
+		timeout: timeout,
+	}
+}
+
+func (e *ExecProvider) Tags(ctx context.Context) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	stderr := new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, e.path, e.args...)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run tag provider %s: %w: %s", e.path, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return ParseTags(bytes.NewReader(out))
+}
+
+// ParseTags reads key=value lines
+func ParseTags(r io.Reader) (map[string]string, error) {
+	tags := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		k, v, ok := strings.Cut(line, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid tag line %q: expected key=value", line)
+		}
+		tags[k] = strings.TrimSpace(v)
+	}
+	return tags, scanner.Err()
+}
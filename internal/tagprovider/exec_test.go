@@ -0,0 +1,51 @@
+package tagprovider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carlmjohnson/be"
+)
+
+func TestParseTags(t *testing.T) {
+	tags, err := ParseTags(strings.NewReader("# rack facts\nrack=r12\n\n gpu = a100 \nempty=\n"))
+	be.NilErr(t, err)
+	be.DeepEqual(t, map[string]string{"rack": "r12", "gpu": "a100", "empty": ""}, tags)
+
+	_, err = ParseTags(strings.NewReader("rack\n"))
+	be.Nonzero(t, err)
+
+	_, err = ParseTags(strings.NewReader("=r12\n"))
+	be.Nonzero(t, err)
+}
+
+func TestExecProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("tag provider script uses sh")
+	}
+
+	script := filepath.Join(t.TempDir(), "tags.sh")
+	be.NilErr(t, os.WriteFile(script, []byte("#!/bin/sh\necho rack=$1\necho zone=b\n"), 0o700))
+
+	tags, err := NewExecProvider(time.Second, script, "r12").Tags(context.Background())
+	be.NilErr(t, err)
+	be.DeepEqual(t, map[string]string{"rack": "r12", "zone": "b"}, tags)
+
+	failing := filepath.Join(t.TempDir(), "fail.sh")
+	be.NilErr(t, os.WriteFile(failing, []byte("#!/bin/sh\necho broken >&2\nexit 1\n"), 0o700))
+	_, err = NewExecProvider(time.Second, failing).Tags(context.Background())
+	be.Nonzero(t, err)
+	be.In(t, "broken", err.Error())
+
+	slow := filepath.Join(t.TempDir(), "slow.sh")
+	be.NilErr(t, os.WriteFile(slow, []byte("#!/bin/sh\nexec sleep 5\n"), 0o700))
+	start := time.Now()
+	_, err = NewExecProvider(100*time.Millisecond, slow).Tags(context.Background())
+	be.Nonzero(t, err)
+	be.True(t, time.Since(start) < 5*time.Second)
+}
@@ -0,0 +1,36 @@
+package tagprovider
+
+import (
+	"context"
+	"os"
+
+	"github.com/synadia-io/nex/models"
+)
+
+var _ models.TagProvider = (*HostFactsProvider)(nil)
+
+// HostFactsProvider detects facts about the host the node runs on: hostname,
+// kernel version, total memory, free disk space in the resource directory
+// and cgroup version. Facts that can not be detected on the platform are left
+// out
+type HostFactsProvider struct {
+	resourceDir string
+}
+
+// NewHostFactsProvider reports the free disk space of resourceDir; with an
+// empty resourceDir the disk fact is left out
+func NewHostFactsProvider(resourceDir string) *HostFactsProvider {
+	return &HostFactsProvider{resourceDir: resourceDir}
+}
+
+func (h *HostFactsProvider) Tags(_ context.Context) (map[string]string, error) {
+	tags := make(map[string]string)
+
+	hostname, err := os.Hostname()
+	if err == nil {
+		tags[models.TagHostname] = hostname
+	}
+
+	hostFacts(h.resourceDir, tags)
+	return tags, nil
+}
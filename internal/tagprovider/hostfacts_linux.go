@@ -0,0 +1,59 @@
+package tagprovider
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/synadia-io/nex/models"
+)
+
+func hostFacts(resourceDir string, tags map[string]string) {
+	if release, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		tags[models.TagKernel] = strings.TrimSpace(string(release))
+	}
+
+	if memoryMB, ok := totalMemoryMB(); ok {
+		tags[models.TagMemoryMB] = strconv.FormatUint(memoryMB, 10)
+	}
+
+	if resourceDir != "" {
+		var fs syscall.Statfs_t
+		if err := syscall.Statfs(resourceDir, &fs); err == nil {
+			tags[models.TagDiskFreeMB] = strconv.FormatUint(fs.Bavail*uint64(fs.Bsize)/(1024*1024), 10)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join("/sys/fs/cgroup", "cgroup.controllers")); err == nil {
+		tags[models.TagCgroupVersion] = "2"
+	} else if _, err := os.Stat("/sys/fs/cgroup"); err == nil {
+		tags[models.TagCgroupVersion] = "1"
+	}
+}
+
+// totalMemoryMB reads MemTotal from /proc/meminfo
+func totalMemoryMB() (uint64, bool) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// MemTotal:       16316412 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return kb / 1024, true
+	}
+	return 0, false
+}
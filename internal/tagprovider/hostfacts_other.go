@@ -0,0 +1,6 @@
+//go:build !linux
+
+package tagprovider
+
+// hostFacts only detects the hostname outside of linux
+func hostFacts(_ string, _ map[string]string) {}
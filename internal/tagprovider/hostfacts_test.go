@@ -0,0 +1,32 @@
+package tagprovider
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/carlmjohnson/be"
+	"github.com/synadia-io/nex/models"
+)
+
+func TestHostFactsProvider(t *testing.T) {
+	tags, err := NewHostFactsProvider(t.TempDir()).Tags(context.Background())
+	be.NilErr(t, err)
+
+	hostname, err := os.Hostname()
+	be.NilErr(t, err)
+	be.Equal(t, hostname, tags[models.TagHostname])
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	be.Nonzero(t, tags[models.TagKernel])
+	be.Nonzero(t, tags[models.TagMemoryMB])
+	be.Nonzero(t, tags[models.TagDiskFreeMB])
+
+	tags, err = NewHostFactsProvider("").Tags(context.Background())
+	be.NilErr(t, err)
+	_, ok := tags[models.TagDiskFreeMB]
+	be.False(t, ok)
+}
@@ -0,0 +1,13 @@
+package models
+
+// AdmissionRejectedCode is the error code returned to the client when a
+// WorkloadAdmitter rejects a start request
+const AdmissionRejectedCode = "403"
+
+type WorkloadAdmitter interface {
+	// AdmitWorkload is called after the run request passed the agent schema and
+	// before the workload is started. The error is returned to the client as the
+	// reason the workload was rejected
+	// req -> start request from the client
+	AdmitWorkload(req *StartWorkloadRequest) error
+}
@@ -72,6 +72,31 @@ func AgentAPIHeartbeatSubject(inNodeId, inAgentId string) string {
 	return fmt.Sprintf("%s.HEARTBEAT.%s", AgentAPIPrefix(inNodeId), inAgentId)
 }
 
+// $NEX.SVC.nodeid.agent.SECRET.*
+func AgentAPISecretSubscribeSubject(inNodeId string) string {
+	return fmt.Sprintf("%s.SECRET.*", AgentAPIPrefix(inNodeId))
+}
+
+// $NEX.SVC.nodeid.agent.SECRET.agentid
+func AgentAPISecretRequestSubject(inNodeId, inAgentId string) string {
+	return fmt.Sprintf("%s.SECRET.%s", AgentAPIPrefix(inNodeId), inAgentId)
+}
+
+// $NEX.SVC.nodeid.agent.OPERATION.*
+func AgentAPIOperationSubscribeSubject(inNodeId string) string {
+	return fmt.Sprintf("%s.OPERATION.*", AgentAPIPrefix(inNodeId))
+}
+
+// $NEX.SVC.nodeid.agent.OPERATION.agentid
+func AgentAPIOperationRequestSubject(inNodeId, inAgentId string) string {
+	return fmt.Sprintf("%s.OPERATION.%s", AgentAPIPrefix(inNodeId), inAgentId)
+}
+
+// $NEX.SVC.nodeid.agent.agentid.SECRETUPDATED
+func AgentAPISecretUpdatedSubject(inNodeId, inAgentId string) string {
+	return fmt.Sprintf("%s.%s.SECRETUPDATED", AgentAPIPrefix(inNodeId), inAgentId)
+}
+
 // $NEX.SVC.nodeid.agent.SETLAMEDUCK
 func AgentAPISetLameduckSubject(inNodeId string) string {
 	return fmt.Sprintf("%s.SETLAMEDUCK", AgentAPIPrefix(inNodeId))
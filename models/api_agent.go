@@ -4,6 +4,7 @@ package models
 
 import "encoding/json"
 import "fmt"
+import "reflect"
 
 type AgentHeartbeat struct {
 	// Send additional data in heartbeat
@@ -129,6 +130,130 @@ func (j *AgentListWorkloadsRequest) UnmarshalJSON(value []byte) error {
 
 type AgentListWorkloadsResponse []WorkloadSummary
 
+// Progress reported by an agent while it starts a workload
+type AgentOperationUpdate struct {
+	// ID of the operation from the start workload request
+	OperationId string `json:"operation_id"`
+
+	// Step the agent reached
+	State AgentOperationUpdateState `json:"state"`
+}
+
+type AgentOperationUpdateState string
+
+const AgentOperationUpdateStateFetchingArtifact AgentOperationUpdateState = "fetching_artifact"
+const AgentOperationUpdateStateStarting AgentOperationUpdateState = "starting"
+
+var enumValues_AgentOperationUpdateState = []interface{}{
+	"fetching_artifact",
+	"starting",
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *AgentOperationUpdateState) UnmarshalJSON(value []byte) error {
+	var v string
+	if err := json.Unmarshal(value, &v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_AgentOperationUpdateState {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_AgentOperationUpdateState, v)
+	}
+	*j = AgentOperationUpdateState(v)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *AgentOperationUpdate) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["operation_id"]; raw != nil && !ok {
+		return fmt.Errorf("field operation_id in AgentOperationUpdate: required")
+	}
+	if _, ok := raw["state"]; raw != nil && !ok {
+		return fmt.Errorf("field state in AgentOperationUpdate: required")
+	}
+	type Plain AgentOperationUpdate
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = AgentOperationUpdate(plain)
+	return nil
+}
+
+type AgentSecretRequest struct {
+	// Key of the secret; referenced by workloads as secret://<key>
+	Key string `json:"key"`
+
+	// Namespace the secret belongs to
+	Namespace string `json:"namespace"`
+
+	// Public xkey of the requester. The node encrypts the secret value for this key
+	Xkey string `json:"xkey"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *AgentSecretRequest) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["key"]; raw != nil && !ok {
+		return fmt.Errorf("field key in AgentSecretRequest: required")
+	}
+	if _, ok := raw["namespace"]; raw != nil && !ok {
+		return fmt.Errorf("field namespace in AgentSecretRequest: required")
+	}
+	if _, ok := raw["xkey"]; raw != nil && !ok {
+		return fmt.Errorf("field xkey in AgentSecretRequest: required")
+	}
+	type Plain AgentSecretRequest
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = AgentSecretRequest(plain)
+	return nil
+}
+
+type AgentSecretResponse struct {
+	// Base64 encoded secret value, encrypted for the requester xkey
+	Value string `json:"value"`
+
+	// Public xkey of the node that encrypted the value
+	Xkey string `json:"xkey"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *AgentSecretResponse) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["value"]; raw != nil && !ok {
+		return fmt.Errorf("field value in AgentSecretResponse: required")
+	}
+	if _, ok := raw["xkey"]; raw != nil && !ok {
+		return fmt.Errorf("field xkey in AgentSecretResponse: required")
+	}
+	type Plain AgentSecretResponse
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = AgentSecretResponse(plain)
+	return nil
+}
+
 type RegisterAgentRequest struct {
 	// A user friendly description of the agent
 	Description string `json:"description"`
@@ -273,3 +398,44 @@ func (j *RegisterRemoteAgentResponse) UnmarshalJSON(value []byte) error {
 	*j = RegisterRemoteAgentResponse(plain)
 	return nil
 }
+
+type SecretUpdate struct {
+	// True if the secret was removed
+	Deleted bool `json:"deleted"`
+
+	// Key of the secret that changed
+	Key string `json:"key"`
+
+	// Namespace the secret belongs to
+	Namespace string `json:"namespace"`
+
+	// Revision of the secret in the secret store
+	Revision int `json:"revision"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *SecretUpdate) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["deleted"]; raw != nil && !ok {
+		return fmt.Errorf("field deleted in SecretUpdate: required")
+	}
+	if _, ok := raw["key"]; raw != nil && !ok {
+		return fmt.Errorf("field key in SecretUpdate: required")
+	}
+	if _, ok := raw["namespace"]; raw != nil && !ok {
+		return fmt.Errorf("field namespace in SecretUpdate: required")
+	}
+	if _, ok := raw["revision"]; raw != nil && !ok {
+		return fmt.Errorf("field revision in SecretUpdate: required")
+	}
+	type Plain SecretUpdate
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = SecretUpdate(plain)
+	return nil
+}
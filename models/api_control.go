@@ -4,15 +4,26 @@ package models
 
 import "encoding/json"
 import "fmt"
+import "reflect"
 import "time"
 
 type AuctionRequest struct {
+	// Placement rules relative to the workloads running on the node
+	Affinity *WorkloadAffinity `json:"affinity,omitempty"`
+
 	// The type of agent to use for the auction
 	AgentType string `json:"agent_type"`
 
 	// A unique identifier for the auction
 	AuctionId string `json:"auction_id"`
 
+	// Constraint expressions the node attributes must satisfy, e.g. nex.cpucount
+	// >= 8
+	Constraints []string `json:"constraints,omitempty"`
+
+	// Resources the workload declares; checked against the namespace quota
+	Resources *WorkloadResources `json:"resources,omitempty"`
+
 	// A map of tags to use for the auction
 	Tags NodeTags `json:"tags"`
 }
@@ -82,6 +93,322 @@ func (j *AuctionResponse) UnmarshalJSON(value []byte) error {
 	return nil
 }
 
+// Immutable record of a control plane mutation
+type AuditRecord struct {
+	// Action the request performed
+	Action string `json:"action"`
+
+	// Public nkey of the caller; empty when the request was not signed
+	Caller string `json:"caller"`
+
+	// Reason the request failed or was denied; empty on success
+	Error string `json:"error"`
+
+	// Namespace the request was sent to
+	Namespace string `json:"namespace"`
+
+	// ID of the node that handled the request
+	NodeId string `json:"node_id"`
+
+	// Outcome of the request
+	Outcome AuditRecordOutcome `json:"outcome"`
+
+	// Hex encoded SHA-256 digest of the request payload
+	RequestDigest string `json:"request_digest"`
+
+	// Workload, node or agent the request acted on
+	Target string `json:"target"`
+
+	// Time the request was handled
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type AuditRecordOutcome string
+
+const AuditRecordOutcomeDenied AuditRecordOutcome = "denied"
+const AuditRecordOutcomeFailure AuditRecordOutcome = "failure"
+const AuditRecordOutcomeSuccess AuditRecordOutcome = "success"
+
+var enumValues_AuditRecordOutcome = []interface{}{
+	"success",
+	"failure",
+	"denied",
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *AuditRecordOutcome) UnmarshalJSON(value []byte) error {
+	var v string
+	if err := json.Unmarshal(value, &v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_AuditRecordOutcome {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_AuditRecordOutcome, v)
+	}
+	*j = AuditRecordOutcome(v)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *AuditRecord) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["action"]; raw != nil && !ok {
+		return fmt.Errorf("field action in AuditRecord: required")
+	}
+	if _, ok := raw["caller"]; raw != nil && !ok {
+		return fmt.Errorf("field caller in AuditRecord: required")
+	}
+	if _, ok := raw["error"]; raw != nil && !ok {
+		return fmt.Errorf("field error in AuditRecord: required")
+	}
+	if _, ok := raw["namespace"]; raw != nil && !ok {
+		return fmt.Errorf("field namespace in AuditRecord: required")
+	}
+	if _, ok := raw["node_id"]; raw != nil && !ok {
+		return fmt.Errorf("field node_id in AuditRecord: required")
+	}
+	if _, ok := raw["outcome"]; raw != nil && !ok {
+		return fmt.Errorf("field outcome in AuditRecord: required")
+	}
+	if _, ok := raw["request_digest"]; raw != nil && !ok {
+		return fmt.Errorf("field request_digest in AuditRecord: required")
+	}
+	if _, ok := raw["target"]; raw != nil && !ok {
+		return fmt.Errorf("field target in AuditRecord: required")
+	}
+	if _, ok := raw["timestamp"]; raw != nil && !ok {
+		return fmt.Errorf("field timestamp in AuditRecord: required")
+	}
+	type Plain AuditRecord
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = AuditRecord(plain)
+	return nil
+}
+
+// Keeps the number of running instances of a workload between a minimum and a
+// maximum, following the pending messages of a JetStream consumer or a metric
+// emitted by the instances
+type AutoscalingPolicy struct {
+	// Public user nkey of the caller that stored the policy; scaling is authorized
+	// as this caller
+	Caller string `json:"caller,omitempty"`
+
+	// Constraint expressions the node of each instance must satisfy
+	Constraints []string `json:"constraints,omitempty"`
+
+	// JetStream consumer whose pending and unacknowledged messages drive the
+	// policy
+	Consumer *AutoscalingPolicyConsumer `json:"consumer,omitempty"`
+
+	// When the policy was created
+	Created time.Time `json:"created"`
+
+	// Most instances kept running
+	MaxInstances int `json:"max_instances"`
+
+	// Metric emitted by the instances on their metrics subject that drives the
+	// policy; the latest values of all instances are summed
+	Metric *AutoscalingPolicyMetric `json:"metric,omitempty"`
+
+	// Fewest instances kept running
+	MinInstances int `json:"min_instances"`
+
+	// The name of the workload the policy scales, unique within the namespace
+	Name string `json:"name"`
+
+	// The namespace of the workload
+	Namespace string `json:"namespace"`
+
+	// Time after any scaling before a scale in, as a Go duration
+	ScaleInCooldown string `json:"scale_in_cooldown,omitempty"`
+
+	// Time after a scale out before the next one, as a Go duration
+	ScaleOutCooldown string `json:"scale_out_cooldown,omitempty"`
+
+	// Signature of the caller over the policy without its signature, base64 raw
+	// URL encoded
+	Signature string `json:"signature,omitempty"`
+
+	// Pending messages or metric value one instance handles; the desired
+	// instances are the observed value divided by the target, rounded up
+	Target float64 `json:"target"`
+
+	// The workload started for each instance
+	Workload StartWorkloadRequest `json:"workload"`
+}
+
+// JetStream consumer whose pending and unacknowledged messages drive the policy
+type AutoscalingPolicyConsumer struct {
+	// The name of the durable consumer
+	Consumer string `json:"consumer"`
+
+	// The stream of the consumer
+	Stream string `json:"stream"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *AutoscalingPolicyConsumer) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["consumer"]; raw != nil && !ok {
+		return fmt.Errorf("field consumer in AutoscalingPolicyConsumer: required")
+	}
+	if _, ok := raw["stream"]; raw != nil && !ok {
+		return fmt.Errorf("field stream in AutoscalingPolicyConsumer: required")
+	}
+	type Plain AutoscalingPolicyConsumer
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = AutoscalingPolicyConsumer(plain)
+	return nil
+}
+
+// Metric emitted by the instances on their metrics subject that drives the
+// policy; the latest values of all instances are summed
+type AutoscalingPolicyMetric struct {
+	// Top-level numeric field of the JSON metrics payload
+	Name string `json:"name"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *AutoscalingPolicyMetric) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in AutoscalingPolicyMetric: required")
+	}
+	type Plain AutoscalingPolicyMetric
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = AutoscalingPolicyMetric(plain)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *AutoscalingPolicy) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["created"]; raw != nil && !ok {
+		return fmt.Errorf("field created in AutoscalingPolicy: required")
+	}
+	if _, ok := raw["max_instances"]; raw != nil && !ok {
+		return fmt.Errorf("field max_instances in AutoscalingPolicy: required")
+	}
+	if _, ok := raw["min_instances"]; raw != nil && !ok {
+		return fmt.Errorf("field min_instances in AutoscalingPolicy: required")
+	}
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in AutoscalingPolicy: required")
+	}
+	if _, ok := raw["namespace"]; raw != nil && !ok {
+		return fmt.Errorf("field namespace in AutoscalingPolicy: required")
+	}
+	if _, ok := raw["target"]; raw != nil && !ok {
+		return fmt.Errorf("field target in AutoscalingPolicy: required")
+	}
+	if _, ok := raw["workload"]; raw != nil && !ok {
+		return fmt.Errorf("field workload in AutoscalingPolicy: required")
+	}
+	type Plain AutoscalingPolicy
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	if v, ok := raw["scale_in_cooldown"]; !ok || v == nil {
+		plain.ScaleInCooldown = "5m"
+	}
+	if v, ok := raw["scale_out_cooldown"]; !ok || v == nil {
+		plain.ScaleOutCooldown = "1m"
+	}
+	*j = AutoscalingPolicy(plain)
+	return nil
+}
+
+// The last evaluation of an autoscaling policy
+type AutoscalingStatus struct {
+	// Instances the policy asked for at the last evaluation
+	Desired int `json:"desired"`
+
+	// Why the last evaluation or scaling failed
+	Error string `json:"error,omitempty"`
+
+	// Running instances at the last evaluation
+	Instances int `json:"instances"`
+
+	// When instances were last stopped
+	LastScaleIn *time.Time `json:"last_scale_in,omitempty"`
+
+	// When instances were last started
+	LastScaleOut *time.Time `json:"last_scale_out,omitempty"`
+
+	// Pending messages or metric value observed at the last evaluation
+	MetricValue float64 `json:"metric_value"`
+
+	// The name of the workload the policy scales
+	Name string `json:"name"`
+
+	// The namespace of the workload
+	Namespace string `json:"namespace"`
+
+	// When the policy was last evaluated
+	Updated time.Time `json:"updated"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *AutoscalingStatus) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["desired"]; raw != nil && !ok {
+		return fmt.Errorf("field desired in AutoscalingStatus: required")
+	}
+	if _, ok := raw["instances"]; raw != nil && !ok {
+		return fmt.Errorf("field instances in AutoscalingStatus: required")
+	}
+	if _, ok := raw["metric_value"]; raw != nil && !ok {
+		return fmt.Errorf("field metric_value in AutoscalingStatus: required")
+	}
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in AutoscalingStatus: required")
+	}
+	if _, ok := raw["namespace"]; raw != nil && !ok {
+		return fmt.Errorf("field namespace in AutoscalingStatus: required")
+	}
+	if _, ok := raw["updated"]; raw != nil && !ok {
+		return fmt.Errorf("field updated in AutoscalingStatus: required")
+	}
+	type Plain AutoscalingStatus
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = AutoscalingStatus(plain)
+	return nil
+}
+
 type CloneWorkloadRequest struct {
 	// Namespace corresponds to the JSON schema field "namespace".
 	Namespace string `json:"namespace"`
@@ -117,6 +444,455 @@ type CloneWorkloadResponse struct {
 	StartWorkloadRequest *StartWorkloadRequest `json:"start_workload_request,omitempty"`
 }
 
+// A running instance of a lazy function started by the activator
+type FunctionInstance struct {
+	// The name of the function
+	Function string `json:"function"`
+
+	// The workload ID of the instance
+	Id string `json:"id"`
+
+	// The namespace of the function
+	Namespace string `json:"namespace"`
+
+	// The node the instance was started on
+	NodeId string `json:"node_id,omitempty"`
+
+	// When the instance was started
+	Started time.Time `json:"started"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *FunctionInstance) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["function"]; raw != nil && !ok {
+		return fmt.Errorf("field function in FunctionInstance: required")
+	}
+	if _, ok := raw["id"]; raw != nil && !ok {
+		return fmt.Errorf("field id in FunctionInstance: required")
+	}
+	if _, ok := raw["namespace"]; raw != nil && !ok {
+		return fmt.Errorf("field namespace in FunctionInstance: required")
+	}
+	if _, ok := raw["started"]; raw != nil && !ok {
+		return fmt.Errorf("field started in FunctionInstance: required")
+	}
+	type Plain FunctionInstance
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = FunctionInstance(plain)
+	return nil
+}
+
+// One execution of a job schedule
+type JobRun struct {
+	// When the run finished
+	EndTime *time.Time `json:"end_time,omitempty"`
+
+	// Why the run failed or was skipped
+	Error string `json:"error,omitempty"`
+
+	// Exit code reported by the agent when the job finished
+	ExitCode *int `json:"exit_code,omitempty"`
+
+	// The workload ID of the run, or a generated ID if no workload was started
+	Id string `json:"id"`
+
+	// The namespace of the schedule
+	Namespace string `json:"namespace"`
+
+	// The node the run was started on
+	NodeId string `json:"node_id,omitempty"`
+
+	// The name of the schedule
+	Schedule string `json:"schedule"`
+
+	// The schedule tick the run belongs to
+	ScheduledTime time.Time `json:"scheduled_time"`
+
+	// When the run was started
+	StartTime time.Time `json:"start_time"`
+
+	// State of the run; every state but running is final
+	State JobRunState `json:"state"`
+}
+
+type JobRunState string
+
+const JobRunStateFailed JobRunState = "failed"
+const JobRunStateReplaced JobRunState = "replaced"
+const JobRunStateRunning JobRunState = "running"
+const JobRunStateSkipped JobRunState = "skipped"
+const JobRunStateSucceeded JobRunState = "succeeded"
+
+var enumValues_JobRunState = []interface{}{
+	"running",
+	"succeeded",
+	"failed",
+	"skipped",
+	"replaced",
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *JobRunState) UnmarshalJSON(value []byte) error {
+	var v string
+	if err := json.Unmarshal(value, &v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_JobRunState {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_JobRunState, v)
+	}
+	*j = JobRunState(v)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *JobRun) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["id"]; raw != nil && !ok {
+		return fmt.Errorf("field id in JobRun: required")
+	}
+	if _, ok := raw["namespace"]; raw != nil && !ok {
+		return fmt.Errorf("field namespace in JobRun: required")
+	}
+	if _, ok := raw["schedule"]; raw != nil && !ok {
+		return fmt.Errorf("field schedule in JobRun: required")
+	}
+	if _, ok := raw["scheduled_time"]; raw != nil && !ok {
+		return fmt.Errorf("field scheduled_time in JobRun: required")
+	}
+	if _, ok := raw["start_time"]; raw != nil && !ok {
+		return fmt.Errorf("field start_time in JobRun: required")
+	}
+	if _, ok := raw["state"]; raw != nil && !ok {
+		return fmt.Errorf("field state in JobRun: required")
+	}
+	type Plain JobRun
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = JobRun(plain)
+	return nil
+}
+
+// A job started on a cron schedule by the nexus scheduler
+type JobSchedule struct {
+	// Public user nkey of the caller that stored the schedule; runs are authorized
+	// as this caller
+	Caller string `json:"caller,omitempty"`
+
+	// What to do when a run is due while an earlier run is still running
+	ConcurrencyPolicy JobScheduleConcurrencyPolicy `json:"concurrency_policy,omitempty"`
+
+	// Constraint expressions the node of each run must satisfy
+	Constraints []string `json:"constraints,omitempty"`
+
+	// When the schedule was created; the first run is the first tick after it
+	Created time.Time `json:"created"`
+
+	// Five field cron expression, or a macro such as @hourly
+	Cron string `json:"cron"`
+
+	// Number of finished runs kept; 10 when zero
+	HistoryLimit int `json:"history_limit,omitempty"`
+
+	// The name of the schedule, unique within the namespace
+	Name string `json:"name"`
+
+	// The namespace of the schedule
+	Namespace string `json:"namespace"`
+
+	// Signature of the caller over the schedule without its signature, base64 raw
+	// URL encoded
+	Signature string `json:"signature,omitempty"`
+
+	// IANA time zone the cron expression is evaluated in; UTC when empty
+	Timezone string `json:"timezone,omitempty"`
+
+	// The job started for each run
+	Workload StartWorkloadRequest `json:"workload"`
+}
+
+type JobScheduleConcurrencyPolicy string
+
+const JobScheduleConcurrencyPolicyAllow JobScheduleConcurrencyPolicy = "allow"
+const JobScheduleConcurrencyPolicyForbid JobScheduleConcurrencyPolicy = "forbid"
+const JobScheduleConcurrencyPolicyReplace JobScheduleConcurrencyPolicy = "replace"
+
+var enumValues_JobScheduleConcurrencyPolicy = []interface{}{
+	"allow",
+	"forbid",
+	"replace",
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *JobScheduleConcurrencyPolicy) UnmarshalJSON(value []byte) error {
+	var v string
+	if err := json.Unmarshal(value, &v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_JobScheduleConcurrencyPolicy {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_JobScheduleConcurrencyPolicy, v)
+	}
+	*j = JobScheduleConcurrencyPolicy(v)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *JobSchedule) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["created"]; raw != nil && !ok {
+		return fmt.Errorf("field created in JobSchedule: required")
+	}
+	if _, ok := raw["cron"]; raw != nil && !ok {
+		return fmt.Errorf("field cron in JobSchedule: required")
+	}
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in JobSchedule: required")
+	}
+	if _, ok := raw["namespace"]; raw != nil && !ok {
+		return fmt.Errorf("field namespace in JobSchedule: required")
+	}
+	if _, ok := raw["workload"]; raw != nil && !ok {
+		return fmt.Errorf("field workload in JobSchedule: required")
+	}
+	type Plain JobSchedule
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	if v, ok := raw["concurrency_policy"]; !ok || v == nil {
+		plain.ConcurrencyPolicy = "allow"
+	}
+	if v, ok := raw["history_limit"]; !ok || v == nil {
+		plain.HistoryLimit = 0.0
+	}
+	*j = JobSchedule(plain)
+	return nil
+}
+
+// A function started by the nexus activator when a message arrives on one of
+// its trigger subjects and stopped once idle
+type LazyFunction struct {
+	// Public user nkey of the caller that stored the function; instances are
+	// authorized as this caller
+	Caller string `json:"caller,omitempty"`
+
+	// Constraint expressions the node of each instance must satisfy
+	Constraints []string `json:"constraints,omitempty"`
+
+	// When the function was created
+	Created time.Time `json:"created"`
+
+	// How long an instance may go without an invocation before it is stopped, as
+	// a Go duration
+	IdleTimeout string `json:"idle_timeout,omitempty"`
+
+	// The name of the function, unique within the namespace
+	Name string `json:"name"`
+
+	// The namespace of the function
+	Namespace string `json:"namespace"`
+
+	// Signature of the caller over the function without its signature, base64 raw
+	// URL encoded
+	Signature string `json:"signature,omitempty"`
+
+	// Subjects the activator listens on while no instance of the function is
+	// running
+	TriggerSubjects []string `json:"trigger_subjects"`
+
+	// The function started for each instance
+	Workload StartWorkloadRequest `json:"workload"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *LazyFunction) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["created"]; raw != nil && !ok {
+		return fmt.Errorf("field created in LazyFunction: required")
+	}
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in LazyFunction: required")
+	}
+	if _, ok := raw["namespace"]; raw != nil && !ok {
+		return fmt.Errorf("field namespace in LazyFunction: required")
+	}
+	if _, ok := raw["trigger_subjects"]; raw != nil && !ok {
+		return fmt.Errorf("field trigger_subjects in LazyFunction: required")
+	}
+	if _, ok := raw["workload"]; raw != nil && !ok {
+		return fmt.Errorf("field workload in LazyFunction: required")
+	}
+	type Plain LazyFunction
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	if v, ok := raw["idle_timeout"]; !ok || v == nil {
+		plain.IdleTimeout = "5m"
+	}
+	*j = LazyFunction(plain)
+	return nil
+}
+
+// Permissions template applied to workload credentials minted in a namespace.
+// Entries may reference {{namespace}} and {{workload_id}}
+type NamespacePolicy struct {
+	// Key value buckets workloads may read and write
+	KvBuckets []string `json:"kv_buckets,omitempty"`
+
+	// Object stores workloads may read and write
+	ObjectStores []string `json:"object_stores,omitempty"`
+
+	// Subjects workloads may publish to
+	Publish []string `json:"publish,omitempty"`
+
+	// Subjects workloads may subscribe to
+	Subscribe []string `json:"subscribe,omitempty"`
+}
+
+// Limits on the workloads a namespace may run across the nexus. A limit of 0 is
+// unlimited
+type NamespaceQuota struct {
+	// Maximum CPUs declared by the workloads in the namespace
+	MaxCpus float64 `json:"max_cpus,omitempty"`
+
+	// Maximum memory in megabytes declared by the workloads in the namespace
+	MaxMemoryMb int `json:"max_memory_mb,omitempty"`
+
+	// Maximum number of workloads in the namespace
+	MaxWorkloads int `json:"max_workloads,omitempty"`
+
+	// Maximum number of workloads in the namespace for each agent type
+	MaxWorkloadsPerType NamespaceQuotaMaxWorkloadsPerType `json:"max_workloads_per_type,omitempty"`
+}
+
+// Maximum number of workloads in the namespace for each agent type
+type NamespaceQuotaMaxWorkloadsPerType map[string]int
+
+// Workloads and declared resources counted against a namespace quota
+type NamespaceQuotaUsage struct {
+	// CPUs declared by the workloads in the namespace
+	Cpus float64 `json:"cpus"`
+
+	// Memory in megabytes declared by the workloads in the namespace
+	MemoryMb int `json:"memory_mb"`
+
+	// Number of workloads in the namespace
+	Workloads int `json:"workloads"`
+
+	// Number of workloads in the namespace for each agent type
+	WorkloadsPerType NamespaceQuotaUsageWorkloadsPerType `json:"workloads_per_type"`
+}
+
+// Number of workloads in the namespace for each agent type
+type NamespaceQuotaUsageWorkloadsPerType map[string]int
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *NamespaceQuotaUsage) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["cpus"]; raw != nil && !ok {
+		return fmt.Errorf("field cpus in NamespaceQuotaUsage: required")
+	}
+	if _, ok := raw["memory_mb"]; raw != nil && !ok {
+		return fmt.Errorf("field memory_mb in NamespaceQuotaUsage: required")
+	}
+	if _, ok := raw["workloads"]; raw != nil && !ok {
+		return fmt.Errorf("field workloads in NamespaceQuotaUsage: required")
+	}
+	if _, ok := raw["workloads_per_type"]; raw != nil && !ok {
+		return fmt.Errorf("field workloads_per_type in NamespaceQuotaUsage: required")
+	}
+	type Plain NamespaceQuotaUsage
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = NamespaceQuotaUsage(plain)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *NamespaceQuota) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	type Plain NamespaceQuota
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	if v, ok := raw["max_cpus"]; !ok || v == nil {
+		plain.MaxCpus = 0.0
+	}
+	if v, ok := raw["max_memory_mb"]; !ok || v == nil {
+		plain.MaxMemoryMb = 0.0
+	}
+	if v, ok := raw["max_workloads"]; !ok || v == nil {
+		plain.MaxWorkloads = 0.0
+	}
+	*j = NamespaceQuota(plain)
+	return nil
+}
+
+// Live nodes known to the responding node through heartbeats
+type NexusMembershipResponse struct {
+	// Number of live nodes, including the responding node
+	NodeCount int `json:"node_count"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *NexusMembershipResponse) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["node_count"]; raw != nil && !ok {
+		return fmt.Errorf("field node_count in NexusMembershipResponse: required")
+	}
+	type Plain NexusMembershipResponse
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = NexusMembershipResponse(plain)
+	return nil
+}
+
 type NodeAgentSummaryResponse map[string]NodeAgentSummary
 
 type NodeInfoRequest map[string]interface{}
@@ -172,6 +948,9 @@ func (j *NodeInfoResponse) UnmarshalJSON(value []byte) error {
 }
 
 type NodePingRequest struct {
+	// Constraint expressions the node attributes must satisfy
+	Constraints []string `json:"constraints,omitempty"`
+
 	// Filter corresponds to the JSON schema field "filter".
 	Filter NodePingRequestFilter `json:"filter"`
 }
@@ -254,3 +1033,222 @@ func (j *NodePingResponse) UnmarshalJSON(value []byte) error {
 	*j = NodePingResponse(plain)
 	return nil
 }
+
+// Changes to the non-reserved tags of a running node
+type NodeTagsRequest struct {
+	// Keys of the tags to remove
+	Remove []string `json:"remove,omitempty"`
+
+	// Tags to add or overwrite
+	Set NodeTags `json:"set,omitempty"`
+}
+
+type NodeTagsResponse struct {
+	// The public nkey of the node
+	NodeId string `json:"node_id"`
+
+	// Placement tags of the node after the change
+	Tags NodeTags `json:"tags"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *NodeTagsResponse) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["node_id"]; raw != nil && !ok {
+		return fmt.Errorf("field node_id in NodeTagsResponse: required")
+	}
+	if _, ok := raw["tags"]; raw != nil && !ok {
+		return fmt.Errorf("field tags in NodeTagsResponse: required")
+	}
+	type Plain NodeTagsResponse
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = NodeTagsResponse(plain)
+	return nil
+}
+
+// Progress of an asynchronous workload deploy
+type OperationStatus struct {
+	// Reason the operation failed
+	Error string `json:"error,omitempty"`
+
+	// Namespace of the workload
+	Namespace string `json:"namespace"`
+
+	// ID of the node running the operation
+	NodeId string `json:"node_id"`
+
+	// ID of the operation
+	OperationId string `json:"operation_id"`
+
+	// State of the operation; running and failed are final
+	State OperationStatusState `json:"state"`
+
+	// Time the operation entered the state
+	Timestamp time.Time `json:"timestamp"`
+
+	// ID of the workload the operation starts
+	WorkloadId string `json:"workload_id"`
+}
+
+type OperationStatusState string
+
+const OperationStatusStateFailed OperationStatusState = "failed"
+const OperationStatusStateFetchingArtifact OperationStatusState = "fetching_artifact"
+const OperationStatusStateQueued OperationStatusState = "queued"
+const OperationStatusStateRunning OperationStatusState = "running"
+const OperationStatusStateStarting OperationStatusState = "starting"
+
+var enumValues_OperationStatusState = []interface{}{
+	"queued",
+	"fetching_artifact",
+	"starting",
+	"running",
+	"failed",
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *OperationStatusState) UnmarshalJSON(value []byte) error {
+	var v string
+	if err := json.Unmarshal(value, &v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_OperationStatusState {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_OperationStatusState, v)
+	}
+	*j = OperationStatusState(v)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *OperationStatus) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["namespace"]; raw != nil && !ok {
+		return fmt.Errorf("field namespace in OperationStatus: required")
+	}
+	if _, ok := raw["node_id"]; raw != nil && !ok {
+		return fmt.Errorf("field node_id in OperationStatus: required")
+	}
+	if _, ok := raw["operation_id"]; raw != nil && !ok {
+		return fmt.Errorf("field operation_id in OperationStatus: required")
+	}
+	if _, ok := raw["state"]; raw != nil && !ok {
+		return fmt.Errorf("field state in OperationStatus: required")
+	}
+	if _, ok := raw["timestamp"]; raw != nil && !ok {
+		return fmt.Errorf("field timestamp in OperationStatus: required")
+	}
+	if _, ok := raw["workload_id"]; raw != nil && !ok {
+		return fmt.Errorf("field workload_id in OperationStatus: required")
+	}
+	type Plain OperationStatus
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = OperationStatus(plain)
+	return nil
+}
+
+type SecretRequest struct {
+	// Key of the secret; referenced by workloads as secret://<key>
+	Key string `json:"key"`
+
+	// Base64 encoded secret value; only used when storing a secret
+	Value string `json:"value"`
+
+	// Public xkey of the requester; required when retrieving a secret. The node
+	// encrypts the secret value for this key
+	Xkey string `json:"xkey,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *SecretRequest) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["key"]; raw != nil && !ok {
+		return fmt.Errorf("field key in SecretRequest: required")
+	}
+	if _, ok := raw["value"]; raw != nil && !ok {
+		return fmt.Errorf("field value in SecretRequest: required")
+	}
+	type Plain SecretRequest
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = SecretRequest(plain)
+	return nil
+}
+
+type SecretResponse struct {
+	// Key of the secret the operation was performed on
+	Key string `json:"key"`
+
+	// List of secret keys in the namespace; only set when listing secrets
+	Keys []string `json:"keys,omitempty"`
+
+	// Optional message on the secret response
+	Message string `json:"message"`
+
+	// Revision of the secret in the secret store
+	Revision int `json:"revision"`
+
+	// Indicates the secret operation was successful
+	Success bool `json:"success"`
+
+	// Base64 encoded secret value, encrypted for the requester xkey; only set when
+	// retrieving a secret
+	Value string `json:"value"`
+
+	// Public xkey of the node that encrypted the value; only set when retrieving a
+	// secret
+	Xkey string `json:"xkey,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *SecretResponse) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["key"]; raw != nil && !ok {
+		return fmt.Errorf("field key in SecretResponse: required")
+	}
+	if _, ok := raw["message"]; raw != nil && !ok {
+		return fmt.Errorf("field message in SecretResponse: required")
+	}
+	if _, ok := raw["revision"]; raw != nil && !ok {
+		return fmt.Errorf("field revision in SecretResponse: required")
+	}
+	if _, ok := raw["success"]; raw != nil && !ok {
+		return fmt.Errorf("field success in SecretResponse: required")
+	}
+	if _, ok := raw["value"]; raw != nil && !ok {
+		return fmt.Errorf("field value in SecretResponse: required")
+	}
+	type Plain SecretResponse
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = SecretResponse(plain)
+	return nil
+}
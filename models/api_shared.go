@@ -38,6 +38,9 @@ func (j *AgentIngressCommands) UnmarshalJSON(value []byte) error {
 }
 
 type AgentStartWorkloadRequest struct {
+	// ID of the operation starting the workload; agents report progress on it
+	OperationId string `json:"operation_id,omitempty"`
+
 	// The start workload request
 	Request StartWorkloadRequest `json:"request"`
 
@@ -187,6 +190,10 @@ func (j *GenericErrors) UnmarshalJSON(value []byte) error {
 }
 
 type LameduckRequest struct {
+	// Constraint expressions the node attributes must satisfy before lameduck
+	// mode is set
+	Constraints []string `json:"constraints,omitempty"`
+
 	// Time delay before lameduck mode is set
 	Delay string `json:"delay"`
 
@@ -413,6 +420,9 @@ func (j *NodeState) UnmarshalJSON(value []byte) error {
 type NodeTags map[string]string
 
 type StartWorkloadRequest struct {
+	// Placement rules relative to the workloads running on the node
+	Affinity *WorkloadAffinity `json:"affinity,omitempty"`
+
 	// A description of the workload
 	Description string `json:"description"`
 
@@ -422,6 +432,13 @@ type StartWorkloadRequest struct {
 	// The namespace of the workload
 	Namespace string `json:"namespace"`
 
+	// NATS permissions requested by the workload; checked against the namespace
+	// policy
+	Permissions *WorkloadPermissions `json:"permissions,omitempty"`
+
+	// Resources the workload declares; counted against the namespace quota
+	Resources *WorkloadResources `json:"resources,omitempty"`
+
 	// The agent specific run request for the workload
 	RunRequest string `json:"run_request"`
 
@@ -477,6 +494,10 @@ type StartWorkloadResponse struct {
 
 	// Name corresponds to the JSON schema field "name".
 	Name string `json:"name"`
+
+	// ID of the operation starting the workload; empty when the workload was
+	// started before the response
+	OperationId string `json:"operation_id,omitempty"`
 }
 
 // UnmarshalJSON implements json.Unmarshaler.
@@ -564,6 +585,27 @@ func (j *StopWorkloadResponse) UnmarshalJSON(value []byte) error {
 	return nil
 }
 
+// Placement rules relative to the workloads already running on a node
+type WorkloadAffinity struct {
+	// Rules a node must run a matching workload for
+	Affinity []WorkloadAffinityRule `json:"affinity,omitempty"`
+
+	// Rules a node must not run a matching workload for
+	AntiAffinity []WorkloadAffinityRule `json:"anti_affinity,omitempty"`
+}
+
+// Selects workloads in the same namespace; every field that is set must match
+type WorkloadAffinityRule struct {
+	// Group of the workload, held in its nex.group tag
+	Group string `json:"group,omitempty"`
+
+	// Name of the workload
+	Name string `json:"name,omitempty"`
+
+	// Tags the workload must have
+	Tags NodeTags `json:"tags,omitempty"`
+}
+
 type WorkloadLifecycle string
 
 const WorkloadLifecycleFunction WorkloadLifecycle = "function"
@@ -596,6 +638,52 @@ func (j *WorkloadLifecycle) UnmarshalJSON(value []byte) error {
 	return nil
 }
 
+// NATS permissions requested by a workload. Entries may reference {{namespace}}
+// and {{workload_id}}
+type WorkloadPermissions struct {
+	// Key value buckets the workload uses
+	KvBuckets []string `json:"kv_buckets,omitempty"`
+
+	// Object stores the workload uses
+	ObjectStores []string `json:"object_stores,omitempty"`
+
+	// Subjects the workload publishes to
+	Publish []string `json:"publish,omitempty"`
+
+	// Subjects the workload subscribes to
+	Subscribe []string `json:"subscribe,omitempty"`
+}
+
+// Resources a workload declares; counted against the namespace quota
+type WorkloadResources struct {
+	// CPUs the workload uses
+	Cpus float64 `json:"cpus,omitempty"`
+
+	// Memory the workload uses in megabytes
+	MemoryMb int `json:"memory_mb,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *WorkloadResources) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	type Plain WorkloadResources
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	if v, ok := raw["cpus"]; !ok || v == nil {
+		plain.Cpus = 0.0
+	}
+	if v, ok := raw["memory_mb"]; !ok || v == nil {
+		plain.MemoryMb = 0.0
+	}
+	*j = WorkloadResources(plain)
+	return nil
+}
+
 type WorkloadState string
 
 const WorkloadStateError WorkloadState = "error"
@@ -1,5 +1,22 @@
 package models
 
+// Headers identifying a remote agent to the agent registrar. The agent sends
+// its public key, and optionally a join token, to the RREGISTER subject. The
+// agent id assigned by the node is the nonce the agent signs with the same key
+// when it sends the REGISTER request
+const (
+	AgentKeyHeader       = "Nex-Agent-Key"
+	AgentTokenHeader     = "Nex-Agent-Token"
+	AgentSignatureHeader = "Nex-Agent-Signature"
+	// AgentIdHeader is set by the node on the headers given to the registrar;
+	// a value sent by the agent is replaced
+	AgentIdHeader = "Nex-Agent-Id"
+)
+
+// AgentJoinTokenType is the claim type of a join token. A join token is a JWT
+// whose subject is the public key of the agent it was issued for
+const AgentJoinTokenType = "nex_agent_join"
+
 type AgentRegistrar interface {
 	// RegisterRemoteInit registers a remote agent with the given metadata.
 	// This is called when a request is sent to the RREGISTER subject
@@ -8,7 +25,8 @@ type AgentRegistrar interface {
 	RegisterRemoteInit(headers map[string][]string, req *RegisterRemoteAgentRequest) error
 
 	// RegisterAgent registers a remote agent with the given metadata.
-	// This is called when a request is sent to the REGISTER subject
+	// This is called when a request is sent to the REGISTER subject by an agent
+	// the node did not start itself
 	// headers -> header map from the NATS request
 	// req -> request containing the agent register request data
 	RegisterAgent(headers map[string][]string, req *RegisterAgentRequest) error
@@ -1,5 +1,34 @@
 package models
 
+import "fmt"
+
 type Auctioneer interface {
 	Auction(namespace, agentType string, auctionTags map[string]string) error
 }
+
+// ResourceAuctioneer is implemented by auctioneers that decide on the resources
+// a workload declares. When implemented, it is called instead of Auction and
+// the error is returned to the client as the reason the node did not bid
+type ResourceAuctioneer interface {
+	AuctionResources(namespace, agentType string, auctionTags map[string]string, res *WorkloadResources) error
+}
+
+// WorkloadReserver is implemented by auctioneers that account for the workloads
+// a node deploys after it won an auction
+type WorkloadReserver interface {
+	// ReserveWorkload is called before the workload is started and fails when
+	// the workload no longer fits
+	ReserveWorkload(workloadID string, req *StartWorkloadRequest) error
+	// ReleaseWorkload is called when a reserved workload failed to start
+	ReleaseWorkload(namespace, workloadID string) error
+}
+
+// QuotaKey is the key of a namespace quota in the quota bucket
+func QuotaKey(namespace string) string {
+	return fmt.Sprintf("quota.%s", namespace)
+}
+
+// QuotaUsageKey is the key of the usage counted against a namespace quota
+func QuotaUsageKey(namespace string) string {
+	return fmt.Sprintf("usage.%s", namespace)
+}
@@ -0,0 +1,14 @@
+package models
+
+// DefaultAuditStream is the JetStream stream audit records are stored in
+const DefaultAuditStream = "NEX_AUDIT"
+
+// AuditActionRegisterAgent is the audit action recorded when an agent registers
+// with a node
+const AuditActionRegisterAgent = "register_agent"
+
+type AuditLog interface {
+	// RecordAudit stores a record of a control plane mutation. Records must not be
+	// changed or removed once stored
+	RecordAudit(rec AuditRecord) error
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"context"
+	"fmt"
+)
+
+// WorkloadScaler starts, stops and finds the instances of autoscaled workloads
+type WorkloadScaler interface {
+	JobLauncher
+	// ListInstances returns the IDs of the starting and running workloads of
+	// the namespace with the name
+	ListInstances(ctx context.Context, namespace, name string) ([]string, error)
+}
+
+// SigningInput returns the bytes the caller storing the policy signs: the
+// policy without its signature
+func (p AutoscalingPolicy) SigningInput() ([]byte, error) {
+	p.Signature = ""
+	return definitionSigningInput(&p)
+}
+
+// AutoscalingPolicyKey is the key of an autoscaling policy in the autoscaler
+// bucket
+func AutoscalingPolicyKey(namespace, name string) string {
+	return fmt.Sprintf("policies.%s.%s", namespace, name)
+}
+
+// AutoscalingStatusKey is the key of the last evaluation of an autoscaling
+// policy
+func AutoscalingStatusKey(namespace, name string) string {
+	return fmt.Sprintf("status.%s.%s", namespace, name)
+}
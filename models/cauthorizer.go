@@ -0,0 +1,103 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// Headers identifying the caller of a control API request. The caller signs
+// the input returned by ControlSigningInput with its user nkey
+const (
+	ControlCallerHeader    = "Nex-Caller"
+	ControlNonceHeader     = "Nex-Nonce"
+	ControlSignatureHeader = "Nex-Signature"
+)
+
+type ControlAction string
+
+const (
+	ControlActionPing        ControlAction = "ping"
+	ControlActionInfo        ControlAction = "info"
+	ControlActionLameduck    ControlAction = "lameduck"
+	ControlActionTags        ControlAction = "tags"
+	ControlActionAuction     ControlAction = "auction"
+	ControlActionDeploy      ControlAction = "deploy"
+	ControlActionUndeploy    ControlAction = "undeploy"
+	ControlActionClone       ControlAction = "clone"
+	ControlActionList        ControlAction = "list"
+	ControlActionSecretRead  ControlAction = "secret_read"
+	ControlActionSecretWrite ControlAction = "secret_write"
+	// ControlActionRenewCreds is requested by workloads renewing their own
+	// credentials, signed with the user nkey the credentials were minted for
+	ControlActionRenewCreds ControlAction = "renew_creds"
+)
+
+// ControlSignedHeaders are the request headers covered by the caller signature
+// because they change what a control request does
+var ControlSignedHeaders = []string{DryRunHeader, ExpectReplyHeader}
+
+type ControlAuthorizer interface {
+	// AuthorizeControl authorizes a control API request before it is handled.
+	// Node level actions (ping, info, lameduck, tags) are requested in the system namespace
+	// subject -> subject the request was sent to
+	// headers -> header map from the NATS request
+	// data -> request payload covered by the caller signature
+	// namespace -> namespace the request was sent to
+	// action -> action the request performs
+	// Returns the public key of the caller when its signature was verified, also
+	// when the request is denied, so the audit log only records verified callers
+	AuthorizeControl(subject string, headers map[string][]string, data []byte, namespace string, action ControlAction) (string, error)
+}
+
+// DefinitionAuthorizer is implemented by control authorizers that authorize the
+// callers of stored definitions, such as job schedules, whose workloads nodes
+// start long after the caller stored them
+type DefinitionAuthorizer interface {
+	// AuthorizeDefinition verifies the signature of the caller over the signing
+	// input of a definition and authorizes the caller for the action in the
+	// namespace. Definitions are authorized again before every start, so there
+	// is no nonce
+	AuthorizeDefinition(caller, signature string, input []byte, namespace string, action ControlAction) error
+}
+
+// NewControlNonce returns a nonce for a signed control request. Nonces start
+// with the unix time they were created at so stale requests can be rejected
+func NewControlNonce() string {
+	return fmt.Sprintf("%d.%s", time.Now().Unix(), nuid.Next())
+}
+
+// ControlSigningInput returns the bytes a caller signs for a control request:
+// the subject, the nonce and the signed headers, one per line, followed by the
+// request payload
+func ControlSigningInput(subject, nonce string, headers map[string][]string, data []byte) []byte {
+	var input bytes.Buffer
+	input.WriteString(subject + "\n")
+	input.WriteString(nonce + "\n")
+	for _, h := range ControlSignedHeaders {
+		input.WriteString(h + ":" + strings.Join(headers[h], ",") + "\n")
+	}
+	input.Write(data)
+	return input.Bytes()
+}
+
+// definitionSigningInput returns the JSON of a definition after a round trip
+// through its type, so the defaults applied when a node reads the definition
+// back do not change the input
+func definitionSigningInput[T any](def *T) ([]byte, error) {
+	defB, err := json.Marshal(def)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := new(T)
+	err = json.Unmarshal(defB, normalized)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(normalized)
+}
@@ -4,6 +4,7 @@ package models
 
 import "encoding/json"
 import "fmt"
+import "reflect"
 import "time"
 
 type AgentLameduckSetEvent struct {
@@ -204,6 +205,174 @@ func (j *NexNodeStoppedEvent) UnmarshalJSON(value []byte) error {
 	return nil
 }
 
+type NexNodeTagsUpdatedEvent struct {
+	// The unique identifier of the nex node
+	Id string `json:"id"`
+
+	// Placement tags associated with the nex node
+	Tags NodeTags `json:"tags"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *NexNodeTagsUpdatedEvent) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["id"]; raw != nil && !ok {
+		return fmt.Errorf("field id in NexNodeTagsUpdatedEvent: required")
+	}
+	if _, ok := raw["tags"]; raw != nil && !ok {
+		return fmt.Errorf("field tags in NexNodeTagsUpdatedEvent: required")
+	}
+	type Plain NexNodeTagsUpdatedEvent
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = NexNodeTagsUpdatedEvent(plain)
+	return nil
+}
+
+type WorkloadScaledEvent struct {
+	// Instances the autoscaling policy asked for
+	Desired int `json:"desired"`
+
+	// Whether instances were started or stopped
+	Direction WorkloadScaledEventDirection `json:"direction"`
+
+	// Why starting or stopping an instance failed
+	Error string `json:"error,omitempty"`
+
+	// Running instances before the decision
+	From int `json:"from"`
+
+	// Pending messages or metric value the decision was based on
+	MetricValue float64 `json:"metric_value"`
+
+	// The name of the scaled workload
+	Name string `json:"name"`
+
+	// The namespace of the workload
+	Namespace string `json:"namespace"`
+
+	// IDs of the instances started
+	Started []string `json:"started,omitempty"`
+
+	// IDs of the instances stopped
+	Stopped []string `json:"stopped,omitempty"`
+
+	// Running instances after the decision
+	To int `json:"to"`
+}
+
+type WorkloadScaledEventDirection string
+
+const WorkloadScaledEventDirectionIn WorkloadScaledEventDirection = "in"
+const WorkloadScaledEventDirectionOut WorkloadScaledEventDirection = "out"
+
+var enumValues_WorkloadScaledEventDirection = []interface{}{
+	"out",
+	"in",
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *WorkloadScaledEventDirection) UnmarshalJSON(value []byte) error {
+	var v string
+	if err := json.Unmarshal(value, &v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_WorkloadScaledEventDirection {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_WorkloadScaledEventDirection, v)
+	}
+	*j = WorkloadScaledEventDirection(v)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *WorkloadScaledEvent) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["desired"]; raw != nil && !ok {
+		return fmt.Errorf("field desired in WorkloadScaledEvent: required")
+	}
+	if _, ok := raw["direction"]; raw != nil && !ok {
+		return fmt.Errorf("field direction in WorkloadScaledEvent: required")
+	}
+	if _, ok := raw["from"]; raw != nil && !ok {
+		return fmt.Errorf("field from in WorkloadScaledEvent: required")
+	}
+	if _, ok := raw["metric_value"]; raw != nil && !ok {
+		return fmt.Errorf("field metric_value in WorkloadScaledEvent: required")
+	}
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in WorkloadScaledEvent: required")
+	}
+	if _, ok := raw["namespace"]; raw != nil && !ok {
+		return fmt.Errorf("field namespace in WorkloadScaledEvent: required")
+	}
+	if _, ok := raw["to"]; raw != nil && !ok {
+		return fmt.Errorf("field to in WorkloadScaledEvent: required")
+	}
+	type Plain WorkloadScaledEvent
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = WorkloadScaledEvent(plain)
+	return nil
+}
+
+type WorkloadSecretRotatedEvent struct {
+	// The unique identifier of the workload
+	Id string `json:"id"`
+
+	// The namespace of the workload
+	Namespace string `json:"namespace"`
+
+	// The key of the secret that was rotated
+	SecretKey string `json:"secret_key"`
+
+	// The type of the workload, e.g., 'container', 'javascript', etc
+	WorkloadType string `json:"workload_type"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *WorkloadSecretRotatedEvent) UnmarshalJSON(value []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["id"]; raw != nil && !ok {
+		return fmt.Errorf("field id in WorkloadSecretRotatedEvent: required")
+	}
+	if _, ok := raw["namespace"]; raw != nil && !ok {
+		return fmt.Errorf("field namespace in WorkloadSecretRotatedEvent: required")
+	}
+	if _, ok := raw["secret_key"]; raw != nil && !ok {
+		return fmt.Errorf("field secret_key in WorkloadSecretRotatedEvent: required")
+	}
+	if _, ok := raw["workload_type"]; raw != nil && !ok {
+		return fmt.Errorf("field workload_type in WorkloadSecretRotatedEvent: required")
+	}
+	type Plain WorkloadSecretRotatedEvent
+	var plain Plain
+	if err := json.Unmarshal(value, &plain); err != nil {
+		return err
+	}
+	*j = WorkloadSecretRotatedEvent(plain)
+	return nil
+}
+
 type WorkloadStartedEvent struct {
 	// The unique identifier of the workload
 	Id string `json:"id"`
@@ -325,11 +494,33 @@ type WorkloadTriggeredEvent struct {
 	// The duration of the workload execution in milliseconds
 	Duration float64 `json:"duration"`
 
+	// The error of a failed execution
+	Error string `json:"error,omitempty"`
+
+	// The exit status of the execution; 0 when it succeeded
+	ExitCode *int `json:"exit_code,omitempty"`
+
+	// The number of failed executions of the workload's triggers so far
+	Failures int `json:"failures,omitempty"`
+
 	// The unique identifier of the workload
 	Id string `json:"id"`
 
+	// The number of executions still running when this one finished
+	InFlight int `json:"in_flight,omitempty"`
+
+	// The number of executions of the workload's triggers so far, including this
+	// one
+	Invocations int `json:"invocations,omitempty"`
+
 	// The namespace of the workload
 	Namespace string `json:"namespace"`
+
+	// Whether the execution ran past the trigger deadline
+	TimedOut bool `json:"timed_out,omitempty"`
+
+	// The time the execution waited for a free invocation slot in milliseconds
+	WaitDuration float64 `json:"wait_duration,omitempty"`
 }
 
 // UnmarshalJSON implements json.Unmarshaler.
@@ -352,6 +543,21 @@ func (j *WorkloadTriggeredEvent) UnmarshalJSON(value []byte) error {
 	if err := json.Unmarshal(value, &plain); err != nil {
 		return err
 	}
+	if v, ok := raw["failures"]; !ok || v == nil {
+		plain.Failures = 0.0
+	}
+	if v, ok := raw["in_flight"]; !ok || v == nil {
+		plain.InFlight = 0.0
+	}
+	if v, ok := raw["invocations"]; !ok || v == nil {
+		plain.Invocations = 0.0
+	}
+	if v, ok := raw["timed_out"]; !ok || v == nil {
+		plain.TimedOut = false
+	}
+	if v, ok := raw["wait_duration"]; !ok || v == nil {
+		plain.WaitDuration = 0.0
+	}
 	*j = WorkloadTriggeredEvent(plain)
 	return nil
 }
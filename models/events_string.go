@@ -12,6 +12,10 @@ func (NexNodeLameduckSetEvent) String() string {
 	return "NODELAMEDUCKSET"
 }
 
+func (NexNodeTagsUpdatedEvent) String() string {
+	return "NODETAGSUPDATED"
+}
+
 func (AgentStartedEvent) String() string {
 	return "AGENTSTARTED"
 }
@@ -31,3 +35,15 @@ func (WorkloadStartedEvent) String() string {
 func (WorkloadStoppedEvent) String() string {
 	return "WORKLOADSTOPPED"
 }
+
+func (WorkloadSecretRotatedEvent) String() string {
+	return "WORKLOADSECRETROTATED"
+}
+
+func (WorkloadTriggeredEvent) String() string {
+	return "WORKLOADTRIGGERED"
+}
+
+func (WorkloadScaledEvent) String() string {
+	return "WORKLOADSCALED"
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultFunctionIdleTimeout is how long an instance of a lazy function may go
+// without an invocation before the activator stops it
+const DefaultFunctionIdleTimeout = 5 * time.Minute
+
+// SigningInput returns the bytes the caller storing the function signs: the
+// function without its signature
+func (f LazyFunction) SigningInput() ([]byte, error) {
+	f.Signature = ""
+	return definitionSigningInput(&f)
+}
+
+// LazyFunctionKey is the key of a lazy function in the function bucket
+func LazyFunctionKey(namespace, name string) string {
+	return fmt.Sprintf("functions.%s.%s", namespace, name)
+}
+
+// FunctionInstanceKey is the key of the running instance of a lazy function
+func FunctionInstanceKey(namespace, name string) string {
+	return fmt.Sprintf("instances.%s.%s", namespace, name)
+}
@@ -3,4 +3,21 @@ package models
 const (
 	NexGroupMetaKey     string = "synadia.com/group"
 	NexNamespaceMetaKey string = "synadia.com/namespace"
+
+	// DryRunHeader set to true on a deploy request validates the request, checks
+	// admission and quotas and mints credentials without starting the workload
+	DryRunHeader string = "Nex-Dry-Run"
+
+	// ExpectReplyHeader set to true on a request sent to every node asks nodes
+	// that would ignore the request to send an empty reply instead, so the
+	// caller can stop waiting once every live node has answered
+	ExpectReplyHeader string = "Nex-Expect-Reply"
+
+	// Headers added to a message of a stream trigger when it is sent to the
+	// dead-letter subject after its last delivery failed
+	TriggerErrorHeader      string = "Nex-Trigger-Error"
+	TriggerStreamHeader     string = "Nex-Trigger-Stream"
+	TriggerSubjectHeader    string = "Nex-Trigger-Subject"
+	TriggerSequenceHeader   string = "Nex-Trigger-Sequence"
+	TriggerDeliveriesHeader string = "Nex-Trigger-Deliveries"
 )
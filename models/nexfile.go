@@ -8,12 +8,45 @@ import (
 const NexfileName string = "Nexfile"
 
 type Nexfile struct {
-	Name         string            `json:"name" yaml:"name"`
-	Description  string            `json:"description" yaml:"description"`
-	AuctionTags  map[string]string `json:"tags" yaml:"tags"`
-	Type         string            `json:"type" yaml:"type"`
-	Lifecycle    string            `json:"lifecycle" yaml:"lifecycle"`
-	StartRequest any               `json:"start_request" yaml:"start_request"`
+	Name         string               `json:"name" yaml:"name"`
+	Description  string               `json:"description" yaml:"description"`
+	AuctionTags  map[string]string    `json:"tags" yaml:"tags"`
+	Constraints  []string             `json:"constraints,omitempty" yaml:"constraints,omitempty"`
+	Type         string               `json:"type" yaml:"type"`
+	Lifecycle    string               `json:"lifecycle" yaml:"lifecycle"`
+	StartRequest any                  `json:"start_request" yaml:"start_request"`
+	Permissions  *WorkloadPermissions `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+	Resources    *WorkloadResources   `json:"resources,omitempty" yaml:"resources,omitempty"`
+	Group        string               `json:"group,omitempty" yaml:"group,omitempty"`
+	Affinity     *WorkloadAffinity    `json:"affinity,omitempty" yaml:"affinity,omitempty"`
+	Schedule     *NexfileSchedule     `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+	Lazy         *NexfileLazy         `json:"lazy,omitempty" yaml:"lazy,omitempty"`
+	Autoscale    *NexfileAutoscale    `json:"autoscale,omitempty" yaml:"autoscale,omitempty"`
+}
+
+// NexfileSchedule runs a job on a cron schedule instead of once
+type NexfileSchedule struct {
+	Cron              string                       `json:"cron" yaml:"cron"`
+	Timezone          string                       `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+	ConcurrencyPolicy JobScheduleConcurrencyPolicy `json:"concurrency_policy,omitempty" yaml:"concurrency_policy,omitempty"`
+	HistoryLimit      int                          `json:"history_limit,omitempty" yaml:"history_limit,omitempty"`
+}
+
+// NexfileLazy starts a function on its first message instead of now
+type NexfileLazy struct {
+	IdleTimeout string `json:"idle_timeout,omitempty" yaml:"idle_timeout,omitempty"`
+}
+
+// NexfileAutoscale keeps between a minimum and maximum number of instances of
+// a service running instead of starting one
+type NexfileAutoscale struct {
+	MinInstances     *int                       `json:"min_instances,omitempty" yaml:"min_instances,omitempty"`
+	MaxInstances     int                        `json:"max_instances" yaml:"max_instances"`
+	Target           float64                    `json:"target" yaml:"target"`
+	Consumer         *AutoscalingPolicyConsumer `json:"consumer,omitempty" yaml:"consumer,omitempty"`
+	Metric           *AutoscalingPolicyMetric   `json:"metric,omitempty" yaml:"metric,omitempty"`
+	ScaleOutCooldown string                     `json:"scale_out_cooldown,omitempty" yaml:"scale_out_cooldown,omitempty"`
+	ScaleInCooldown  string                     `json:"scale_in_cooldown,omitempty" yaml:"scale_in_cooldown,omitempty"`
 }
 
 func (j *Nexfile) UnmarshalJSON(b []byte) error {
@@ -13,9 +13,27 @@ const (
 	TagLameDuck = "nex.lameduck"
 	TagNexus    = "nex.nexus"
 	TagNodeName = "nex.node"
+	// Host facts detected by the node
+	TagHostname      = "nex.hostname"
+	TagKernel        = "nex.kernel"
+	TagMemoryMB      = "nex.memory_mb"
+	TagDiskFreeMB    = "nex.disk_free_mb"
+	TagCgroupVersion = "nex.cgroup_version"
+	// TagAgentVersion is the version of the agent an auction is for. It is only
+	// set while matching auction constraints
+	TagAgentVersion = "nex.agent.version"
+	// TagWorkloadGroup is the workload tag naming the group a workload belongs
+	// to; affinity rules can select workloads by group
+	TagWorkloadGroup = "nex.group"
 
 	AgentEnvNatsUrl = "NEX_AGENT_NATS_URL"
 	AgentEnvNodeId  = "NEX_AGENT_NODE_ID"
 )
 
 var ReservedTagPrefixes = []string{"nex."}
+
+// AgentVersionTag is the attribute holding the version of the agent with the
+// given register type, e.g. nex.agent.native.version
+func AgentVersionTag(agentType string) string {
+	return "nex.agent." + agentType + ".version"
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"context"
+	"fmt"
+)
+
+// DefaultJobHistoryLimit is the number of finished runs kept for a schedule
+// without a history limit
+const DefaultJobHistoryLimit = 10
+
+// JobLauncher starts and stops the runs of job schedules and the instances of
+// lazy functions
+type JobLauncher interface {
+	// DeployJob auctions the job in its namespace and deploys it on a winning
+	// node. It returns once the node accepted the job
+	DeployJob(ctx context.Context, req *StartWorkloadRequest, constraints []string) (*StartWorkloadResponse, error)
+	// WaitForOperation waits until the deploy operation finished and returns its
+	// final status, with an error if the job failed to start
+	WaitForOperation(ctx context.Context, namespace, operationID string) (*OperationStatus, error)
+	// StopJob stops a running job
+	StopJob(ctx context.Context, namespace, workloadID string) error
+}
+
+// SigningInput returns the bytes the caller storing the schedule signs: the
+// schedule without its signature
+func (s JobSchedule) SigningInput() ([]byte, error) {
+	s.Signature = ""
+	return definitionSigningInput(&s)
+}
+
+// ScheduleKey is the key of a job schedule in the schedule bucket
+func ScheduleKey(namespace, name string) string {
+	return fmt.Sprintf("schedules.%s.%s", namespace, name)
+}
+
+// ScheduleTickKey is the key of the last tick a job schedule was run for
+func ScheduleTickKey(namespace, name string) string {
+	return fmt.Sprintf("ticks.%s.%s", namespace, name)
+}
+
+// JobRunKey is the key of a run of a job schedule
+func JobRunKey(namespace, name, runID string) string {
+	return fmt.Sprintf("runs.%s.%s.%s", namespace, name, runID)
+}
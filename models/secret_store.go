@@ -1,9 +1,32 @@
 package models
 
+import "context"
+
 const (
 	NexSecretPrefix = "secret://"
+
+	SecretOperationPut    = "PUT"
+	SecretOperationGet    = "GET"
+	SecretOperationList   = "LIST"
+	SecretOperationDelete = "DELETE"
 )
 
 type SecretStore interface {
 	GetSecret(namespace string, secretID string) ([]byte, error)
 }
+
+// SecretManager is a SecretStore that can also be written to. Nodes configured
+// with a SecretManager expose it on the secret control API for the CLI
+type SecretManager interface {
+	SecretStore
+	PutSecret(namespace, secretID string, value []byte) (uint64, error)
+	DeleteSecret(namespace, secretID string) error
+	ListSecrets(namespace string) ([]string, error)
+}
+
+// SecretWatcher is a SecretStore that can notify when secrets change. Updates are
+// delivered until the context is cancelled
+type SecretWatcher interface {
+	SecretStore
+	WatchSecrets(ctx context.Context) (<-chan SecretUpdate, error)
+}
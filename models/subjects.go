@@ -12,9 +12,11 @@ var (
 	AgentAPIPrefix   = func(ns string) string { return fmt.Sprintf("$NEX.SVC.%s.agent", ns) }
 
 	// Feeds
-	LogAPIPrefix     = func(ns string) string { return fmt.Sprintf("$NEX.FEED.%s.logs", ns) }
-	MetricsAPIPrefix = func(ns string) string { return fmt.Sprintf("$NEX.FEED.%s.metrics", ns) }
-	EventAPIPrefix   = func(ns string) string { return fmt.Sprintf("$NEX.FEED.%s.events", ns) }
+	LogAPIPrefix       = func(ns string) string { return fmt.Sprintf("$NEX.FEED.%s.logs", ns) }
+	MetricsAPIPrefix   = func(ns string) string { return fmt.Sprintf("$NEX.FEED.%s.metrics", ns) }
+	EventAPIPrefix     = func(ns string) string { return fmt.Sprintf("$NEX.FEED.%s.events", ns) }
+	AuditAPIPrefix     = func(ns string) string { return fmt.Sprintf("$NEX.FEED.%s.audit", ns) }
+	OperationAPIPrefix = func(ns string) string { return fmt.Sprintf("$NEX.FEED.%s.operations", ns) }
 )
 
 // $NEX.SVC.namespace.control.PING
@@ -32,6 +34,21 @@ func NodeEmitHeartbeatSubject(inNodeId string) string {
 	return fmt.Sprintf("%s.HEARTBEAT.%s", ControlAPIPrefix(NodeSystemNamespace), inNodeId)
 }
 
+// $NEX.SVC.system.control.HEARTBEAT.*
+func NodeHeartbeatSubscribeSubject() string {
+	return fmt.Sprintf("%s.HEARTBEAT.*", ControlAPIPrefix(NodeSystemNamespace))
+}
+
+// $NEX.SVC.namespace.control.MEMBERSHIP
+func MembershipRequestSubject(inNamespace string) string {
+	return fmt.Sprintf("%s.MEMBERSHIP", ControlAPIPrefix(inNamespace))
+}
+
+// $NEX.SVC.*.control.MEMBERSHIP
+func MembershipSubscribeSubject() string {
+	return fmt.Sprintf("%s.MEMBERSHIP", ControlAPIPrefix("*"))
+}
+
 // $NEX.SVC.namespace.control.LAMEDUCK.nodeid
 func LameduckRequestSubject(inNamespace, inNodeId string) string {
 	return fmt.Sprintf("%s.LAMEDUCK.%s", ControlAPIPrefix(inNamespace), inNodeId)
@@ -42,6 +59,16 @@ func LameduckSubscribeSubject(inNodeId string) string {
 	return fmt.Sprintf("%s.LAMEDUCK.%s", ControlAPIPrefix(NodeSystemNamespace), inNodeId)
 }
 
+// $NEX.SVC.namespace.control.TAGS.nodeid
+func NodeTagsRequestSubject(inNamespace, inNodeId string) string {
+	return fmt.Sprintf("%s.TAGS.%s", ControlAPIPrefix(inNamespace), inNodeId)
+}
+
+// $NEX.SVC.system.control.TAGS.nodeid
+func NodeTagsSubscribeSubject(inNodeId string) string {
+	return fmt.Sprintf("%s.TAGS.%s", ControlAPIPrefix(NodeSystemNamespace), inNodeId)
+}
+
 // $NEX.SVC.namespace.control.PING.nodeid
 func DirectPingRequestSubject(inNamespace, inNodeId string) string {
 	return fmt.Sprintf("%s.PING.%s", ControlAPIPrefix(inNamespace), inNodeId)
@@ -126,3 +153,48 @@ func NamespacePingSubscribeSubject() string {
 func WorkloadPingSubscribeSubject() string {
 	return fmt.Sprintf("%s.WPING.*", ControlAPIPrefix("*"))
 }
+
+// $NEX.SVC.namespace.control.SECRET.operation
+func SecretRequestSubject(inNS, inOperation string) string {
+	return fmt.Sprintf("%s.SECRET.%s", ControlAPIPrefix(inNS), inOperation)
+}
+
+// $NEX.SVC.*.control.SECRET.*
+func SecretSubscribeSubject() string {
+	return fmt.Sprintf("%s.SECRET.*", ControlAPIPrefix("*"))
+}
+
+// $NEX.SVC.namespace.control.RENEWCREDS.nodeid.workloadid
+func RenewWorkloadCredsRequestSubject(inNS, inNodeId, inWorkloadId string) string {
+	return fmt.Sprintf("%s.RENEWCREDS.%s.%s", ControlAPIPrefix(inNS), inNodeId, inWorkloadId)
+}
+
+// $NEX.SVC.*.control.RENEWCREDS.nodeid.*
+func RenewWorkloadCredsSubscribeSubject(inNodeId string) string {
+	return fmt.Sprintf("%s.RENEWCREDS.%s.*", ControlAPIPrefix("*"), inNodeId)
+}
+
+// $NEX.FEED.namespace.audit.action
+func AuditRecordSubject(inNS, inAction string) string {
+	return fmt.Sprintf("%s.%s", AuditAPIPrefix(inNS), inAction)
+}
+
+// $NEX.FEED.*.audit.>
+func AuditSubscribeSubject() string {
+	return fmt.Sprintf("%s.>", AuditAPIPrefix("*"))
+}
+
+// $NEX.FEED.namespace.operations.operationid
+func OperationSubject(inNS, inOperationId string) string {
+	return fmt.Sprintf("%s.%s", OperationAPIPrefix(inNS), inOperationId)
+}
+
+// $NEX.SVC.namespace.control.OPERATION.operationid
+func OperationStatusRequestSubject(inNS, inOperationId string) string {
+	return fmt.Sprintf("%s.OPERATION.%s", ControlAPIPrefix(inNS), inOperationId)
+}
+
+// $NEX.SVC.*.control.OPERATION.*
+func OperationStatusSubscribeSubject() string {
+	return fmt.Sprintf("%s.OPERATION.*", ControlAPIPrefix("*"))
+}
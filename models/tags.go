@@ -0,0 +1,12 @@
+package models
+
+import "context"
+
+// TagProvider supplies node tags that the node refreshes periodically, so
+// auctions and constraints see current values. Tags of providers passed to
+// the node may not use a reserved prefix
+type TagProvider interface {
+	// Tags returns the current tags of the provider. On error the node keeps
+	// the tags from the last successful call
+	Tags(ctx context.Context) (map[string]string, error)
+}
@@ -1,5 +1,7 @@
 package models
 
+import "errors"
+
 type CredType int
 
 const (
@@ -7,7 +9,33 @@ const (
 	WorkloadCred
 )
 
+// ErrCredentialsNotFound is returned when renewing credentials that were not
+// issued by the vendor
+var ErrCredentialsNotFound = errors.New("workload credentials not found")
+
 type CredVendor interface {
 	MintRegister(agentId, nodeId string) (*NatsConnectionData, error)
 	Mint(typ CredType, namespace, id string) (*NatsConnectionData, error)
 }
+
+// CredRenewer is a CredVendor that issues expiring workload credentials. Renew
+// re-signs the credentials presented by a running workload as userJwt
+type CredRenewer interface {
+	CredVendor
+	Renew(namespace, id, userJwt string) (*NatsConnectionData, error)
+}
+
+// ScopedCredVendor is a CredVendor that can limit workload credentials to the
+// permissions a workload requested. CheckPermissions rejects requests that are
+// broader than the namespace policy
+type ScopedCredVendor interface {
+	CredVendor
+	CheckPermissions(namespace string, perms *WorkloadPermissions) error
+	MintScoped(namespace, id string, perms *WorkloadPermissions) (*NatsConnectionData, error)
+}
+
+// NamespacePolicyStore provides the permissions template for workload credentials
+// in a namespace. A nil policy without error means the namespace has no policy
+type NamespacePolicyStore interface {
+	GetNamespacePolicy(namespace string) (*NamespacePolicy, error)
+}
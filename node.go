@@ -14,11 +14,15 @@ import (
 
 	"github.com/synadia-io/nex/internal"
 	"github.com/synadia-io/nex/internal/aregistrar"
+	"github.com/synadia-io/nex/internal/audit"
+	"github.com/synadia-io/nex/internal/cauthorizer"
 	"github.com/synadia-io/nex/internal/credentials"
 	eventemitter "github.com/synadia-io/nex/internal/event_emitter"
 	"github.com/synadia-io/nex/internal/idgen"
+	"github.com/synadia-io/nex/internal/scheduler"
 	secretstore "github.com/synadia-io/nex/internal/secret_store"
 	"github.com/synadia-io/nex/internal/state"
+	"github.com/synadia-io/nex/internal/tagprovider"
 	"github.com/synadia-io/nex/models"
 
 	"github.com/nats-io/nats-server/v2/server"
@@ -55,6 +59,12 @@ type (
 		nexus     string
 		tags      map[string]string
 		nodeState models.NodeState
+		// Tags refreshed from providers, starting with the host facts
+		tagSources         []*tagSource
+		tagRefreshInterval time.Duration
+		tagsMu             sync.RWMutex
+		// Directory the free disk space is reported for
+		resourceDir string
 
 		agentRestartLimit int
 		// Embedded agents
@@ -65,14 +75,31 @@ type (
 
 		// List of active agents
 		registeredAgents *internal.AgentRegistrations
+		// IDs of the agents started by this node
+		launchedAgents   map[string]struct{}
+		launchedAgentsMu sync.RWMutex
 
 		minter       models.CredVendor
 		state        models.NexNodeState
 		auctioneer   models.Auctioneer
+		admitters    []models.WorkloadAdmitter
 		idgen        models.IDGen
 		aregistrar   models.AgentRegistrar
+		cauthorizer  models.ControlAuthorizer
+		auditLog     models.AuditLog
 		secretStore  models.SecretStore
 		eventEmitter models.EventEmitter
+		// Bucket of the job schedules this node runs when it holds the lease
+		scheduleBucket   string
+		scheduleLauncher models.WorkloadScaler
+		// Bucket of the lazy functions this node activates when it holds the
+		// lease
+		functionBucket   string
+		functionLauncher models.JobLauncher
+		// Bucket of the autoscaling policies this node evaluates when it holds
+		// the lease
+		autoscaleBucket string
+		autoscaleScaler models.WorkloadScaler
 
 		nc          *nats.Conn
 		service     micro.Service
@@ -80,6 +107,18 @@ type (
 		server      *server.Server
 		serverCreds *models.NatsConnectionData
 
+		// Accepted deploys waiting for a worker to start them
+		deployQueue     chan *deployJob
+		deployStop      chan struct{}
+		deployQueueSize int
+		deployWorkers   int
+		operations      map[string]*operation
+		operationsMu    sync.RWMutex
+
+		// Last heartbeat of every other live node
+		members   map[string]time.Time
+		membersMu sync.Mutex
+
 		nodeShutdown          chan struct{}
 		shutdownMu            sync.RWMutex
 		shutdownDueToLameduck bool
@@ -91,6 +130,8 @@ const (
 	defaultNexNodeNexus          = "nexus"
 	defaultAuctionTTLMapDuration = time.Second * 10
 	defaultAgentWatcherRestarts  = 3
+	defaultDeployWorkers         = 4
+	defaultDeployQueueSize       = 64
 )
 
 func NewNexNode(opts ...NexNodeOption) (*NexNode, error) {
@@ -126,12 +167,15 @@ func NewNexNode(opts ...NexNodeOption) (*NexNode, error) {
 		agentRestartLimit: defaultAgentWatcherRestarts,
 		embeddedRunners:   make([]*sdk.Runner, 0),
 		localRunners:      make([]*internal.AgentProcess, 0),
+		launchedAgents:    make(map[string]struct{}),
 
 		minter:       &credentials.FullAccessMinter{NatsServers: []string{nats.DefaultURL}},
 		state:        &state.NoState{},
 		auctioneer:   nil,
 		idgen:        idgen.NewNuidGen(),
 		aregistrar:   &aregistrar.AllowAllRegistrar{},
+		cauthorizer:  &cauthorizer.AllowAllAuthorizer{},
+		auditLog:     &audit.NoAudit{},
 		secretStore:  &secretstore.NoStore{},
 		eventEmitter: &eventemitter.NoEmit{},
 
@@ -143,6 +187,14 @@ func NewNexNode(opts ...NexNodeOption) (*NexNode, error) {
 		nc:     nil,
 		server: nil,
 
+		deployStop:      make(chan struct{}),
+		deployQueueSize: defaultDeployQueueSize,
+		deployWorkers:   defaultDeployWorkers,
+
+		tagRefreshInterval: defaultTagRefreshInterval,
+		operations:         make(map[string]*operation),
+		members:            make(map[string]time.Time),
+
 		nodeShutdown: make(chan struct{}, 1),
 	}
 
@@ -162,8 +214,10 @@ func NewNexNode(opts ...NexNodeOption) (*NexNode, error) {
 	}
 
 	n.ctx, n.cancel = context.WithCancel(n.ctx)
+	n.deployQueue = make(chan *deployJob, n.deployQueueSize)
 	n.tags[models.TagNexus] = n.nexus
 	n.tags[models.TagNodeName] = n.name
+	n.tagSources = append([]*tagSource{{provider: tagprovider.NewHostFactsProvider(n.resourceDir), reserved: true}}, n.tagSources...)
 
 	pubKey, err := n.nodeKeypair.PublicKey()
 	if err != nil {
@@ -232,6 +286,9 @@ func (n *NexNode) Start() error {
 		return err
 	}
 
+	// the first auction already sees the host facts and provided tags
+	n.refreshTags()
+
 	n.service, err = micro.AddService(n.nc, micro.Config{
 		Name:        "nexnode",
 		Version:     n.version,
@@ -246,20 +303,33 @@ func (n *NexNode) Start() error {
 	errs = errors.Join(errs, n.service.AddEndpoint("PingNexus", micro.HandlerFunc(n.handlePing()), micro.WithEndpointSubject(models.PingSubscribeSubject()), micro.WithEndpointQueueGroup(n.id)))
 	errs = errors.Join(errs, n.service.AddEndpoint("PingNode", micro.HandlerFunc(n.handlePing()), micro.WithEndpointSubject(models.DirectPingSubscribeSubject(n.id)), micro.WithEndpointQueueGroup(n.id)))
 	errs = errors.Join(errs, n.service.AddEndpoint("GetNodeInfo", micro.HandlerFunc(n.handleNodeInfo()), micro.WithEndpointSubject(models.NodeInfoSubscribeSubject(n.id)), micro.WithEndpointQueueGroup(n.id)))
-	errs = errors.Join(errs, n.service.AddEndpoint("SetLameduck", micro.HandlerFunc(n.handleLameduck()), micro.WithEndpointSubject(models.LameduckSubscribeSubject(n.id)), micro.WithEndpointQueueGroup(n.id)))
+	errs = errors.Join(errs, n.service.AddEndpoint("SetLameduck", micro.HandlerFunc(n.audited(string(models.ControlActionLameduck), n.handleLameduck())), micro.WithEndpointSubject(models.LameduckSubscribeSubject(n.id)), micro.WithEndpointQueueGroup(n.id)))
+	errs = errors.Join(errs, n.service.AddEndpoint("SetTags", micro.HandlerFunc(n.audited(string(models.ControlActionTags), n.handleTags())), micro.WithEndpointSubject(models.NodeTagsSubscribeSubject(n.id)), micro.WithEndpointQueueGroup(n.id)))
 	errs = errors.Join(errs, n.service.AddEndpoint("GetAgentIdByName", micro.HandlerFunc(n.handleGetAgentIDByName()), micro.WithEndpointSubject(models.GetAgentIdByNameSubject(n.id)), micro.WithEndpointQueueGroup(n.id)))
 	// System only agent endpoints
 	if n.allowRemoteAgentRegistration {
 		n.logger.Warn("remote registration enabled. agents can remotely register to this node")
-		errs = errors.Join(errs, n.service.AddEndpoint("RegisterRemoteAgent", micro.HandlerFunc(n.handleRegisterRemoteAgent()), micro.WithEndpointSubject(models.AgentAPIInitRemoteRegisterSubscribeSubject(n.nexus)), micro.WithEndpointQueueGroup(n.nexus)))
+		errs = errors.Join(errs, n.service.AddEndpoint("RegisterRemoteAgent", micro.HandlerFunc(n.audited(models.AuditActionRegisterAgent, n.handleRegisterRemoteAgent())), micro.WithEndpointSubject(models.AgentAPIInitRemoteRegisterSubscribeSubject(n.nexus)), micro.WithEndpointQueueGroup(n.nexus)))
 	}
-	errs = errors.Join(errs, n.service.AddEndpoint("RegisterAgent", micro.HandlerFunc(n.handleRegisterAgent()), micro.WithEndpointSubject(models.AgentAPIRegisterSubscribeSubject(n.id)), micro.WithEndpointQueueGroup(n.id)))
+	errs = errors.Join(errs, n.service.AddEndpoint("RegisterAgent", micro.HandlerFunc(n.audited(models.AuditActionRegisterAgent, n.handleRegisterAgent())), micro.WithEndpointSubject(models.AgentAPIRegisterSubscribeSubject(n.id)), micro.WithEndpointQueueGroup(n.id)))
+	errs = errors.Join(errs, n.service.AddEndpoint("AgentSecret", micro.HandlerFunc(n.handleAgentSecret()), micro.WithEndpointSubject(models.AgentAPISecretSubscribeSubject(n.id)), micro.WithEndpointQueueGroup(n.id)))
+	errs = errors.Join(errs, n.service.AddEndpoint("AgentOperation", micro.HandlerFunc(n.handleAgentOperation()), micro.WithEndpointSubject(models.AgentAPIOperationSubscribeSubject(n.id)), micro.WithEndpointQueueGroup(n.id)))
 	// User endpoints
 	errs = errors.Join(errs, n.service.AddEndpoint("AuctionRequest", micro.HandlerFunc(n.handleAuction()), micro.WithEndpointSubject(models.AuctionSubscribeSubject()), micro.WithEndpointQueueGroup(n.id)))
-	errs = errors.Join(errs, n.service.AddEndpoint("StopWorkload", micro.HandlerFunc(n.handleStopWorkload()), micro.WithEndpointSubject(models.UndeploySubscribeSubject()), micro.WithEndpointQueueGroup(n.id)))
-	errs = errors.Join(errs, n.service.AddEndpoint("AuctionDeployWorkload", micro.HandlerFunc(n.handleAuctionDeployWorkload()), micro.WithEndpointSubject(models.AuctionDeploySubscribeSubject()), micro.WithEndpointQueueGroup(n.id)))
-	errs = errors.Join(errs, n.service.AddEndpoint("CloneWorkload", micro.HandlerFunc(n.handleCloneWorkload()), micro.WithEndpointSubject(models.CloneWorkloadSubscribeSubject()), micro.WithEndpointQueueGroup(n.id)))
+	errs = errors.Join(errs, n.service.AddEndpoint("StopWorkload", micro.HandlerFunc(n.audited(string(models.ControlActionUndeploy), n.handleStopWorkload())), micro.WithEndpointSubject(models.UndeploySubscribeSubject()), micro.WithEndpointQueueGroup(n.id)))
+	errs = errors.Join(errs, n.service.AddEndpoint("AuctionDeployWorkload", micro.HandlerFunc(n.audited(string(models.ControlActionDeploy), n.handleAuctionDeployWorkload())), micro.WithEndpointSubject(models.AuctionDeploySubscribeSubject()), micro.WithEndpointQueueGroup(n.id)))
+	errs = errors.Join(errs, n.service.AddEndpoint("CloneWorkload", micro.HandlerFunc(n.audited(string(models.ControlActionClone), n.handleCloneWorkload())), micro.WithEndpointSubject(models.CloneWorkloadSubscribeSubject()), micro.WithEndpointQueueGroup(n.id)))
+	errs = errors.Join(errs, n.service.AddEndpoint("OperationStatus", micro.HandlerFunc(n.handleOperationStatus()), micro.WithEndpointSubject(models.OperationStatusSubscribeSubject()), micro.WithEndpointQueueGroup(n.id)))
+	errs = errors.Join(errs, n.service.AddEndpoint("Membership", micro.HandlerFunc(n.handleMembership()), micro.WithEndpointSubject(models.MembershipSubscribeSubject()), micro.WithEndpointQueueGroup(n.nexus)))
 	errs = errors.Join(errs, n.service.AddEndpoint("NamespacePingRequest", micro.HandlerFunc(n.handleNamespacePing()), micro.WithEndpointSubject(models.NamespacePingSubscribeSubject()), micro.WithEndpointQueueGroup(n.id)))
+	if sm, ok := n.secretStore.(models.SecretManager); ok {
+		// Secrets are shared by the nexus; only one node needs to handle each request
+		errs = errors.Join(errs, n.service.AddEndpoint("SecretRequest", micro.HandlerFunc(n.audited(string(models.ControlActionSecretWrite), n.handleSecret(sm))), micro.WithEndpointSubject(models.SecretSubscribeSubject()), micro.WithEndpointQueueGroup(n.nexus)))
+	}
+	if cr, ok := n.minter.(models.CredRenewer); ok {
+		// Workloads renew their credentials with the node that minted them
+		errs = errors.Join(errs, n.service.AddEndpoint("RenewWorkloadCreds", micro.HandlerFunc(n.handleRenewWorkloadCreds(cr)), micro.WithEndpointSubject(models.RenewWorkloadCredsSubscribeSubject(n.id)), micro.WithEndpointQueueGroup(n.id)))
+	}
 
 	if errs != nil {
 		return errs
@@ -269,13 +339,51 @@ func (n *NexNode) Start() error {
 		Id:    n.id,
 		Name:  n.name,
 		Nexus: n.nexus,
-		Tags:  n.tags,
+		Tags:  n.nodeTags(),
 		Type:  "io.synadia.nex.event.nexnode_started",
 	})
 	if err != nil {
 		n.logger.Error("failed to emit nex node started event", slog.String("err", err.Error()))
 	}
+	err = n.watchMembership()
+	if err != nil {
+		return err
+	}
 	go n.heartbeat()
+	go n.watchTags()
+
+	for range n.deployWorkers {
+		go n.deployWorker()
+	}
+
+	if sw, ok := n.secretStore.(models.SecretWatcher); ok {
+		go n.watchSecrets(sw)
+	}
+	go n.watchSecretAccess()
+
+	if n.scheduleBucket != "" {
+		s, err := scheduler.NewScheduler(n.ctx, n.nc, n.scheduleBucket, n.id, n.scheduleLauncher, n.cauthorizer, n.logger.WithGroup("scheduler"))
+		if err != nil {
+			return err
+		}
+		go s.Run()
+	}
+
+	if n.functionBucket != "" {
+		a, err := scheduler.NewActivator(n.ctx, n.nc, n.functionBucket, n.id, n.functionLauncher, n.cauthorizer, n.logger.WithGroup("activator"))
+		if err != nil {
+			return err
+		}
+		go a.Run()
+	}
+
+	if n.autoscaleBucket != "" {
+		a, err := scheduler.NewAutoscaler(n.ctx, n.nc, n.autoscaleBucket, n.id, n.autoscaleScaler, n.cauthorizer, n.eventEmitter, n.logger.WithGroup("autoscaler"))
+		if err != nil {
+			return err
+		}
+		go a.Run()
+	}
 
 	for _, e := range n.service.Info().Endpoints {
 		if e.QueueGroup != micro.DefaultQueueGroup {
@@ -293,6 +401,7 @@ func (n *NexNode) Start() error {
 			n.logger.Error("failed to mint register", slog.String("err", err.Error()))
 			continue
 		}
+		n.trackLaunchedAgent(id)
 		go n.agentWatcher.StartEmbeddedAgent(id, runner, connData)
 	}
 
@@ -305,6 +414,7 @@ func (n *NexNode) Start() error {
 			n.logger.Error("failed to mint register", slog.String("err", err.Error()))
 			continue
 		}
+		n.trackLaunchedAgent(agentProcess.ID)
 		go n.agentWatcher.StartLocalBinaryAgent(agentProcess, connData)
 	}
 
@@ -318,6 +428,21 @@ func (n *NexNode) Start() error {
 	return nil
 }
 
+// trackLaunchedAgent remembers an agent started by this node so its
+// registration skips the agent registrar
+func (n *NexNode) trackLaunchedAgent(agentID string) {
+	n.launchedAgentsMu.Lock()
+	defer n.launchedAgentsMu.Unlock()
+	n.launchedAgents[agentID] = struct{}{}
+}
+
+func (n *NexNode) isLaunchedAgent(agentID string) bool {
+	n.launchedAgentsMu.RLock()
+	defer n.launchedAgentsMu.RUnlock()
+	_, ok := n.launchedAgents[agentID]
+	return ok
+}
+
 func (n *NexNode) IsReady() bool {
 	return n.nodeState == models.NodeStateRunning
 }
@@ -335,13 +460,23 @@ func (n *NexNode) Shutdown() error {
 	}
 	n.nodeState = models.NodeStateStopping
 
+	// workers finish the deploy they are running; queued deploys are failed
+	// once the service stops accepting new ones
+	close(n.deployStop)
+
 	n.agentWatcher.Shutdown()
 
+	if n.nc != nil && !n.nc.IsClosed() {
+		n.publishHeartbeat(true)
+	}
+
 	err := n.service.Stop()
 	if err != nil {
 		n.logger.Error("failed to stop micro service", slog.String("err", err.Error()))
 	}
 
+	n.cancelQueuedDeploys()
+
 	pubKey, err := n.nodeKeypair.PublicKey()
 	if err != nil {
 		n.logger.Error("failed to get node public key", slog.String("err", err.Error()))
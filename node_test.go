@@ -3,24 +3,33 @@ package nex
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"io"
 	"log/slog"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/carlmjohnson/be"
+	"github.com/nats-io/jwt/v2"
 	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
 	"github.com/nats-io/nkeys"
 	"github.com/nats-io/nuid"
 	sdk "github.com/synadia-io/nex/sdk/go/agent"
 	tminter "github.com/synadia-io/nex/_test/minter"
 	inmem "github.com/synadia-io/nex/_test/nexlet_inmem"
 	"github.com/synadia-io/nex/internal"
+	"github.com/synadia-io/nex/internal/aregistrar"
+	"github.com/synadia-io/nex/internal/cauthorizer"
+	"github.com/synadia-io/nex/internal/credentials"
+	eventemitter "github.com/synadia-io/nex/internal/event_emitter"
+	secretstore "github.com/synadia-io/nex/internal/secret_store"
 	"github.com/synadia-io/nex/internal/state"
 	"github.com/synadia-io/nex/models"
 )
@@ -149,8 +158,8 @@ func TestNodeStartStop(t *testing.T) {
 	}
 
 	be.Equal(t, 1, nn.registeredAgents.Count())
-	be.Equal(t, 21, nc.NumSubscriptions())
-	be.Equal(t, models.NodeStateRunning, nn.nodeState)
+	be.Equal(t, 27, nc.NumSubscriptions())
+	be.True(t, nn.IsReady())
 
 	cancel()
 	be.NilErr(t, nn.WaitForShutdown())
@@ -243,6 +252,246 @@ func TestNodeInfoHandler(t *testing.T) {
 	be.Equal(t, "false", resp.Tags["nex.lameduck"])
 }
 
+type testAuditLog struct {
+	mu      sync.Mutex
+	records []models.AuditRecord
+}
+
+func (a *testAuditLog) RecordAudit(rec models.AuditRecord) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.records = append(a.records, rec)
+	return nil
+}
+
+func TestNodeControlAuthorizer(t *testing.T) {
+	s := startNatsServer(t)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	kp, err := nkeys.CreateServer()
+	be.NilErr(t, err)
+
+	pub, err := kp.PublicKey()
+	be.NilErr(t, err)
+
+	userKp, err := nkeys.CreateUser()
+	be.NilErr(t, err)
+
+	userPub, err := userKp.PublicKey()
+	be.NilErr(t, err)
+
+	authorizer, err := cauthorizer.NewPolicyAuthorizer(&cauthorizer.ControlPolicy{
+		Users: []cauthorizer.ControlPolicyUser{
+			{Name: "ops", Nkey: userPub, Namespaces: []string{models.SystemNamespace}, Actions: []models.ControlAction{models.ControlActionInfo}},
+		},
+	})
+	be.NilErr(t, err)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	auditLog := new(testAuditLog)
+
+	xkp, err := nkeys.CreateCurveKeys()
+	be.NilErr(t, err)
+	store, err := secretstore.NewNatsKVSecretStore(nc, "nex-secrets", xkp, logger)
+	be.NilErr(t, err)
+
+	nn, err := NewNexNode(
+		WithNatsConn(nc),
+		WithLogger(logger),
+		WithNodeKeyPair(kp),
+		WithControlAuthorizer(authorizer),
+		WithAuditLog(auditLog),
+		WithSecretStore(store),
+	)
+	be.NilErr(t, err)
+
+	be.NilErr(t, nn.Start())
+	defer func() {
+		be.NilErr(t, nn.Shutdown())
+	}()
+
+	for !nn.IsReady() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	signed := func(subject string, data []byte) *nats.Msg {
+		nonce := models.NewControlNonce()
+		msg := nats.NewMsg(subject)
+		msg.Data = data
+		sig, err := userKp.Sign(models.ControlSigningInput(subject, nonce, msg.Header, data))
+		be.NilErr(t, err)
+
+		msg.Header.Set(models.ControlCallerHeader, userPub)
+		msg.Header.Set(models.ControlNonceHeader, nonce)
+		msg.Header.Set(models.ControlSignatureHeader, base64.RawURLEncoding.EncodeToString(sig))
+		return msg
+	}
+
+	unsigned, err := nc.Request(models.NodeInfoRequestSubject(models.SystemNamespace, pub), []byte{}, time.Second)
+	be.NilErr(t, err)
+	be.Nonzero(t, unsigned.Header.Get(micro.ErrorHeader))
+
+	// the signature covers the subject the request was signed for
+	redirected := signed(models.NodeInfoRequestSubject(models.SystemNamespace, "other"), []byte{})
+	redirected.Subject = models.NodeInfoRequestSubject(models.SystemNamespace, pub)
+	redirectedResp, err := nc.RequestMsg(redirected, time.Second)
+	be.NilErr(t, err)
+	be.Nonzero(t, redirectedResp.Header.Get(micro.ErrorHeader))
+
+	nodeInfo, err := nc.RequestMsg(signed(models.NodeInfoRequestSubject(models.SystemNamespace, pub), []byte{}), time.Second)
+	be.NilErr(t, err)
+	be.Zero(t, nodeInfo.Header.Get(micro.ErrorHeader))
+
+	resp := models.NodeInfoResponse{}
+	be.NilErr(t, json.Unmarshal(nodeInfo.Data, &resp))
+	be.Equal(t, pub, resp.NodeId)
+
+	// the user may not ping the nexus, so membership is not shared
+	membership, err := nc.RequestMsg(signed(models.MembershipRequestSubject(models.SystemNamespace), nil), time.Second)
+	be.NilErr(t, err)
+	be.Nonzero(t, membership.Header.Get(micro.ErrorHeader))
+
+	// the user is not allowed to put the node in lameduck mode
+	ldReqB, err := json.Marshal(models.LameduckRequest{Delay: "1m"})
+	be.NilErr(t, err)
+	lameduck, err := nc.RequestMsg(signed(models.LameduckRequestSubject(models.SystemNamespace, pub), ldReqB), time.Second)
+	be.NilErr(t, err)
+	be.Nonzero(t, lameduck.Header.Get(micro.ErrorHeader))
+	be.True(t, nn.IsReady())
+
+	// an unsigned request claiming to be the user is not audited as the user
+	forged := nats.NewMsg(models.LameduckRequestSubject(models.SystemNamespace, pub))
+	forged.Data = ldReqB
+	forged.Header.Set(models.ControlCallerHeader, userPub)
+	forgedResp, err := nc.RequestMsg(forged, time.Second)
+	be.NilErr(t, err)
+	be.Nonzero(t, forgedResp.Header.Get(micro.ErrorHeader))
+
+	// a denied secret read is audited as a read
+	secretReqB, err := json.Marshal(models.SecretRequest{Key: "dbpass"})
+	be.NilErr(t, err)
+	secretResp, err := nc.RequestMsg(signed(models.SecretRequestSubject("user", models.SecretOperationGet), secretReqB), time.Second)
+	be.NilErr(t, err)
+	be.Nonzero(t, secretResp.Header.Get(micro.ErrorHeader))
+
+	// denied requests are audited once the handler returns, reads are not
+	auditLog.mu.Lock()
+	defer auditLog.mu.Unlock()
+	for i := 0; len(auditLog.records) < 3 && i < 20; i++ {
+		auditLog.mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		auditLog.mu.Lock()
+	}
+	be.Equal(t, 3, len(auditLog.records))
+	be.Equal(t, string(models.ControlActionLameduck), auditLog.records[0].Action)
+	be.Equal(t, models.AuditRecordOutcomeDenied, auditLog.records[0].Outcome)
+	be.Equal(t, userPub, auditLog.records[0].Caller)
+	be.Equal(t, pub, auditLog.records[0].Target)
+	be.Equal(t, models.SystemNamespace, auditLog.records[0].Namespace)
+
+	be.Equal(t, models.AuditRecordOutcomeDenied, auditLog.records[1].Outcome)
+	be.Zero(t, auditLog.records[1].Caller)
+
+	be.Equal(t, string(models.ControlActionSecretRead), auditLog.records[2].Action)
+	be.Equal(t, models.AuditRecordOutcomeDenied, auditLog.records[2].Outcome)
+	be.Equal(t, userPub, auditLog.records[2].Caller)
+	be.Equal(t, "user", auditLog.records[2].Namespace)
+}
+
+func TestNodeRemoteAgentPolicy(t *testing.T) {
+	s := startNatsServer(t)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	kp, err := nkeys.CreateServer()
+	be.NilErr(t, err)
+
+	pub, err := kp.PublicKey()
+	be.NilErr(t, err)
+
+	agentKp, err := nkeys.CreateUser()
+	be.NilErr(t, err)
+
+	agentPub, err := agentKp.PublicKey()
+	be.NilErr(t, err)
+
+	strangerKp, err := nkeys.CreateUser()
+	be.NilErr(t, err)
+
+	registrar, err := aregistrar.NewPolicyRegistrar(&aregistrar.AgentPolicy{
+		Agents: []aregistrar.AgentPolicyAgent{
+			{Name: "remote", PublicKey: agentPub, RegisterTypes: []string{"remote"}},
+		},
+	}, pub)
+	be.NilErr(t, err)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// agents started by the node are not checked against the policy
+	embedded, err := inmem.NewInMemAgent("nexus", pub, logger)
+	be.NilErr(t, err)
+
+	nn, err := NewNexNode(
+		WithNatsConn(nc),
+		WithLogger(logger),
+		WithNodeKeyPair(kp),
+		WithAgentRunner(embedded),
+		WithAllowRemoteAgentRegistration(),
+		WithAgentRegistrar(registrar),
+		WithMinter(&tminter.TestMinter{
+			NatsServers: []string{s.ClientURL()},
+		}),
+	)
+	be.NilErr(t, err)
+
+	be.NilErr(t, nn.Start())
+	defer func() {
+		be.NilErr(t, nn.Shutdown())
+	}()
+
+	for !nn.IsReady() {
+		time.Sleep(100 * time.Millisecond)
+	}
+	be.Equal(t, 1, nn.registeredAgents.Count())
+
+	_, err = sdk.RemoteAgentInit(nc, "nexus", "")
+	be.Nonzero(t, err)
+
+	_, err = sdk.RemoteAgentInitWithKey(nc, "nexus", strangerKp, "")
+	be.Nonzero(t, err)
+
+	rrr, err := sdk.RemoteAgentInitWithKey(nc, "nexus", agentKp, "")
+	be.NilErr(t, err)
+	be.Equal(t, pub, rrr.RespondTo)
+
+	remote, err := inmem.NewInMemAgent("nexus", pub, logger, inmem.WithWorkloadType("remote"), inmem.WithRegistrationKey(agentKp))
+	be.NilErr(t, err)
+	be.NilErr(t, remote.Run(rrr.AssignedAgentId, *rrr.RegistrationCreds, &eventemitter.NoEmit{}))
+	defer func() {
+		be.NilErr(t, remote.Shutdown())
+	}()
+	be.Equal(t, 2, nn.registeredAgents.Count())
+
+	// a join token issued by the node only allows the types it lists
+	token, err := aregistrar.NewJoinToken(kp, agentPub, []string{"other"}, time.Minute)
+	be.NilErr(t, err)
+
+	rrr, err = sdk.RemoteAgentInitWithKey(nc, "nexus", agentKp, token)
+	be.NilErr(t, err)
+
+	denied, err := inmem.NewInMemAgent("nexus", pub, logger, inmem.WithWorkloadType("denied"), inmem.WithRegistrationKey(agentKp))
+	be.NilErr(t, err)
+	be.Nonzero(t, denied.Run(rrr.AssignedAgentId, *rrr.RegistrationCreds, &eventemitter.NoEmit{}))
+	be.Equal(t, 2, nn.registeredAgents.Count())
+}
+
 func TestNodeLameduckHandlerWithTag(t *testing.T) {
 	s := startNatsServer(t)
 	defer s.Shutdown()
@@ -281,6 +530,18 @@ func TestNodeLameduckHandlerWithTag(t *testing.T) {
 		time.Sleep(100 * time.Millisecond)
 	}
 
+	// a node whose tags do not match answers with an empty reply when every
+	// node is expected to answer
+	skipB, err := json.Marshal(models.LameduckRequest{Delay: "0s", Tag: map[string]string{"foo": "baz"}})
+	be.NilErr(t, err)
+	skipMsg := nats.NewMsg(models.LameduckRequestSubject(models.SystemNamespace, pub))
+	skipMsg.Data = skipB
+	skipMsg.Header.Set(models.ExpectReplyHeader, "true")
+	skipResp, err := nc.RequestMsg(skipMsg, time.Second)
+	be.NilErr(t, err)
+	be.Equal(t, 0, len(skipResp.Data))
+	be.True(t, nn.IsReady())
+
 	req := models.LameduckRequest{
 		Delay: "0s",
 		Tag:   map[string]string{"foo": "bar"},
@@ -350,6 +611,82 @@ func TestNodeLameduckHandlerWithoutTag(t *testing.T) {
 	be.NilErr(t, nn.Shutdown())
 }
 
+func TestNodeTagsHandler(t *testing.T) {
+	s := startNatsServer(t)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	kp, err := nkeys.CreateServer()
+	be.NilErr(t, err)
+
+	pub, err := kp.PublicKey()
+	be.NilErr(t, err)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	nn, err := NewNexNode(
+		WithNatsConn(nc),
+		WithLogger(logger),
+		WithNodeKeyPair(kp),
+		WithEventEmitter(eventemitter.NewNatsEmitter(context.Background(), nc)),
+		WithTag("foo", "bar"),
+	)
+	be.NilErr(t, err)
+	defer func() { be.NilErr(t, nn.Shutdown()) }()
+
+	be.NilErr(t, nn.Start())
+
+	for !nn.IsReady() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	events, err := nc.SubscribeSync(models.EventAPIPrefix(pub) + "." + models.NexNodeTagsUpdatedEvent{}.String())
+	be.NilErr(t, err)
+
+	reqB, err := json.Marshal(models.NodeTagsRequest{
+		Set:    models.NodeTags{"zone": "a"},
+		Remove: []string{"foo"},
+	})
+	be.NilErr(t, err)
+
+	msg, err := nc.Request(models.NodeTagsRequestSubject(models.SystemNamespace, pub), reqB, time.Second*3)
+	be.NilErr(t, err)
+	be.Zero(t, msg.Header.Get(micro.ErrorHeader))
+
+	resp := models.NodeTagsResponse{}
+	be.NilErr(t, json.Unmarshal(msg.Data, &resp))
+	be.Equal(t, pub, resp.NodeId)
+	be.Equal(t, "a", resp.Tags["zone"])
+	be.Equal(t, "false", resp.Tags[models.TagLameDuck])
+	_, ok := resp.Tags["foo"]
+	be.False(t, ok)
+
+	eventMsg, err := events.NextMsg(time.Second)
+	be.NilErr(t, err)
+	event := models.NexNodeTagsUpdatedEvent{}
+	be.NilErr(t, json.Unmarshal(eventMsg.Data, &event))
+	be.Equal(t, "a", event.Tags["zone"])
+
+	// reserved tags can not be changed
+	reqB, err = json.Marshal(models.NodeTagsRequest{Remove: []string{models.TagLameDuck}})
+	be.NilErr(t, err)
+
+	msg, err = nc.Request(models.NodeTagsRequestSubject(models.SystemNamespace, pub), reqB, time.Second*3)
+	be.NilErr(t, err)
+	be.Nonzero(t, msg.Header.Get(micro.ErrorHeader))
+
+	// replacing the tags keeps the reserved tags
+	tags, err := nn.ReplaceTags(map[string]string{"env": "dev"})
+	be.NilErr(t, err)
+	be.Equal(t, "dev", tags["env"])
+	be.Equal(t, runtime.GOOS, tags[models.TagOS])
+	_, ok = tags["zone"]
+	be.False(t, ok)
+}
+
 func TestNodeShutdownExitCodes(t *testing.T) {
 	t.Run("normal shutdown returns nil", func(t *testing.T) {
 		s := startNatsServer(t)
@@ -431,6 +768,55 @@ func TestNodeShutdownExitCodes(t *testing.T) {
 	})
 }
 
+func TestNodeShutdownCancelsQueuedDeploys(t *testing.T) {
+	s := startNatsServer(t)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	kp, err := nkeys.CreateServer()
+	be.NilErr(t, err)
+
+	nn, err := NewNexNode(
+		WithNatsConn(nc),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithNodeKeyPair(kp),
+	)
+	be.NilErr(t, err)
+
+	req := &models.StartWorkloadRequest{Namespace: "user", Name: "queued"}
+	sub, err := nc.SubscribeSync(models.OperationSubject("user", "op1"))
+	be.NilErr(t, err)
+
+	nn.trackOperation("op1", "wid1", "agent", req)
+	nn.deployQueue <- &deployJob{operationID: "op1", workloadID: "wid1", agentID: "agent", req: req}
+	nn.cancelQueuedDeploys()
+
+	op, ok := nn.getOperation("op1")
+	be.True(t, ok)
+	be.Equal(t, models.OperationStatusStateFailed, op.status.State)
+	be.Equal(t, errDeployCanceled.Error(), op.status.Error)
+	be.Equal(t, 0, len(nn.deployQueue))
+
+	// progress reported after the operation finished is ignored
+	nn.updateOperation("op1", models.OperationStatusStateStarting, "")
+	nn.updateOperation("op1", models.OperationStatusStateRunning, "")
+	op, ok = nn.getOperation("op1")
+	be.True(t, ok)
+	be.Equal(t, models.OperationStatusStateFailed, op.status.State)
+
+	// queued, then failed
+	_, err = sub.NextMsg(time.Second)
+	be.NilErr(t, err)
+	msg, err := sub.NextMsg(time.Second)
+	be.NilErr(t, err)
+	status := new(models.OperationStatus)
+	be.NilErr(t, json.Unmarshal(msg.Data, status))
+	be.Equal(t, models.OperationStatusStateFailed, status.State)
+}
+
 func TestNodeDeployCloneUndeploy(t *testing.T) {
 	s := startNatsServer(t)
 	defer func() {
@@ -480,6 +866,11 @@ func TestNodeDeployCloneUndeploy(t *testing.T) {
 		time.Sleep(100 * time.Millisecond)
 	}
 
+	// agents bid on auctions once they are healthy
+	for _, err := nn.registeredAgents.GetByRegisterType("inmem"); err != nil; _, err = nn.registeredAgents.GetByRegisterType("inmem") {
+		time.Sleep(100 * time.Millisecond)
+	}
+
 	req := models.AuctionRequest{
 		AgentType: "inmem",
 		AuctionId: nuid.New().Next(),
@@ -504,11 +895,34 @@ func TestNodeDeployCloneUndeploy(t *testing.T) {
 	startWorkloadReqB, err := json.Marshal(startWorkloadReq)
 	be.NilErr(t, err)
 
+	opSub, err := nc.SubscribeSync(models.OperationAPIPrefix(models.SystemNamespace) + ".*")
+	be.NilErr(t, err)
+
 	startWorkloadRespRaw, err := nc.Request(models.AuctionDeployRequestSubject(models.SystemNamespace, auctionResp.BidderId), startWorkloadReqB, time.Second)
 	be.NilErr(t, err)
 
 	startWorkloadResp := models.StartWorkloadResponse{}
 	be.NilErr(t, json.Unmarshal(startWorkloadRespRaw.Data, &startWorkloadResp))
+	be.Nonzero(t, startWorkloadResp.OperationId)
+
+	// the workload is started after the deploy is accepted
+	opStates := []models.OperationStatusState{}
+	for len(opStates) == 0 || opStates[len(opStates)-1] != models.OperationStatusStateRunning {
+		opMsg, err := opSub.NextMsg(5 * time.Second)
+		be.NilErr(t, err)
+		opStatus := models.OperationStatus{}
+		be.NilErr(t, json.Unmarshal(opMsg.Data, &opStatus))
+		be.Equal(t, startWorkloadResp.OperationId, opStatus.OperationId)
+		be.Equal(t, startWorkloadResp.Id, opStatus.WorkloadId)
+		opStates = append(opStates, opStatus.State)
+	}
+	be.AllEqual(t, []models.OperationStatusState{models.OperationStatusStateQueued, models.OperationStatusStateRunning}, opStates)
+
+	opStatusRaw, err := nc.Request(models.OperationStatusRequestSubject(models.SystemNamespace, startWorkloadResp.OperationId), nil, time.Second)
+	be.NilErr(t, err)
+	opStatus := models.OperationStatus{}
+	be.NilErr(t, json.Unmarshal(opStatusRaw.Data, &opStatus))
+	be.Equal(t, models.OperationStatusStateRunning, opStatus.State)
 
 	xkp, err := nkeys.CreateCurveKeys()
 	be.NilErr(t, err)
@@ -584,3 +998,357 @@ func TestNodeDeployCloneUndeploy(t *testing.T) {
 	be.Equal(t, startWorkloadResp.Id, stopWorkloadResp.Id)
 	be.True(t, stopWorkloadResp.Stopped)
 }
+
+func TestNodeAgentSecretRequest(t *testing.T) {
+	s := startNatsServer(t)
+	defer func() {
+		for s.NumClients() == 0 {
+			s.Shutdown()
+		}
+	}()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	nc, err := nats.Connect(s.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	kp, err := nkeys.CreateServer()
+	be.NilErr(t, err)
+
+	pub, err := kp.PublicKey()
+	be.NilErr(t, err)
+
+	xkp, err := nkeys.CreateCurveKeys()
+	be.NilErr(t, err)
+
+	store, err := secretstore.NewNatsKVSecretStore(nc, "nex-secrets", xkp, logger)
+	be.NilErr(t, err)
+	_, err = store.PutSecret("user", "dbpass", []byte("supersecret"))
+	be.NilErr(t, err)
+
+	// runner has no secret store of its own and must ask the node
+	r, err := inmem.NewInMemAgent("nexus", pub, logger)
+	be.NilErr(t, err)
+
+	nn, err := NewNexNode(
+		WithNatsConn(nc),
+		WithLogger(logger),
+		WithNodeKeyPair(kp),
+		WithAgentRunner(r),
+		WithSecretStore(store),
+		WithMinter(&tminter.TestMinter{
+			NatsServers: []string{s.ClientURL()},
+		}),
+	)
+	be.NilErr(t, err)
+
+	be.NilErr(t, nn.Start())
+	defer func() {
+		be.NilErr(t, nn.Shutdown())
+	}()
+
+	for !nn.IsReady() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	reg, err := nn.registeredAgents.GetByRegisterName("inmem")
+	be.NilErr(t, err)
+
+	// no workloads running in the namespace
+	_, err = r.GetNamespaceSecret("user", "dbpass")
+	be.Nonzero(t, err)
+
+	be.NilErr(t, nn.registeredAgents.AddWorkload(reg.ID, "workload1", "user"))
+
+	value, err := r.GetNamespaceSecret("user", "dbpass")
+	be.NilErr(t, err)
+	be.Equal(t, "supersecret", string(value))
+
+	_, err = r.GetNamespaceSecret("other", "dbpass")
+	be.Nonzero(t, err)
+
+	nn.registeredAgents.RemoveWorkload("workload1")
+	_, err = r.GetNamespaceSecret("user", "dbpass")
+	be.Nonzero(t, err)
+
+	// workloads that exit on their own are no longer listed by their agent
+	be.NilErr(t, nn.registeredAgents.AddWorkload(reg.ID, "workload2", "user"))
+	nn.pruneSecretAccess(time.Now().Add(-time.Minute))
+	_, err = r.GetNamespaceSecret("user", "dbpass")
+	be.NilErr(t, err)
+
+	nn.pruneSecretAccess(time.Now())
+	_, err = r.GetNamespaceSecret("user", "dbpass")
+	be.Nonzero(t, err)
+}
+
+func TestNodeSecretUpdatesScopedToNamespace(t *testing.T) {
+	s := startNatsServer(t)
+	defer func() {
+		for s.NumClients() == 0 {
+			s.Shutdown()
+		}
+	}()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	nc, err := nats.Connect(s.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	kp, err := nkeys.CreateServer()
+	be.NilErr(t, err)
+
+	pub, err := kp.PublicKey()
+	be.NilErr(t, err)
+
+	xkp, err := nkeys.CreateCurveKeys()
+	be.NilErr(t, err)
+
+	store, err := secretstore.NewNatsKVSecretStore(nc, "nex-secrets", xkp, logger)
+	be.NilErr(t, err)
+
+	r, err := inmem.NewInMemAgent("nexus", pub, logger)
+	be.NilErr(t, err)
+
+	nn, err := NewNexNode(
+		WithNatsConn(nc),
+		WithLogger(logger),
+		WithNodeKeyPair(kp),
+		WithAgentRunner(r),
+		WithSecretStore(store),
+		WithMinter(&tminter.TestMinter{
+			NatsServers: []string{s.ClientURL()},
+		}),
+	)
+	be.NilErr(t, err)
+
+	be.NilErr(t, nn.Start())
+	defer func() {
+		be.NilErr(t, nn.Shutdown())
+	}()
+
+	for !nn.IsReady() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	reg, err := nn.registeredAgents.GetByRegisterName("inmem")
+	be.NilErr(t, err)
+	be.NilErr(t, nn.registeredAgents.AddWorkload(reg.ID, "workload1", "user"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates, err := r.WatchSecrets(ctx)
+	be.NilErr(t, err)
+	be.NilErr(t, nc.Flush())
+
+	// the agent runs nothing in the other namespace
+	_, err = store.PutSecret("other", "dbpass", []byte("hidden"))
+	be.NilErr(t, err)
+	_, err = store.PutSecret("user", "dbpass", []byte("rotated"))
+	be.NilErr(t, err)
+
+	select {
+	case update := <-updates:
+		be.Equal(t, "user", update.Namespace)
+		be.Equal(t, "dbpass", update.Key)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no secret update received")
+	}
+	select {
+	case update := <-updates:
+		t.Fatalf("unexpected secret update for namespace %s", update.Namespace)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestNodeRenewWorkloadCreds(t *testing.T) {
+	s := startNatsServer(t)
+	defer func() {
+		for s.NumClients() == 0 {
+			s.Shutdown()
+		}
+	}()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	nc, err := nats.Connect(s.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	kp, err := nkeys.CreateServer()
+	be.NilErr(t, err)
+
+	pub, err := kp.PublicKey()
+	be.NilErr(t, err)
+
+	minter := &credentials.SigningKeyMinter{
+		NodeId:          pub,
+		Nexus:           "nexus",
+		NatsServers:     []string{s.ClientURL()},
+		RootAccountKey:  "ABOMDDCH76P5CAEOFEC5AFRMUL3W62Y5SPBNL6R3GBYE5X4N6UDE5QQL",
+		SigningSeed:     "SAAO4BQQIG6ESCYGHXTBEEF4TWX7XI545EAYZPXZMR5JCIRUZLRWUONGD4",
+		WorkloadCredTTL: time.Minute,
+	}
+
+	r, err := inmem.NewInMemAgent("nexus", pub, logger)
+	be.NilErr(t, err)
+
+	nn, err := NewNexNode(
+		WithNatsConn(nc),
+		WithLogger(logger),
+		WithNodeKeyPair(kp),
+		WithAgentRunner(r),
+		WithMinter(minter),
+	)
+	be.NilErr(t, err)
+
+	be.NilErr(t, nn.Start())
+	defer func() {
+		be.NilErr(t, nn.Shutdown())
+	}()
+
+	for !nn.IsReady() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	connData, err := minter.Mint(models.WorkloadCred, "user", "workload1")
+	be.NilErr(t, err)
+	claims, err := jwt.DecodeUserClaims(connData.NatsUserJwt)
+	be.NilErr(t, err)
+
+	reg, err := nn.registeredAgents.GetByRegisterName("inmem")
+	be.NilErr(t, err)
+	be.NilErr(t, nn.registeredAgents.AddWorkload(reg.ID, "workload1", "user"))
+
+	msg, err := nc.Request(models.RenewWorkloadCredsRequestSubject("user", pub, "workload1"), []byte(connData.NatsUserJwt), time.Second)
+	be.NilErr(t, err)
+	be.Zero(t, msg.Header.Get(micro.ErrorHeader))
+
+	renewed := new(models.NatsConnectionData)
+	be.NilErr(t, json.Unmarshal(msg.Data, renewed))
+	renewedClaims, err := jwt.DecodeUserClaims(renewed.NatsUserJwt)
+	be.NilErr(t, err)
+	be.Equal(t, claims.Subject, renewedClaims.Subject)
+
+	// other nodes do not answer for the workload
+	_, err = nc.Request(models.RenewWorkloadCredsRequestSubject("user", "NOTHISNODE", "workload1"), []byte(connData.NatsUserJwt), 250*time.Millisecond)
+	be.Equal(t, nats.ErrNoResponders, err)
+
+	// stopped workloads can no longer renew
+	nn.registeredAgents.RemoveWorkload("workload1")
+
+	msg, err = nc.Request(models.RenewWorkloadCredsRequestSubject("user", pub, "workload1"), []byte(renewed.NatsUserJwt), time.Second)
+	be.NilErr(t, err)
+	be.Nonzero(t, msg.Header.Get(micro.ErrorHeader))
+}
+
+type testPolicyStore map[string]*models.NamespacePolicy
+
+func (p testPolicyStore) GetNamespacePolicy(namespace string) (*models.NamespacePolicy, error) {
+	return p[namespace], nil
+}
+
+func TestNodeDeployWorkloadPermissions(t *testing.T) {
+	s := startNatsServer(t)
+	defer func() {
+		for s.NumClients() == 0 {
+			s.Shutdown()
+		}
+	}()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	nc, err := nats.Connect(s.ClientURL())
+	be.NilErr(t, err)
+	defer nc.Close()
+
+	kp, err := nkeys.CreateServer()
+	be.NilErr(t, err)
+
+	pub, err := kp.PublicKey()
+	be.NilErr(t, err)
+
+	r, err := inmem.NewInMemAgent("nexus", pub, logger)
+	be.NilErr(t, err)
+
+	nn, err := NewNexNode(
+		WithNatsConn(nc),
+		WithLogger(logger),
+		WithNodeKeyPair(kp),
+		WithAgentRunner(r),
+		WithMinter(&credentials.SigningKeyMinter{
+			NodeId:         pub,
+			Nexus:          "nexus",
+			NatsServers:    []string{s.ClientURL()},
+			RootAccountKey: "ABOMDDCH76P5CAEOFEC5AFRMUL3W62Y5SPBNL6R3GBYE5X4N6UDE5QQL",
+			SigningSeed:    "SAAO4BQQIG6ESCYGHXTBEEF4TWX7XI545EAYZPXZMR5JCIRUZLRWUONGD4",
+			Policies: testPolicyStore{
+				"user": {Publish: []string{"orders.>"}},
+			},
+		}),
+	)
+	be.NilErr(t, err)
+
+	be.NilErr(t, nn.Start())
+	defer func() {
+		be.NilErr(t, nn.Shutdown())
+	}()
+
+	for !nn.IsReady() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// agents bid on auctions once they are healthy
+	for _, err := nn.registeredAgents.GetByRegisterType("inmem"); err != nil; _, err = nn.registeredAgents.GetByRegisterType("inmem") {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	deploy := func(perms *models.WorkloadPermissions) *nats.Msg {
+		req := models.AuctionRequest{
+			AgentType: "inmem",
+			AuctionId: nuid.New().Next(),
+		}
+		reqB, err := json.Marshal(req)
+		be.NilErr(t, err)
+
+		auctionRespRaw, err := nc.Request(models.AuctionRequestSubject("user"), reqB, time.Second*3)
+		be.NilErr(t, err)
+
+		auctionResp := models.AuctionResponse{}
+		be.NilErr(t, json.Unmarshal(auctionRespRaw.Data, &auctionResp))
+
+		startWorkloadReqB, err := json.Marshal(models.StartWorkloadRequest{
+			Description:       "test",
+			Name:              "test",
+			Namespace:         "user",
+			RunRequest:        "{}",
+			WorkloadLifecycle: "service",
+			WorkloadType:      "inmem",
+			Permissions:       perms,
+		})
+		be.NilErr(t, err)
+
+		msg, err := nc.Request(models.AuctionDeployRequestSubject("user", auctionResp.BidderId), startWorkloadReqB, time.Second)
+		be.NilErr(t, err)
+		return msg
+	}
+
+	msg := deploy(&models.WorkloadPermissions{Publish: []string{"orders.created"}})
+	be.Zero(t, msg.Header.Get(micro.ErrorHeader))
+
+	msg = deploy(&models.WorkloadPermissions{Publish: []string{"payments.>"}})
+	be.True(t, strings.Contains(msg.Header.Get(micro.ErrorHeader), "payments.>"))
+}
+
+func TestNodeMintWorkloadCredsUnscopedMinter(t *testing.T) {
+	nn := &NexNode{minter: &tminter.TestMinter{NatsServers: []string{"nats://localhost:4222"}}}
+
+	_, err := nn.mintWorkloadCreds("user", "workload1", nil)
+	be.NilErr(t, err)
+
+	// the minter would grant more than the workload requested
+	_, err = nn.mintWorkloadCreds("user", "workload1", &models.WorkloadPermissions{Publish: []string{"orders.created"}})
+	be.Nonzero(t, err)
+}
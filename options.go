@@ -5,6 +5,7 @@ import (
 	"errors"
 	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/synadia-io/nex/internal"
 	"github.com/synadia-io/nex/models"
@@ -85,6 +86,22 @@ func WithAgentRestartLimit(limit int) NexNodeOption {
 	}
 }
 
+// WithDeployWorkers sets how many workload starts the node runs at once and how
+// many accepted deploys may wait for a worker
+func WithDeployWorkers(workers, queue int) NexNodeOption {
+	return func(n *NexNode) error {
+		if workers < 1 {
+			return errors.New("deploy workers must be at least 1")
+		}
+		if queue < 0 {
+			return errors.New("deploy queue size must be non-negative")
+		}
+		n.deployWorkers = workers
+		n.deployQueueSize = queue
+		return nil
+	}
+}
+
 func WithAgentRunner(agent *sdk.Runner) NexNodeOption {
 	return func(n *NexNode) error {
 		n.embeddedRunners = append(n.embeddedRunners, agent)
@@ -114,6 +131,39 @@ func WithTag(key, value string) NexNodeOption {
 	}
 }
 
+// WithTagProvider adds tags from the provider to the node; they are refreshed
+// every tag refresh interval
+func WithTagProvider(provider models.TagProvider) NexNodeOption {
+	return func(n *NexNode) error {
+		if provider == nil {
+			return errors.New("tag provider is nil")
+		}
+		n.tagSources = append(n.tagSources, &tagSource{provider: provider})
+		return nil
+	}
+}
+
+// WithTagRefreshInterval sets how often the host facts and provided tags are
+// refreshed
+func WithTagRefreshInterval(interval time.Duration) NexNodeOption {
+	return func(n *NexNode) error {
+		if interval <= 0 {
+			return errors.New("tag refresh interval must be positive")
+		}
+		n.tagRefreshInterval = interval
+		return nil
+	}
+}
+
+// WithResourceDirectory sets the directory whose free disk space is reported
+// in the nex.disk_free_mb tag
+func WithResourceDirectory(dir string) NexNodeOption {
+	return func(n *NexNode) error {
+		n.resourceDir = dir
+		return nil
+	}
+}
+
 func WithAllowRemoteAgentRegistration() NexNodeOption {
 	return func(n *NexNode) error {
 		n.allowRemoteAgentRegistration = true
@@ -150,6 +200,71 @@ func WithAuctioneer(a models.Auctioneer) NexNodeOption {
 	}
 }
 
+// WithWorkloadAdmitter adds an admitter to the chain every start request must
+// pass. Admitters are consulted in the order they were added
+func WithWorkloadAdmitter(a models.WorkloadAdmitter) NexNodeOption {
+	return func(n *NexNode) error {
+		n.admitters = append(n.admitters, a)
+		return nil
+	}
+}
+
+// WithJobScheduler runs the job schedules stored in the bucket. The nodes
+// running a scheduler elect a leader that starts every scheduled run through
+// the launcher, such as the one returned by client.NewLauncher. Each run is
+// authorized by the control authorizer as the caller that signed the schedule
+func WithJobScheduler(bucket string, launcher models.WorkloadScaler) NexNodeOption {
+	return func(n *NexNode) error {
+		if bucket == "" {
+			return errors.New("schedule bucket is required")
+		}
+		if launcher == nil {
+			return errors.New("job launcher is required")
+		}
+		n.scheduleBucket = bucket
+		n.scheduleLauncher = launcher
+		return nil
+	}
+}
+
+// WithFunctionActivator starts the lazy functions stored in the bucket on
+// demand and stops their idle instances. The nodes running an activator elect
+// a leader that listens on the trigger subjects of every function without a
+// running instance. Instances are started through the launcher, such as the
+// one returned by client.NewLauncher
+func WithFunctionActivator(bucket string, launcher models.JobLauncher) NexNodeOption {
+	return func(n *NexNode) error {
+		if bucket == "" {
+			return errors.New("function bucket is required")
+		}
+		if launcher == nil {
+			return errors.New("function launcher is required")
+		}
+		n.functionBucket = bucket
+		n.functionLauncher = launcher
+		return nil
+	}
+}
+
+// WithAutoscaler keeps the instances of the workloads with an autoscaling
+// policy in the bucket between their minimum and maximum. The nodes running an
+// autoscaler elect a leader that evaluates every policy. Instances are started
+// and stopped through the scaler, such as the one returned by
+// client.NewLauncher
+func WithAutoscaler(bucket string, scaler models.WorkloadScaler) NexNodeOption {
+	return func(n *NexNode) error {
+		if bucket == "" {
+			return errors.New("autoscale bucket is required")
+		}
+		if scaler == nil {
+			return errors.New("workload scaler is required")
+		}
+		n.autoscaleBucket = bucket
+		n.autoscaleScaler = scaler
+		return nil
+	}
+}
+
 func WithIDGenerator(a models.IDGen) NexNodeOption {
 	return func(n *NexNode) error {
 		n.idgen = a
@@ -164,6 +279,23 @@ func WithAgentRegistrar(a models.AgentRegistrar) NexNodeOption {
 	}
 }
 
+// WithControlAuthorizer sets the authorizer consulted with the caller identity
+// before each control API request is handled
+func WithControlAuthorizer(a models.ControlAuthorizer) NexNodeOption {
+	return func(n *NexNode) error {
+		n.cauthorizer = a
+		return nil
+	}
+}
+
+// WithAuditLog records control plane mutations in the given audit log
+func WithAuditLog(a models.AuditLog) NexNodeOption {
+	return func(n *NexNode) error {
+		n.auditLog = a
+		return nil
+	}
+}
+
 func WithSecretStore(s models.SecretStore) NexNodeOption {
 	return func(n *NexNode) error {
 		n.secretStore = s
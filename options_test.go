@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"log/slog"
+	"maps"
 	"strings"
 	"testing"
 	"time"
@@ -163,6 +164,57 @@ func TestNexNodeOptions(t *testing.T) {
 		be.True(t, ok)
 		be.DeepEqual(t, a, aa)
 	})
+	t.Run("WithJobScheduler", func(t *testing.T) {
+		t.Parallel()
+		nn, err := NewNexNode(
+			WithJobScheduler("schedules", new(launcher)),
+		)
+		be.NilErr(t, err)
+		be.Equal(t, "schedules", nn.scheduleBucket)
+
+		_, err = NewNexNode(WithJobScheduler("", new(launcher)))
+		be.Nonzero(t, err)
+		_, err = NewNexNode(WithJobScheduler("schedules", nil))
+		be.Nonzero(t, err)
+	})
+	t.Run("WithFunctionActivator", func(t *testing.T) {
+		t.Parallel()
+		nn, err := NewNexNode(
+			WithFunctionActivator("functions", new(launcher)),
+		)
+		be.NilErr(t, err)
+		be.Equal(t, "functions", nn.functionBucket)
+
+		_, err = NewNexNode(WithFunctionActivator("", new(launcher)))
+		be.Nonzero(t, err)
+		_, err = NewNexNode(WithFunctionActivator("functions", nil))
+		be.Nonzero(t, err)
+	})
+	t.Run("WithAutoscaler", func(t *testing.T) {
+		t.Parallel()
+		nn, err := NewNexNode(
+			WithAutoscaler("autoscalers", new(launcher)),
+		)
+		be.NilErr(t, err)
+		be.Equal(t, "autoscalers", nn.autoscaleBucket)
+
+		_, err = NewNexNode(WithAutoscaler("", new(launcher)))
+		be.Nonzero(t, err)
+		_, err = NewNexNode(WithAutoscaler("autoscalers", nil))
+		be.Nonzero(t, err)
+	})
+	t.Run("WithWorkloadAdmitter", func(t *testing.T) {
+		t.Parallel()
+		a, b := &admitter{}, &admitter{}
+		nn, err := NewNexNode(
+			WithWorkloadAdmitter(a),
+			WithWorkloadAdmitter(b),
+		)
+		be.NilErr(t, err)
+		be.Equal(t, 2, len(nn.admitters))
+		be.True(t, nn.admitters[0] == models.WorkloadAdmitter(a))
+		be.True(t, nn.admitters[1] == models.WorkloadAdmitter(b))
+	})
 	t.Run("WithAgentRestartLimit", func(t *testing.T) {
 		t.Parallel()
 		nn, err := NewNexNode(
@@ -171,6 +223,45 @@ func TestNexNodeOptions(t *testing.T) {
 		be.NilErr(t, err)
 		be.Equal(t, 5, nn.agentRestartLimit)
 	})
+	t.Run("WithDeployWorkers", func(t *testing.T) {
+		t.Parallel()
+		nn, err := NewNexNode(
+			WithDeployWorkers(2, 10),
+		)
+		be.NilErr(t, err)
+		be.Equal(t, 2, nn.deployWorkers)
+		be.Equal(t, 10, cap(nn.deployQueue))
+
+		_, err = NewNexNode(WithDeployWorkers(0, 10))
+		be.Nonzero(t, err)
+	})
+	t.Run("WithTagProvider", func(t *testing.T) {
+		t.Parallel()
+		nn, err := NewNexNode(
+			WithTag("rack", "static"),
+			WithTagProvider(tagProvider{"rack": "provided", "zone": "b", models.TagNexus: "other"}),
+			WithTagRefreshInterval(time.Minute),
+			WithResourceDirectory(t.TempDir()),
+		)
+		be.NilErr(t, err)
+		be.Equal(t, time.Minute, nn.tagRefreshInterval)
+
+		nn.refreshTags()
+		tags := nn.nodeTags()
+		be.Equal(t, "static", tags["rack"])
+		be.Equal(t, "b", tags["zone"])
+		be.Equal(t, "nexus", tags[models.TagNexus])
+		be.Nonzero(t, tags[models.TagHostname])
+
+		_, err = NewNexNode(WithTagRefreshInterval(0))
+		be.Nonzero(t, err)
+	})
+}
+
+type tagProvider map[string]string
+
+func (p tagProvider) Tags(_ context.Context) (map[string]string, error) {
+	return maps.Clone(p), nil
 }
 
 type auction struct{}
@@ -179,6 +270,30 @@ func (a *auction) Auction(namespace, _type string, aTags map[string]string) erro
 	return nil
 }
 
+type launcher struct{}
+
+func (l *launcher) DeployJob(_ context.Context, _ *models.StartWorkloadRequest, _ []string) (*models.StartWorkloadResponse, error) {
+	return nil, nil
+}
+
+func (l *launcher) WaitForOperation(_ context.Context, _, _ string) (*models.OperationStatus, error) {
+	return nil, nil
+}
+
+func (l *launcher) StopJob(_ context.Context, _, _ string) error {
+	return nil
+}
+
+func (l *launcher) ListInstances(_ context.Context, _, _ string) ([]string, error) {
+	return nil, nil
+}
+
+type admitter struct{ _ int }
+
+func (a *admitter) AdmitWorkload(req *models.StartWorkloadRequest) error {
+	return nil
+}
+
 type minter struct{}
 
 func (m *minter) MintRegister(agentId, nodeId string) (*models.NatsConnectionData, error) {
@@ -0,0 +1,52 @@
+package scheduling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carlmjohnson/be"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"* * * * *", "*/15 9-17 * * mon-fri", "0 0 1,15 * *", "5 4 * jan-mar 7", "@hourly", "@Daily"} {
+		_, err := ParseCron(expr)
+		be.NilErr(t, err)
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		_, err := ParseCron(expr)
+		be.Nonzero(t, err)
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	be.NilErr(t, err)
+
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, 1, 1, 10, 0, 30, 0, time.UTC), time.Date(2025, 1, 1, 10, 1, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 1, 1, 10, 15, 0, 0, time.UTC), time.Date(2025, 1, 1, 10, 30, 0, 0, time.UTC)},
+		{"0 9-17 * * mon-fri", time.Date(2025, 1, 3, 17, 30, 0, 0, time.UTC), time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC), time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// both day fields restricted: either one matches
+		{"0 0 13 * 5", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC)},
+		// evaluated in the location of the time
+		{"30 2 * * *", time.Date(2025, 3, 29, 12, 0, 0, 0, berlin), time.Date(2025, 3, 31, 2, 30, 0, 0, berlin)},
+		{"0 8 * * *", time.Date(2025, 6, 1, 9, 0, 0, 0, berlin), time.Date(2025, 6, 2, 8, 0, 0, 0, berlin)},
+		{"0 0 30 2 *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			be.NilErr(t, err)
+			be.True(t, tt.want.Equal(c.Next(tt.from)))
+		})
+	}
+}
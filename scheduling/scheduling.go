@@ -0,0 +1,165 @@
+// Package scheduling reads the job schedules, lazy functions and autoscaling
+// policies shared by the nex client and the nodes that run them
+package scheduling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/synadia-io/nex/models"
+)
+
+// ParseSchedule reads the cron expression and time zone of a schedule
+func ParseSchedule(sched *models.JobSchedule) (*Cron, *time.Location, error) {
+	cron, err := ParseCron(sched.Cron)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	loc := time.UTC
+	if sched.Timezone != "" {
+		loc, err = time.LoadLocation(sched.Timezone)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid time zone %q: %w", sched.Timezone, err)
+		}
+	}
+	return cron, loc, nil
+}
+
+// ListRuns returns the runs of a schedule recorded in the schedule bucket,
+// oldest first
+func ListRuns(ctx context.Context, kv jetstream.KeyValue, namespace, name string) ([]*models.JobRun, error) {
+	lister, err := kv.ListKeysFiltered(ctx, models.JobRunKey(namespace, name, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []*models.JobRun{}
+	for key := range lister.Keys() {
+		entry, err := kv.Get(ctx, key)
+		if err != nil {
+			continue
+		}
+		run := new(models.JobRun)
+		if json.Unmarshal(entry.Value(), run) == nil {
+			runs = append(runs, run)
+		}
+	}
+
+	slices.SortFunc(runs, func(a, b *models.JobRun) int {
+		return a.StartTime.Compare(b.StartTime)
+	})
+	return runs, nil
+}
+
+// ListFunctionInstances returns the running instances of the lazy functions of
+// the namespace recorded in the function bucket
+func ListFunctionInstances(ctx context.Context, kv jetstream.KeyValue, namespace string) ([]*models.FunctionInstance, error) {
+	lister, err := kv.ListKeysFiltered(ctx, models.FunctionInstanceKey(namespace, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	instances := []*models.FunctionInstance{}
+	for key := range lister.Keys() {
+		entry, err := kv.Get(ctx, key)
+		if err != nil {
+			continue
+		}
+		instance := new(models.FunctionInstance)
+		if json.Unmarshal(entry.Value(), instance) == nil {
+			instances = append(instances, instance)
+		}
+	}
+	return instances, nil
+}
+
+// ParseIdleTimeout reads the idle timeout of a lazy function
+func ParseIdleTimeout(fn *models.LazyFunction) (time.Duration, error) {
+	if fn.IdleTimeout == "" {
+		return models.DefaultFunctionIdleTimeout, nil
+	}
+	timeout, err := time.ParseDuration(fn.IdleTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid idle timeout %q: %w", fn.IdleTimeout, err)
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid idle timeout %q: must be positive", fn.IdleTimeout)
+	}
+	return timeout, nil
+}
+
+// ParseAutoscalingPolicy validates a policy and reads its scale out and scale
+// in cooldowns
+func ParseAutoscalingPolicy(policy *models.AutoscalingPolicy) (time.Duration, time.Duration, error) {
+	var errs error
+	if policy.MaxInstances < 1 {
+		errs = errors.Join(errs, errors.New("max instances must be at least 1"))
+	}
+	if policy.MinInstances < 0 || policy.MinInstances > policy.MaxInstances {
+		errs = errors.Join(errs, errors.New("min instances must be between 0 and max instances"))
+	}
+	if policy.Target <= 0 {
+		errs = errors.Join(errs, errors.New("target must be positive"))
+	}
+
+	switch {
+	case (policy.Consumer == nil) == (policy.Metric == nil):
+		errs = errors.Join(errs, errors.New("exactly one of consumer and metric is required"))
+	case policy.Consumer != nil && (policy.Consumer.Stream == "" || policy.Consumer.Consumer == ""):
+		errs = errors.Join(errs, errors.New("consumer requires a stream and a consumer name"))
+	case policy.Metric != nil && policy.Metric.Name == "":
+		errs = errors.Join(errs, errors.New("metric requires a name"))
+	case policy.Metric != nil && policy.MinInstances < 1:
+		// without instances nothing emits the metric
+		errs = errors.Join(errs, errors.New("metric policies require at least 1 min instance"))
+	}
+
+	outCooldown, err := parseCooldown("scale out", policy.ScaleOutCooldown)
+	errs = errors.Join(errs, err)
+	inCooldown, err := parseCooldown("scale in", policy.ScaleInCooldown)
+	errs = errors.Join(errs, err)
+
+	return outCooldown, inCooldown, errs
+}
+
+func parseCooldown(name, cooldown string) (time.Duration, error) {
+	if cooldown == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(cooldown)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s cooldown %q: %w", name, cooldown, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid %s cooldown %q: must not be negative", name, cooldown)
+	}
+	return d, nil
+}
+
+// ListAutoscalingStatus returns the last evaluations of the autoscaling
+// policies of the namespace recorded in the autoscaler bucket
+func ListAutoscalingStatus(ctx context.Context, kv jetstream.KeyValue, namespace string) ([]*models.AutoscalingStatus, error) {
+	lister, err := kv.ListKeysFiltered(ctx, models.AutoscalingStatusKey(namespace, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []*models.AutoscalingStatus{}
+	for key := range lister.Keys() {
+		entry, err := kv.Get(ctx, key)
+		if err != nil {
+			continue
+		}
+		status := new(models.AutoscalingStatus)
+		if json.Unmarshal(entry.Value(), status) == nil {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
@@ -2,6 +2,7 @@ package agent
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -16,6 +18,7 @@ import (
 
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/micro"
+	"github.com/nats-io/nkeys"
 )
 
 const (
@@ -36,16 +39,19 @@ type Runner struct {
 	metrics      bool
 	metricsPort  int
 
-	nodeID   string
-	nexus    string
-	agentID  string
-	triggers map[string]*triggerResources
+	nodeID     string
+	nexus      string
+	agentID    string
+	triggers   map[string]*triggerResources
+	triggersMu sync.Mutex
 
 	agent Agent
 	nc    *nats.Conn
 	micro micro.Service
 
 	secretStore models.SecretStore
+	// Key proving the identity of a remote agent at registration
+	registrationKey nkeys.KeyPair
 
 	// Ingress Settings
 	ingressHostMachineIPAddr string
@@ -53,11 +59,6 @@ type Runner struct {
 	EmitEvent func(string, any) error
 }
 
-type triggerResources struct {
-	nc  *nats.Conn
-	sub *nats.Subscription
-}
-
 type RunnerOpt func(*Runner) error
 
 func WithLogger(logger *slog.Logger) RunnerOpt {
@@ -96,7 +97,26 @@ func WithIngressSettings(hostMachineIPAddr string) RunnerOpt {
 	}
 }
 
+// WithRegistrationKey signs the registration request of a remote agent with
+// the key it was assigned an agent id for by RemoteAgentInitWithKey
+func WithRegistrationKey(kp nkeys.KeyPair) RunnerOpt {
+	return func(a *Runner) error {
+		if _, err := kp.PublicKey(); err != nil {
+			return fmt.Errorf("invalid registration key: %w", err)
+		}
+		a.registrationKey = kp
+		return nil
+	}
+}
+
 func RemoteAgentInit(nc *nats.Conn, nexus, pubKey string) (*models.RegisterRemoteAgentResponse, error) {
+	return RemoteAgentInitWithKey(nc, nexus, nil, "")
+}
+
+// RemoteAgentInitWithKey requests an agent id from a node that only accepts
+// remote agents with allowlisted keys or join tokens. The same key must be
+// given to the runner with WithRegistrationKey. The join token is optional
+func RemoteAgentInitWithKey(nc *nats.Conn, nexus string, kp nkeys.KeyPair, joinToken string) (*models.RegisterRemoteAgentResponse, error) {
 	req := models.RegisterRemoteAgentRequest{}
 
 	reqB, err := json.Marshal(req)
@@ -104,10 +124,26 @@ func RemoteAgentInit(nc *nats.Conn, nexus, pubKey string) (*models.RegisterRemot
 		return nil, fmt.Errorf("failed to marshal remote agent registration request: %w", err)
 	}
 
-	regResp, err := nc.Request(models.AgentAPIInitRemoteRegisterRequestSubject(nexus), reqB, time.Second*3)
+	msg := nats.NewMsg(models.AgentAPIInitRemoteRegisterRequestSubject(nexus))
+	msg.Data = reqB
+	if kp != nil {
+		pub, err := kp.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get agent public key: %w", err)
+		}
+		msg.Header.Set(models.AgentKeyHeader, pub)
+	}
+	if joinToken != "" {
+		msg.Header.Set(models.AgentTokenHeader, joinToken)
+	}
+
+	regResp, err := nc.RequestMsg(msg, time.Second*3)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send remote agent registration request: %w", err)
 	}
+	if desc := regResp.Header.Get(micro.ErrorHeader); desc != "" {
+		return nil, errors.New("remote agent registration rejected: " + desc)
+	}
 
 	var resp models.RegisterRemoteAgentResponse
 	err = json.Unmarshal(regResp.Data, &resp)
@@ -154,6 +190,11 @@ func (a *Runner) ServiceIsRunning() bool {
 	return !a.micro.Stopped()
 }
 
+// NodeID returns the id of the node the nexlet is registered with
+func (a *Runner) NodeID() string {
+	return a.nodeID
+}
+
 func (a *Runner) String() string {
 	return fmt.Sprintf("%s-%s", a.registerType, a.name)
 }
@@ -203,10 +244,23 @@ func (a *Runner) Run(agentID string, connData models.NatsConnectionData, eventEm
 
 	var regRet *nats.Msg
 
-	regRet, err = a.nc.Request(models.AgentAPIRegisterRequestSubject(agentID, a.nodeID), registerB, time.Minute)
+	regMsg := nats.NewMsg(models.AgentAPIRegisterRequestSubject(agentID, a.nodeID))
+	regMsg.Data = registerB
+	if a.registrationKey != nil {
+		err = a.signRegistration(regMsg, agentID)
+		if err != nil {
+			return err
+		}
+	}
+
+	regRet, err = a.nc.RequestMsg(regMsg, time.Minute)
 	if err != nil {
 		return fmt.Errorf("failed to send agent registration request to node %s: %w", a.nodeID, err)
 	}
+	if desc := regRet.Header.Get(micro.ErrorHeader); desc != "" {
+		a.nc.Close()
+		return errors.New("agent registration failed: " + desc)
+	}
 
 	var regRetJSON models.RegisterAgentResponse
 	err = json.Unmarshal(regRet.Data, &regRetJSON)
@@ -295,6 +349,22 @@ func (a *Runner) Run(agentID string, connData models.NatsConnectionData, eventEm
 	return nil
 }
 
+// signRegistration identifies a remote agent to the node by signing the agent
+// id the node assigned to it
+func (a *Runner) signRegistration(msg *nats.Msg, agentID string) error {
+	pub, err := a.registrationKey.PublicKey()
+	if err != nil {
+		return fmt.Errorf("failed to get registration public key: %w", err)
+	}
+	sig, err := a.registrationKey.Sign([]byte(agentID))
+	if err != nil {
+		return fmt.Errorf("failed to sign registration request: %w", err)
+	}
+	msg.Header.Set(models.AgentKeyHeader, pub)
+	msg.Header.Set(models.AgentSignatureHeader, base64.RawURLEncoding.EncodeToString(sig))
+	return nil
+}
+
 func (a *Runner) performHeartbeat() {
 	hb, err := a.agent.Heartbeat()
 	if err != nil {
@@ -317,39 +387,214 @@ func (a *Runner) Shutdown() error {
 	return a.micro.Stop()
 }
 
+// GetNamespaceSecret resolves a secret from the configured secret store. If the
+// runner has no secret store, the secret is requested from the node instead
 func (a *Runner) GetNamespaceSecret(namespace, secretKey string) ([]byte, error) {
-	if a.secretStore == nil {
-		return nil, errors.New("secret store not configured")
+	if a.secretStore != nil {
+		return a.secretStore.GetSecret(namespace, secretKey)
+	}
+
+	return a.requestNamespaceSecret(namespace, secretKey)
+}
+
+// WatchSecrets delivers an update every time a secret changes until the context is
+// cancelled. Updates come from the configured secret store if it supports watching,
+// otherwise they are forwarded by the node
+func (a *Runner) WatchSecrets(ctx context.Context) (<-chan models.SecretUpdate, error) {
+	if a.secretStore != nil {
+		sw, ok := a.secretStore.(models.SecretWatcher)
+		if !ok {
+			return nil, errors.New("secret store does not support watching secrets")
+		}
+		return sw.WatchSecrets(ctx)
+	}
+
+	if a.nc == nil {
+		return nil, errors.New("secret store not configured and runner is not connected to a node")
 	}
 
-	return a.secretStore.GetSecret(namespace, secretKey)
+	msgs := make(chan *nats.Msg, 64)
+	sub, err := a.nc.ChanSubscribe(models.AgentAPISecretUpdatedSubject(a.nodeID, a.agentID), msgs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to secret updates: %w", err)
+	}
+
+	ret := make(chan models.SecretUpdate)
+	go func() {
+		defer close(ret)
+		defer func() {
+			err := sub.Unsubscribe()
+			if err != nil {
+				a.logger.Warn("failed to unsubscribe from secret updates", slog.String("err", err.Error()))
+			}
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case m := <-msgs:
+				update := models.SecretUpdate{}
+				err := json.Unmarshal(m.Data, &update)
+				if err != nil {
+					a.logger.Warn("failed to unmarshal secret update", slog.String("err", err.Error()))
+					continue
+				}
+
+				select {
+				case ret <- update:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ret, nil
 }
 
-func (a *Runner) RegisterTrigger(workloadID, namespace, triggerSubject string, workloadConnData *models.NatsConnectionData, tFunc func([]byte) ([]byte, error)) error {
-	tr := new(triggerResources)
+func (a *Runner) requestNamespaceSecret(namespace, secretKey string) ([]byte, error) {
+	if a.nc == nil {
+		return nil, errors.New("secret store not configured and runner is not connected to a node")
+	}
 
-	var err error
-	tr.nc, err = configureNatsConnection(*workloadConnData)
+	// The node encrypts the value for a one-time key so it is never sent in the clear
+	xkp, err := nkeys.CreateCurveKeys()
+	if err != nil {
+		return nil, err
+	}
+	xkpPub, err := xkp.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	reqB, err := json.Marshal(models.AgentSecretRequest{
+		Key:       secretKey,
+		Namespace: namespace,
+		Xkey:      xkpPub,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal secret request: %w", err)
+	}
+
+	msg, err := a.nc.Request(models.AgentAPISecretRequestSubject(a.nodeID, a.agentID), reqB, time.Second*5)
 	if err != nil {
-		return fmt.Errorf("failed to configure trigger NATS connection: %w", err)
+		return nil, fmt.Errorf("failed to request secret from node %s: %w", a.nodeID, err)
+	}
+
+	if msg.Header.Get(micro.ErrorHeader) != "" {
+		errMsg := struct {
+			Error string `json:"error"`
+		}{}
+		if json.Unmarshal(msg.Data, &errMsg) == nil && errMsg.Error != "" {
+			return nil, errors.New(errMsg.Error)
+		}
+		return nil, errors.New(msg.Header.Get(micro.ErrorHeader))
+	}
+
+	resp := new(models.AgentSecretResponse)
+	err = json.Unmarshal(msg.Data, resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret response: %w", err)
+	}
+
+	encValue, err := base64.StdEncoding.DecodeString(resp.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode secret value: %w", err)
+	}
+
+	return xkp.Open(encValue, resp.Xkey)
+}
+
+// UpdateOperation reports the progress of the operation starting a workload to
+// the node. Requests without an operation ID are not tracked and are ignored
+func (a *Runner) UpdateOperation(operationID string, state models.AgentOperationUpdateState) error {
+	if operationID == "" {
+		return nil
+	}
+
+	if a.nc == nil {
+		return errors.New("runner is not connected to a node")
+	}
+
+	updateB, err := json.Marshal(models.AgentOperationUpdate{
+		OperationId: operationID,
+		State:       state,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal operation update: %w", err)
+	}
+
+	msg, err := a.nc.Request(models.AgentAPIOperationRequestSubject(a.nodeID, a.agentID), updateB, time.Second*2)
+	if err != nil {
+		return fmt.Errorf("failed to send operation update to node %s: %w", a.nodeID, err)
+	}
+
+	if errMsg := msg.Header.Get(micro.ErrorHeader); errMsg != "" {
+		return errors.New(errMsg)
+	}
+
+	return nil
+}
+
+// RegisterTrigger subscribes the trigger function to the trigger subject with
+// the connection of the workload. A workload may register several subjects;
+// they share one connection and the invocation limits of the first
+// registration. With WithTriggerConsumer the subject is consumed from a durable
+// consumer of a stream instead. Each execution is reported in a
+// WorkloadTriggeredEvent with its exit status, which is taken from errors
+// implementing ExitCode() int, such as *exec.ExitError, and is 1 for other
+// errors
+func (a *Runner) RegisterTrigger(workloadID, namespace, triggerSubject string, workloadConnData *models.NatsConnectionData, tFunc func([]byte) ([]byte, error), opts ...TriggerOpt) error {
+	options := triggerOptions{maxInFlight: DefaultTriggerMaxInFlight}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	a.triggersMu.Lock()
+	defer a.triggersMu.Unlock()
+
+	tr, ok := a.triggers[workloadID]
+	if !ok {
+		tr = newTriggerResources(options)
+
+		var err error
+		tr.nc, err = configureNatsConnection(*workloadConnData)
+		if err != nil {
+			return fmt.Errorf("failed to configure trigger NATS connection: %w", err)
+		}
 	}
 
-	tr.sub, err = tr.nc.Subscribe(triggerSubject, func(m *nats.Msg) {
+	if options.consumer != nil {
+		err := a.consumeTrigger(tr, workloadID, namespace, triggerSubject, *options.consumer, tFunc)
+		if err != nil {
+			if !ok {
+				tr.nc.Close()
+			}
+			return fmt.Errorf("failed to consume trigger stream %s: %w", options.consumer.Stream, err)
+		}
+		a.triggers[workloadID] = tr
+		return nil
+	}
+
+	handler := func(m *nats.Msg) {
+		// blocks the subscription while all slots are taken, so messages queue
+		// up in the subscription instead of piling up in goroutines
+		wait := tr.acquire()
 		go func() {
-			startTime := time.Now()
-			ret, funcError := tFunc(m.Data)
-			if funcError != nil {
-				a.logger.Error("error running trigger function", slog.String("err", funcError.Error()))
+			inv := tr.invoke(tFunc, m.Data)
+			if inv.err != nil {
+				a.logger.Error("error running trigger function", slog.String("workload_id", workloadID), slog.String("err", inv.err.Error()))
 			}
 			if m.Reply != "" { // empty if original trigger was a publish and not request
 				nHeader := nats.Header{"workload_id": []string{workloadID}, "namespace": []string{namespace}}
-				if funcError != nil {
-					nHeader["error"] = []string{funcError.Error()}
+				if inv.err != nil {
+					nHeader["error"] = []string{inv.err.Error()}
 				}
 				msg := &nats.Msg{
 					Subject: m.Reply,
 					Header:  nHeader,
-					Data:    ret,
+					Data:    inv.ret,
 				}
 				pubErr := tr.nc.PublishMsg(msg)
 				if pubErr != nil {
@@ -357,20 +602,36 @@ func (a *Runner) RegisterTrigger(workloadID, namespace, triggerSubject string, w
 				}
 			}
 
-			runDuration := time.Since(startTime)
-			if err = a.EmitEvent(namespace, models.WorkloadTriggeredEvent{
-				Duration:  float64(runDuration.Milliseconds()),
-				Id:        workloadID,
-				Namespace: namespace,
-			}); err != nil {
-				a.logger.Error("error emitting workload triggered event", slog.String("err", err.Error()))
-			}
+			a.emitTriggered(workloadID, namespace, inv, wait)
 		}()
-	})
+	}
+
+	var sub *nats.Subscription
+	var err error
+	if options.queueGroup != "" {
+		sub, err = tr.nc.QueueSubscribe(triggerSubject, options.queueGroup, handler)
+	} else {
+		sub, err = tr.nc.Subscribe(triggerSubject, handler)
+	}
+	if err != nil {
+		if !ok {
+			tr.nc.Close()
+		}
+		return fmt.Errorf("failed to subscribe to trigger subject %s: %w", triggerSubject, err)
+	}
+
+	// the server must know the subscription before the workload is reported
+	// as started, or a trigger sent right after the start has no responders
+	err = tr.nc.Flush()
 	if err != nil {
+		_ = sub.Unsubscribe()
+		if !ok {
+			tr.nc.Close()
+		}
 		return fmt.Errorf("failed to subscribe to trigger subject %s: %w", triggerSubject, err)
 	}
 
+	tr.subs = append(tr.subs, sub)
 	a.triggers[workloadID] = tr
 	return nil
 }
@@ -379,18 +640,37 @@ func (a *Runner) RegisterTrigger(workloadID, namespace, triggerSubject string, w
 // If a workload is stopped via successful StopWorkloadRequest, the trigger will be unregistered automatically
 // If the workload fails to start inside a nexlet, use this function to clean up any unused triggers
 func (a *Runner) UnregisterTrigger(workloadID string) error {
+	a.triggersMu.Lock()
+	defer a.triggersMu.Unlock()
+
 	tr, ok := a.triggers[workloadID]
 	if !ok {
 		a.logger.Debug("attempted to unregister a non-existent trigger", slog.String("workload_id", workloadID))
 		return nil
 	}
 
-	err := tr.sub.Unsubscribe()
-	if err != nil {
-		a.logger.Error("failed to unsubscribe trigger", slog.String("workload_id", workloadID), slog.String("err", err.Error()))
+	for _, sub := range tr.subs {
+		err := sub.Unsubscribe()
+		if err != nil {
+			a.logger.Error("failed to unsubscribe trigger", slog.String("workload_id", workloadID), slog.String("err", err.Error()))
+		}
+	}
+	// the durable consumers are kept; unacknowledged messages are redelivered
+	// once the workload runs again. Draining is asynchronous, so wait until no
+	// further message reaches this workload
+	tr.stopping.Store(true)
+	for _, cc := range tr.consumers {
+		cc.Drain()
+	}
+	for _, cc := range tr.consumers {
+		select {
+		case <-cc.Closed():
+		case <-time.After(triggerConsumerTimeout):
+			a.logger.Warn("timed out stopping trigger consumer", slog.String("workload_id", workloadID))
+		}
 	}
 
-	err = tr.nc.Drain()
+	err := tr.nc.Drain()
 	if err != nil {
 		a.logger.Error("failed to drain trigger connection", slog.String("workload_id", workloadID), slog.String("err", err.Error()))
 	}
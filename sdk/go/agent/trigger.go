@@ -0,0 +1,352 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/synadia-io/nex/models"
+)
+
+const (
+	// DefaultTriggerMaxInFlight is the number of concurrent executions of a
+	// workload's triggers unless set with WithTriggerMaxInFlight
+	DefaultTriggerMaxInFlight = 100
+	// DefaultTriggerMaxDeliver is the number of deliveries of a stream trigger
+	// message before it is dead-lettered unless set in the TriggerConsumer
+	DefaultTriggerMaxDeliver = 5
+
+	// triggerConsumerTimeout bounds creating the durable consumer of a trigger
+	triggerConsumerTimeout = 10 * time.Second
+)
+
+// defaultTriggerBackoff are the delays before redelivering a failed stream
+// trigger message unless set in the TriggerConsumer
+var defaultTriggerBackoff = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second}
+
+// TriggerOpt configures a trigger registered with RegisterTrigger
+type TriggerOpt func(*triggerOptions)
+
+type triggerOptions struct {
+	queueGroup  string
+	maxInFlight int
+	timeout     time.Duration
+	consumer    *TriggerConsumer
+}
+
+// TriggerConsumer binds a trigger to a durable consumer of a JetStream stream,
+// so messages published while the workload is not running are not lost. The
+// replicas of a function bind to the same consumer and share its messages
+type TriggerConsumer struct {
+	Stream string
+	// Name of the durable consumer, which is created if it does not exist
+	Durable string
+	// Deliveries of a message before it is dead-lettered;
+	// DefaultTriggerMaxDeliver when zero
+	MaxDeliver int
+	// Delays before the redeliveries of a failed message, the last one repeats
+	Backoff []time.Duration
+	// Subject messages are published to when their last delivery failed; they
+	// are dropped when empty
+	DeadLetterSubject string
+}
+
+// WithTriggerQueueGroup subscribes the trigger in the queue group, so the
+// replicas of a function share the messages instead of each handling all of
+// them. Nexlets pass TriggerQueueGroup of the workload
+func WithTriggerQueueGroup(group string) TriggerOpt {
+	return func(o *triggerOptions) {
+		o.queueGroup = group
+	}
+}
+
+// TriggerQueueGroup returns the queue group shared by the replicas of a
+// function: its name qualified by its namespace, so functions with the same
+// name in other namespaces of the account do not take each other's messages
+func TriggerQueueGroup(namespace, name string) string {
+	return namespace + "." + name
+}
+
+// TriggerDurable returns the default durable consumer of a function's trigger
+// stream: its name qualified by its namespace, joined with an underscore since
+// consumer names cannot contain dots
+func TriggerDurable(namespace, name string) string {
+	return namespace + "_" + name
+}
+
+// WithTriggerMaxInFlight limits the concurrent executions of the workload's
+// triggers. Messages arriving while all executions are taken wait in the
+// subscription. Zero or less means no limit
+func WithTriggerMaxInFlight(n int) TriggerOpt {
+	return func(o *triggerOptions) {
+		o.maxInFlight = n
+	}
+}
+
+// WithTriggerTimeout sets the deadline of each execution. An execution past the
+// deadline is answered with an error and keeps its slot until the trigger
+// function returns. Trigger functions enforcing deadlines themselves report
+// them with errors wrapping context.DeadlineExceeded
+func WithTriggerTimeout(timeout time.Duration) TriggerOpt {
+	return func(o *triggerOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithTriggerConsumer consumes the trigger subject from a durable consumer of
+// the stream instead of subscribing to it. Messages are acknowledged once the
+// trigger function succeeds and redelivered with backoff when it fails
+func WithTriggerConsumer(consumer TriggerConsumer) TriggerOpt {
+	return func(o *triggerOptions) {
+		o.consumer = &consumer
+	}
+}
+
+type triggerResources struct {
+	nc        *nats.Conn
+	subs      []*nats.Subscription
+	consumers []jetstream.ConsumeContext
+
+	timeout time.Duration
+	// nil when the executions are not limited
+	slots chan struct{}
+
+	invocations atomic.Int64
+	failures    atomic.Int64
+	inFlight    atomic.Int64
+	// set once the trigger is unregistered; stream messages delivered after
+	// that are handed back to the stream
+	stopping atomic.Bool
+}
+
+// triggerInvocation is the outcome of one execution of a trigger function
+type triggerInvocation struct {
+	ret      []byte
+	err      error
+	timedOut bool
+	duration time.Duration
+
+	invocations int
+	failures    int
+	inFlight    int
+}
+
+func newTriggerResources(options triggerOptions) *triggerResources {
+	tr := &triggerResources{timeout: options.timeout}
+	if options.maxInFlight > 0 {
+		tr.slots = make(chan struct{}, options.maxInFlight)
+	}
+	return tr
+}
+
+// acquire waits for a free execution slot and returns how long it waited
+func (tr *triggerResources) acquire() time.Duration {
+	if tr.slots == nil {
+		return 0
+	}
+
+	start := time.Now()
+	tr.slots <- struct{}{}
+	return time.Since(start)
+}
+
+func (tr *triggerResources) release() {
+	if tr.slots != nil {
+		<-tr.slots
+	}
+}
+
+// invoke runs the trigger function in a slot taken by acquire and releases the
+// slot once the function returns, which may be after the deadline
+func (tr *triggerResources) invoke(tFunc func([]byte) ([]byte, error), payload []byte) triggerInvocation {
+	inv := triggerInvocation{invocations: int(tr.invocations.Add(1))}
+	tr.inFlight.Add(1)
+	start := time.Now()
+
+	type result struct {
+		ret []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ret, err := tFunc(payload)
+		tr.inFlight.Add(-1)
+		tr.release()
+		done <- result{ret: ret, err: err}
+	}()
+
+	var deadline <-chan time.Time
+	if tr.timeout > 0 {
+		timer := time.NewTimer(tr.timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	select {
+	case r := <-done:
+		inv.ret, inv.err = r.ret, r.err
+		inv.timedOut = errors.Is(r.err, context.DeadlineExceeded)
+	case <-deadline:
+		inv.err = fmt.Errorf("trigger timed out after %s: %w", tr.timeout, context.DeadlineExceeded)
+		inv.timedOut = true
+	}
+
+	inv.duration = time.Since(start)
+	if inv.err != nil {
+		inv.failures = int(tr.failures.Add(1))
+	} else {
+		inv.failures = int(tr.failures.Load())
+	}
+	inv.inFlight = int(tr.inFlight.Load())
+	return inv
+}
+
+// consumeTrigger creates or updates the durable consumer of the trigger and
+// runs the trigger function for its messages. The caller holds the triggers lock
+func (a *Runner) consumeTrigger(tr *triggerResources, workloadID, namespace, subject string, c TriggerConsumer, tFunc func([]byte) ([]byte, error)) error {
+	if c.Stream == "" || c.Durable == "" {
+		return errors.New("stream triggers require a stream and a durable consumer name")
+	}
+	if c.MaxDeliver <= 0 {
+		c.MaxDeliver = DefaultTriggerMaxDeliver
+	}
+	if len(c.Backoff) == 0 {
+		c.Backoff = defaultTriggerBackoff
+	}
+
+	js, err := jetstream.New(tr.nc)
+	if err != nil {
+		return err
+	}
+
+	cfg := jetstream.ConsumerConfig{
+		Durable:       c.Durable,
+		FilterSubject: subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		// the runner stops the redeliveries itself, so a message is never
+		// dropped by the server before it reached the dead-letter subject
+		MaxDeliver: -1,
+	}
+	if tr.timeout > 0 {
+		// a message is settled at the deadline at the latest
+		cfg.AckWait = 2 * tr.timeout
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, triggerConsumerTimeout)
+	defer cancel()
+	consumer, err := js.CreateOrUpdateConsumer(ctx, c.Stream, cfg)
+	if err != nil {
+		return err
+	}
+
+	var consumeOpts []jetstream.PullConsumeOpt
+	if tr.slots != nil {
+		consumeOpts = append(consumeOpts, jetstream.PullMaxMessages(cap(tr.slots)))
+	}
+
+	cc, err := consumer.Consume(func(m jetstream.Msg) {
+		if tr.stopping.Load() {
+			// redelivered right away to the next instance of the workload
+			_ = m.Nak()
+			return
+		}
+		wait := tr.acquire()
+		go func() {
+			inv := tr.invoke(tFunc, m.Data())
+			if inv.err != nil {
+				a.logger.Error("error running trigger function", slog.String("workload_id", workloadID), slog.String("err", inv.err.Error()))
+			}
+			a.settleTriggerMsg(tr, c, m, inv.err)
+			a.emitTriggered(workloadID, namespace, inv, wait)
+		}()
+	}, consumeOpts...)
+	if err != nil {
+		return err
+	}
+
+	tr.consumers = append(tr.consumers, cc)
+	return nil
+}
+
+// settleTriggerMsg acknowledges a message of a stream trigger whose execution
+// succeeded. A failed message is redelivered after the backoff or, after its
+// last delivery, sent to the dead-letter subject
+func (a *Runner) settleTriggerMsg(tr *triggerResources, c TriggerConsumer, m jetstream.Msg, funcErr error) {
+	if funcErr == nil {
+		if err := m.Ack(); err != nil {
+			a.logger.Error("failed to acknowledge trigger message", slog.String("err", err.Error()))
+		}
+		return
+	}
+
+	var delivered uint64 = 1
+	var sequence uint64
+	if meta, err := m.Metadata(); err == nil {
+		delivered = meta.NumDelivered
+		sequence = meta.Sequence.Stream
+	}
+
+	backoff := c.Backoff[min(int(delivered)-1, len(c.Backoff)-1)]
+	if delivered < uint64(c.MaxDeliver) {
+		if err := m.NakWithDelay(backoff); err != nil {
+			a.logger.Error("failed to reject trigger message", slog.String("err", err.Error()))
+		}
+		return
+	}
+
+	if c.DeadLetterSubject != "" {
+		dead := nats.NewMsg(c.DeadLetterSubject)
+		dead.Data = m.Data()
+		for k, v := range m.Headers() {
+			dead.Header[k] = v
+		}
+		dead.Header.Set(models.TriggerErrorHeader, funcErr.Error())
+		dead.Header.Set(models.TriggerStreamHeader, c.Stream)
+		dead.Header.Set(models.TriggerSubjectHeader, m.Subject())
+		dead.Header.Set(models.TriggerSequenceHeader, strconv.FormatUint(sequence, 10))
+		dead.Header.Set(models.TriggerDeliveriesHeader, strconv.FormatUint(delivered, 10))
+
+		if err := tr.nc.PublishMsg(dead); err != nil {
+			a.logger.Error("failed to dead-letter trigger message", slog.String("subject", c.DeadLetterSubject), slog.String("err", err.Error()))
+			_ = m.NakWithDelay(backoff)
+			return
+		}
+	}
+
+	if err := m.TermWithReason(funcErr.Error()); err != nil {
+		a.logger.Error("failed to terminate trigger message", slog.String("err", err.Error()))
+	}
+}
+
+// emitTriggered reports an execution of a trigger in a WorkloadTriggeredEvent
+func (a *Runner) emitTriggered(workloadID, namespace string, inv triggerInvocation, wait time.Duration) {
+	event := models.WorkloadTriggeredEvent{
+		Duration:     float64(inv.duration.Milliseconds()),
+		Failures:     inv.failures,
+		Id:           workloadID,
+		InFlight:     inv.inFlight,
+		Invocations:  inv.invocations,
+		Namespace:    namespace,
+		TimedOut:     inv.timedOut,
+		WaitDuration: float64(wait.Milliseconds()),
+	}
+	exitCode := 0
+	if inv.err != nil {
+		event.Error = inv.err.Error()
+		exitCode = 1
+		var exitErr interface{ ExitCode() int }
+		if errors.As(inv.err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+	event.ExitCode = &exitCode
+	if err := a.EmitEvent(namespace, event); err != nil {
+		a.logger.Error("error emitting workload triggered event", slog.String("err", err.Error()))
+	}
+}
@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/carlmjohnson/be"
+)
+
+func TestTriggerInvoke(t *testing.T) {
+	t.Run("counts", func(t *testing.T) {
+		tr := newTriggerResources(triggerOptions{maxInFlight: 1})
+
+		tr.acquire()
+		inv := tr.invoke(func(b []byte) ([]byte, error) { return b, nil }, []byte("hi"))
+		be.NilErr(t, inv.err)
+		be.Equal(t, "hi", string(inv.ret))
+		be.Equal(t, 1, inv.invocations)
+		be.Equal(t, 0, inv.failures)
+		be.Equal(t, 0, inv.inFlight)
+
+		tr.acquire()
+		inv = tr.invoke(func([]byte) ([]byte, error) { return nil, errors.New("boom") }, nil)
+		be.Nonzero(t, inv.err)
+		be.False(t, inv.timedOut)
+		be.Equal(t, 2, inv.invocations)
+		be.Equal(t, 1, inv.failures)
+	})
+
+	t.Run("max in flight", func(t *testing.T) {
+		tr := newTriggerResources(triggerOptions{maxInFlight: 2})
+		unblock := make(chan struct{})
+		blocked := func([]byte) ([]byte, error) {
+			<-unblock
+			return nil, nil
+		}
+
+		var wg sync.WaitGroup
+		for range 2 {
+			tr.acquire()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				tr.invoke(blocked, nil)
+			}()
+		}
+
+		acquired := make(chan time.Duration)
+		go func() {
+			acquired <- tr.acquire()
+		}()
+
+		select {
+		case <-acquired:
+			t.Fatal("acquired a slot while all slots were taken")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(unblock)
+		be.True(t, <-acquired >= 50*time.Millisecond)
+		wg.Wait()
+		tr.release()
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		tr := newTriggerResources(triggerOptions{maxInFlight: 1, timeout: 20 * time.Millisecond})
+		unblock := make(chan struct{})
+
+		tr.acquire()
+		inv := tr.invoke(func([]byte) ([]byte, error) {
+			<-unblock
+			return nil, nil
+		}, nil)
+		be.True(t, inv.timedOut)
+		be.True(t, errors.Is(inv.err, context.DeadlineExceeded))
+		be.Equal(t, 1, inv.failures)
+		be.Equal(t, 1, inv.inFlight)
+
+		// the slot is held until the function returns
+		be.Equal(t, 1, len(tr.slots))
+		close(unblock)
+		tr.acquire()
+		tr.release()
+	})
+
+	t.Run("function deadline", func(t *testing.T) {
+		tr := newTriggerResources(triggerOptions{})
+		inv := tr.invoke(func([]byte) ([]byte, error) { return nil, context.DeadlineExceeded }, nil)
+		be.True(t, inv.timedOut)
+	})
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/nex/models"
+)
+
+// WorkloadNatsFromEnv connects a workload to NATS with the credentials provided by
+// its nexlet. When the nexlet provides a renewal subject, the JWT is renewed before
+// it expires. A renewed JWT only takes effect when the connection reconnects: the
+// server closes the connection once the old JWT expires and the default reconnect
+// options connect again with the renewed one, so do not pass nats.NoReconnect
+func WorkloadNatsFromEnv(opts ...nats.Option) (*nats.Conn, error) {
+	natsServers, ok := os.LookupEnv("NEX_WORKLOAD_NATS_SERVERS")
+	if !ok {
+		return nil, errors.New("NEX_WORKLOAD_NATS_SERVERS is required")
+	}
+
+	seed := os.Getenv("NEX_WORKLOAD_NATS_NKEY")
+	b64Jwt := os.Getenv("NEX_WORKLOAD_NATS_B64_JWT")
+	if seed == "" || b64Jwt == "" {
+		return nats.Connect(natsServers, opts...)
+	}
+
+	userJwt, err := base64.StdEncoding.DecodeString(b64Jwt)
+	if err != nil {
+		return nil, err
+	}
+
+	kp, err := nkeys.FromSeed([]byte(seed))
+	if err != nil {
+		return nil, err
+	}
+
+	creds := &workloadCreds{jwt: string(userJwt), kp: kp}
+	opts = append(opts, nats.UserJWT(creds.get, func(nonce []byte) ([]byte, error) {
+		return kp.Sign(nonce)
+	}))
+
+	nc, err := nats.Connect(natsServers, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if renewSubject, ok := os.LookupEnv("NEX_WORKLOAD_NATS_RENEW_SUBJECT"); ok && renewSubject != "" {
+		go creds.renew(nc, renewSubject)
+	}
+
+	return nc, nil
+}
+
+type workloadCreds struct {
+	sync.Mutex
+	jwt string
+	kp  nkeys.KeyPair
+}
+
+func (c *workloadCreds) get() (string, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.jwt, nil
+}
+
+// renew requests a new JWT once 3/4 of the current one's lifetime has passed
+func (c *workloadCreds) renew(nc *nats.Conn, subject string) {
+	for !nc.IsClosed() {
+		userJwt, _ := c.get()
+		claims, err := jwt.DecodeUserClaims(userJwt)
+		if err != nil || claims.Expires == 0 {
+			return
+		}
+
+		issuedAt := time.Unix(claims.IssuedAt, 0)
+		renewAt := issuedAt.Add(time.Unix(claims.Expires, 0).Sub(issuedAt) * 3 / 4)
+		if wait := time.Until(renewAt); wait > 0 {
+			// wake up at least every minute so the loop ends with the connection
+			time.Sleep(min(wait, time.Minute))
+			continue
+		}
+
+		connData, err := requestRenewal(nc, c.kp, subject, userJwt)
+		if err != nil {
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		c.Lock()
+		c.jwt = connData.NatsUserJwt
+		c.Unlock()
+	}
+}
+
+// requestRenewal sends the current JWT to the node that issued it. The request
+// is signed with the workload user nkey to prove it holds the JWT
+func requestRenewal(nc *nats.Conn, kp nkeys.KeyPair, subject, userJwt string) (*models.NatsConnectionData, error) {
+	caller, err := kp.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	req := nats.NewMsg(subject)
+	req.Data = []byte(userJwt)
+	nonce := models.NewControlNonce()
+	sig, err := kp.Sign(models.ControlSigningInput(subject, nonce, req.Header, req.Data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(models.ControlCallerHeader, caller)
+	req.Header.Set(models.ControlNonceHeader, nonce)
+	req.Header.Set(models.ControlSignatureHeader, base64.RawURLEncoding.EncodeToString(sig))
+
+	msg, err := nc.RequestMsg(req, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Header.Get(micro.ErrorHeader) != "" {
+		return nil, errors.New(msg.Header.Get(micro.ErrorHeader))
+	}
+
+	connData := new(models.NatsConnectionData)
+	err = json.Unmarshal(msg.Data, connData)
+	if err != nil {
+		return nil, err
+	}
+	if connData.NatsUserJwt == "" {
+		return nil, errors.New("renewal response did not include a jwt")
+	}
+
+	return connData, nil
+}
@@ -0,0 +1,85 @@
+package nex
+
+import (
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/synadia-io/nex/models"
+)
+
+const (
+	// secretAccessPruneInterval is how often workloads that exited on their
+	// own lose access to the secrets of their namespace
+	secretAccessPruneInterval = 15 * time.Second
+	// secretAccessStartGrace keeps the access of a workload its agent may not
+	// list yet because it is still being started
+	secretAccessStartGrace = time.Minute
+)
+
+// watchSecrets forwards secret store updates to the agents of this node running
+// workloads in the namespace of the secret so they can rotate the secrets of
+// those workloads
+func (n *NexNode) watchSecrets(sw models.SecretWatcher) {
+	updates, err := sw.WatchSecrets(n.ctx)
+	if err != nil {
+		n.logger.Error("failed to watch secret store", slog.String("err", err.Error()))
+		return
+	}
+
+	for update := range updates {
+		updateB, err := json.Marshal(update)
+		if err != nil {
+			n.logger.Error("failed to marshal secret update", slog.String("err", err.Error()))
+			continue
+		}
+
+		// only agents running workloads in the namespace learn about its secrets
+		n.logger.Debug("secret updated", slog.String("namespace", update.Namespace), slog.String("key", update.Key), slog.Bool("deleted", update.Deleted))
+		for _, agentID := range n.registeredAgents.AgentsInNamespace(update.Namespace) {
+			err = n.nc.Publish(models.AgentAPISecretUpdatedSubject(n.id, agentID), updateB)
+			if err != nil {
+				n.logger.Error("failed to publish secret update", slog.String("err", err.Error()), slog.String("agent_id", agentID))
+			}
+		}
+	}
+}
+
+// watchSecretAccess removes the workloads that are no longer running from the
+// agents of this node until the node shuts down. Stopped workloads are removed
+// right away; this catches workloads that exit on their own
+func (n *NexNode) watchSecretAccess() {
+	ticker := time.NewTicker(secretAccessPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-ticker.C:
+			n.pruneSecretAccess(time.Now().Add(-secretAccessStartGrace))
+		}
+	}
+}
+
+// pruneSecretAccess removes the workloads added before the given time that no
+// agent reports as running. A namespace is skipped if an agent does not answer
+func (n *NexNode) pruneSecretAccess(before time.Time) {
+	for _, ns := range n.registeredAgents.WorkloadNamespaces() {
+		workloads, err := n.namespaceWorkloads(ns)
+		if err != nil {
+			n.logger.Debug("failed to list workloads for secret access", slog.String("err", err.Error()), slog.String("namespace", ns))
+			continue
+		}
+
+		live := []string{}
+		for _, w := range workloads {
+			if w.WorkloadState != models.WorkloadStateStopped && w.WorkloadState != models.WorkloadStateError {
+				live = append(live, w.Id)
+			}
+		}
+		for _, id := range n.registeredAgents.PruneWorkloads(ns, live, before) {
+			n.logger.Debug("workload no longer running; removed its secret access", slog.String("namespace", ns), slog.String("workload_id", id))
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package nex
+
+import (
+	"errors"
+	"log/slog"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/synadia-io/nex/models"
+)
+
+const defaultTagRefreshInterval = 30 * time.Second
+
+// tagSource is a tag provider and the tags of its last successful refresh
+type tagSource struct {
+	provider models.TagProvider
+	// reserved lets the provider set tags with a reserved prefix; only the
+	// providers built into the node are trusted with them
+	reserved bool
+	tags     map[string]string
+}
+
+// nodeTags returns the current tags of the node. Tags set on the node win over
+// provided tags with the same key
+func (n *NexNode) nodeTags() map[string]string {
+	n.tagsMu.RLock()
+	defer n.tagsMu.RUnlock()
+
+	ret := make(map[string]string, len(n.tags))
+	for _, src := range n.tagSources {
+		maps.Copy(ret, src.tags)
+	}
+	maps.Copy(ret, n.tags)
+	return ret
+}
+
+func (n *NexNode) setTag(key, value string) {
+	n.tagsMu.Lock()
+	defer n.tagsMu.Unlock()
+	n.tags[key] = value
+}
+
+// UpdateTags sets and removes tags on the running node and returns the
+// resulting node tags. Reserved tags can not be changed. Running workloads are
+// left alone; only new placement decisions see the change
+func (n *NexNode) UpdateTags(set map[string]string, remove []string) (map[string]string, error) {
+	for k := range set {
+		if prefix := reservedTagPrefix(k); prefix != "" {
+			return nil, errors.New("can not use reserved tag prefix: " + prefix)
+		}
+	}
+	for _, k := range remove {
+		if prefix := reservedTagPrefix(k); prefix != "" {
+			return nil, errors.New("can not use reserved tag prefix: " + prefix)
+		}
+	}
+
+	n.tagsMu.Lock()
+	for _, k := range remove {
+		delete(n.tags, k)
+	}
+	maps.Copy(n.tags, set)
+	n.tagsMu.Unlock()
+
+	return n.tagsUpdated(), nil
+}
+
+// ReplaceTags replaces every non-reserved tag of the running node, e.g. with
+// the tags of a reloaded config file, and returns the resulting node tags
+func (n *NexNode) ReplaceTags(tags map[string]string) (map[string]string, error) {
+	for k := range tags {
+		if prefix := reservedTagPrefix(k); prefix != "" {
+			return nil, errors.New("can not use reserved tag prefix: " + prefix)
+		}
+	}
+
+	n.tagsMu.Lock()
+	maps.DeleteFunc(n.tags, func(k, _ string) bool {
+		return reservedTagPrefix(k) == ""
+	})
+	maps.Copy(n.tags, tags)
+	n.tagsMu.Unlock()
+
+	return n.tagsUpdated(), nil
+}
+
+// tagsUpdated announces the current node tags after they were changed
+func (n *NexNode) tagsUpdated() map[string]string {
+	tags := n.nodeTags()
+	n.logger.Info("node tags updated", slog.Any("tags", tags))
+
+	err := n.eventEmitter.EmitEvent(n.id, models.NexNodeTagsUpdatedEvent{
+		Id:   n.id,
+		Tags: tags,
+	})
+	if err != nil {
+		n.logger.Warn("failed to emit tags updated event", slog.String("err", err.Error()))
+	}
+	return tags
+}
+
+// reservedTagPrefix returns the reserved prefix the key starts with, if any
+func reservedTagPrefix(key string) string {
+	for _, prefix := range models.ReservedTagPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// watchTags refreshes the provided tags until the node shuts down
+func (n *NexNode) watchTags() {
+	ticker := time.NewTicker(n.tagRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-ticker.C:
+			n.refreshTags()
+		}
+	}
+}
+
+func (n *NexNode) refreshTags() {
+	for _, src := range n.tagSources {
+		tags, err := src.provider.Tags(n.ctx)
+		if err != nil {
+			n.logger.Warn("failed to refresh node tags", slog.String("err", err.Error()))
+			continue
+		}
+
+		if !src.reserved {
+			maps.DeleteFunc(tags, func(k, _ string) bool {
+				if reservedTagPrefix(k) != "" {
+					n.logger.Warn("tag provider can not set reserved tag", slog.String("tag", k))
+					return true
+				}
+				return false
+			})
+		}
+
+		n.tagsMu.Lock()
+		src.tags = tags
+		n.tagsMu.Unlock()
+	}
+}